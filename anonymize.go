@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+// exportPrivacy controls how much identifying detail CSV and text exports
+// keep, for sharing them in bug reports or research. The zero value
+// exports everything as is.
+type exportPrivacy struct {
+	anonymize    bool // replace handles and contact names with "Contact A", "Contact B", ...
+	redactBodies bool // replace message text with its length and drop attachment filenames
+}
+
+// enabled reports whether anything is anonymized or redacted. Exports that
+// can't do either refuse to run while it's true.
+func (p exportPrivacy) enabled() bool {
+	return p.anonymize || p.redactBodies
+}
+
+// apply rewrites what an exporter is about to write. Pseudonyms are
+// assigned to participants in order, then to any other senders as they
+// appear, so one export maps each person to the same name throughout. The
+// returned contact book is empty when anonymizing, so names resolve to the
+// pseudonyms, and the title becomes generic so the filename doesn't leak it.
+func (p exportPrivacy) apply(messages []chatdb.Message, participants []string, contacts *chatdb.ContactBook, title string) ([]chatdb.Message, []string, *chatdb.ContactBook, string) {
+	if !p.enabled() {
+		return messages, participants, contacts, title
+	}
+
+	pseudonym := newPseudonyms("Contact ").name
+
+	if p.anonymize {
+		anonParticipants := make([]string, len(participants))
+		for i, h := range participants {
+			anonParticipants[i] = pseudonym(h)
+		}
+		participants = anonParticipants
+		contacts = &chatdb.ContactBook{}
+		title = "anonymized"
+	}
+
+	out := make([]chatdb.Message, len(messages))
+	for i, msg := range messages {
+		if p.anonymize {
+			msg.Sender = pseudonym(msg.Sender)
+			msg.SenderDisplay = ""
+		}
+		if p.redactBodies {
+			msg.Text = redactText(msg.Text)
+			attachments := make([]chatdb.AttachmentInfo, len(msg.Attachments))
+			for j, a := range msg.Attachments {
+				a.Filename = ""
+				attachments[j] = a
+			}
+			msg.Attachments = attachments
+		}
+		out[i] = msg
+	}
+	return out, participants, contacts, title
+}
+
+// pseudonyms hands out names like "Contact A", "Contact B", ... in the
+// order keys first come up, giving a key the same name every time.
+type pseudonyms struct {
+	prefix string
+	names  map[string]string
+}
+
+func newPseudonyms(prefix string) *pseudonyms {
+	return &pseudonyms{prefix: prefix, names: map[string]string{}}
+}
+
+// name returns key's pseudonym, case-insensitively, or "" for an empty key.
+func (p *pseudonyms) name(key string) string {
+	if key == "" {
+		return ""
+	}
+	key = strings.ToLower(key)
+	if name, ok := p.names[key]; ok {
+		return name
+	}
+	name := p.prefix + pseudonymLetters(len(p.names))
+	p.names[key] = name
+	return name
+}
+
+// redactText replaces message text with its length, leaving empty text
+// empty.
+func redactText(text string) string {
+	if text == "" {
+		return ""
+	}
+	return fmt.Sprintf("[%d chars]", utf8.RuneCountInString(text))
+}
+
+// pseudonymLetters numbers pseudonyms like spreadsheet columns: A–Z, then
+// AA, AB, and so on.
+func pseudonymLetters(n int) string {
+	var letters []byte
+	for n >= 0 {
+		letters = append([]byte{byte('A' + n%26)}, letters...)
+		n = n/26 - 1
+	}
+	return string(letters)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isCompressedDatabase reports whether path names a gzip or zip file that
+// openCompressedDatabase can unpack.
+func isCompressedDatabase(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".gz" || ext == ".zip"
+}
+
+// openCompressedDatabase unpacks a gzipped chat.db, or the chat.db inside a
+// zip archive (with its -wal and -shm files, if present), into a temporary
+// directory. It returns the unpacked database path and a cleanup function
+// that removes the directory.
+func openCompressedDatabase(path string) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "smsDbViewer-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	dbPath := filepath.Join(dir, "chat.db")
+
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		err = unzipDatabase(path, dir)
+	} else {
+		err = gunzipFile(path, dbPath)
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dbPath, cleanup, nil
+}
+
+func gunzipFile(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", src, err)
+	}
+	defer zr.Close()
+
+	return writeFile(dst, zr)
+}
+
+// unzipDatabase extracts chat.db and its WAL companions from the zip at src
+// into dir. The archive may keep them in a subdirectory.
+func unzipDatabase(src, dir string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	found := false
+	for _, f := range zr.File {
+		name := filepath.Base(f.Name)
+		if name != "chat.db" && name != "chat.db-wal" && name != "chat.db-shm" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(filepath.Join(dir, name), rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if name == "chat.db" {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s: no chat.db inside the archive", src)
+	}
+	return nil
+}
+
+func writeFile(dst string, r io.Reader) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
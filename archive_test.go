@@ -0,0 +1,96 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenCompressedDatabase(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("SQLite format 3\x00 pretend database")
+
+	t.Run("gzip", func(t *testing.T) {
+		src := filepath.Join(dir, "chat.db.gz")
+		f, _ := os.Create(src)
+		zw := gzip.NewWriter(f)
+		zw.Write(content)
+		zw.Close()
+		f.Close()
+
+		dbPath, cleanup, err := openCompressedDatabase(src)
+		if err != nil {
+			t.Fatalf("openCompressedDatabase: %v", err)
+		}
+		got, _ := os.ReadFile(dbPath)
+		if string(got) != string(content) {
+			t.Errorf("unpacked content: got %q", got)
+		}
+		cleanup()
+		if _, err := os.Stat(dbPath); !os.IsNotExist(err) {
+			t.Errorf("cleanup should remove the unpacked file, stat: %v", err)
+		}
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		src := filepath.Join(dir, "backup.zip")
+		f, _ := os.Create(src)
+		zw := zip.NewWriter(f)
+		for name, data := range map[string]string{
+			"Messages/chat.db":     string(content),
+			"Messages/chat.db-wal": "wal",
+			"Messages/notes.txt":   "ignored",
+		} {
+			w, _ := zw.Create(name)
+			w.Write([]byte(data))
+		}
+		zw.Close()
+		f.Close()
+
+		dbPath, cleanup, err := openCompressedDatabase(src)
+		if err != nil {
+			t.Fatalf("openCompressedDatabase: %v", err)
+		}
+		defer cleanup()
+		got, _ := os.ReadFile(dbPath)
+		if string(got) != string(content) {
+			t.Errorf("unpacked content: got %q", got)
+		}
+		if _, err := os.Stat(dbPath + "-wal"); err != nil {
+			t.Errorf("WAL file should be unpacked next to the database: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(dbPath), "notes.txt")); !os.IsNotExist(err) {
+			t.Error("unrelated archive entries should be skipped")
+		}
+	})
+
+	t.Run("zip_without_chat_db", func(t *testing.T) {
+		src := filepath.Join(dir, "empty.zip")
+		f, _ := os.Create(src)
+		zw := zip.NewWriter(f)
+		w, _ := zw.Create("readme.txt")
+		w.Write([]byte("nothing here"))
+		zw.Close()
+		f.Close()
+
+		if _, _, err := openCompressedDatabase(src); err == nil || !strings.Contains(err.Error(), "no chat.db") {
+			t.Errorf("expected a missing chat.db error, got %v", err)
+		}
+	})
+}
+
+func TestIsCompressedDatabase(t *testing.T) {
+	for path, want := range map[string]bool{
+		"chat.db":        false,
+		"chat.db.gz":     true,
+		"Backup.ZIP":     true,
+		"~/dumps/db.zip": true,
+	} {
+		if got := isCompressedDatabase(path); got != want {
+			t.Errorf("isCompressedDatabase(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package chatdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf8"
+)
+
+// decodeAttributedBody extracts the plain text from message.attributedBody,
+// an NSAttributedString archived in Apple's typedstream format. Recent macOS
+// versions often leave message.text NULL and store the content only here.
+//
+// Only enough of the format is parsed to find the string: after the
+// NSString class name comes a '+' type tag, then the UTF-8 length (one byte,
+// or 0x81 followed by a little-endian uint16, or 0x82 followed by a uint32),
+// then the bytes themselves. Returns "" if the blob doesn't look like that.
+func decodeAttributedBody(blob []byte) string {
+	i := bytes.Index(blob, []byte("NSString"))
+	if i < 0 {
+		return ""
+	}
+	rest := blob[i+len("NSString"):]
+	j := bytes.IndexByte(rest, '+')
+	if j < 0 {
+		return ""
+	}
+	rest = rest[j+1:]
+	if len(rest) == 0 {
+		return ""
+	}
+
+	var n int
+	switch rest[0] {
+	case 0x81:
+		if len(rest) < 3 {
+			return ""
+		}
+		n = int(binary.LittleEndian.Uint16(rest[1:3]))
+		rest = rest[3:]
+	case 0x82:
+		if len(rest) < 5 {
+			return ""
+		}
+		n = int(binary.LittleEndian.Uint32(rest[1:5]))
+		rest = rest[5:]
+	default:
+		n = int(rest[0])
+		rest = rest[1:]
+	}
+	if n > len(rest) || !utf8.Valid(rest[:n]) {
+		return ""
+	}
+	return string(rest[:n])
+}
@@ -0,0 +1,44 @@
+package chatdb
+
+import (
+	"strings"
+	"testing"
+)
+
+// typedstreamBody builds an attributedBody blob shaped like the ones in
+// chat.db, with text encoded after the NSString '+' tag.
+func typedstreamBody(text string) []byte {
+	blob := []byte("\x04\x0bstreamtyped\x81\xe8\x03\x84\x01@\x84\x84\x84\x12NSAttributedString\x00" +
+		"\x84\x84\x08NSObject\x00\x85\x92\x84\x84\x84\x08NSString\x01\x94\x84\x01+")
+	if n := len(text); n < 0x80 {
+		blob = append(blob, byte(n))
+	} else {
+		blob = append(blob, 0x81, byte(n), byte(n>>8))
+	}
+	blob = append(blob, text...)
+	return append(blob, []byte("\x86\x84\x02iI\x01\x05\x92\x84\x84\x84\x0cNSDictionary\x00")...)
+}
+
+func TestDecodeAttributedBody(t *testing.T) {
+	long := strings.Repeat("long message ", 30)
+	hello := typedstreamBody("hello")
+	truncated := hello[:strings.Index(string(hello), "hello")+2]
+	tests := []struct {
+		name string
+		blob []byte
+		want string
+	}{
+		{"short", typedstreamBody("Running late 🏃"), "Running late 🏃"},
+		{"two_byte_length", typedstreamBody(long), long},
+		{"empty_blob", nil, ""},
+		{"not_typedstream", []byte("garbage"), ""},
+		{"truncated", truncated, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeAttributedBody(tt.blob); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package chatdb
+
+import "strings"
+
+// balloonLabels names the iMessage apps behind message.balloon_bundle_id.
+// App extensions are stored as
+// "com.apple.messages.MSMessageExtensionBalloonPlugin:<team id>:<bundle id>",
+// so they're looked up by the last part.
+var balloonLabels = map[string]string{
+	"com.apple.messages.URLBalloonProvider":                    "Link",
+	"com.apple.PassbookUIService.PeerPaymentMessagesExtension": "Apple Pay",
+	"com.apple.DigitalTouchBalloonProvider":                    "Digital Touch",
+	"com.apple.Handwriting.HandwritingProvider":                "Handwriting",
+	"com.apple.Stickers.UserGenerated.MessagesExtension":       "Sticker",
+	"com.apple.mobileslideshow.PhotosMessagesApp":              "Photos",
+	"com.apple.findmy.FindMyMessagesApp":                       "Location",
+	"com.apple.SafetyMonitorApp.SafetyMonitorMessages":         "Check In",
+	"com.apple.messages.Polls":                                 "Poll",
+	"com.apple.icloud.apps.messages.business.extension":        "Business Chat",
+	"com.apple.Jellyfish.JellyfishMessagesExtension":           "Animoji",
+}
+
+// balloonLabel returns the placeholder name for a message sent through an
+// iMessage app, "App" for apps not in balloonLabels, or "" when bundleID
+// is empty.
+func balloonLabel(bundleID string) string {
+	if bundleID == "" {
+		return ""
+	}
+	if i := strings.LastIndexByte(bundleID, ':'); i >= 0 {
+		bundleID = bundleID[i+1:]
+	}
+	if label, ok := balloonLabels[bundleID]; ok {
+		return label
+	}
+	return "App"
+}
+
+// Placeholder is what to show for a message with no text: the iMessage app
+// it came through, like "[Apple Pay]", or "[attachment]".
+func (msg Message) Placeholder() string {
+	if msg.BalloonType != "" {
+		return "[" + msg.BalloonType + "]"
+	}
+	return "[attachment]"
+}
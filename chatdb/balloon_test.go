@@ -0,0 +1,54 @@
+package chatdb
+
+import (
+	"testing"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb/chatdbtest"
+)
+
+func TestBalloonLabel(t *testing.T) {
+	tests := []struct {
+		bundleID string
+		want     string
+	}{
+		{"", ""},
+		{"com.apple.messages.URLBalloonProvider", "Link"},
+		{"com.apple.messages.MSMessageExtensionBalloonPlugin:0000000000:com.apple.PassbookUIService.PeerPaymentMessagesExtension", "Apple Pay"},
+		{"com.apple.messages.MSMessageExtensionBalloonPlugin:EWFNLB79LQ:com.example.SomeGame.MessagesExtension", "App"},
+	}
+	for _, tt := range tests {
+		if got := balloonLabel(tt.bundleID); got != tt.want {
+			t.Errorf("balloonLabel(%q) = %q, want %q", tt.bundleID, got, tt.want)
+		}
+	}
+}
+
+func TestFetchMessagesBalloonType(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	if _, err := db.Exec(`ALTER TABLE message ADD COLUMN balloon_bundle_id TEXT`); err != nil {
+		t.Fatal(err)
+	}
+	res, err := db.Exec(`INSERT INTO message (guid, text, handle_id, service, date, is_from_me, balloon_bundle_id)
+		VALUES ('msg-pay', NULL, 3, 'iMessage', ?, 0,
+		'com.apple.messages.MSMessageExtensionBalloonPlugin:0000000000:com.apple.PassbookUIService.PeerPaymentMessagesExtension')`,
+		chatdbtest.BaseAppleNanos+int64(100)*60_000_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	db.Exec(`INSERT INTO chat_message_join (chat_id, message_id, message_date) VALUES (2, ?, 0)`, id)
+
+	store := NewStore(db)
+	msgs, err := store.FetchMessages(t.Context(), 2, MessageCursor{}, 0)
+	if err != nil {
+		t.Fatalf("FetchMessages: %v", err)
+	}
+	pay := msgs[len(msgs)-1]
+	if pay.BalloonType != "Apple Pay" || pay.Placeholder() != "[Apple Pay]" {
+		t.Errorf("balloon message: type %q, placeholder %q", pay.BalloonType, pay.Placeholder())
+	}
+	if msgs[0].BalloonType != "" || msgs[0].Placeholder() != "[attachment]" {
+		t.Errorf("plain message: type %q, placeholder %q", msgs[0].BalloonType, msgs[0].Placeholder())
+	}
+}
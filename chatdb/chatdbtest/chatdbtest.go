@@ -1,4 +1,6 @@
-package main
+// Package chatdbtest provides a seeded in-memory chat.db for tests of code
+// built on package chatdb.
+package chatdbtest
 
 import (
 	"database/sql"
@@ -8,9 +10,9 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-// newTestDB creates an in-memory SQLite database with the iMessage schema
+// NewDB creates an in-memory SQLite database with the iMessage schema
 // and populates it with test conversations, handles, and messages.
-func newTestDB(t *testing.T) *sql.DB {
+func NewDB(t testing.TB) *sql.DB {
 	t.Helper()
 	db, err := sql.Open("sqlite", ":memory:")
 	if err != nil {
@@ -81,11 +83,12 @@ func newTestDB(t *testing.T) *sql.DB {
 	return db
 }
 
-// Apple epoch: nanoseconds since 2001-01-01.
+// BaseAppleNanos is the date of the first seeded message, in Apple epoch
+// nanoseconds (since 2001-01-01).
 // Base timestamp: 2024-06-15 10:00:00 UTC = 740,142,000 seconds from Apple epoch.
-const baseAppleNanos = 740_142_000_000_000_000
+const BaseAppleNanos = 740_142_000_000_000_000
 
-func seedTestData(t *testing.T, db *sql.DB) {
+func seedTestData(t testing.TB, db *sql.DB) {
 	t.Helper()
 
 	// --- Handles ---
@@ -139,7 +142,7 @@ func seedTestData(t *testing.T, db *sql.DB) {
 		{"No worries, I just got here", 0, 1},
 	}
 	for i, m := range chat1Msgs {
-		dateNanos := baseAppleNanos + int64(i)*60_000_000_000 // 1 minute apart
+		dateNanos := BaseAppleNanos + int64(i)*60_000_000_000 // 1 minute apart
 		guid := fmt.Sprintf("msg-c1-%d", i)
 		db.Exec(`INSERT INTO message (guid, text, handle_id, service, date, is_from_me)
 			VALUES (?, ?, ?, 'iMessage', ?, ?)`, guid, m.text, m.handleID, dateNanos, m.fromMe)
@@ -160,7 +163,7 @@ func seedTestData(t *testing.T, db *sql.DB) {
 	}
 	msgID := len(chat1Msgs) + 1
 	for i, m := range chat2Msgs {
-		dateNanos := baseAppleNanos + int64(i+20)*60_000_000_000 // offset from chat1
+		dateNanos := BaseAppleNanos + int64(i+20)*60_000_000_000 // offset from chat1
 		guid := fmt.Sprintf("msg-c2-%d", i)
 		handleID := 3
 		if m.fromMe == 1 {
@@ -189,7 +192,7 @@ func seedTestData(t *testing.T, db *sql.DB) {
 		{"See you all tonight!", 0, 1},
 	}
 	for i, m := range chat3Msgs {
-		dateNanos := baseAppleNanos + int64(i+40)*60_000_000_000
+		dateNanos := BaseAppleNanos + int64(i+40)*60_000_000_000
 		guid := fmt.Sprintf("msg-c3-%d", i)
 		db.Exec(`INSERT INTO message (guid, text, handle_id, service, date, is_from_me)
 			VALUES (?, ?, ?, 'iMessage', ?, ?)`, guid, m.text, m.handleID, dateNanos, m.fromMe)
@@ -0,0 +1,371 @@
+package chatdb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Contact holds a resolved contact's display name and identifiers.
+type Contact struct {
+	Name   string   // "First Last"
+	Phones []string // raw phone numbers from AddressBook
+	Emails []string // email addresses
+}
+
+// ContactBook maps handle identifiers (phone/email) to contact info.
+type ContactBook struct {
+	byDigits map[string]*Contact // normalized digits → contact
+	byEmail  map[string]*Contact // lowercase email → contact
+	loadErr  error               // first failure reading an AddressBook database
+
+	// resolved memoizes Resolve by raw handle (nil for unknown ones), since
+	// the message view resolves every sender on every render. Anything that
+	// changes the book clears it.
+	resolved sync.Map
+}
+
+// NewContactBook loads contacts from all AddressBook databases found on the system.
+// Returns an empty book (not an error) if contacts can't be read — the app
+// should still work, just without names. Err tells the two apart.
+func NewContactBook() *ContactBook {
+	cb := &ContactBook{
+		byDigits: make(map[string]*Contact),
+		byEmail:  make(map[string]*Contact),
+	}
+
+	abDir := filepath.Join(os.Getenv("HOME"), "Library", "Application Support", "AddressBook")
+
+	var permErr, firstErr error
+	note := func(err error) {
+		if permErr == nil && errors.Is(err, fs.ErrPermission) {
+			permErr = err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// Find all .abcddb files (main + per-source)
+	var dbPaths []string
+	filepath.Walk(abDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// No AddressBook directory just means no contacts
+			if !os.IsNotExist(err) {
+				note(err)
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".abcddb") {
+			dbPaths = append(dbPaths, path)
+		}
+		return nil
+	})
+
+	loaded := false
+	for _, p := range dbPaths {
+		if err := cb.loadFromDB(p); err != nil {
+			note(fmt.Errorf("reading %s: %w", p, err))
+		} else {
+			loaded = true
+		}
+	}
+
+	// One unreadable source among several, like a stale account, still
+	// leaves names to show; only say so when macOS is blocking access or
+	// nothing at all could be read
+	switch {
+	case permErr != nil:
+		cb.loadErr = permErr
+	case !loaded:
+		cb.loadErr = firstErr
+	}
+
+	return cb
+}
+
+// Err returns why contacts couldn't be read: macOS privacy protection
+// blocking any AddressBook database, which shows up as an error matching
+// fs.ErrPermission and is fixed by granting Full Disk Access, or the first
+// failure when no database could be read at all. It's nil when at least
+// one database was read, or when there's no AddressBook, so an empty book
+// with a nil Err really has no contacts.
+func (cb *ContactBook) Err() error {
+	return cb.loadErr
+}
+
+// loadFromDB adds the contacts in one AddressBook database, failing only
+// when neither its phone numbers nor its email addresses could be read.
+func (cb *ContactBook) loadFromDB(path string) error {
+	// SQLite reports a file it may not open as a generic "unable to open",
+	// so check access directly to keep the permission error recognizable
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer cb.resolved.Clear()
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// The tables are read independently, so a source missing one still
+	// gives the names in the other
+	phoneErr := cb.loadPhones(db)
+	emailErr := cb.loadEmails(db)
+	if phoneErr != nil && emailErr != nil {
+		return phoneErr
+	}
+	return nil
+}
+
+// loadPhones adds the contacts with phone numbers in an AddressBook
+// database.
+func (cb *ContactBook) loadPhones(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT r.Z_PK, COALESCE(r.ZFIRSTNAME,''), COALESCE(r.ZLASTNAME,''),
+		       COALESCE(r.ZORGANIZATION,''), p.ZFULLNUMBER
+		FROM ZABCDRECORD r
+		JOIN ZABCDPHONENUMBER p ON p.ZOWNER = r.Z_PK
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pk int
+		var first, last, org, phone string
+		if err := rows.Scan(&pk, &first, &last, &org, &phone); err != nil {
+			continue
+		}
+		name := buildName(first, last, org)
+		if name == "" {
+			continue
+		}
+		digits := normalizePhone(phone)
+		if digits == "" {
+			continue
+		}
+		c := cb.getOrCreate(digits, "phone")
+		c.Name = name
+		c.Phones = appendUnique(c.Phones, phone)
+	}
+	return rows.Err()
+}
+
+// loadEmails adds the contacts with email addresses in an AddressBook
+// database.
+func (cb *ContactBook) loadEmails(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT r.Z_PK, COALESCE(r.ZFIRSTNAME,''), COALESCE(r.ZLASTNAME,''),
+		       COALESCE(r.ZORGANIZATION,''), e.ZADDRESS
+		FROM ZABCDRECORD r
+		JOIN ZABCDEMAILADDRESS e ON e.ZOWNER = r.Z_PK
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pk int
+		var first, last, org, email string
+		if err := rows.Scan(&pk, &first, &last, &org, &email); err != nil {
+			continue
+		}
+		name := buildName(first, last, org)
+		if name == "" {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(email))
+		if key == "" {
+			continue
+		}
+		c := cb.getOrCreate(key, "email")
+		c.Name = name
+		c.Emails = appendUnique(c.Emails, email)
+	}
+	return rows.Err()
+}
+
+// Add indexes c under each of its phone numbers and email addresses, for
+// building a book from a source other than the AddressBook.
+func (cb *ContactBook) Add(c *Contact) {
+	defer cb.resolved.Clear()
+	if cb.byDigits == nil {
+		cb.byDigits = make(map[string]*Contact)
+	}
+	if cb.byEmail == nil {
+		cb.byEmail = make(map[string]*Contact)
+	}
+	for _, p := range c.Phones {
+		if digits := normalizePhone(p); digits != "" {
+			cb.byDigits[digits] = c
+		}
+	}
+	for _, e := range c.Emails {
+		if key := strings.ToLower(strings.TrimSpace(e)); key != "" {
+			cb.byEmail[key] = c
+		}
+	}
+}
+
+func (cb *ContactBook) getOrCreate(key string, kind string) *Contact {
+	if kind == "phone" {
+		if c, ok := cb.byDigits[key]; ok {
+			return c
+		}
+		c := &Contact{}
+		cb.byDigits[key] = c
+		return c
+	}
+	if c, ok := cb.byEmail[key]; ok {
+		return c
+	}
+	c := &Contact{}
+	cb.byEmail[key] = c
+	return c
+}
+
+// Resolve looks up a handle identifier (phone number or email) and returns
+// the Contact if found, or nil.
+func (cb *ContactBook) Resolve(handle string) *Contact {
+	if handle == "" {
+		return nil
+	}
+	if c, ok := cb.resolved.Load(handle); ok {
+		return c.(*Contact)
+	}
+	c := cb.resolve(handle)
+	cb.resolved.Store(handle, c)
+	return c
+}
+
+// resolve is Resolve without the cache.
+func (cb *ContactBook) resolve(handle string) *Contact {
+	// Try as email first (contains @)
+	if strings.Contains(handle, "@") {
+		if c, ok := cb.byEmail[strings.ToLower(strings.TrimSpace(handle))]; ok {
+			return c
+		}
+		return nil
+	}
+	// Try as phone — normalize to digits and match
+	digits := normalizePhone(handle)
+	if digits == "" {
+		return nil
+	}
+	// Try full digits match
+	if c, ok := cb.byDigits[digits]; ok {
+		return c
+	}
+	// Try last 10 digits (strip country code)
+	if len(digits) > 10 {
+		short := digits[len(digits)-10:]
+		if c, ok := cb.byDigits[short]; ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// ResolveName returns the contact name for a handle, or the handle itself if unknown.
+func (cb *ContactBook) ResolveName(handle string) string {
+	if c := cb.Resolve(handle); c != nil {
+		return c.Name
+	}
+	return handle
+}
+
+// UnresolvedHandles returns the handles that don't match any contact,
+// preserving their order.
+func (cb *ContactBook) UnresolvedHandles(handles []HandleCount) []HandleCount {
+	var unknown []HandleCount
+	for _, h := range handles {
+		if cb.Resolve(h.Handle) == nil {
+			unknown = append(unknown, h)
+		}
+	}
+	return unknown
+}
+
+// Search returns the contacts whose name contains every word of query,
+// ignoring case, sorted by name. "jo sm" finds "John Smith".
+func (cb *ContactBook) Search(query string) []*Contact {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return nil
+	}
+	seen := make(map[*Contact]bool)
+	var matches []*Contact
+	check := func(c *Contact) {
+		if seen[c] || c.Name == "" {
+			return
+		}
+		seen[c] = true
+		name := strings.ToLower(c.Name)
+		for _, w := range words {
+			if !strings.Contains(name, w) {
+				return
+			}
+		}
+		matches = append(matches, c)
+	}
+	for _, c := range cb.byDigits {
+		check(c)
+	}
+	for _, c := range cb.byEmail {
+		check(c)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := strings.ToLower(matches[i].Name), strings.ToLower(matches[j].Name)
+		if a != b {
+			return a < b
+		}
+		return strings.Join(matches[i].Phones, ",")+strings.Join(matches[i].Emails, ",") <
+			strings.Join(matches[j].Phones, ",")+strings.Join(matches[j].Emails, ",")
+	})
+	return matches
+}
+
+// normalizePhone strips everything except digits from a phone number.
+// Returns the last 10 digits if longer (strips country code for matching).
+func normalizePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	d := digits.String()
+	// Normalize to 10-digit for US numbers
+	if len(d) == 11 && d[0] == '1' {
+		d = d[1:]
+	}
+	return d
+}
+
+func buildName(first, last, org string) string {
+	name := strings.TrimSpace(first + " " + last)
+	if name == "" {
+		name = org
+	}
+	return name
+}
+
+func appendUnique(slice []string, val string) []string {
+	for _, s := range slice {
+		if s == val {
+			return slice
+		}
+	}
+	return append(slice, val)
+}
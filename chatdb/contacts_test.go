@@ -0,0 +1,288 @@
+package chatdb
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"+15551234567", "5551234567"},
+		{"(555) 123-4567", "5551234567"},
+		{"555-123-4567", "5551234567"},
+		{"5551234567", "5551234567"},
+		{"+1 (555) 123-4567", "5551234567"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got := normalizePhone(tt.input)
+		if got != tt.want {
+			t.Errorf("normalizePhone(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestContactBookResolve(t *testing.T) {
+	cb := &ContactBook{
+		byDigits: map[string]*Contact{
+			"5551234567": {Name: "John Doe", Phones: []string{"+15551234567"}},
+		},
+		byEmail: map[string]*Contact{
+			"jane@example.com": {Name: "Jane Smith", Emails: []string{"jane@example.com"}},
+		},
+	}
+
+	t.Run("phone_with_country_code", func(t *testing.T) {
+		c := cb.Resolve("+15551234567")
+		if c == nil || c.Name != "John Doe" {
+			t.Errorf("expected John Doe, got %v", c)
+		}
+	})
+
+	t.Run("phone_formatted", func(t *testing.T) {
+		c := cb.Resolve("(555) 123-4567")
+		if c == nil || c.Name != "John Doe" {
+			t.Errorf("expected John Doe, got %v", c)
+		}
+	})
+
+	t.Run("email", func(t *testing.T) {
+		c := cb.Resolve("jane@example.com")
+		if c == nil || c.Name != "Jane Smith" {
+			t.Errorf("expected Jane Smith, got %v", c)
+		}
+	})
+
+	t.Run("email_case_insensitive", func(t *testing.T) {
+		c := cb.Resolve("Jane@Example.COM")
+		if c == nil || c.Name != "Jane Smith" {
+			t.Errorf("expected Jane Smith, got %v", c)
+		}
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		c := cb.Resolve("+19999999999")
+		if c != nil {
+			t.Errorf("expected nil, got %v", c)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		c := cb.Resolve("")
+		if c != nil {
+			t.Errorf("expected nil, got %v", c)
+		}
+	})
+}
+
+func TestContactBookResolveName(t *testing.T) {
+	cb := &ContactBook{
+		byDigits: map[string]*Contact{
+			"5551234567": {Name: "John Doe"},
+		},
+		byEmail: make(map[string]*Contact),
+	}
+
+	t.Run("known", func(t *testing.T) {
+		name := cb.ResolveName("+15551234567")
+		if name != "John Doe" {
+			t.Errorf("expected 'John Doe', got %q", name)
+		}
+	})
+
+	t.Run("unknown_returns_handle", func(t *testing.T) {
+		name := cb.ResolveName("+19999999999")
+		if name != "+19999999999" {
+			t.Errorf("expected handle back, got %q", name)
+		}
+	})
+}
+
+func TestUnresolvedHandles(t *testing.T) {
+	cb := &ContactBook{
+		byDigits: map[string]*Contact{
+			"5551234567": {Name: "John Doe"},
+		},
+		byEmail: make(map[string]*Contact),
+	}
+	handles := []HandleCount{
+		{"+15551234567", 8},
+		{"jane@example.com", 3},
+		{"+15559876543", 2},
+	}
+
+	unknown := cb.UnresolvedHandles(handles)
+	if len(unknown) != 2 {
+		t.Fatalf("expected 2 unresolved handles, got %v", unknown)
+	}
+	if unknown[0].Handle != "jane@example.com" || unknown[1].Handle != "+15559876543" {
+		t.Errorf("unexpected unresolved handles: %v", unknown)
+	}
+}
+
+func TestBuildName(t *testing.T) {
+	tests := []struct {
+		first, last, org string
+		want             string
+	}{
+		{"John", "Doe", "Acme", "John Doe"},
+		{"John", "", "", "John"},
+		{"", "Doe", "", "Doe"},
+		{"", "", "Acme Inc", "Acme Inc"},
+		{"", "", "", ""},
+	}
+	for _, tt := range tests {
+		got := buildName(tt.first, tt.last, tt.org)
+		if got != tt.want {
+			t.Errorf("buildName(%q,%q,%q) = %q, want %q", tt.first, tt.last, tt.org, got, tt.want)
+		}
+	}
+}
+
+func TestContactBookAdd(t *testing.T) {
+	var cb ContactBook
+	cb.Add(&Contact{Name: "John Doe", Phones: []string{"(555) 123-4567"}, Emails: []string{" John@Example.com"}})
+
+	for _, handle := range []string{"+15551234567", "john@example.com"} {
+		if got := cb.ResolveName(handle); got != "John Doe" {
+			t.Errorf("ResolveName(%q) = %q, want John Doe", handle, got)
+		}
+	}
+	if got := cb.ResolveName("+15559876543"); got != "+15559876543" {
+		t.Errorf("unknown handle: got %q", got)
+	}
+}
+
+func TestContactBookSearch(t *testing.T) {
+	var cb ContactBook
+	john := &Contact{Name: "John Smith", Phones: []string{"5551234567", "5550001111"}, Emails: []string{"john@example.com"}}
+	cb.Add(john)
+	cb.Add(&Contact{Name: "Johnny Appleseed", Phones: []string{"5559876543"}})
+	cb.Add(&Contact{Name: "Jane Doe", Emails: []string{"jane@example.com"}})
+
+	got := cb.Search("JOHN")
+	if len(got) != 2 || got[0] != john || got[1].Name != "Johnny Appleseed" {
+		t.Fatalf("Search(JOHN) = %v, want John Smith then Johnny Appleseed", got)
+	}
+	if got := cb.Search("jo sm"); len(got) != 1 || got[0] != john {
+		t.Errorf("Search(jo sm) = %v, want only John Smith", got)
+	}
+	if got := cb.Search("bob"); got != nil {
+		t.Errorf("Search(bob) = %v, want none", got)
+	}
+	if got := cb.Search("  "); got != nil {
+		t.Errorf("blank query = %v, want none", got)
+	}
+}
+
+func TestContactBookResolveCache(t *testing.T) {
+	var cb ContactBook
+	if got := cb.ResolveName("+15551234567"); got != "+15551234567" {
+		t.Fatalf("empty book: got %q", got)
+	}
+	// Adding a contact must not leave the earlier miss cached
+	cb.Add(&Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+	if got := cb.ResolveName("+15551234567"); got != "John Doe" {
+		t.Errorf("after Add: got %q, want John Doe", got)
+	}
+	cb.Add(&Contact{Name: "Johnny", Phones: []string{"5551234567"}})
+	if got := cb.ResolveName("+15551234567"); got != "Johnny" {
+		t.Errorf("after replacing the number: got %q, want Johnny", got)
+	}
+}
+
+// BenchmarkResolveName resolves the senders of a 5,000-message thread, as
+// one render of the message view does, against a 1,000-contact book.
+func BenchmarkResolveName(b *testing.B) {
+	var cb ContactBook
+	for i := range 1000 {
+		cb.Add(&Contact{
+			Name:   fmt.Sprintf("Contact %d", i),
+			Phones: []string{fmt.Sprintf("+1 (555) %03d-%04d", i/10, i)},
+			Emails: []string{fmt.Sprintf("Person%d@Example.com", i)},
+		})
+	}
+	senders := make([]string, 5000)
+	for i := range senders {
+		switch i % 3 {
+		case 0:
+			senders[i] = fmt.Sprintf("+1555%03d%04d", i%40/10, i%40)
+		case 1:
+			senders[i] = fmt.Sprintf("person%d@example.com", i%40)
+		default:
+			senders[i] = "+15550000000" // not in the book
+		}
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		for b.Loop() {
+			for _, h := range senders {
+				if c := cb.resolve(h); c != nil {
+					_ = c.Name
+				}
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for b.Loop() {
+			for _, h := range senders {
+				_ = cb.ResolveName(h)
+			}
+		}
+	})
+}
+
+func TestContactBookErr(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := NewContactBook().Err(); err != nil {
+		t.Errorf("no AddressBook should mean no contacts, not an error: %v", err)
+	}
+
+	// A database that can't be read is reported rather than read as empty
+	dir := filepath.Join(home, "Library", "Application Support", "AddressBook")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "AddressBook-v22.abcddb"), []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewContactBook().Err(); err == nil {
+		t.Error("an unreadable AddressBook database should set Err")
+	}
+
+	// Beside a readable source it's skipped quietly, and a source without
+	// an email table still gives its phone numbers
+	src := filepath.Join(dir, "Sources", "ABC", "AddressBook-v22.abcddb")
+	if err := os.MkdirAll(filepath.Dir(src), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE ZABCDRECORD (Z_PK INTEGER PRIMARY KEY, ZFIRSTNAME TEXT, ZLASTNAME TEXT, ZORGANIZATION TEXT)`,
+		`CREATE TABLE ZABCDPHONENUMBER (ZOWNER INTEGER, ZFULLNUMBER TEXT)`,
+		`INSERT INTO ZABCDRECORD VALUES (1, 'Jane', 'Doe', NULL)`,
+		`INSERT INTO ZABCDPHONENUMBER VALUES (1, '(555) 123-4567')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+	cb := NewContactBook()
+	if err := cb.Err(); err != nil {
+		t.Errorf("one unreadable source beside a readable one: %v", err)
+	}
+	if got := cb.ResolveName("+15551234567"); got != "Jane Doe" {
+		t.Errorf("name from the phone table = %q", got)
+	}
+}
@@ -0,0 +1,1893 @@
+// Package chatdb reads the macOS Messages database (chat.db): conversations,
+// messages, attachments, and tapbacks, with contact names resolved from the
+// AddressBook. It opens nothing itself and never writes; pass NewStore a
+// *sql.DB opened read-only with the modernc.org/sqlite driver.
+package chatdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	appleEpochOffset = 978307200
+
+	// MessagesPageSize is the page size FetchMessages uses when given none.
+	MessagesPageSize = 200
+	// GlobalAttachmentLimit caps attachment queries that are given no limit.
+	GlobalAttachmentLimit = 500
+
+	// busyRetries is how many times a query is retried when SQLite reports
+	// the database busy or locked, e.g. while Messages is writing to it.
+	busyRetries = 4
+)
+
+// busyBackoff is the first wait before retrying a busy query; it doubles on
+// each attempt. A variable so tests can shorten it.
+var busyBackoff = 25 * time.Millisecond
+
+type Conversation struct {
+	ChatID           int
+	GUID             string // chat.guid, e.g. "iMessage;-;+15551234567"
+	Identifier       string
+	DisplayName      string
+	Participants     []string
+	Countries        map[string]string // participant handle → handle.country, e.g. "gb"; only recorded ones
+	ServiceName      string
+	FirstMsgDate     time.Time
+	LastMsgDate      time.Time
+	MessageCount     int // every row, including reactions and attachment-only messages
+	TextMessageCount int // messages with text, not counting reactions
+	SentCount        int
+	ReceivedCount    int
+	Style            int
+	LastMessageText  string   // newest message's text, "" if it had none (e.g. attachment only)
+	Senders          []string // for a group with no recorded participants, the handles that wrote in it
+}
+
+type AttachmentInfo struct {
+	TypeLabel string // e.g. "photo", "PDF", "video"
+	Filename  string // e.g. "IMG_1234.jpeg"
+	Size      int64  // bytes
+}
+
+func (a AttachmentInfo) String() string {
+	return a.Label(UnitsLegacy)
+}
+
+// Label is String with the size written in units.
+func (a AttachmentInfo) Label(units ByteUnits) string {
+	parts := []string{a.TypeLabel}
+	if a.Filename != "" {
+		parts = append(parts, a.Filename)
+	}
+	if a.Size > 0 {
+		parts = append(parts, units.Format(a.Size))
+	}
+	return "[" + strings.Join(parts, " — ") + "]"
+}
+
+type Message struct {
+	ROWID       int
+	GUID        string
+	Text        string
+	Date        time.Time
+	RawDate     int64 // message.date as stored: nanoseconds since 2001-01-01 UTC
+	IsFromMe    bool
+	Sender      string
+	Service     string
+	Attachments []AttachmentInfo
+
+	// Optional columns; left zero when the schema lacks them.
+	DateRead         time.Time
+	DateDelivered    time.Time
+	ThreadOriginator string // guid of the message this replies to
+	SenderCountry    string // handle.country of the sender, e.g. "us"
+	SenderDisplay    string // handle.uncanonicalized_id, as the sender's handle was first written, when it differs, e.g. "(555) 987-6543"
+	Edited           bool   // has message_summary_info (edit/unsend history)
+	Failed           bool   // non-zero error code: the send never went through
+	BalloonType      string // iMessage app it was sent with, e.g. "Apple Pay"; see balloonLabels
+
+	Reactions []Reaction // tapbacks currently on the message
+}
+
+// Reaction is one participant's tapback on a message.
+type Reaction struct {
+	Type     int    // associated_message_type, 2000–2006
+	Emoji    string // custom emoji for type 2006
+	Sender   string // handle; empty when IsFromMe
+	IsFromMe bool
+}
+
+// tapbackEmoji maps associated_message_type codes to their tapback glyph.
+var tapbackEmoji = map[int]string{
+	2000: "❤️",
+	2001: "👍",
+	2002: "👎",
+	2003: "😂",
+	2004: "‼️",
+	2005: "❓",
+}
+
+// Glyph returns the emoji shown for a reaction. Custom emoji tapbacks
+// (type 2006) carry their own; unknown types fall back to a placeholder.
+func (r Reaction) Glyph() string {
+	if r.Type == 2006 && r.Emoji != "" {
+		return r.Emoji
+	}
+	if e, ok := tapbackEmoji[r.Type]; ok {
+		return e
+	}
+	return "•"
+}
+
+// ByteUnits is a way of writing sizes: the divisor and unit labels.
+type ByteUnits int
+
+const (
+	// UnitsLegacy divides by 1024 but labels sizes KB, MB, and GB, as the
+	// viewer always has.
+	UnitsLegacy ByteUnits = iota
+	// UnitsIEC divides by 1024 and labels sizes KiB, MiB, and GiB.
+	UnitsIEC
+	// UnitsSI divides by 1000 and labels sizes kB, MB, and GB.
+	UnitsSI
+)
+
+// ParseByteUnits maps a --units value ("legacy", "iec", or "si") to its
+// ByteUnits.
+func ParseByteUnits(name string) (ByteUnits, error) {
+	switch strings.ToLower(name) {
+	case "legacy", "":
+		return UnitsLegacy, nil
+	case "iec":
+		return UnitsIEC, nil
+	case "si":
+		return UnitsSI, nil
+	}
+	return 0, fmt.Errorf("unknown units %q (valid: legacy, iec, si)", name)
+}
+
+// Format renders a byte count in u, e.g. "1.2 MB" or "1.2 MiB".
+func (u ByteUnits) Format(b int64) string {
+	base, labels := int64(1<<10), [3]string{"KB", "MB", "GB"}
+	switch u {
+	case UnitsIEC:
+		labels = [3]string{"KiB", "MiB", "GiB"}
+	case UnitsSI:
+		base, labels = 1000, [3]string{"kB", "MB", "GB"}
+	}
+	switch {
+	case b >= base*base*base:
+		return fmt.Sprintf("%.1f %s", float64(b)/float64(base*base*base), labels[2])
+	case b >= base*base:
+		return fmt.Sprintf("%.1f %s", float64(b)/float64(base*base), labels[1])
+	case b >= base:
+		return fmt.Sprintf("%.1f %s", float64(b)/float64(base), labels[0])
+	default:
+		return fmt.Sprintf("%d B", b)
+	}
+}
+
+// FormatBytes renders a byte count for display in UnitsLegacy, e.g.
+// "1.2 MB".
+func FormatBytes(b int64) string {
+	return UnitsLegacy.Format(b)
+}
+
+// attachmentLabel returns a human-friendly label from a mime_type string.
+// Changes belong in attachmentLabelSQL too.
+func attachmentLabel(mime string) string {
+	mime = strings.TrimSpace(strings.ToLower(mime))
+	switch {
+	case strings.HasPrefix(mime, "image/"):
+		sub := strings.TrimPrefix(mime, "image/")
+		switch sub {
+		case "jpeg", "jpg":
+			return "photo"
+		case "png":
+			return "image"
+		case "heic", "heif":
+			return "photo"
+		case "gif":
+			return "GIF"
+		case "webp":
+			return "image"
+		default:
+			return "image"
+		}
+	case strings.HasPrefix(mime, "video/"):
+		return "video"
+	case strings.HasPrefix(mime, "audio/"):
+		return "audio"
+	case mime == "application/pdf":
+		return "PDF"
+	case mime == "text/vcard":
+		return "contact card"
+	case mime == "text/x-markdown":
+		return "markdown"
+	case strings.Contains(mime, "zip") || strings.Contains(mime, "archive"):
+		return "archive"
+	case strings.Contains(mime, "iwork-numbers"):
+		return "Numbers spreadsheet"
+	case strings.Contains(mime, "iwork-pages"):
+		return "Pages document"
+	case strings.Contains(mime, "iwork-keynote"):
+		return "Keynote presentation"
+	case mime == "":
+		return "attachment"
+	default:
+		return "file"
+	}
+}
+
+// parseAttachments splits a GROUP_CONCAT result into AttachmentInfo structs.
+// Each attachment is separated by ";;", fields within by "||".
+// Format: mime_type||transfer_name||total_bytes
+func parseAttachments(raw string) []AttachmentInfo {
+	if raw == "" {
+		return nil
+	}
+	entries := strings.Split(raw, ";;")
+	var attachments []AttachmentInfo
+	for _, entry := range entries {
+		fields := strings.SplitN(entry, "||", 3)
+		mime := ""
+		if len(fields) > 0 {
+			mime = strings.TrimSpace(fields[0])
+		}
+		name := ""
+		if len(fields) > 1 {
+			name = strings.TrimSpace(fields[1])
+		}
+		var size int64
+		if len(fields) > 2 {
+			size, _ = strconv.ParseInt(strings.TrimSpace(fields[2]), 10, 64)
+		}
+		if size < 0 {
+			size = 0
+		}
+		// Skip entries with no usable fields (null rows from the LEFT JOIN,
+		// or malformed concat output)
+		if mime == "" && name == "" && size == 0 {
+			continue
+		}
+		// Without a mime type we only know it's some file with a name or size
+		label := "file"
+		if mime != "" {
+			label = attachmentLabel(mime)
+		}
+		attachments = append(attachments, AttachmentInfo{
+			TypeLabel: label,
+			Filename:  name,
+			Size:      size,
+		})
+	}
+	return attachments
+}
+
+type ChatAttachment struct {
+	ROWID     int
+	FilePath  string // full path from attachment.filename
+	Filename  string // transfer_name (display name)
+	MimeType  string
+	TypeLabel string
+	Size      int64
+	Date      time.Time
+	IsFromMe  bool
+	Sender    string
+	ChatID    int
+	ChatName  string // display name, or chat identifier when unnamed
+	State     AttachmentState
+}
+
+// AttachmentState says whether an attachment's file can be opened.
+type AttachmentState int
+
+const (
+	AttachmentAvailable AttachmentState = iota // the file is on disk
+	AttachmentOffloaded                        // kept in iCloud; Messages must download it first
+	AttachmentMissing                          // not on disk and not waiting to download
+)
+
+func (st AttachmentState) String() string {
+	switch st {
+	case AttachmentOffloaded:
+		return "needs download"
+	case AttachmentMissing:
+		return "missing"
+	}
+	return "available"
+}
+
+const (
+	// transferFinished is attachment.transfer_state once the file has been
+	// fully received.
+	transferFinished = 5
+	// placeholderSize is the size below which a file standing in for a
+	// larger attachment is taken to be an iCloud placeholder.
+	placeholderSize = 1024
+)
+
+// attachmentState works out where an attachment's file stands from a stat
+// of path, the size Messages expects, and attachment.transfer_state (NULL
+// on databases without the column).
+func attachmentState(path string, totalBytes int64, transferState sql.NullInt64) AttachmentState {
+	info, err := os.Stat(path)
+	if err == nil && info.Mode().IsRegular() {
+		size := info.Size()
+		placeholder := (size == 0 && totalBytes > 0) ||
+			(size < placeholderSize && totalBytes > placeholderSize)
+		if !placeholder {
+			return AttachmentAvailable
+		}
+		return AttachmentOffloaded
+	}
+	if transferState.Valid && transferState.Int64 != transferFinished {
+		return AttachmentOffloaded
+	}
+	return AttachmentMissing
+}
+
+type SearchResult struct {
+	Message
+	ChatID   int
+	ChatName string
+}
+
+// AttachmentGroup is one conversation's attachments matching a search.
+type AttachmentGroup struct {
+	ChatID      int
+	ChatName    string
+	Attachments []ChatAttachment // newest first
+}
+
+// DatabaseSummary is the overall size of a chat.db.
+type DatabaseSummary struct {
+	Conversations int
+	Messages      int
+	Attachments   int
+	First, Last   time.Time // oldest and newest message; zero when empty
+}
+
+// HandleCount pairs a handle identifier with the number of messages it sent.
+type HandleCount struct {
+	Handle       string
+	MessageCount int
+}
+
+// DayCount is the number of messages sent or received on one local calendar day.
+type DayCount struct {
+	Day   time.Time
+	Count int
+}
+
+type Store struct {
+	db     *sql.DB
+	schema schema
+}
+
+// NewStore wraps an open chat.db and probes which optional columns it has.
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db, schema: probeSchema(db)}
+}
+
+// schema records the columns present in each table. chat.db varies across
+// macOS versions, so queries check here before selecting newer columns.
+type schema map[string]map[string]bool
+
+// probeSchema reads the column list of the tables the store queries. A table
+// that can't be inspected is treated as having no optional columns.
+func probeSchema(db *sql.DB) schema {
+	sc := schema{}
+	for _, table := range []string{"message", "chat", "handle", "attachment"} {
+		cols := map[string]bool{}
+		rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+		if err != nil {
+			sc[table] = cols
+			continue
+		}
+		for rows.Next() {
+			var cid, notNull, pk int
+			var name, colType string
+			var dflt sql.NullString
+			if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err == nil {
+				cols[strings.ToLower(name)] = true
+			}
+		}
+		rows.Close()
+		sc[table] = cols
+	}
+	return sc
+}
+
+// has reports whether table has the named column.
+func (sc schema) has(table, column string) bool {
+	return sc[table][strings.ToLower(column)]
+}
+
+// optional returns expr when table has column, or fallback otherwise, so a
+// SELECT keeps the same shape on every schema.
+func (sc schema) optional(table, column, expr, fallback string) string {
+	if sc.has(table, column) {
+		return expr
+	}
+	return fallback
+}
+
+// messageColumns is the SELECT list shared by the message fetch queries,
+// scanned by scanMessage. Expects m (message), h (handle) and a (attachment)
+// aliases and a GROUP BY m.ROWID.
+func (s *Store) messageColumns() string {
+	return strings.Join([]string{
+		"m.ROWID", "COALESCE(m.guid, '')", "COALESCE(m.text, '')", "m.date", "m.is_from_me",
+		"COALESCE(h.id, '')", "COALESCE(m.service, '')",
+		"COALESCE(GROUP_CONCAT(COALESCE(a.mime_type,'') || '||' || COALESCE(a.transfer_name,'') || '||' || COALESCE(a.total_bytes,0), ';;'), '')",
+		s.schema.optional("message", "date_read", "COALESCE(m.date_read, 0)", "0"),
+		s.schema.optional("message", "date_delivered", "COALESCE(m.date_delivered, 0)", "0"),
+		s.schema.optional("message", "thread_originator_guid", "COALESCE(m.thread_originator_guid, '')", "''"),
+		s.schema.optional("handle", "country", "COALESCE(h.country, '')", "''"),
+		s.schema.optional("message", "message_summary_info", "m.message_summary_info IS NOT NULL", "0"),
+		s.schema.optional("message", "attributedBody", "m.attributedBody", "NULL"),
+		s.schema.optional("message", "error", "COALESCE(m.error, 0) != 0", "0"),
+		s.schema.optional("message", "balloon_bundle_id", "COALESCE(m.balloon_bundle_id, '')", "''"),
+		s.schema.optional("handle", "uncanonicalized_id", "COALESCE(h.uncanonicalized_id, '')", "''"),
+	}, ",\n\t\t       ")
+}
+
+// scanMessage reads one row selected with messageColumns.
+func scanMessage(rows *sql.Rows) (Message, error) {
+	var msg Message
+	var dateNanos, readNanos, deliveredNanos int64
+	var attachRaw string
+	var attributedBody []byte
+	var balloon string
+	err := rows.Scan(&msg.ROWID, &msg.GUID, &msg.Text, &dateNanos, &msg.IsFromMe, &msg.Sender, &msg.Service,
+		&attachRaw, &readNanos, &deliveredNanos, &msg.ThreadOriginator, &msg.SenderCountry, &msg.Edited, &attributedBody, &msg.Failed,
+		&balloon, &msg.SenderDisplay)
+	if err != nil {
+		return Message{}, err
+	}
+	if strings.EqualFold(msg.SenderDisplay, msg.Sender) {
+		msg.SenderDisplay = ""
+	}
+	msg.BalloonType = balloonLabel(balloon)
+	if msg.Text == "" && len(attributedBody) > 0 {
+		msg.Text = decodeAttributedBody(attributedBody)
+	}
+	msg.Date = appleNanosToTime(dateNanos)
+	msg.RawDate = dateNanos
+	msg.DateRead = appleNanosToTime(readNanos)
+	msg.DateDelivered = appleNanosToTime(deliveredNanos)
+	msg.Attachments = parseAttachments(attachRaw)
+	return msg, nil
+}
+
+// queryWithRetry runs a query, retrying with backoff while the database is
+// busy or locked. Other errors are returned immediately. Failures come back
+// classified by ClassifyError; errors met while reading the rows aren't, so
+// scan loops pass rows.Err() through ClassifyError too.
+func (s *Store) queryWithRetry(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := withBusyRetry(ctx, func() error {
+		var err error
+		rows, err = s.db.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, ClassifyError(err)
+}
+
+// queryRowWithRetry is queryWithRetry for single-row queries, scanning the
+// row into dest. sql.ErrNoRows is returned as is.
+func (s *Store) queryRowWithRetry(ctx context.Context, query string, args []interface{}, dest ...interface{}) error {
+	return ClassifyError(withBusyRetry(ctx, func() error {
+		return s.db.QueryRowContext(ctx, query, args...).Scan(dest...)
+	}))
+}
+
+// withBusyRetry calls op until it succeeds, fails with a non-busy error, or
+// busyRetries retries have been used. Canceling ctx stops the backoff early.
+func withBusyRetry(ctx context.Context, op func() error) error {
+	wait := busyBackoff
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || !isBusyError(err) || attempt == busyRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// isBusyError reports whether err is SQLITE_BUSY or SQLITE_LOCKED,
+// including their extended codes.
+func isBusyError(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return true
+	}
+	return false
+}
+
+func appleNanosToTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	unixSeconds := nanos/1_000_000_000 + appleEpochOffset
+	remainder := nanos % 1_000_000_000
+	return time.Unix(unixSeconds, remainder)
+}
+
+// timeToAppleNanos is the inverse of appleNanosToTime.
+func timeToAppleNanos(t time.Time) int64 {
+	return (t.Unix()-appleEpochOffset)*1_000_000_000 + int64(t.Nanosecond())
+}
+
+func (s *Store) FetchConversations(ctx context.Context) ([]Conversation, error) {
+	query := `
+		SELECT
+			c.ROWID,
+			c.guid,
+			c.chat_identifier,
+			COALESCE(c.display_name, ''),
+			c.service_name,
+			COALESCE(c.style, 0),
+			COALESCE(sub.first_date, 0),
+			COALESCE(sub.last_date, 0),
+			COALESCE(sub.msg_count, 0),
+			COALESCE(sub.sent_count, 0),
+			COALESCE(sub.recv_count, 0),
+			COALESCE(sub.text_count, 0),
+			COALESCE(lm.text, ''),
+			` + s.schema.optional("message", "attributedBody", "lm.attributedBody", "NULL") + `
+		FROM chat c
+		LEFT JOIN message lm ON lm.ROWID = (
+			SELECT m.ROWID
+			FROM chat_message_join cmj
+			JOIN message m ON cmj.message_id = m.ROWID
+			WHERE cmj.chat_id = c.ROWID` + s.skipReactions() + `
+			ORDER BY m.date DESC, m.ROWID DESC
+			LIMIT 1
+		)
+		LEFT JOIN (
+			SELECT
+				cmj.chat_id,
+				MIN(m.date) AS first_date,
+				MAX(m.date) AS last_date,
+				COUNT(*) AS msg_count,
+				SUM(m.is_from_me) AS sent_count,
+				SUM(CASE WHEN m.is_from_me = 0 THEN 1 ELSE 0 END) AS recv_count,
+				SUM(CASE WHEN ` + s.hasText() + ` THEN 1 ELSE 0 END) AS text_count
+			FROM chat_message_join cmj
+			JOIN message m ON cmj.message_id = m.ROWID
+			GROUP BY cmj.chat_id
+		) sub ON sub.chat_id = c.ROWID
+		ORDER BY sub.last_date DESC
+	`
+	rows, err := s.queryWithRetry(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversations []Conversation
+	for rows.Next() {
+		var conv Conversation
+		var firstDate, lastDate int64
+		var lastBody []byte
+		err := rows.Scan(
+			&conv.ChatID,
+			&conv.GUID,
+			&conv.Identifier,
+			&conv.DisplayName,
+			&conv.ServiceName,
+			&conv.Style,
+			&firstDate,
+			&lastDate,
+			&conv.MessageCount,
+			&conv.SentCount,
+			&conv.ReceivedCount,
+			&conv.TextMessageCount,
+			&conv.LastMessageText,
+			&lastBody,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if conv.LastMessageText == "" && len(lastBody) > 0 {
+			conv.LastMessageText = decodeAttributedBody(lastBody)
+		}
+		conv.FirstMsgDate = appleNanosToTime(firstDate)
+		conv.LastMsgDate = appleNanosToTime(lastDate)
+		conversations = append(conversations, conv)
+	}
+	if err := ClassifyError(rows.Err()); err != nil {
+		return nil, err
+	}
+
+	for i := range conversations {
+		participants, countries, err := s.fetchParticipants(ctx, conversations[i].ChatID)
+		if err != nil {
+			return nil, err
+		}
+		conversations[i].Participants = participants
+		conversations[i].Countries = countries
+		if len(participants) == 0 && conversations[i].Style == ChatStyleGroup {
+			// SMS groups often keep no chat_handle_join rows; name them
+			// after whoever wrote in them instead
+			senders, err := s.fetchSenders(ctx, conversations[i].ChatID)
+			if err != nil {
+				return nil, err
+			}
+			conversations[i].Senders = senders
+		}
+	}
+
+	return conversations, nil
+}
+
+// fetchParticipants returns a chat's handles and, for those that have one
+// recorded, their country code.
+func (s *Store) fetchParticipants(ctx context.Context, chatID int) ([]string, map[string]string, error) {
+	query := `
+		SELECT h.id, ` + s.schema.optional("handle", "country", "COALESCE(h.country, '')", "''") + `
+		FROM handle h
+		JOIN chat_handle_join chj ON chj.handle_id = h.ROWID
+		WHERE chj.chat_id = ?
+	`
+	rows, err := s.queryWithRetry(ctx, query, chatID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var participants []string
+	var countries map[string]string
+	for rows.Next() {
+		var p, country string
+		if err := rows.Scan(&p, &country); err != nil {
+			return nil, nil, err
+		}
+		participants = append(participants, p)
+		if country != "" {
+			if countries == nil {
+				countries = map[string]string{}
+			}
+			countries[p] = country
+		}
+	}
+	if err := ClassifyError(rows.Err()); err != nil {
+		return nil, nil, err
+	}
+	return participants, countries, nil
+}
+
+// fetchSenders returns the handles that sent messages in a chat, in the
+// order they first wrote.
+func (s *Store) fetchSenders(ctx context.Context, chatID int) ([]string, error) {
+	join, where, args := chatMessages(chatID)
+	query := `
+		SELECT h.id
+		FROM message m
+		` + join + `
+		JOIN handle h ON m.handle_id = h.ROWID
+		WHERE ` + where + ` AND m.is_from_me = 0
+		GROUP BY h.id
+		ORDER BY MIN(m.date), h.id
+	`
+	rows, err := s.queryWithRetry(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var senders []string
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		senders = append(senders, h)
+	}
+	if err := ClassifyError(rows.Err()); err != nil {
+		return nil, err
+	}
+	return senders, nil
+}
+
+// OrphanChatID is the chat id of the synthetic conversation holding messages
+// that chat_message_join links to no chat, which no other query sees. Real
+// chat ROWIDs are always positive.
+const OrphanChatID = -1
+
+// chatMessages returns the join, condition, and arguments that select a
+// chat's messages, as m, for every query about one chat. For OrphanChatID
+// they select messages joined to no chat.
+func chatMessages(chatID int) (join, where string, args []interface{}) {
+	if chatID == OrphanChatID {
+		return "LEFT JOIN chat_message_join cmj ON cmj.message_id = m.ROWID", "cmj.chat_id IS NULL", nil
+	}
+	return "JOIN chat_message_join cmj ON cmj.message_id = m.ROWID", "cmj.chat_id = ?", []interface{}{chatID}
+}
+
+// FetchOrphanConversation summarizes the messages joined to no chat as a
+// conversation with ChatID OrphanChatID. found is false when there are none.
+func (s *Store) FetchOrphanConversation(ctx context.Context) (conv Conversation, found bool, err error) {
+	join, where, args := chatMessages(OrphanChatID)
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(m.is_from_me), 0),
+		       COALESCE(MIN(m.date), 0), COALESCE(MAX(m.date), 0)
+		FROM message m
+		` + join + `
+		WHERE ` + where + s.skipReactions()
+	var firstDate, lastDate int64
+	err = s.queryRowWithRetry(ctx, query, args, &conv.MessageCount, &conv.SentCount, &firstDate, &lastDate)
+	if err != nil || conv.MessageCount == 0 {
+		return Conversation{}, false, err
+	}
+	conv.ChatID = OrphanChatID
+	conv.Identifier = "orphaned"
+	conv.DisplayName = "Orphaned messages"
+	conv.ReceivedCount = conv.MessageCount - conv.SentCount
+	conv.FirstMsgDate = appleNanosToTime(firstDate)
+	conv.LastMsgDate = appleNanosToTime(lastDate)
+	return conv, true, nil
+}
+
+// MessageCursor is a message's place in a chat's date order, for paging.
+// Pages are cut by date with ROWID breaking ties, not by ROWID alone, so
+// they stay consistent when messages are inserted out of order, as when
+// history syncs in from another device. The zero value is past the newest
+// message.
+type MessageCursor struct {
+	Date  time.Time
+	ROWID int
+}
+
+// CursorAt returns msg's place in date order.
+func CursorAt(msg Message) MessageCursor {
+	return MessageCursor{Date: msg.Date, ROWID: msg.ROWID}
+}
+
+// dateNanos is the cursor's date as stored in message.date.
+func (c MessageCursor) dateNanos() int64 {
+	if c.Date.IsZero() {
+		return 0
+	}
+	return timeToAppleNanos(c.Date)
+}
+
+// FetchMessages returns the page of a chat's messages just before cursor,
+// oldest first: the newest pageSize messages for the zero cursor.
+func (s *Store) FetchMessages(ctx context.Context, chatID int, cursor MessageCursor, pageSize int) ([]Message, error) {
+	join, where, args := chatMessages(chatID)
+	messages, err := s.fetchMessagePage(ctx, join, where, args, cursor, pageSize, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachReactions(ctx, chatID, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// FetchMessagesAsc returns the page of a chat's messages just after
+// cursor, oldest first, for reading a chat from the beginning: the first
+// pageSize messages for the zero cursor, which here means before the
+// oldest message. Passing the last message of one page as the cursor for
+// the next pages forward without overlap.
+func (s *Store) FetchMessagesAsc(ctx context.Context, chatID int, cursor MessageCursor, pageSize int) ([]Message, error) {
+	join, where, args := chatMessages(chatID)
+	messages, err := s.fetchMessagePage(ctx, join, where, args, cursor, pageSize, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachReactions(ctx, chatID, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// FetchMessagesByHandle returns the page of messages exchanged with handle
+// just before cursor, from every chat, oldest first. Messages are matched
+// on message.handle_id, which covers what the person sent anywhere and
+// what was sent to them one-on-one, across every handle row with that id
+// (SMS and iMessage alike). Reactions are not attached, since they belong
+// to each chat.
+func (s *Store) FetchMessagesByHandle(ctx context.Context, handle string, cursor MessageCursor, pageSize int) ([]Message, error) {
+	return s.fetchMessagePage(ctx, "", "h.id = ? COLLATE NOCASE", []interface{}{handle}, cursor, pageSize, false)
+}
+
+// fetchMessagePage returns the page of messages matching where, over m
+// (message) joined with join and h (handle), just before cursor, or just
+// after it when forward is set, oldest first, without reactions.
+func (s *Store) fetchMessagePage(ctx context.Context, join, where string, args []interface{}, cursor MessageCursor, pageSize int, forward bool) ([]Message, error) {
+	if pageSize <= 0 {
+		pageSize = MessagesPageSize
+	}
+
+	where += s.skipReactions()
+	order := "DESC"
+	if forward {
+		order = "ASC"
+	}
+	if cursor != (MessageCursor{}) {
+		if forward {
+			where += " AND (m.date > ? OR (m.date = ? AND m.ROWID > ?))"
+		} else {
+			where += " AND (m.date < ? OR (m.date = ? AND m.ROWID < ?))"
+		}
+		args = append(args, cursor.dateNanos(), cursor.dateNanos(), cursor.ROWID)
+	}
+	args = append(args, pageSize)
+
+	query := `
+		SELECT ` + s.messageColumns() + `
+		FROM message m
+		` + join + `
+		LEFT JOIN handle h ON m.handle_id = h.ROWID
+		LEFT JOIN message_attachment_join maj ON maj.message_id = m.ROWID
+		LEFT JOIN attachment a ON maj.attachment_id = a.ROWID
+		WHERE ` + where + `
+		GROUP BY m.ROWID
+		ORDER BY m.date ` + order + `, m.ROWID ` + order + `
+		LIMIT ?
+	`
+
+	rows, err := s.queryWithRetry(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := ClassifyError(rows.Err()); err != nil {
+		return nil, err
+	}
+
+	if !forward {
+		// Reverse to chronological order
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, nil
+}
+
+// FetchMessagesFrom returns a chat's messages from cursor's message on,
+// oldest first, including any that arrived since it was loaded. Reloading
+// from the oldest loaded message refreshes the loaded window in place.
+func (s *Store) FetchMessagesFrom(ctx context.Context, chatID int, cursor MessageCursor) ([]Message, error) {
+	return s.fetchMessagesWhere(ctx, chatID, " AND (m.date > ? OR (m.date = ? AND m.ROWID >= ?))",
+		cursor.dateNanos(), cursor.dateNanos(), cursor.ROWID)
+}
+
+// FetchMessagesAfter returns a chat's messages with a ROWID above rowid,
+// oldest first. ROWIDs only grow, so polling with the newest loaded ROWID
+// picks up just the messages written since.
+func (s *Store) FetchMessagesAfter(ctx context.Context, chatID int, rowid int) ([]Message, error) {
+	return s.fetchMessagesWhere(ctx, chatID, " AND m.ROWID > ?", rowid)
+}
+
+// RefreshReactions reloads the tapbacks on messages fetched earlier,
+// replacing each one's Reactions. A tapback added or taken back later is a
+// row of its own, reacting to an older message, so FetchMessagesAfter
+// doesn't bring it back with its target.
+func (s *Store) RefreshReactions(ctx context.Context, chatID int, messages []Message) error {
+	for i := range messages {
+		messages[i].Reactions = nil
+	}
+	return s.attachReactions(ctx, chatID, messages)
+}
+
+// fetchMessagesWhere returns a chat's messages, without reactions, that
+// also match cond, oldest first, with their reactions attached.
+func (s *Store) fetchMessagesWhere(ctx context.Context, chatID int, cond string, condArgs ...interface{}) ([]Message, error) {
+	join, where, args := chatMessages(chatID)
+	where += s.skipReactions() + cond
+	args = append(args, condArgs...)
+
+	query := `
+		SELECT ` + s.messageColumns() + `
+		FROM message m
+		` + join + `
+		LEFT JOIN handle h ON m.handle_id = h.ROWID
+		LEFT JOIN message_attachment_join maj ON maj.message_id = m.ROWID
+		LEFT JOIN attachment a ON maj.attachment_id = a.ROWID
+		WHERE ` + where + `
+		GROUP BY m.ROWID
+		ORDER BY m.date ASC, m.ROWID ASC
+	`
+
+	rows, err := s.queryWithRetry(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := ClassifyError(rows.Err()); err != nil {
+		return nil, err
+	}
+
+	if err := s.attachReactions(ctx, chatID, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (s *Store) FetchAllMessages(ctx context.Context, chatID int) ([]Message, error) {
+	return s.FetchMessagesBetween(ctx, chatID, time.Time{}, time.Time{})
+}
+
+// FetchMessagesBetween returns a chat's messages sent between from and to,
+// inclusive, oldest first. A zero bound leaves that end open.
+func (s *Store) FetchMessagesBetween(ctx context.Context, chatID int, from, to time.Time) ([]Message, error) {
+	join, where, args := chatMessages(chatID)
+	where += s.skipReactions()
+	if !from.IsZero() {
+		where += " AND m.date >= ?"
+		args = append(args, timeToAppleNanos(from))
+	}
+	if !to.IsZero() {
+		where += " AND m.date <= ?"
+		args = append(args, timeToAppleNanos(to))
+	}
+
+	query := `
+		SELECT ` + s.messageColumns() + `
+		FROM message m
+		` + join + `
+		LEFT JOIN handle h ON m.handle_id = h.ROWID
+		LEFT JOIN message_attachment_join maj ON maj.message_id = m.ROWID
+		LEFT JOIN attachment a ON maj.attachment_id = a.ROWID
+		WHERE ` + where + `
+		GROUP BY m.ROWID
+		ORDER BY m.date ASC
+	`
+
+	rows, err := s.queryWithRetry(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := ClassifyError(rows.Err()); err != nil {
+		return nil, err
+	}
+	if err := s.attachReactions(ctx, chatID, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// FetchThread returns an inline reply thread: the message with
+// originatorGUID followed by every reply to it, oldest first. On schemas
+// without thread_originator_guid there are no replies, so only the
+// originating message is returned.
+func (s *Store) FetchThread(ctx context.Context, originatorGUID string) ([]Message, error) {
+	where := "m.guid = ?"
+	args := []interface{}{originatorGUID}
+	if s.schema.has("message", "thread_originator_guid") {
+		where = "(m.guid = ? OR m.thread_originator_guid = ?)"
+		args = append(args, originatorGUID)
+	}
+
+	query := `
+		SELECT ` + s.messageColumns() + `
+		FROM message m
+		LEFT JOIN handle h ON m.handle_id = h.ROWID
+		LEFT JOIN message_attachment_join maj ON maj.message_id = m.ROWID
+		LEFT JOIN attachment a ON maj.attachment_id = a.ROWID
+		WHERE ` + where + s.skipReactions() + `
+		GROUP BY m.ROWID
+		ORDER BY m.date ASC
+	`
+
+	rows, err := s.queryWithRetry(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := ClassifyError(rows.Err()); err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	var chatID int
+	err = s.queryRowWithRetry(ctx, `SELECT chat_id FROM chat_message_join WHERE message_id = ?`,
+		[]interface{}{messages[0].ROWID}, &chatID)
+	if err == sql.ErrNoRows {
+		return messages, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachReactions(ctx, chatID, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// FetchMessagesByGUID looks up messages by guid, for showing what a reply
+// quotes when the original isn't on a loaded page. Reactions are not
+// attached. Unknown guids are left out of the result.
+func (s *Store) FetchMessagesByGUID(ctx context.Context, guids []string) (map[string]Message, error) {
+	found := map[string]Message{}
+	if len(guids) == 0 {
+		return found, nil
+	}
+	args := make([]interface{}, len(guids))
+	for i, g := range guids {
+		args[i] = g
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(guids)), ",")
+
+	query := `
+		SELECT ` + s.messageColumns() + `
+		FROM message m
+		LEFT JOIN handle h ON m.handle_id = h.ROWID
+		LEFT JOIN message_attachment_join maj ON maj.message_id = m.ROWID
+		LEFT JOIN attachment a ON maj.attachment_id = a.ROWID
+		WHERE m.guid IN (` + placeholders + `)
+		GROUP BY m.ROWID
+	`
+
+	rows, err := s.queryWithRetry(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		found[msg.GUID] = msg
+	}
+	return found, ClassifyError(rows.Err())
+}
+
+// GroupEventKind is the kind of change a GroupEvent records.
+type GroupEventKind int
+
+const (
+	MemberAdded GroupEventKind = iota
+	MemberRemoved
+	MemberLeft
+	GroupRenamed
+)
+
+// GroupEvent is one change to a group chat's members or name.
+type GroupEvent struct {
+	Date     time.Time
+	Kind     GroupEventKind
+	IsFromMe bool   // I made the change (or, for MemberLeft, I left)
+	Actor    string // handle of who made the change; "" when IsFromMe or unrecorded
+	Member   string // handle added or removed; "" when unrecorded
+	Title    string // the new name, for GroupRenamed
+}
+
+// GroupEvents returns a chat's membership and name changes, oldest first.
+// Messages records them as message rows with no text: item_type 1 is a
+// member added (group_action_type 0) or removed (1), with other_handle
+// naming the member; item_type 2 is a rename to group_title; item_type 3
+// with group_action_type 0 is the sender leaving. Returns nil on schemas
+// without item_type.
+func (s *Store) GroupEvents(ctx context.Context, chatID int) ([]GroupEvent, error) {
+	if !s.schema.has("message", "item_type") {
+		return nil, nil
+	}
+	join, where, args := chatMessages(chatID)
+	query := `
+		SELECT m.date, m.item_type,
+		       ` + s.schema.optional("message", "group_action_type", "COALESCE(m.group_action_type, 0)", "0") + `,
+		       m.is_from_me, COALESCE(h.id, ''), COALESCE(oh.id, ''),
+		       ` + s.schema.optional("message", "group_title", "COALESCE(m.group_title, '')", "''") + `
+		FROM message m
+		` + join + `
+		LEFT JOIN handle h ON m.handle_id = h.ROWID
+		LEFT JOIN handle oh ON oh.ROWID = ` + s.schema.optional("message", "other_handle", "m.other_handle", "NULL") + `
+		WHERE ` + where + ` AND m.item_type IN (1, 2, 3)
+		ORDER BY m.date ASC, m.ROWID ASC
+	`
+	rows, err := s.queryWithRetry(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []GroupEvent
+	for rows.Next() {
+		var e GroupEvent
+		var dateNanos int64
+		var itemType, action int
+		if err := rows.Scan(&dateNanos, &itemType, &action, &e.IsFromMe, &e.Actor, &e.Member, &e.Title); err != nil {
+			return nil, err
+		}
+		switch {
+		case itemType == 1 && action == 0:
+			e.Kind = MemberAdded
+		case itemType == 1 && action == 1:
+			e.Kind = MemberRemoved
+		case itemType == 2:
+			e.Kind = GroupRenamed
+		case itemType == 3 && action == 0:
+			e.Kind = MemberLeft
+		default:
+			// Photo changes and other group actions
+			continue
+		}
+		if e.IsFromMe {
+			e.Actor = ""
+		}
+		e.Date = appleNanosToTime(dateNanos)
+		events = append(events, e)
+	}
+	return events, ClassifyError(rows.Err())
+}
+
+// MessageDetail is everything known about a single message, for debugging
+// and forensic use.
+type MessageDetail struct {
+	Message
+	ChatID int              // 0 when the message isn't joined to a chat
+	Files  []ChatAttachment // attachments with their full paths and MIME types
+}
+
+// FetchMessageDetail loads one message by ROWID, with its tapbacks and the
+// full attachment records. found is false if there is no such message.
+func (s *Store) FetchMessageDetail(ctx context.Context, rowid int) (detail MessageDetail, found bool, err error) {
+	query := `
+		SELECT ` + s.messageColumns() + `
+		FROM message m
+		LEFT JOIN handle h ON m.handle_id = h.ROWID
+		LEFT JOIN message_attachment_join maj ON maj.message_id = m.ROWID
+		LEFT JOIN attachment a ON maj.attachment_id = a.ROWID
+		WHERE m.ROWID = ?
+		GROUP BY m.ROWID
+	`
+	rows, err := s.queryWithRetry(ctx, query, rowid)
+	if err != nil {
+		return detail, false, err
+	}
+	if rows.Next() {
+		detail.Message, err = scanMessage(rows)
+		found = err == nil
+	} else {
+		err = ClassifyError(rows.Err())
+	}
+	rows.Close()
+	if !found {
+		return detail, false, err
+	}
+
+	err = s.queryRowWithRetry(ctx, `SELECT chat_id FROM chat_message_join WHERE message_id = ?`,
+		[]interface{}{rowid}, &detail.ChatID)
+	if err != nil && err != sql.ErrNoRows {
+		return detail, true, err
+	}
+	if detail.ChatID != 0 {
+		messages := []Message{detail.Message}
+		if err := s.attachReactions(ctx, detail.ChatID, messages); err != nil {
+			return detail, true, err
+		}
+		detail.Message = messages[0]
+	}
+
+	detail.Files, err = s.queryAttachmentsWhere(ctx, attachmentChats, "WHERE m.ROWID = ?", []interface{}{rowid}, 0)
+	return detail, true, err
+}
+
+// skipReactions is a WHERE fragment excluding tapback rows, which are
+// attached to their target message instead of listed on their own.
+func (s *Store) skipReactions() string {
+	return s.schema.optional("message", "associated_message_type",
+		" AND COALESCE(m.associated_message_type, 0) NOT BETWEEN 2000 AND 3999", "")
+}
+
+// hasText is a condition on m that holds for messages with text: not
+// reactions, and not attachment-only messages, whose text is empty or just
+// the U+FFFC placeholder Messages puts where the attachment goes. Newer
+// macOS versions often leave text NULL and keep the body only in
+// attributedBody, so a message with an attributedBody and no attachments
+// counts too.
+func (s *Store) hasText() string {
+	body := s.schema.optional("message", "attributedBody",
+		` OR (COALESCE(m.text, '') = '' AND LENGTH(m.attributedBody) > 0
+			AND NOT EXISTS (SELECT 1 FROM message_attachment_join maj WHERE maj.message_id = m.ROWID))`, "")
+	return "(TRIM(COALESCE(m.text, ''), char(65532)) <> ''" + body + ")" +
+		s.schema.optional("message", "associated_message_type",
+			" AND COALESCE(m.associated_message_type, 0) NOT BETWEEN 2000 AND 3999", "")
+}
+
+// attachReactions loads the tapbacks on messages (in chronological order)
+// and fills in each message's Reactions. Removals (types 3000–3006) cancel
+// the sender's earlier tapback, and a new tapback replaces the sender's
+// previous one, so only current reactions remain.
+func (s *Store) attachReactions(ctx context.Context, chatID int, messages []Message) error {
+	if len(messages) == 0 || !s.schema.has("message", "associated_message_type") {
+		return nil
+	}
+	byGUID := make(map[string]int, len(messages))
+	for i, msg := range messages {
+		byGUID[msg.GUID] = i
+	}
+	// Each message's tapbacks are all in the batch holding it, so they
+	// still apply in order
+	for lo := 0; lo < len(messages); lo += reactionBatch {
+		if err := s.attachReactionBatch(ctx, chatID, messages, byGUID, messages[lo:min(lo+reactionBatch, len(messages))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reactionBatch is how many messages attachReactions looks up tapbacks for
+// per query, keeping well under SQLite's limit on bound parameters.
+const reactionBatch = 500
+
+// reactionTargetSQL strips the part prefix from m.associated_message_guid
+// ("p:0/GUID" or "bp:GUID") to get the guid of the message a tapback row
+// reacts to. Guids contain neither "/" nor ":".
+const reactionTargetSQL = `CASE
+		WHEN instr(m.associated_message_guid, '/') > 0 THEN substr(m.associated_message_guid, instr(m.associated_message_guid, '/') + 1)
+		WHEN instr(m.associated_message_guid, ':') > 0 THEN substr(m.associated_message_guid, instr(m.associated_message_guid, ':') + 1)
+		ELSE m.associated_message_guid
+	END`
+
+// attachReactionBatch applies the tapbacks on batch, some of messages, to
+// messages. Only tapbacks targeting the batch are read, however far the
+// chat goes on after it.
+func (s *Store) attachReactionBatch(ctx context.Context, chatID int, messages []Message, byGUID map[string]int, batch []Message) error {
+	join, where, args := chatMessages(chatID)
+	for _, msg := range batch {
+		args = append(args, msg.GUID)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+	query := `
+		SELECT ` + reactionTargetSQL + `, m.associated_message_type,
+		       ` + s.schema.optional("message", "associated_message_emoji", "COALESCE(m.associated_message_emoji, '')", "''") + `,
+		       m.is_from_me, COALESCE(h.id, '')
+		FROM message m
+		` + join + `
+		LEFT JOIN handle h ON m.handle_id = h.ROWID
+		WHERE ` + where + `
+		  AND m.associated_message_type BETWEEN 2000 AND 3999
+		  AND ` + reactionTargetSQL + ` IN (` + placeholders + `)
+		ORDER BY m.date ASC, m.ROWID ASC
+	`
+	rows, err := s.queryWithRetry(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var target string
+		var r Reaction
+		if err := rows.Scan(&target, &r.Type, &r.Emoji, &r.IsFromMe, &r.Sender); err != nil {
+			return err
+		}
+		i, ok := byGUID[target]
+		if !ok {
+			continue
+		}
+		if r.IsFromMe {
+			r.Sender = ""
+		}
+		msg := &messages[i]
+		kept := msg.Reactions[:0]
+		for _, prev := range msg.Reactions {
+			if prev.IsFromMe != r.IsFromMe || prev.Sender != r.Sender {
+				kept = append(kept, prev)
+			}
+		}
+		msg.Reactions = kept
+		if r.Type < 3000 {
+			msg.Reactions = append(msg.Reactions, r)
+		}
+	}
+	return ClassifyError(rows.Err())
+}
+
+func (s *Store) SearchMessages(ctx context.Context, term string, limit int) ([]SearchResult, error) {
+	return s.SearchMessagesBetween(ctx, term, time.Time{}, time.Time{}, limit, false)
+}
+
+// SearchMessagesFolded is SearchMessages ignoring case and diacritics, so
+// "jose" matches "José" and "cafe" matches "café".
+func (s *Store) SearchMessagesFolded(ctx context.Context, term string, limit int) ([]SearchResult, error) {
+	return s.SearchMessagesBetween(ctx, term, time.Time{}, time.Time{}, limit, true)
+}
+
+// SearchMessagesBetween is SearchMessages limited to messages sent between
+// from and to, inclusive, folding case and diacritics when fold is set. A
+// zero bound leaves that end open.
+func (s *Store) SearchMessagesBetween(ctx context.Context, term string, from, to time.Time, limit int, fold bool) ([]SearchResult, error) {
+	return s.SearchMessagesScoped(ctx, term, ScopeAll, from, to, limit, fold)
+}
+
+// Values of chat.style.
+const (
+	ChatStyleGroup  = 43
+	ChatStyleDirect = 45
+)
+
+// ChatScope limits a search to one kind of conversation.
+type ChatScope int
+
+const (
+	ScopeAll    ChatScope = iota
+	ScopeDirect           // one-to-one chats
+	ScopeGroups           // group chats
+)
+
+func (sc ChatScope) String() string {
+	switch sc {
+	case ScopeDirect:
+		return "direct chats"
+	case ScopeGroups:
+		return "group chats"
+	default:
+		return "all chats"
+	}
+}
+
+// SearchMessagesScoped is SearchMessagesBetween limited to the chats in
+// scope, going by chat.style.
+func (s *Store) SearchMessagesScoped(ctx context.Context, term string, scope ChatScope, from, to time.Time, limit int, fold bool) ([]SearchResult, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var conds []string
+	var args []interface{}
+	positive := false
+	for _, c := range ParseQuery(term) {
+		cond, arg := "COALESCE(m.text, '') LIKE '%' || ? || '%'", c.Text
+		switch {
+		case c.Exact:
+			cond = "instr(COALESCE(m.text, ''), ?) > 0"
+		case fold:
+			cond, arg = "fold(COALESCE(m.text, '')) LIKE '%' || ? || '%'", foldText(c.Text)
+		}
+		if c.Negate {
+			cond = "NOT (" + cond + ")"
+		} else {
+			positive = true
+		}
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	if !positive {
+		// Only exclusions would match nearly every message
+		return nil, nil
+	}
+	if !from.IsZero() {
+		conds = append(conds, "m.date >= ?")
+		args = append(args, timeToAppleNanos(from))
+	}
+	if !to.IsZero() {
+		conds = append(conds, "m.date <= ?")
+		args = append(args, timeToAppleNanos(to))
+	}
+	switch scope {
+	case ScopeDirect:
+		conds = append(conds, "c.style = ?")
+		args = append(args, ChatStyleDirect)
+	case ScopeGroups:
+		conds = append(conds, "c.style = ?")
+		args = append(args, ChatStyleGroup)
+	}
+	args = append(args, limit)
+
+	query := `
+		SELECT m.ROWID, COALESCE(m.text, ''), m.date, m.is_from_me,
+		       COALESCE(h.id, ''), COALESCE(m.service, ''),
+		       c.ROWID, COALESCE(NULLIF(c.display_name, ''), c.chat_identifier)
+		FROM message m
+		JOIN chat_message_join cmj ON cmj.message_id = m.ROWID
+		JOIN chat c ON cmj.chat_id = c.ROWID
+		LEFT JOIN handle h ON m.handle_id = h.ROWID
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY m.date DESC
+		LIMIT ?
+	`
+
+	rows, err := s.queryWithRetry(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		var dateNanos int64
+		err := rows.Scan(&r.ROWID, &r.Text, &dateNanos, &r.IsFromMe, &r.Sender, &r.Service,
+			&r.ChatID, &r.ChatName)
+		if err != nil {
+			return nil, err
+		}
+		r.Date = appleNanosToTime(dateNanos)
+		r.RawDate = dateNanos
+		results = append(results, r)
+	}
+	if err := ClassifyError(rows.Err()); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// QueryClause is one part of a search query, as split by ParseQuery.
+type QueryClause struct {
+	Text   string
+	Exact  bool // quoted: match the phrase as typed, case included
+	Negate bool // prefixed with -: exclude messages that match
+}
+
+// ParseQuery splits a search query into clauses, all of which a message
+// must satisfy. Each plain word is its own clause, matching as a
+// case-insensitive substring anywhere in the message, so "lunch downtown"
+// finds both words in any order. "Double quotes" make an exact,
+// case-sensitive phrase, and a leading - excludes the word or quoted phrase
+// after it. Words made only of hyphens are ignored.
+func ParseQuery(q string) []QueryClause {
+	var clauses []QueryClause
+	i := 0
+	for i < len(q) {
+		if q[i] == ' ' || q[i] == '\t' {
+			i++
+			continue
+		}
+		start := i
+		negate := false
+		if q[i] == '-' && i+1 < len(q) && q[i+1] != ' ' && q[i+1] != '\t' {
+			negate = true
+			i++
+		}
+		if q[i] == '"' {
+			end := strings.IndexByte(q[i+1:], '"')
+			var phrase string
+			if end < 0 {
+				phrase, i = q[i+1:], len(q)
+			} else {
+				phrase, i = q[i+1:i+1+end], i+end+2
+			}
+			if phrase != "" {
+				clauses = append(clauses, QueryClause{Text: phrase, Exact: true, Negate: negate})
+			}
+			continue
+		}
+		for i < len(q) && q[i] != ' ' && q[i] != '\t' {
+			i++
+		}
+		if strings.Trim(q[start:i], "-") == "" {
+			// A lone - (or --) is punctuation, not a search for hyphens
+			continue
+		}
+		if negate {
+			clauses = append(clauses, QueryClause{Text: q[start+1 : i], Negate: true})
+			continue
+		}
+		clauses = append(clauses, QueryClause{Text: q[start:i]})
+	}
+	return clauses
+}
+
+// foldText lowercases s and strips combining marks, so "José" becomes "jose".
+func foldText(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+	return strings.ToLower(folded)
+}
+
+func init() {
+	// fold(text) lets queries compare text with case and diacritics folded.
+	// Registered at init so it exists on every connection the driver opens.
+	sqlite.MustRegisterDeterministicScalarFunction("fold", 1,
+		func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			switch v := args[0].(type) {
+			case string:
+				return foldText(v), nil
+			case []byte:
+				return foldText(string(v)), nil
+			default:
+				return v, nil
+			}
+		})
+}
+
+func expandTilde(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			return home + path[1:]
+		}
+	}
+	return path
+}
+
+func (s *Store) FetchChatAttachments(ctx context.Context, chatID int) ([]ChatAttachment, error) {
+	return s.queryAttachments(ctx, chatID, 0)
+}
+
+// FetchAllAttachments returns the most recent attachments across every chat,
+// newest first, up to limit.
+func (s *Store) FetchAllAttachments(ctx context.Context, limit int) ([]ChatAttachment, error) {
+	if limit <= 0 {
+		limit = GlobalAttachmentLimit
+	}
+	return s.queryAttachments(ctx, 0, limit)
+}
+
+// queryAttachments lists attachments newest first, restricted to one chat
+// when chatID is non-zero and to limit rows when limit is positive.
+func (s *Store) queryAttachments(ctx context.Context, chatID int, limit int) ([]ChatAttachment, error) {
+	if chatID != 0 {
+		join, where, args := chatMessages(chatID)
+		// Orphaned messages have no chat row to join
+		join += " LEFT JOIN chat c ON cmj.chat_id = c.ROWID"
+		return s.queryAttachmentsWhere(ctx, join, "WHERE "+where, args, limit)
+	}
+	return s.queryAttachmentsWhere(ctx, attachmentChats, "", nil, limit)
+}
+
+// attachmentChats joins each attachment's message to the chats it's in,
+// for queryAttachmentsWhere.
+const attachmentChats = "JOIN chat_message_join cmj ON cmj.message_id = m.ROWID JOIN chat c ON cmj.chat_id = c.ROWID"
+
+// queryAttachmentsWhere runs the attachment query with an optional WHERE
+// clause over a (attachment), maj, m (message), h (handle), and the cmj and
+// c (chat) that join brings in, newest first. Attachments with no chat row
+// get OrphanChatID.
+func (s *Store) queryAttachmentsWhere(ctx context.Context, join, where string, args []interface{}, limit int) ([]ChatAttachment, error) {
+	var tail string
+	if limit > 0 {
+		tail = "LIMIT ?"
+		args = append(args, limit)
+	}
+	query := `
+		SELECT a.ROWID, COALESCE(a.filename, ''), COALESCE(a.transfer_name, ''),
+		       COALESCE(a.mime_type, ''), COALESCE(a.total_bytes, 0),
+		       m.date, m.is_from_me, COALESCE(h.id, ''),
+		       COALESCE(c.ROWID, ` + strconv.Itoa(OrphanChatID) + `), COALESCE(NULLIF(c.display_name, ''), c.chat_identifier, ''),
+		       ` + s.schema.optional("attachment", "transfer_state", "a.transfer_state", "NULL") + `
+		FROM attachment a
+		JOIN message_attachment_join maj ON maj.attachment_id = a.ROWID
+		JOIN message m ON maj.message_id = m.ROWID
+		` + join + `
+		LEFT JOIN handle h ON m.handle_id = h.ROWID
+		` + where + `
+		ORDER BY m.date DESC
+		` + tail + `
+	`
+
+	rows, err := s.queryWithRetry(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []ChatAttachment
+	for rows.Next() {
+		var a ChatAttachment
+		var dateNanos int64
+		var transferState sql.NullInt64
+		err := rows.Scan(&a.ROWID, &a.FilePath, &a.Filename, &a.MimeType, &a.Size,
+			&dateNanos, &a.IsFromMe, &a.Sender, &a.ChatID, &a.ChatName, &transferState)
+		if err != nil {
+			return nil, err
+		}
+		a.Date = appleNanosToTime(dateNanos)
+		a.TypeLabel = attachmentLabel(a.MimeType)
+		a.FilePath = expandTilde(a.FilePath)
+		a.State = attachmentState(a.FilePath, a.Size, transferState)
+		attachments = append(attachments, a)
+	}
+	if err := ClassifyError(rows.Err()); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// DistinctHandles returns every handle identifier in the database with the
+// number of messages received from it, most active first. Handles that exist
+// for more than one service (SMS and iMessage) are merged.
+func (s *Store) DistinctHandles(ctx context.Context) ([]HandleCount, error) {
+	query := `
+		SELECT h.id, COUNT(m.ROWID) AS msg_count
+		FROM handle h
+		LEFT JOIN message m ON m.handle_id = h.ROWID
+		GROUP BY h.id
+		ORDER BY msg_count DESC, h.id ASC
+	`
+
+	rows, err := s.queryWithRetry(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var handles []HandleCount
+	for rows.Next() {
+		var h HandleCount
+		if err := rows.Scan(&h.Handle, &h.MessageCount); err != nil {
+			return nil, err
+		}
+		handles = append(handles, h)
+	}
+	if err := ClassifyError(rows.Err()); err != nil {
+		return nil, err
+	}
+	return handles, nil
+}
+
+// MatchHandle finds handle among handles, ignoring case, and for phone
+// numbers comparing normalized digits, so "+1 (555) 123-4567" matches
+// "+15551234567".
+func MatchHandle(handles []HandleCount, handle string) (HandleCount, bool) {
+	for _, h := range handles {
+		if strings.EqualFold(h.Handle, handle) {
+			return h, true
+		}
+		if !strings.Contains(handle, "@") {
+			if digits := normalizePhone(handle); digits != "" && normalizePhone(h.Handle) == digits {
+				return h, true
+			}
+		}
+	}
+	return HandleCount{}, false
+}
+
+// FindChatByHandle returns the chat that includes the given handle. When the
+// handle is in several chats, the one with the fewest participants wins (a
+// direct conversation over a group), then the most recently created.
+// Phone numbers are matched on normalized digits, so "+1 (555) 123-4567"
+// finds "+15551234567".
+func (s *Store) FindChatByHandle(ctx context.Context, handle string) (int, bool, error) {
+	handles, err := s.DistinctHandles(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	h, ok := MatchHandle(handles, handle)
+	if !ok {
+		return 0, false, nil
+	}
+	match := h.Handle
+
+	query := `
+		SELECT c.ROWID
+		FROM chat c
+		JOIN chat_handle_join chj ON chj.chat_id = c.ROWID
+		JOIN handle h ON chj.handle_id = h.ROWID
+		WHERE h.id = ?
+		ORDER BY (SELECT COUNT(*) FROM chat_handle_join x WHERE x.chat_id = c.ROWID) ASC,
+		         c.ROWID DESC
+		LIMIT 1
+	`
+	var chatID int
+	err = s.queryRowWithRetry(ctx, query, []interface{}{match}, &chatID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return chatID, true, nil
+}
+
+// MessagesPerDay returns the message count for each local calendar day with
+// at least one message in the chat, oldest first.
+func (s *Store) MessagesPerDay(ctx context.Context, chatID int) ([]DayCount, error) {
+	join, where, args := chatMessages(chatID)
+	query := `
+		SELECT date(m.date / 1000000000 + 978307200, 'unixepoch', 'localtime') AS day,
+		       COUNT(*)
+		FROM message m
+		` + join + `
+		WHERE ` + where + `
+		GROUP BY day
+		ORDER BY day ASC
+	`
+
+	rows, err := s.queryWithRetry(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []DayCount
+	for rows.Next() {
+		var day string
+		var dc DayCount
+		if err := rows.Scan(&day, &dc.Count); err != nil {
+			return nil, err
+		}
+		dc.Day, err = time.ParseInLocation("2006-01-02", day, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, dc)
+	}
+	if err := ClassifyError(rows.Err()); err != nil {
+		return nil, err
+	}
+	return days, nil
+}
+
+// DatabaseSummary counts conversations, messages (excluding tapbacks) and
+// attachments, and finds the date span of all messages, in one query.
+func (s *Store) DatabaseSummary(ctx context.Context) (DatabaseSummary, error) {
+	var sum DatabaseSummary
+	var first, last int64
+	query := `
+		SELECT (SELECT COUNT(*) FROM chat),
+		       COUNT(*),
+		       (SELECT COUNT(*) FROM attachment),
+		       COALESCE(MIN(NULLIF(m.date, 0)), 0),
+		       COALESCE(MAX(m.date), 0)
+		FROM message m
+		WHERE 1 = 1` + s.skipReactions() + `
+	`
+	err := s.queryRowWithRetry(ctx, query, nil, &sum.Conversations, &sum.Messages, &sum.Attachments, &first, &last)
+	if err != nil {
+		return DatabaseSummary{}, err
+	}
+	sum.First = appleNanosToTime(first)
+	sum.Last = appleNanosToTime(last)
+	return sum, nil
+}
+
+// MessageHourHistogram counts a chat's messages by local day of week
+// (0 = Sunday) and hour of day.
+func (s *Store) MessageHourHistogram(ctx context.Context, chatID int) ([7][24]int, error) {
+	var hist [7][24]int
+	join, where, args := chatMessages(chatID)
+	query := `
+		SELECT CAST(strftime('%w', m.date / 1000000000 + 978307200, 'unixepoch', 'localtime') AS INTEGER) AS dow,
+		       CAST(strftime('%H', m.date / 1000000000 + 978307200, 'unixepoch', 'localtime') AS INTEGER) AS hour,
+		       COUNT(*)
+		FROM message m
+		` + join + `
+		WHERE ` + where + s.skipReactions() + `
+		GROUP BY dow, hour
+	`
+
+	rows, err := s.queryWithRetry(ctx, query, args...)
+	if err != nil {
+		return hist, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dow, hour, count int
+		if err := rows.Scan(&dow, &hour, &count); err != nil {
+			return hist, err
+		}
+		if dow >= 0 && dow < 7 && hour >= 0 && hour < 24 {
+			hist[dow][hour] = count
+		}
+	}
+	if err := ClassifyError(rows.Err()); err != nil {
+		return hist, err
+	}
+	return hist, nil
+}
+
+// SearchAttachments finds attachments whose friendly type (as produced by
+// attachmentLabel, e.g. "PDF", "video"), mime type (e.g. "image/heic") or
+// mime subtype ("heic") is typeLabel, case-insensitively, grouped by
+// conversation. Groups are ordered by their newest match; at most limit
+// attachments are returned in total.
+func (s *Store) SearchAttachments(ctx context.Context, typeLabel string, limit int) ([]AttachmentGroup, error) {
+	if limit <= 0 {
+		limit = GlobalAttachmentLimit
+	}
+	want := strings.ToLower(strings.TrimSpace(typeLabel))
+	if want == "" {
+		return nil, nil
+	}
+
+	where := "WHERE (LOWER(" + attachmentLabelSQL + ") = ? OR " + mimeTypeSQL + " = ? OR " +
+		"substr(" + mimeTypeSQL + ", instr(" + mimeTypeSQL + ", '/') + 1) = ?)"
+	matches, err := s.queryAttachmentsWhere(ctx, attachmentChats, where, []interface{}{want, want, want}, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []AttachmentGroup
+	index := map[int]int{} // chat id → position in groups
+	for _, a := range matches {
+		i, ok := index[a.ChatID]
+		if !ok {
+			i = len(groups)
+			index[a.ChatID] = i
+			groups = append(groups, AttachmentGroup{ChatID: a.ChatID, ChatName: a.ChatName})
+		}
+		groups[i].Attachments = append(groups[i].Attachments, a)
+	}
+	return groups, nil
+}
+
+// mimeTypeSQL is an attachment's mime type as attachmentLabel sees it.
+const mimeTypeSQL = "LOWER(TRIM(COALESCE(a.mime_type, '')))"
+
+// attachmentLabelSQL is attachmentLabel in SQL, so queries can match on
+// the friendly type without loading every attachment. The two must agree.
+const attachmentLabelSQL = `CASE
+		WHEN ` + mimeTypeSQL + ` IN ('image/jpeg', 'image/jpg', 'image/heic', 'image/heif') THEN 'photo'
+		WHEN ` + mimeTypeSQL + ` = 'image/gif' THEN 'GIF'
+		WHEN ` + mimeTypeSQL + ` LIKE 'image/%' THEN 'image'
+		WHEN ` + mimeTypeSQL + ` LIKE 'video/%' THEN 'video'
+		WHEN ` + mimeTypeSQL + ` LIKE 'audio/%' THEN 'audio'
+		WHEN ` + mimeTypeSQL + ` = 'application/pdf' THEN 'PDF'
+		WHEN ` + mimeTypeSQL + ` = 'text/vcard' THEN 'contact card'
+		WHEN ` + mimeTypeSQL + ` = 'text/x-markdown' THEN 'markdown'
+		WHEN instr(` + mimeTypeSQL + `, 'zip') > 0 OR instr(` + mimeTypeSQL + `, 'archive') > 0 THEN 'archive'
+		WHEN instr(` + mimeTypeSQL + `, 'iwork-numbers') > 0 THEN 'Numbers spreadsheet'
+		WHEN instr(` + mimeTypeSQL + `, 'iwork-pages') > 0 THEN 'Pages document'
+		WHEN instr(` + mimeTypeSQL + `, 'iwork-keynote') > 0 THEN 'Keynote presentation'
+		WHEN ` + mimeTypeSQL + ` = '' THEN 'attachment'
+		ELSE 'file'
+	END`
@@ -0,0 +1,1894 @@
+package chatdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb/chatdbtest"
+)
+
+func TestFetchConversations(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	convs, err := store.FetchConversations(t.Context())
+	if err != nil {
+		t.Fatalf("FetchConversations: %v", err)
+	}
+
+	if len(convs) != 3 {
+		t.Fatalf("expected 3 conversations, got %d", len(convs))
+	}
+
+	// Conversations are ordered by last message date DESC.
+	// Chat 3 has the latest messages (offset +40..+47 min),
+	// Chat 2 next (offset +20..+24 min), Chat 1 first (offset +0..+9 min).
+
+	t.Run("order", func(t *testing.T) {
+		if convs[0].ChatID != 3 {
+			t.Errorf("expected first conv to be chat 3 (latest), got chat %d", convs[0].ChatID)
+		}
+		if convs[1].ChatID != 2 {
+			t.Errorf("expected second conv to be chat 2, got chat %d", convs[1].ChatID)
+		}
+		if convs[2].ChatID != 1 {
+			t.Errorf("expected third conv to be chat 1, got chat %d", convs[2].ChatID)
+		}
+	})
+
+	t.Run("identifiers", func(t *testing.T) {
+		if convs[0].GUID != "chat3" || convs[0].Identifier != "chat100200300" {
+			t.Errorf("chat 3: got GUID %q, identifier %q", convs[0].GUID, convs[0].Identifier)
+		}
+	})
+
+	t.Run("last_message_text", func(t *testing.T) {
+		want := map[int]string{
+			1: "No worries, I just got here",
+			2: "You're welcome",
+			3: "See you all tonight!",
+		}
+		for _, c := range convs {
+			if c.LastMessageText != want[c.ChatID] {
+				t.Errorf("chat %d: got %q, want %q", c.ChatID, c.LastMessageText, want[c.ChatID])
+			}
+		}
+	})
+
+	t.Run("message_counts", func(t *testing.T) {
+		// Find each chat by ID
+		counts := map[int]int{}
+		sent := map[int]int{}
+		recv := map[int]int{}
+		for _, c := range convs {
+			counts[c.ChatID] = c.MessageCount
+			sent[c.ChatID] = c.SentCount
+			recv[c.ChatID] = c.ReceivedCount
+		}
+		if counts[1] != 10 {
+			t.Errorf("chat 1: expected 10 messages, got %d", counts[1])
+		}
+		if counts[2] != 5 {
+			t.Errorf("chat 2: expected 5 messages, got %d", counts[2])
+		}
+		if counts[3] != 8 {
+			t.Errorf("chat 3: expected 8 messages, got %d", counts[3])
+		}
+		if sent[1] != 5 {
+			t.Errorf("chat 1: expected 5 sent, got %d", sent[1])
+		}
+		if recv[1] != 5 {
+			t.Errorf("chat 1: expected 5 received, got %d", recv[1])
+		}
+	})
+
+	t.Run("participants", func(t *testing.T) {
+		for _, c := range convs {
+			switch c.ChatID {
+			case 1:
+				if len(c.Participants) != 1 || c.Participants[0] != "+15551234567" {
+					t.Errorf("chat 1 participants: %v", c.Participants)
+				}
+			case 2:
+				if len(c.Participants) != 1 || c.Participants[0] != "jane@example.com" {
+					t.Errorf("chat 2 participants: %v", c.Participants)
+				}
+			case 3:
+				if len(c.Participants) != 2 {
+					t.Errorf("chat 3: expected 2 participants, got %d", len(c.Participants))
+				}
+			}
+		}
+	})
+
+	t.Run("group_chat", func(t *testing.T) {
+		for _, c := range convs {
+			if c.ChatID == 3 {
+				if c.DisplayName != "Family Group" {
+					t.Errorf("chat 3 display name: got %q, want %q", c.DisplayName, "Family Group")
+				}
+				if c.Style != 16 {
+					t.Errorf("chat 3 style: got %d, want 16", c.Style)
+				}
+			}
+		}
+	})
+
+	t.Run("dates", func(t *testing.T) {
+		for _, c := range convs {
+			if c.FirstMsgDate.IsZero() {
+				t.Errorf("chat %d: FirstMsgDate is zero", c.ChatID)
+			}
+			if c.LastMsgDate.IsZero() {
+				t.Errorf("chat %d: LastMsgDate is zero", c.ChatID)
+			}
+			if !c.FirstMsgDate.Before(c.LastMsgDate) {
+				t.Errorf("chat %d: FirstMsgDate (%v) not before LastMsgDate (%v)",
+					c.ChatID, c.FirstMsgDate, c.LastMsgDate)
+			}
+		}
+	})
+}
+
+func TestFetchConversationsGroupSenders(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	// An SMS group with no name and no recorded participants
+	db.Exec(`UPDATE chat SET style = ?, display_name = '' WHERE ROWID = 3`, ChatStyleGroup)
+	db.Exec(`DELETE FROM chat_handle_join WHERE chat_id = 3`)
+
+	convs, err := store.FetchConversations(t.Context())
+	if err != nil {
+		t.Fatalf("FetchConversations: %v", err)
+	}
+	for _, c := range convs {
+		switch c.ChatID {
+		case 3:
+			if want := []string{"+15551234567", "+15559876543"}; !reflect.DeepEqual(c.Senders, want) {
+				t.Errorf("group senders = %q, want %q", c.Senders, want)
+			}
+		default:
+			if c.Senders != nil {
+				t.Errorf("chat %d has participants, so no senders: %q", c.ChatID, c.Senders)
+			}
+		}
+	}
+}
+
+func TestFetchMessages(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	t.Run("basic", func(t *testing.T) {
+		msgs, err := store.FetchMessages(t.Context(), 1, MessageCursor{}, 200)
+		if err != nil {
+			t.Fatalf("FetchMessages: %v", err)
+		}
+		if len(msgs) != 10 {
+			t.Fatalf("expected 10 messages, got %d", len(msgs))
+		}
+
+		// Should be in chronological order (oldest first)
+		if msgs[0].Text != "Hey, how are you?" {
+			t.Errorf("first message text: got %q", msgs[0].Text)
+		}
+		if msgs[9].Text != "No worries, I just got here" {
+			t.Errorf("last message text: got %q", msgs[9].Text)
+		}
+
+		// Check is_from_me alternation
+		if !msgs[0].IsFromMe {
+			t.Error("first message should be from me")
+		}
+		if msgs[1].IsFromMe {
+			t.Error("second message should not be from me")
+		}
+	})
+
+	t.Run("chronological_order", func(t *testing.T) {
+		msgs, _ := store.FetchMessages(t.Context(), 1, MessageCursor{}, 200)
+		for i := 1; i < len(msgs); i++ {
+			if msgs[i].Date.Before(msgs[i-1].Date) {
+				t.Errorf("message %d (%v) is before message %d (%v)",
+					i, msgs[i].Date, i-1, msgs[i-1].Date)
+			}
+		}
+	})
+
+	t.Run("sender_handle", func(t *testing.T) {
+		msgs, _ := store.FetchMessages(t.Context(), 1, MessageCursor{}, 200)
+		for _, m := range msgs {
+			if !m.IsFromMe && m.Sender != "+15551234567" {
+				t.Errorf("expected sender +15551234567, got %q", m.Sender)
+			}
+		}
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		// Fetch first 5 messages (most recent due to DESC, then reversed)
+		page1, err := store.FetchMessages(t.Context(), 1, MessageCursor{}, 5)
+		if err != nil {
+			t.Fatalf("page 1: %v", err)
+		}
+		if len(page1) != 5 {
+			t.Fatalf("page 1: expected 5 messages, got %d", len(page1))
+		}
+
+		// These are the 5 most recent messages (ROWIDs 6-10), reversed to chronological
+		// page1[0] should be ROWID 6, page1[4] should be ROWID 10
+
+		// Fetch next page using cursor from oldest in page1
+		cursor := CursorAt(page1[0])
+		page2, err := store.FetchMessages(t.Context(), 1, cursor, 5)
+		if err != nil {
+			t.Fatalf("page 2: %v", err)
+		}
+		if len(page2) != 5 {
+			t.Fatalf("page 2: expected 5 messages, got %d", len(page2))
+		}
+
+		// page2 should be the 5 oldest messages (ROWIDs 1-5)
+		// No overlap
+		for _, m1 := range page1 {
+			for _, m2 := range page2 {
+				if m1.ROWID == m2.ROWID {
+					t.Errorf("duplicate ROWID %d across pages", m1.ROWID)
+				}
+			}
+		}
+
+		// Third page should be empty
+		cursor2 := CursorAt(page2[0])
+		page3, err := store.FetchMessages(t.Context(), 1, cursor2, 5)
+		if err != nil {
+			t.Fatalf("page 3: %v", err)
+		}
+		if len(page3) != 0 {
+			t.Errorf("page 3: expected 0 messages, got %d", len(page3))
+		}
+	})
+
+	t.Run("attachments", func(t *testing.T) {
+		msgs, _ := store.FetchMessages(t.Context(), 1, MessageCursor{}, 200)
+
+		// Message 3 (index 2) should have 1 JPEG attachment
+		if len(msgs[2].Attachments) != 1 {
+			t.Fatalf("msg 3: expected 1 attachment, got %d", len(msgs[2].Attachments))
+		}
+		if msgs[2].Attachments[0].TypeLabel != "photo" {
+			t.Errorf("msg 3 attachment type: got %q, want %q", msgs[2].Attachments[0].TypeLabel, "photo")
+		}
+		if msgs[2].Attachments[0].Filename != "IMG_001.jpg" {
+			t.Errorf("msg 3 attachment filename: got %q", msgs[2].Attachments[0].Filename)
+		}
+		if msgs[2].Attachments[0].Size != 2048576 {
+			t.Errorf("msg 3 attachment size: got %d", msgs[2].Attachments[0].Size)
+		}
+
+		// Message 5 (index 4) should have 2 attachments (photo + video)
+		if len(msgs[4].Attachments) != 2 {
+			t.Fatalf("msg 5: expected 2 attachments, got %d", len(msgs[4].Attachments))
+		}
+
+		// Message 7 (index 6) should have a PDF
+		if len(msgs[6].Attachments) != 1 {
+			t.Fatalf("msg 7: expected 1 attachment, got %d", len(msgs[6].Attachments))
+		}
+		if msgs[6].Attachments[0].TypeLabel != "PDF" {
+			t.Errorf("msg 7 attachment type: got %q, want %q", msgs[6].Attachments[0].TypeLabel, "PDF")
+		}
+
+		// Messages without attachments should have none
+		if len(msgs[0].Attachments) != 0 {
+			t.Errorf("msg 1: expected 0 attachments, got %d", len(msgs[0].Attachments))
+		}
+	})
+}
+
+func TestFetchAllMessages(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	msgs, err := store.FetchAllMessages(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("FetchAllMessages: %v", err)
+	}
+	if len(msgs) != 10 {
+		t.Fatalf("expected 10 messages, got %d", len(msgs))
+	}
+
+	// Should be in chronological order (ASC)
+	for i := 1; i < len(msgs); i++ {
+		if msgs[i].Date.Before(msgs[i-1].Date) {
+			t.Errorf("message %d is before message %d", i, i-1)
+		}
+	}
+}
+
+func TestTextMessageCount(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	for _, stmt := range []string{
+		`ALTER TABLE message ADD COLUMN associated_message_type INTEGER DEFAULT 0`,
+		`ALTER TABLE message ADD COLUMN attributedBody BLOB`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Chat 2 has 5 text messages; add one whose text is only in
+	// attributedBody, two reactions, a removed reaction, and three
+	// attachment-only messages, one of them with an attributedBody
+	extra := []struct {
+		text       interface{}
+		body       []byte
+		assoc      int
+		attachment bool
+	}{
+		{nil, typedstreamBody("Sent from a newer Mac"), 0, false},
+		{"Loved “Thanks Jane!”", nil, 2000, false},
+		{"Liked “You're welcome”", nil, 2001, false},
+		{"Removed a heart from “Thanks Jane!”", nil, 3000, false},
+		{"\ufffc", nil, 0, true},
+		{nil, nil, 0, true},
+		{nil, typedstreamBody("\ufffc"), 0, true},
+	}
+	for i, e := range extra {
+		date := chatdbtest.BaseAppleNanos + int64(30+i)*60_000_000_000
+		res, err := db.Exec(`INSERT INTO message (guid, text, attributedBody, handle_id, service, date, is_from_me, associated_message_type)
+			VALUES (?, ?, ?, 3, 'iMessage', ?, 0, ?)`, fmt.Sprintf("msg-count-%d", i), e.text, e.body, date, e.assoc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		if _, err := db.Exec(`INSERT INTO chat_message_join (chat_id, message_id, message_date) VALUES (2, ?, ?)`, id, date); err != nil {
+			t.Fatal(err)
+		}
+		if e.attachment {
+			if _, err := db.Exec(`INSERT INTO message_attachment_join (message_id, attachment_id) VALUES (?, 1)`, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	convs, err := NewStore(db).FetchConversations(t.Context())
+	if err != nil {
+		t.Fatalf("FetchConversations: %v", err)
+	}
+	for _, c := range convs {
+		if c.ChatID != 2 {
+			continue
+		}
+		if c.MessageCount != 12 || c.TextMessageCount != 6 {
+			t.Errorf("chat 2: %d messages, %d with text; want 12 and 6", c.MessageCount, c.TextMessageCount)
+		}
+		return
+	}
+	t.Fatal("chat 2 missing")
+}
+
+func TestFetchMessagesCursor(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	// A late-synced message: the highest ROWID in the chat, but dated
+	// between the first and second messages
+	insert := func(guid, text string, date int64) {
+		res, err := db.Exec(`INSERT INTO message (guid, text, handle_id, service, date, is_from_me)
+			VALUES (?, ?, 1, 'iMessage', ?, 0)`, guid, text, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		db.Exec(`INSERT INTO chat_message_join (chat_id, message_id, message_date) VALUES (1, ?, ?)`, id, date)
+	}
+	insert("msg-synced", "Synced late", chatdbtest.BaseAppleNanos+30_000_000_000)
+
+	newest, err := store.FetchMessages(t.Context(), 1, MessageCursor{}, 5)
+	if err != nil {
+		t.Fatalf("newest page: %v", err)
+	}
+	older, err := store.FetchMessages(t.Context(), 1, CursorAt(newest[0]), 50)
+	if err != nil {
+		t.Fatalf("older page: %v", err)
+	}
+	if len(older) != 6 || older[1].Text != "Synced late" {
+		t.Errorf("older page should hold the synced message second, got %d messages: %+v", len(older), older)
+	}
+
+	// Reloading from the oldest loaded message picks up new arrivals
+	insert("msg-new", "Just arrived", chatdbtest.BaseAppleNanos+int64(500)*60_000_000_000)
+	reloaded, err := store.FetchMessagesFrom(t.Context(), 1, CursorAt(newest[0]))
+	if err != nil {
+		t.Fatalf("FetchMessagesFrom: %v", err)
+	}
+	if len(reloaded) != 6 || reloaded[0].ROWID != newest[0].ROWID || reloaded[5].Text != "Just arrived" {
+		t.Errorf("reloaded = %d messages: %+v", len(reloaded), reloaded)
+	}
+
+	// Polling past the highest loaded ROWID, the synced message's, finds
+	// only the new arrival
+	after, err := store.FetchMessagesAfter(t.Context(), 1, older[1].ROWID)
+	if err != nil {
+		t.Fatalf("FetchMessagesAfter: %v", err)
+	}
+	if len(after) != 1 || after[0].Text != "Just arrived" {
+		t.Errorf("after = %d messages: %+v", len(after), after)
+	}
+}
+
+func TestFetchMessagesAsc(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	all, err := store.FetchAllMessages(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("FetchAllMessages: %v", err)
+	}
+
+	// Paging forward 3 at a time from the start visits every message once,
+	// in order, and a short page marks the end
+	var paged []Message
+	cursor := MessageCursor{}
+	for pages := 0; ; pages++ {
+		if pages > len(all) {
+			t.Fatal("paging forward never ended")
+		}
+		page, err := store.FetchMessagesAsc(t.Context(), 1, cursor, 3)
+		if err != nil {
+			t.Fatalf("page %d: %v", pages, err)
+		}
+		paged = append(paged, page...)
+		if len(page) < 3 {
+			break
+		}
+		cursor = CursorAt(page[len(page)-1])
+	}
+	if len(paged) != len(all) {
+		t.Fatalf("paged %d messages, want %d", len(paged), len(all))
+	}
+	for i := range all {
+		if paged[i].ROWID != all[i].ROWID {
+			t.Errorf("message %d: ROWID %d, want %d", i, paged[i].ROWID, all[i].ROWID)
+		}
+	}
+}
+
+func TestFetchMessagesByHandle(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	// +15551234567 sent 5 messages in chat 1 and 3 in the group
+	newest, err := store.FetchMessagesByHandle(t.Context(), "+15551234567", MessageCursor{}, 5)
+	if err != nil {
+		t.Fatalf("newest page: %v", err)
+	}
+	var texts []string
+	for _, msg := range newest {
+		texts = append(texts, msg.Text)
+	}
+	want := []string{"Perfect, see you there!", "No worries, I just got here", "Thanks!", "Awesome!", "See you all tonight!"}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("newest page = %q, want %q", texts, want)
+	}
+
+	older, err := store.FetchMessagesByHandle(t.Context(), "+15551234567", CursorAt(newest[0]), 5)
+	if err != nil {
+		t.Fatalf("older page: %v", err)
+	}
+	if len(older) != 3 || older[0].Text != "I'm good, thanks! How about you?" {
+		t.Errorf("older page = %d messages: %+v", len(older), older)
+	}
+
+	// Emails match whatever their case
+	jane, err := store.FetchMessagesByHandle(t.Context(), "Jane@Example.com", MessageCursor{}, 0)
+	if err != nil {
+		t.Fatalf("email handle: %v", err)
+	}
+	if len(jane) != 3 {
+		t.Errorf("expected Jane's 3 messages, got %d", len(jane))
+	}
+}
+
+func TestFetchMessagesBetween(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	all, err := store.FetchAllMessages(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("FetchAllMessages: %v", err)
+	}
+
+	msgs, err := store.FetchMessagesBetween(t.Context(), 1, all[2].Date, all[5].Date)
+	if err != nil {
+		t.Fatalf("FetchMessagesBetween: %v", err)
+	}
+	if len(msgs) != 4 {
+		t.Fatalf("expected 4 messages (bounds inclusive), got %d", len(msgs))
+	}
+	if msgs[0].ROWID != all[2].ROWID || msgs[3].ROWID != all[5].ROWID {
+		t.Errorf("range: got ROWIDs %d..%d", msgs[0].ROWID, msgs[3].ROWID)
+	}
+
+	open, err := store.FetchMessagesBetween(t.Context(), 1, all[8].Date, time.Time{})
+	if err != nil {
+		t.Fatalf("FetchMessagesBetween open end: %v", err)
+	}
+	if len(open) != 2 {
+		t.Errorf("open-ended range: expected 2 messages, got %d", len(open))
+	}
+}
+
+func TestSearchMessages(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	t.Run("found", func(t *testing.T) {
+		results, err := store.SearchMessages(t.Context(), "lunch", 100)
+		if err != nil {
+			t.Fatalf("SearchMessages: %v", err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("expected 1 result for 'lunch', got %d", len(results))
+		}
+		if results[0].ChatID != 1 {
+			t.Errorf("expected chat 1, got chat %d", results[0].ChatID)
+		}
+	})
+
+	t.Run("multiple_results", func(t *testing.T) {
+		results, _ := store.SearchMessages(t.Context(), "good", 100)
+		if len(results) < 2 {
+			t.Errorf("expected at least 2 results for 'good', got %d", len(results))
+		}
+	})
+
+	t.Run("no_results", func(t *testing.T) {
+		results, _ := store.SearchMessages(t.Context(), "xyznonexistent", 100)
+		if len(results) != 0 {
+			t.Errorf("expected 0 results, got %d", len(results))
+		}
+	})
+
+	t.Run("cross_chat", func(t *testing.T) {
+		// "cake" is only in chat 3
+		results, _ := store.SearchMessages(t.Context(), "cake", 100)
+		if len(results) != 1 {
+			t.Fatalf("expected 1 result for 'cake', got %d", len(results))
+		}
+		if results[0].ChatID != 3 {
+			t.Errorf("expected chat 3, got chat %d", results[0].ChatID)
+		}
+		if results[0].ChatName != "Family Group" {
+			t.Errorf("expected chat name 'Family Group', got %q", results[0].ChatName)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		results, _ := store.SearchMessages(t.Context(), "e", 3) // many matches, limit to 3
+		if len(results) > 3 {
+			t.Errorf("expected at most 3 results, got %d", len(results))
+		}
+	})
+}
+
+func TestAppleNanosToTime(t *testing.T) {
+	t.Run("zero", func(t *testing.T) {
+		result := appleNanosToTime(0)
+		if !result.IsZero() {
+			t.Errorf("expected zero time, got %v", result)
+		}
+	})
+
+	t.Run("known_value", func(t *testing.T) {
+		// 2024-06-15 10:00:00 UTC = 740142000 seconds from Apple epoch
+		nanos := int64(740_142_000_000_000_000)
+		result := appleNanosToTime(nanos)
+		if result.UTC().Year() != 2024 || result.UTC().Month() != 6 || result.UTC().Day() != 15 {
+			t.Errorf("expected 2024-06-15, got %v", result.UTC())
+		}
+	})
+}
+
+func TestAttachmentLabel(t *testing.T) {
+	tests := []struct {
+		mime string
+		want string
+	}{
+		{"image/jpeg", "photo"},
+		{"image/heic", "photo"},
+		{"image/png", "image"},
+		{"image/gif", "GIF"},
+		{"video/quicktime", "video"},
+		{"audio/mpeg", "audio"},
+		{"application/pdf", "PDF"},
+		{"text/vcard", "contact card"},
+		{"", "attachment"},
+		{"application/octet-stream", "file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mime, func(t *testing.T) {
+			got := attachmentLabel(tt.mime)
+			if got != tt.want {
+				t.Errorf("attachmentLabel(%q) = %q, want %q", tt.mime, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAttachments(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		result := parseAttachments("")
+		if result != nil {
+			t.Errorf("expected nil, got %v", result)
+		}
+	})
+
+	t.Run("null_row", func(t *testing.T) {
+		// LEFT JOIN producing empty fields: mime="" || name="" || size=0
+		result := parseAttachments("||||0")
+		if len(result) != 0 {
+			t.Errorf("expected 0 attachments for null row, got %d", len(result))
+		}
+	})
+
+	t.Run("single", func(t *testing.T) {
+		result := parseAttachments("image/jpeg||photo.jpg||2048576")
+		if len(result) != 1 {
+			t.Fatalf("expected 1 attachment, got %d", len(result))
+		}
+		if result[0].TypeLabel != "photo" {
+			t.Errorf("type: got %q", result[0].TypeLabel)
+		}
+		if result[0].Filename != "photo.jpg" {
+			t.Errorf("filename: got %q", result[0].Filename)
+		}
+		if result[0].Size != 2048576 {
+			t.Errorf("size: got %d", result[0].Size)
+		}
+	})
+
+	t.Run("name_only", func(t *testing.T) {
+		result := parseAttachments("||doc||0")
+		if len(result) != 1 {
+			t.Fatalf("expected 1 attachment, got %d", len(result))
+		}
+		if result[0].TypeLabel != "file" {
+			t.Errorf("type: got %q, want %q", result[0].TypeLabel, "file")
+		}
+		if result[0].Filename != "doc" {
+			t.Errorf("filename: got %q", result[0].Filename)
+		}
+	})
+
+	t.Run("size_only", func(t *testing.T) {
+		result := parseAttachments("||||1024")
+		if len(result) != 1 {
+			t.Fatalf("expected 1 attachment, got %d", len(result))
+		}
+		if result[0].TypeLabel != "file" {
+			t.Errorf("type: got %q, want %q", result[0].TypeLabel, "file")
+		}
+		if result[0].Size != 1024 {
+			t.Errorf("size: got %d", result[0].Size)
+		}
+	})
+
+	t.Run("malformed_entries_skipped", func(t *testing.T) {
+		result := parseAttachments("||||0;; || ||abc;;image/png||a.png||10;;")
+		if len(result) != 1 {
+			t.Fatalf("expected 1 attachment, got %d: %v", len(result), result)
+		}
+		if result[0].TypeLabel != "image" {
+			t.Errorf("type: got %q", result[0].TypeLabel)
+		}
+	})
+
+	t.Run("multiple", func(t *testing.T) {
+		result := parseAttachments("image/heic||a.heic||1000;;video/quicktime||b.mov||5000")
+		if len(result) != 2 {
+			t.Fatalf("expected 2 attachments, got %d", len(result))
+		}
+		if result[0].TypeLabel != "photo" {
+			t.Errorf("first type: got %q", result[0].TypeLabel)
+		}
+		if result[1].TypeLabel != "video" {
+			t.Errorf("second type: got %q", result[1].TypeLabel)
+		}
+	})
+}
+
+func TestSchemaProbe(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+
+	t.Run("older_schema", func(t *testing.T) {
+		store := NewStore(db)
+		if !store.schema.has("message", "text") {
+			t.Error("expected message.text to be detected")
+		}
+		if store.schema.has("message", "date_read") {
+			t.Error("test schema has no message.date_read")
+		}
+		msgs, err := store.FetchMessages(t.Context(), 1, MessageCursor{}, 200)
+		if err != nil {
+			t.Fatalf("FetchMessages without optional columns: %v", err)
+		}
+		if !msgs[0].DateRead.IsZero() || msgs[0].ThreadOriginator != "" || msgs[0].Edited || msgs[0].Failed {
+			t.Errorf("optional fields should be zero: %+v", msgs[0])
+		}
+	})
+
+	t.Run("newer_schema", func(t *testing.T) {
+		for _, stmt := range []string{
+			`ALTER TABLE message ADD COLUMN date_read INTEGER DEFAULT 0`,
+			`ALTER TABLE message ADD COLUMN date_delivered INTEGER DEFAULT 0`,
+			`ALTER TABLE message ADD COLUMN thread_originator_guid TEXT`,
+			`ALTER TABLE message ADD COLUMN message_summary_info BLOB`,
+			`ALTER TABLE message ADD COLUMN error INTEGER DEFAULT 0`,
+		} {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatalf("%s: %v", stmt, err)
+			}
+		}
+		db.Exec(`UPDATE message SET date_read = date + 60000000000,
+			thread_originator_guid = 'msg-c1-0', message_summary_info = x'00'
+			WHERE ROWID = 2`)
+		db.Exec(`UPDATE message SET error = 22 WHERE ROWID = 3`)
+
+		store := NewStore(db)
+		msgs, err := store.FetchAllMessages(t.Context(), 1)
+		if err != nil {
+			t.Fatalf("FetchAllMessages: %v", err)
+		}
+		reply := msgs[1]
+		if want := reply.Date.Add(time.Minute); !reply.DateRead.Equal(want) {
+			t.Errorf("DateRead: got %v, want %v", reply.DateRead, want)
+		}
+		if reply.ThreadOriginator != "msg-c1-0" {
+			t.Errorf("ThreadOriginator: got %q", reply.ThreadOriginator)
+		}
+		if !reply.Edited {
+			t.Error("expected Edited to be set")
+		}
+		if msgs[0].Edited {
+			t.Error("message without summary info should not be Edited")
+		}
+		if !msgs[2].Failed || msgs[1].Failed {
+			t.Errorf("Failed: got %v for errored message, %v for delivered one", msgs[2].Failed, msgs[1].Failed)
+		}
+	})
+}
+
+func TestFetchMessagesReactions(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	for _, stmt := range []string{
+		`ALTER TABLE message ADD COLUMN associated_message_guid TEXT`,
+		`ALTER TABLE message ADD COLUMN associated_message_type INTEGER DEFAULT 0`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	tapbacks := []struct {
+		target   string
+		kind     int
+		fromMe   int
+		handleID int
+	}{
+		{"p:0/msg-c1-0", 2000, 0, 1}, // they love it
+		{"p:0/msg-c1-0", 2001, 1, 0}, // I like it...
+		{"p:0/msg-c1-0", 3001, 1, 0}, // ...then take it back
+		{"bp:msg-c1-0", 2003, 1, 0},  // and laugh instead
+		{"p:0/msg-c1-4", 2002, 0, 1}, // dislike, replaced below
+		{"p:0/msg-c1-4", 2004, 0, 1},
+	}
+	for i, tb := range tapbacks {
+		guid := fmt.Sprintf("tapback-%d", i)
+		db.Exec(`INSERT INTO message (guid, text, handle_id, service, date, is_from_me,
+			associated_message_guid, associated_message_type)
+			VALUES (?, '', ?, 'iMessage', ?, ?, ?, ?)`,
+			guid, tb.handleID, chatdbtest.BaseAppleNanos+int64(10+i)*60_000_000_000, tb.fromMe, tb.target, tb.kind)
+		db.Exec(`INSERT INTO chat_message_join (chat_id, message_id)
+			VALUES (1, (SELECT ROWID FROM message WHERE guid = ?))`, guid)
+	}
+
+	store := NewStore(db)
+	msgs, err := store.FetchMessages(t.Context(), 1, MessageCursor{}, 200)
+	if err != nil {
+		t.Fatalf("FetchMessages: %v", err)
+	}
+	if len(msgs) != 10 {
+		t.Fatalf("tapback rows should not be listed: got %d messages", len(msgs))
+	}
+
+	got := msgs[0].Reactions
+	want := []Reaction{
+		{Type: 2000, Sender: "+15551234567"},
+		{Type: 2003, IsFromMe: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("msgs[0] reactions: got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("reaction %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if r := msgs[4].Reactions; len(r) != 1 || r[0].Type != 2004 {
+		t.Errorf("a new tapback should replace the sender's previous one: %+v", r)
+	}
+	if len(msgs[1].Reactions) != 0 {
+		t.Errorf("msgs[1] should have no reactions: %+v", msgs[1].Reactions)
+	}
+
+	// A late-synced message: older than the whole page but with the
+	// highest ROWID, so it leads the page
+	if _, err := db.Exec(`INSERT INTO message (guid, text, handle_id, service, date, is_from_me)
+		VALUES ('msg-late', 'Synced late', 1, 'iMessage', ?, 0)`, chatdbtest.BaseAppleNanos-60_000_000_000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO chat_message_join (chat_id, message_id)
+		VALUES (1, (SELECT ROWID FROM message WHERE guid = 'msg-late'))`); err != nil {
+		t.Fatal(err)
+	}
+	for name, fetch := range map[string]func() ([]Message, error){
+		"FetchMessages":    func() ([]Message, error) { return store.FetchMessages(t.Context(), 1, MessageCursor{}, 200) },
+		"FetchMessagesAsc": func() ([]Message, error) { return store.FetchMessagesAsc(t.Context(), 1, MessageCursor{}, 200) },
+	} {
+		msgs, err := fetch()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if msgs[0].GUID != "msg-late" {
+			t.Fatalf("%s: page starts with %s, want the late-synced message", name, msgs[0].GUID)
+		}
+		if got := len(msgs[1].Reactions); got != 2 {
+			t.Errorf("%s: with a late-synced message first, msg-c1-0 has %d reactions, want 2", name, got)
+		}
+	}
+}
+
+func TestReactionsAcrossBatches(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	for _, stmt := range []string{
+		`ALTER TABLE message ADD COLUMN associated_message_guid TEXT`,
+		`ALTER TABLE message ADD COLUMN associated_message_type INTEGER DEFAULT 0`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	// More messages than one reaction lookup covers, each with a tapback
+	n := reactionBatch + 20
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range n {
+		date := chatdbtest.BaseAppleNanos + int64(1000+i)*60_000_000_000
+		guid := fmt.Sprintf("msg-bulk-%d", i)
+		for _, row := range [][]interface{}{
+			{guid, "Bulk", "", 0, date},
+			{fmt.Sprintf("tapback-bulk-%d", i), "", "p:0/" + guid, 2000, date + 1},
+		} {
+			if _, err := tx.Exec(`INSERT INTO message (guid, text, handle_id, service, date, is_from_me,
+				associated_message_guid, associated_message_type) VALUES (?, ?, 1, 'iMessage', ?, 0, ?, ?)`,
+				row[0], row[1], row[4], row[2], row[3]); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tx.Exec(`INSERT INTO chat_message_join (chat_id, message_id)
+				VALUES (1, (SELECT ROWID FROM message WHERE guid = ?))`, row[0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := NewStore(db).FetchAllMessages(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("FetchAllMessages: %v", err)
+	}
+	reacted := 0
+	for _, msg := range msgs {
+		if strings.HasPrefix(msg.GUID, "msg-bulk-") {
+			if len(msg.Reactions) != 1 {
+				t.Errorf("%s has %d reactions, want 1", msg.GUID, len(msg.Reactions))
+			}
+			reacted++
+		} else if len(msg.Reactions) != 0 {
+			t.Errorf("%s picked up reactions: %+v", msg.GUID, msg.Reactions)
+		}
+	}
+	if reacted != n {
+		t.Errorf("got %d bulk messages, want %d", reacted, n)
+	}
+}
+
+func TestRefreshReactions(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	for _, stmt := range []string{
+		`ALTER TABLE message ADD COLUMN associated_message_guid TEXT`,
+		`ALTER TABLE message ADD COLUMN associated_message_type INTEGER DEFAULT 0`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	store := NewStore(db)
+	msgs, err := store.FetchMessages(t.Context(), 1, MessageCursor{}, 200)
+	if err != nil {
+		t.Fatalf("FetchMessages: %v", err)
+	}
+	tapback := func(i, kind int) {
+		guid := fmt.Sprintf("tapback-%d", i)
+		if _, err := db.Exec(`INSERT INTO message (guid, text, handle_id, service, date, is_from_me,
+			associated_message_guid, associated_message_type)
+			VALUES (?, '', 1, 'iMessage', ?, 0, 'p:0/msg-c1-1', ?)`,
+			guid, chatdbtest.BaseAppleNanos+int64(100+i)*60_000_000_000, kind); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO chat_message_join (chat_id, message_id)
+			VALUES (1, (SELECT ROWID FROM message WHERE guid = ?))`, guid); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tapback(0, 2000)
+	if err := store.RefreshReactions(t.Context(), 1, msgs); err != nil {
+		t.Fatalf("RefreshReactions: %v", err)
+	}
+	if r := msgs[1].Reactions; len(r) != 1 || r[0].Type != 2000 {
+		t.Errorf("a tapback added after loading should show up: %+v", r)
+	}
+	tapback(1, 3000)
+	if err := store.RefreshReactions(t.Context(), 1, msgs); err != nil {
+		t.Fatalf("RefreshReactions: %v", err)
+	}
+	if r := msgs[1].Reactions; len(r) != 0 {
+		t.Errorf("a tapback taken back should go away: %+v", r)
+	}
+}
+
+func TestFetchMessagesAttributedBody(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	if _, err := db.Exec(`ALTER TABLE message ADD COLUMN attributedBody BLOB`); err != nil {
+		t.Fatalf("add attributedBody: %v", err)
+	}
+	db.Exec(`UPDATE message SET text = NULL, attributedBody = ? WHERE ROWID = 2`,
+		typedstreamBody("Only in the attributed body"))
+	db.Exec(`UPDATE message SET attributedBody = ? WHERE ROWID = 4`, typedstreamBody("ignored"))
+
+	store := NewStore(db)
+	msgs, err := store.FetchMessages(t.Context(), 1, MessageCursor{}, 200)
+	if err != nil {
+		t.Fatalf("FetchMessages: %v", err)
+	}
+	if msgs[1].Text != "Only in the attributed body" {
+		t.Errorf("NULL text should fall back to attributedBody: got %q", msgs[1].Text)
+	}
+	if msgs[3].Text != "Sure, where?" {
+		t.Errorf("text column should win when present: got %q", msgs[3].Text)
+	}
+}
+
+func TestFetchThread(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+
+	t.Run("older_schema", func(t *testing.T) {
+		msgs, err := NewStore(db).FetchThread(t.Context(), "msg-c1-0")
+		if err != nil {
+			t.Fatalf("FetchThread: %v", err)
+		}
+		if len(msgs) != 1 || msgs[0].GUID != "msg-c1-0" {
+			t.Errorf("expected only the originating message, got %+v", msgs)
+		}
+	})
+
+	t.Run("with_replies", func(t *testing.T) {
+		if _, err := db.Exec(`ALTER TABLE message ADD COLUMN thread_originator_guid TEXT`); err != nil {
+			t.Fatalf("add thread_originator_guid: %v", err)
+		}
+		db.Exec(`UPDATE message SET thread_originator_guid = 'msg-c1-0' WHERE guid IN ('msg-c1-3', 'msg-c1-1')`)
+
+		msgs, err := NewStore(db).FetchThread(t.Context(), "msg-c1-0")
+		if err != nil {
+			t.Fatalf("FetchThread: %v", err)
+		}
+		var guids []string
+		for _, m := range msgs {
+			guids = append(guids, m.GUID)
+		}
+		if want := []string{"msg-c1-0", "msg-c1-1", "msg-c1-3"}; strings.Join(guids, ",") != strings.Join(want, ",") {
+			t.Errorf("thread: got %v, want %v", guids, want)
+		}
+
+		none, err := NewStore(db).FetchThread(t.Context(), "no-such-guid")
+		if err != nil || len(none) != 0 {
+			t.Errorf("unknown guid: got %v, %v", none, err)
+		}
+	})
+}
+
+func TestHandleCountry(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	if _, err := db.Exec(`UPDATE handle SET country = 'gb' WHERE id = '+15559876543'`); err != nil {
+		t.Fatalf("set country: %v", err)
+	}
+	store := NewStore(db)
+
+	convs, err := store.FetchConversations(t.Context())
+	if err != nil {
+		t.Fatalf("FetchConversations: %v", err)
+	}
+	for _, c := range convs {
+		want := map[string]string(nil)
+		for _, p := range c.Participants {
+			if p == "+15559876543" {
+				want = map[string]string{p: "gb"}
+			}
+		}
+		if !reflect.DeepEqual(c.Countries, want) {
+			t.Errorf("chat %d countries = %v, want %v", c.ChatID, c.Countries, want)
+		}
+	}
+
+	msgs, err := store.FetchMessages(t.Context(), 3, MessageCursor{}, 0)
+	if err != nil {
+		t.Fatalf("FetchMessages: %v", err)
+	}
+	for _, m := range msgs {
+		want := ""
+		if m.Sender == "+15559876543" {
+			want = "gb"
+		}
+		if m.SenderCountry != want {
+			t.Errorf("message from %q: country %q, want %q", m.Sender, m.SenderCountry, want)
+		}
+	}
+}
+
+func TestFetchMessagesByGUID(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+
+	got, err := NewStore(db).FetchMessagesByGUID(t.Context(), []string{"msg-c1-0", "msg-c2-1", "no-such-guid"})
+	if err != nil {
+		t.Fatalf("FetchMessagesByGUID: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d messages, want 2: %+v", len(got), got)
+	}
+	if msg := got["msg-c1-0"]; msg.Text != "Hey, how are you?" {
+		t.Errorf("msg-c1-0 text = %q", msg.Text)
+	}
+	if _, ok := got["no-such-guid"]; ok {
+		t.Error("unknown guid should be left out")
+	}
+
+	none, err := NewStore(db).FetchMessagesByGUID(t.Context(), nil)
+	if err != nil || len(none) != 0 {
+		t.Errorf("no guids: got %v, %v", none, err)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []QueryClause
+	}{
+		{"lunch", []QueryClause{{Text: "lunch"}}},
+		{"lunch  plans", []QueryClause{{Text: "lunch"}, {Text: "plans"}}},
+		{`"Sounds good"`, []QueryClause{{Text: "Sounds good", Exact: true}}},
+		{"good -overall", []QueryClause{{Text: "good"}, {Text: "overall", Negate: true}}},
+		{`-"deep dish" pizza night`, []QueryClause{{Text: "deep dish", Exact: true, Negate: true}, {Text: "pizza"}, {Text: "night"}}},
+		{`e-mail - me`, []QueryClause{{Text: "e-mail"}, {Text: "me"}}},
+		{`lunch -- -tomorrow`, []QueryClause{{Text: "lunch"}, {Text: "tomorrow", Negate: true}}},
+		{`"unterminated phrase`, []QueryClause{{Text: "unterminated phrase", Exact: true}}},
+		{`"" -`, nil},
+		{"   ", nil},
+	}
+	for _, tt := range tests {
+		if got := ParseQuery(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestOrphanedMessages(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	if _, found, err := store.FetchOrphanConversation(t.Context()); err != nil || found {
+		t.Fatalf("before: found = %v, err = %v; want none", found, err)
+	}
+
+	// Messages in no chat_message_join row
+	for i, text := range []string{"Lost in migration", "Also lost"} {
+		db.Exec(`INSERT INTO message (guid, text, handle_id, service, date, is_from_me)
+			VALUES (?, ?, 1, 'SMS', ?, ?)`, fmt.Sprintf("msg-orphan-%d", i), text,
+			chatdbtest.BaseAppleNanos+int64(100+i)*60_000_000_000, i)
+	}
+
+	conv, found, err := store.FetchOrphanConversation(t.Context())
+	if err != nil || !found {
+		t.Fatalf("FetchOrphanConversation: found = %v, err = %v", found, err)
+	}
+	if conv.ChatID != OrphanChatID || conv.MessageCount != 2 || conv.SentCount != 1 || conv.ReceivedCount != 1 {
+		t.Errorf("conversation = %+v", conv)
+	}
+
+	msgs, err := store.FetchMessages(t.Context(), OrphanChatID, MessageCursor{}, 50)
+	if err != nil {
+		t.Fatalf("FetchMessages: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].Text != "Lost in migration" || msgs[0].Sender != "+15551234567" {
+		t.Errorf("orphaned messages = %+v", msgs)
+	}
+
+	// Real chats don't pick them up
+	all, _ := store.FetchAllMessages(t.Context(), 1)
+	for _, m := range all {
+		if strings.HasPrefix(m.GUID, "msg-orphan") {
+			t.Errorf("chat 1 includes orphaned message %s", m.GUID)
+		}
+	}
+
+	// Nor do the stats and attachment queries miss them
+	days, err := store.MessagesPerDay(t.Context(), OrphanChatID)
+	if err != nil || len(days) != 1 || days[0].Count != 2 {
+		t.Errorf("MessagesPerDay = %+v, %v; want one day of 2", days, err)
+	}
+	hist, err := store.MessageHourHistogram(t.Context(), OrphanChatID)
+	total := 0
+	for _, hours := range hist {
+		for _, n := range hours {
+			total += n
+		}
+	}
+	if err != nil || total != 2 {
+		t.Errorf("MessageHourHistogram counted %d, err %v; want 2", total, err)
+	}
+	if senders, err := store.fetchSenders(t.Context(), OrphanChatID); err != nil || !reflect.DeepEqual(senders, []string{"+15551234567"}) {
+		t.Errorf("fetchSenders = %v, %v", senders, err)
+	}
+	if _, err := db.Exec(`INSERT INTO attachment (guid, original_guid, mime_type, transfer_name, total_bytes, filename)
+		VALUES ('att-orphan', 'att-orphan-orig', 'image/jpeg', 'lost.jpg', 100, '~/lost.jpg')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO message_attachment_join (message_id, attachment_id)
+		VALUES ((SELECT ROWID FROM message WHERE guid = 'msg-orphan-0'),
+		        (SELECT ROWID FROM attachment WHERE guid = 'att-orphan'))`); err != nil {
+		t.Fatal(err)
+	}
+	atts, err := store.FetchChatAttachments(t.Context(), OrphanChatID)
+	if err != nil || len(atts) != 1 || atts[0].Filename != "lost.jpg" || atts[0].ChatID != OrphanChatID {
+		t.Errorf("FetchChatAttachments = %+v, %v", atts, err)
+	}
+	if atts, _ := store.FetchChatAttachments(t.Context(), 1); len(atts) != 4 {
+		t.Errorf("chat 1 has %d attachments, want 4", len(atts))
+	}
+}
+
+func TestGroupEvents(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+
+	if events, err := NewStore(db).GroupEvents(t.Context(), 3); err != nil || events != nil {
+		t.Fatalf("without item_type: events = %v, err = %v", events, err)
+	}
+
+	for _, stmt := range []string{
+		`ALTER TABLE message ADD COLUMN item_type INTEGER DEFAULT 0`,
+		`ALTER TABLE message ADD COLUMN group_action_type INTEGER DEFAULT 0`,
+		`ALTER TABLE message ADD COLUMN other_handle INTEGER DEFAULT 0`,
+		`ALTER TABLE message ADD COLUMN group_title TEXT`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	actions := []struct {
+		handleID, fromMe, itemType, action, other int
+		title                                     string
+	}{
+		{0, 1, 1, 0, 2, ""},       // I added +15559876543
+		{1, 0, 2, 0, 0, "Family"}, // +15551234567 renamed the group
+		{0, 1, 3, 1, 0, ""},       // photo change, skipped
+		{1, 0, 1, 1, 2, ""},       // +15551234567 removed +15559876543
+		{2, 0, 3, 0, 0, ""},       // +15559876543 left
+	}
+	for i, a := range actions {
+		msgID := 200 + i
+		date := chatdbtest.BaseAppleNanos + int64(60+i)*60_000_000_000
+		db.Exec(`INSERT INTO message (ROWID, guid, handle_id, service, date, is_from_me, item_type, group_action_type, other_handle, group_title)
+			VALUES (?, ?, ?, 'iMessage', ?, ?, ?, ?, ?, ?)`, msgID, fmt.Sprintf("msg-group-%d", i),
+			a.handleID, date, a.fromMe, a.itemType, a.action, a.other, a.title)
+		db.Exec(`INSERT INTO chat_message_join (chat_id, message_id, message_date) VALUES (3, ?, ?)`, msgID, date)
+	}
+
+	events, err := NewStore(db).GroupEvents(t.Context(), 3)
+	if err != nil {
+		t.Fatalf("GroupEvents: %v", err)
+	}
+	want := []GroupEvent{
+		{Kind: MemberAdded, IsFromMe: true, Member: "+15559876543"},
+		{Kind: GroupRenamed, Actor: "+15551234567", Title: "Family"},
+		{Kind: MemberRemoved, Actor: "+15551234567", Member: "+15559876543"},
+		{Kind: MemberLeft, Actor: "+15559876543"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, e := range events {
+		e.Date = time.Time{}
+		if e != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, e, want[i])
+		}
+	}
+}
+
+func TestSearchMessagesBetween(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	all, err := store.SearchMessages(t.Context(), "good", 100)
+	if err != nil {
+		t.Fatalf("SearchMessages: %v", err)
+	}
+	if len(all) < 2 {
+		t.Fatalf("expected at least 2 results for 'good', got %d", len(all))
+	}
+
+	// Results are newest first, so the oldest match falls outside this range
+	oldest := all[len(all)-1]
+	got, err := store.SearchMessagesBetween(t.Context(), "good", oldest.Date.Add(time.Second), time.Time{}, 100, false)
+	if err != nil {
+		t.Fatalf("SearchMessagesBetween: %v", err)
+	}
+	if len(got) != len(all)-1 {
+		t.Errorf("open-ended range: got %d results, want %d", len(got), len(all)-1)
+	}
+
+	got, _ = store.SearchMessagesBetween(t.Context(), "good", oldest.Date, oldest.Date, 100, false)
+	if len(got) != 1 || got[0].ROWID != oldest.ROWID {
+		t.Errorf("single-instant range: got %v, want only ROWID %d", got, oldest.ROWID)
+	}
+}
+
+func TestSearchMessagesScoped(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	db.Exec(`UPDATE chat SET style = ? WHERE ROWID IN (1, 2)`, ChatStyleDirect)
+	db.Exec(`UPDATE chat SET style = ? WHERE ROWID = 3`, ChatStyleGroup)
+	store := NewStore(db)
+
+	count := func(scope ChatScope) (n int, chats map[int]bool) {
+		t.Helper()
+		results, err := store.SearchMessagesScoped(t.Context(), "thanks", scope, time.Time{}, time.Time{}, 100, false)
+		if err != nil {
+			t.Fatalf("SearchMessagesScoped(%v): %v", scope, err)
+		}
+		chats = map[int]bool{}
+		for _, r := range results {
+			chats[r.ChatID] = true
+		}
+		return len(results), chats
+	}
+	if n, _ := count(ScopeAll); n != 3 {
+		t.Errorf("all chats: got %d results, want 3", n)
+	}
+	if n, chats := count(ScopeDirect); n != 2 || chats[3] {
+		t.Errorf("direct chats: got %d results in %v", n, chats)
+	}
+	if n, chats := count(ScopeGroups); n != 1 || !chats[3] {
+		t.Errorf("group chats: got %d results in %v", n, chats)
+	}
+}
+
+func TestSearchMessagesQuery(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{`"Sounds good"`, 1},
+		{`"sounds good"`, 0}, // quoted phrases keep case
+		{"sounds good", 1},
+		{"good thanks", 1}, // "I'm good, thanks!"
+		{"thanks good", 1}, // in any order
+		{"good -overall", 2},
+		{`"I'll" -cake`, 2},
+		{"-good", 0}, // nothing required, so nothing searched
+	}
+	for _, tt := range tests {
+		results, err := store.SearchMessages(t.Context(), tt.query, 100)
+		if err != nil {
+			t.Fatalf("SearchMessages(%q): %v", tt.query, err)
+		}
+		if len(results) != tt.want {
+			t.Errorf("SearchMessages(%q): got %d results, want %d", tt.query, len(results), tt.want)
+		}
+	}
+}
+
+func TestSearchMessagesAllWords(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	// The fixture has "lunch" and "downtown" only in separate messages
+	if results, _ := store.SearchMessages(t.Context(), "lunch downtown", 100); len(results) != 0 {
+		t.Fatalf("words in different messages matched: %+v", results)
+	}
+
+	db.Exec(`INSERT INTO message (guid, text, handle_id, service, date, is_from_me)
+		VALUES ('msg-both', 'Downtown for a quick lunch tomorrow?', 1, 'iMessage', ?, 0)`, chatdbtest.BaseAppleNanos+1)
+	db.Exec(`INSERT INTO chat_message_join (chat_id, message_id)
+		VALUES (1, (SELECT ROWID FROM message WHERE guid = 'msg-both'))`)
+	results, err := store.SearchMessages(t.Context(), "lunch downtown", 100)
+	if err != nil {
+		t.Fatalf("SearchMessages: %v", err)
+	}
+	if len(results) != 1 || results[0].Text != "Downtown for a quick lunch tomorrow?" {
+		t.Errorf("want only the message with both words, got %+v", results)
+	}
+}
+
+func TestSearchMessagesFolded(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	for i, text := range []string{"Meet me at the café", "Say hi to José for me"} {
+		db.Exec(`INSERT INTO message (guid, text, handle_id, service, date, is_from_me)
+			VALUES (?, ?, 3, 'iMessage', ?, 0)`, fmt.Sprintf("msg-fold-%d", i), text, chatdbtest.BaseAppleNanos+int64(i))
+		db.Exec(`INSERT INTO chat_message_join (chat_id, message_id)
+			VALUES (2, (SELECT ROWID FROM message WHERE guid = ?))`, fmt.Sprintf("msg-fold-%d", i))
+	}
+	store := NewStore(db)
+
+	tests := []struct {
+		term string
+		want string
+	}{
+		{"cafe", "Meet me at the café"},
+		{"jose", "Say hi to José for me"},
+		{"JOSÉ", "Say hi to José for me"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.term, func(t *testing.T) {
+			plain, err := store.SearchMessages(t.Context(), tt.term, 100)
+			if err != nil {
+				t.Fatalf("SearchMessages: %v", err)
+			}
+			if tt.term != "JOSÉ" && len(plain) != 0 {
+				t.Errorf("plain search for %q should miss accented text, got %d results", tt.term, len(plain))
+			}
+
+			folded, err := store.SearchMessagesFolded(t.Context(), tt.term, 100)
+			if err != nil {
+				t.Fatalf("SearchMessagesFolded: %v", err)
+			}
+			if len(folded) != 1 || folded[0].Text != tt.want {
+				t.Errorf("SearchMessagesFolded(%q) = %v, want %q", tt.term, folded, tt.want)
+			}
+		})
+	}
+
+	t.Run("ascii_unchanged", func(t *testing.T) {
+		results, _ := store.SearchMessagesFolded(t.Context(), "LUNCH", 100)
+		if len(results) != 1 {
+			t.Errorf("expected 1 result for 'LUNCH', got %d", len(results))
+		}
+	})
+}
+
+func TestFetchChatAttachments(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	t.Run("chat_with_attachments", func(t *testing.T) {
+		attachments, err := store.FetchChatAttachments(t.Context(), 1)
+		if err != nil {
+			t.Fatalf("FetchChatAttachments: %v", err)
+		}
+		// Chat 1 has 4 attachments: msg 3 (1 JPEG), msg 5 (1 HEIC + 1 video), msg 7 (1 PDF)
+		if len(attachments) != 4 {
+			t.Fatalf("expected 4 attachments, got %d", len(attachments))
+		}
+	})
+
+	t.Run("ordered_by_date_desc", func(t *testing.T) {
+		attachments, _ := store.FetchChatAttachments(t.Context(), 1)
+		for i := 1; i < len(attachments); i++ {
+			if attachments[i].Date.After(attachments[i-1].Date) {
+				t.Errorf("attachment %d date (%v) is after attachment %d date (%v)",
+					i, attachments[i].Date, i-1, attachments[i-1].Date)
+			}
+		}
+	})
+
+	t.Run("fields_populated", func(t *testing.T) {
+		attachments, _ := store.FetchChatAttachments(t.Context(), 1)
+		// First result (most recent) should be the PDF from msg 7
+		pdf := attachments[0]
+		if pdf.TypeLabel != "PDF" {
+			t.Errorf("expected PDF, got %q", pdf.TypeLabel)
+		}
+		if pdf.Filename != "menu.pdf" {
+			t.Errorf("expected menu.pdf, got %q", pdf.Filename)
+		}
+		if pdf.Size != 524288 {
+			t.Errorf("expected size 524288, got %d", pdf.Size)
+		}
+		if !strings.Contains(pdf.FilePath, "menu.pdf") {
+			t.Errorf("expected file path containing menu.pdf, got %q", pdf.FilePath)
+		}
+	})
+
+	t.Run("sender_info", func(t *testing.T) {
+		attachments, _ := store.FetchChatAttachments(t.Context(), 1)
+		for _, a := range attachments {
+			if !a.IsFromMe && a.Sender == "" {
+				t.Errorf("non-from-me attachment should have sender, date=%v", a.Date)
+			}
+		}
+	})
+
+	t.Run("chat_without_attachments", func(t *testing.T) {
+		attachments, err := store.FetchChatAttachments(t.Context(), 2)
+		if err != nil {
+			t.Fatalf("FetchChatAttachments: %v", err)
+		}
+		if len(attachments) != 0 {
+			t.Errorf("expected 0 attachments for chat 2, got %d", len(attachments))
+		}
+	})
+}
+
+func TestAttachmentState(t *testing.T) {
+	dir := t.TempDir()
+	full := filepath.Join(dir, "photo.jpg")
+	stub := filepath.Join(dir, "clip.mov")
+	os.WriteFile(full, make([]byte, 4096), 0o644)
+	os.WriteFile(stub, make([]byte, 100), 0o644)
+	absent := filepath.Join(dir, "gone.pdf")
+	pending := sql.NullInt64{Int64: 0, Valid: true}
+	finished := sql.NullInt64{Int64: transferFinished, Valid: true}
+
+	tests := []struct {
+		name  string
+		path  string
+		total int64
+		state sql.NullInt64
+		want  AttachmentState
+	}{
+		{"on_disk", full, 4096, finished, AttachmentAvailable},
+		{"placeholder", stub, 10_485_760, finished, AttachmentOffloaded},
+		{"small_file", stub, 100, sql.NullInt64{}, AttachmentAvailable},
+		{"not_downloaded", absent, 524288, pending, AttachmentOffloaded},
+		{"deleted", absent, 524288, finished, AttachmentMissing},
+		{"no_transfer_state", absent, 524288, sql.NullInt64{}, AttachmentMissing},
+		{"directory", dir, 0, sql.NullInt64{}, AttachmentMissing},
+	}
+	for _, tt := range tests {
+		if got := attachmentState(tt.path, tt.total, tt.state); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// The seeded attachments point at files that don't exist here
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	attachments, err := NewStore(db).FetchChatAttachments(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("FetchChatAttachments: %v", err)
+	}
+	for _, a := range attachments {
+		if a.State != AttachmentMissing {
+			t.Errorf("%s: got %v, want missing", a.Filename, a.State)
+		}
+	}
+}
+
+func TestFetchAllAttachments(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	attachments, err := store.FetchAllAttachments(t.Context(), 0)
+	if err != nil {
+		t.Fatalf("FetchAllAttachments: %v", err)
+	}
+	if len(attachments) != 4 {
+		t.Fatalf("expected 4 attachments, got %d", len(attachments))
+	}
+	for _, a := range attachments {
+		if a.ChatID != 1 || a.ChatName != "+15551234567" {
+			t.Errorf("attachment %s: chat %d %q", a.Filename, a.ChatID, a.ChatName)
+		}
+	}
+
+	limited, err := store.FetchAllAttachments(t.Context(), 2)
+	if err != nil {
+		t.Fatalf("FetchAllAttachments(2): %v", err)
+	}
+	if len(limited) != 2 || limited[0].Filename != "menu.pdf" {
+		t.Errorf("expected the 2 newest attachments, got %+v", limited)
+	}
+}
+
+func TestFetchMessageDetail(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	d, found, err := store.FetchMessageDetail(t.Context(), 3)
+	if err != nil || !found {
+		t.Fatalf("FetchMessageDetail(3): found %v, err %v", found, err)
+	}
+	if d.ROWID != 3 || d.GUID != "msg-c1-2" || d.ChatID != 1 || !d.IsFromMe || d.Service != "iMessage" {
+		t.Errorf("unexpected detail: %+v", d)
+	}
+	if len(d.Files) != 1 {
+		t.Fatalf("expected 1 attachment, got %d", len(d.Files))
+	}
+	if f := d.Files[0]; f.MimeType != "image/jpeg" || !strings.HasSuffix(f.FilePath, "/Library/Messages/Attachments/ab/cd/att1/IMG_001.jpg") || strings.HasPrefix(f.FilePath, "~") {
+		t.Errorf("attachment: got %q %q", f.MimeType, f.FilePath)
+	}
+
+	if _, found, err := store.FetchMessageDetail(t.Context(), 999); found || err != nil {
+		t.Errorf("missing message: found %v, err %v", found, err)
+	}
+}
+
+func TestSearchAttachments(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	tests := []struct {
+		label string
+		count int
+	}{
+		{"PDF", 1},
+		{"photo", 2}, // JPEG and HEIC
+		{"Video", 1},
+		{"heic", 1}, // mime subtype
+		{"image/jpeg", 1},
+		{"spreadsheet", 0},
+		{"a", 0}, // not a substring match
+	}
+	for _, tt := range tests {
+		groups, err := store.SearchAttachments(t.Context(), tt.label, 0)
+		if err != nil {
+			t.Fatalf("SearchAttachments(%q): %v", tt.label, err)
+		}
+		total := 0
+		for _, g := range groups {
+			if g.ChatID != 1 {
+				t.Errorf("%q: unexpected chat %d", tt.label, g.ChatID)
+			}
+			total += len(g.Attachments)
+		}
+		if total != tt.count {
+			t.Errorf("SearchAttachments(%q): got %d attachments, want %d", tt.label, total, tt.count)
+		}
+		if tt.count > 0 && len(groups) != 1 {
+			t.Errorf("%q: expected 1 group, got %d", tt.label, len(groups))
+		}
+	}
+
+	groups, err := store.SearchAttachments(t.Context(), "photo", 1)
+	if err != nil || len(groups) != 1 || len(groups[0].Attachments) != 1 {
+		t.Errorf("limit 1: got %+v, %v", groups, err)
+	}
+}
+
+func TestAttachmentLabelSQL(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	for _, mime := range []string{
+		"image/jpeg", "IMAGE/HEIC", "image/heif", "image/gif", "image/png", "image/webp",
+		"video/quicktime", "audio/x-m4a", "application/pdf", "text/vcard", "text/x-markdown",
+		"application/zip", "application/x-archive", "application/x-iwork-numbers-sffnumbers",
+		"application/x-iwork-pages-sffpages", "application/x-iwork-keynote-sffkey",
+		"", " image/jpeg ", "text/plain",
+	} {
+		var got string
+		if err := db.QueryRow(`SELECT `+attachmentLabelSQL+` FROM (SELECT ? AS mime_type) a`, mime).Scan(&got); err != nil {
+			t.Fatalf("%q: %v", mime, err)
+		}
+		if want := attachmentLabel(mime); got != want {
+			t.Errorf("%q: SQL label %q, Go label %q", mime, got, want)
+		}
+	}
+}
+
+func TestDistinctHandles(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	handles, err := store.DistinctHandles(t.Context())
+	if err != nil {
+		t.Fatalf("DistinctHandles: %v", err)
+	}
+	if len(handles) != 3 {
+		t.Fatalf("expected 3 handles, got %d", len(handles))
+	}
+
+	// +15551234567 sends 5 messages in chat 1 and 3 in the group
+	want := []HandleCount{
+		{"+15551234567", 8},
+		{"jane@example.com", 3},
+		{"+15559876543", 2},
+	}
+	for i, w := range want {
+		if handles[i] != w {
+			t.Errorf("handle %d: got %+v, want %+v", i, handles[i], w)
+		}
+	}
+}
+
+func TestFindChatByHandle(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	tests := []struct {
+		handle string
+		chatID int
+		found  bool
+	}{
+		{"+15551234567", 1, true},     // direct chat preferred over the group
+		{"(555) 123-4567", 1, true},   // formatted phone
+		{"Jane@Example.com", 2, true}, // email, case-insensitive
+		{"+15559876543", 3, true},     // only in the group
+		{"+15550000000", 0, false},    // unknown
+	}
+	for _, tt := range tests {
+		chatID, found, err := store.FindChatByHandle(t.Context(), tt.handle)
+		if err != nil {
+			t.Fatalf("FindChatByHandle(%q): %v", tt.handle, err)
+		}
+		if chatID != tt.chatID || found != tt.found {
+			t.Errorf("FindChatByHandle(%q) = %d, %v; want %d, %v",
+				tt.handle, chatID, found, tt.chatID, tt.found)
+		}
+	}
+}
+
+func TestMessagesPerDay(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	days, err := store.MessagesPerDay(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("MessagesPerDay: %v", err)
+	}
+	// All chat 1 messages are one minute apart on the same day
+	if len(days) != 1 {
+		t.Fatalf("expected 1 day, got %d", len(days))
+	}
+	if days[0].Count != 10 {
+		t.Errorf("expected 10 messages, got %d", days[0].Count)
+	}
+	want := appleNanosToTime(chatdbtest.BaseAppleNanos).Format("2006-01-02")
+	if got := days[0].Day.Format("2006-01-02"); got != want {
+		t.Errorf("day: got %s, want %s", got, want)
+	}
+}
+
+func TestDatabaseSummary(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	sum, err := store.DatabaseSummary(t.Context())
+	if err != nil {
+		t.Fatalf("DatabaseSummary: %v", err)
+	}
+	if sum.Conversations != 3 || sum.Messages != 23 || sum.Attachments != 4 {
+		t.Errorf("totals: got %+v", sum)
+	}
+	if !sum.First.Equal(appleNanosToTime(chatdbtest.BaseAppleNanos)) {
+		t.Errorf("First: got %v", sum.First)
+	}
+	if want := appleNanosToTime(chatdbtest.BaseAppleNanos + 47*60_000_000_000); !sum.Last.Equal(want) {
+		t.Errorf("Last: got %v, want %v", sum.Last, want)
+	}
+}
+
+func TestMessageHourHistogram(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := NewStore(db)
+
+	hist, err := store.MessageHourHistogram(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("MessageHourHistogram: %v", err)
+	}
+	// All chat 1 messages fall within the same ten minutes
+	at := appleNanosToTime(chatdbtest.BaseAppleNanos)
+	if got := hist[at.Weekday()][at.Hour()]; got != 10 {
+		t.Errorf("expected 10 messages on %s at %02d:00, got %d", at.Weekday(), at.Hour(), got)
+	}
+	total := 0
+	for _, day := range hist {
+		for _, c := range day {
+			total += c
+		}
+	}
+	if total != 10 {
+		t.Errorf("expected 10 messages in total, got %d", total)
+	}
+}
+
+func TestQueryWithRetry(t *testing.T) {
+	orig := busyBackoff
+	busyBackoff = 2 * time.Millisecond
+	defer func() { busyBackoff = orig }()
+
+	path := filepath.Join(t.TempDir(), "busy.db")
+	writer, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open writer: %v", err)
+	}
+	defer writer.Close()
+	writer.Exec(`CREATE TABLE message (ROWID INTEGER PRIMARY KEY, text TEXT)`)
+
+	reader, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open reader: %v", err)
+	}
+	defer reader.Close()
+	store := &Store{db: reader}
+
+	t.Run("busy_then_free", func(t *testing.T) {
+		conn, err := writer.Conn(context.Background())
+		if err != nil {
+			t.Fatalf("writer conn: %v", err)
+		}
+		if _, err := conn.ExecContext(context.Background(), `BEGIN EXCLUSIVE`); err != nil {
+			t.Fatalf("lock: %v", err)
+		}
+		if _, err := store.db.Query(`SELECT COUNT(*) FROM message`); !isBusyError(err) {
+			t.Fatalf("expected a busy error while locked, got %v", err)
+		}
+
+		go func() {
+			time.Sleep(5 * time.Millisecond)
+			conn.ExecContext(context.Background(), `COMMIT`)
+			conn.Close()
+		}()
+		rows, err := store.queryWithRetry(t.Context(), `SELECT COUNT(*) FROM message`)
+		if err != nil {
+			t.Fatalf("queryWithRetry should outlast the lock: %v", err)
+		}
+		rows.Close()
+	})
+
+	t.Run("other_errors_not_retried", func(t *testing.T) {
+		calls := 0
+		err := withBusyRetry(t.Context(), func() error {
+			calls++
+			_, err := store.db.Query(`SELECT nope FROM message`)
+			return err
+		})
+		if err == nil || calls != 1 {
+			t.Errorf("expected one failed attempt, got %d (err %v)", calls, err)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		if _, err := store.FetchConversations(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestExpandTilde(t *testing.T) {
+	t.Run("with_tilde", func(t *testing.T) {
+		result := expandTilde("~/Library/Messages/test.jpg")
+		if strings.HasPrefix(result, "~/") {
+			t.Errorf("tilde not expanded: %q", result)
+		}
+		if !strings.HasSuffix(result, "/Library/Messages/test.jpg") {
+			t.Errorf("path suffix wrong: %q", result)
+		}
+	})
+
+	t.Run("without_tilde", func(t *testing.T) {
+		result := expandTilde("/usr/local/test.jpg")
+		if result != "/usr/local/test.jpg" {
+			t.Errorf("path should be unchanged: %q", result)
+		}
+	})
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		input int64
+		want  string
+	}{
+		{500, "500 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{1048576, "1.0 MB"},
+		{1073741824, "1.0 GB"},
+	}
+	for _, tt := range tests {
+		got := FormatBytes(tt.input)
+		if got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestByteUnitsFormat(t *testing.T) {
+	tests := []struct {
+		units ByteUnits
+		input int64
+		want  string
+	}{
+		{UnitsIEC, 500, "500 B"},
+		{UnitsIEC, 1536, "1.5 KiB"},
+		{UnitsIEC, 1048576, "1.0 MiB"},
+		{UnitsIEC, 1073741824, "1.0 GiB"},
+		{UnitsSI, 999, "999 B"},
+		{UnitsSI, 1500, "1.5 kB"},
+		{UnitsSI, 1048576, "1.0 MB"},
+		{UnitsSI, 2500000000, "2.5 GB"},
+		{UnitsLegacy, 1048576, "1.0 MB"},
+	}
+	for _, tt := range tests {
+		if got := tt.units.Format(tt.input); got != tt.want {
+			t.Errorf("units %d: Format(%d) = %q, want %q", tt.units, tt.input, got, tt.want)
+		}
+	}
+
+	for name, want := range map[string]ByteUnits{"legacy": UnitsLegacy, "IEC": UnitsIEC, "si": UnitsSI} {
+		if got, err := ParseByteUnits(name); err != nil || got != want {
+			t.Errorf("ParseByteUnits(%q) = %d, %v; want %d", name, got, err, want)
+		}
+	}
+	if _, err := ParseByteUnits("metric"); err == nil {
+		t.Error("ParseByteUnits(metric): expected an error")
+	}
+}
@@ -0,0 +1,86 @@
+package chatdb
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Kinds of database failure. Store methods return them wrapped in a
+// *DBError along with the driver's error, so callers can test for a kind
+// with errors.Is and explain it, while the message stays the driver's.
+var (
+	// ErrSchemaUnsupported means a query named a table or column the
+	// database doesn't have: a chat.db layout this package doesn't know.
+	ErrSchemaUnsupported = errors.New("database schema not supported")
+
+	// ErrDatabaseLocked means the database stayed busy or locked through
+	// every retry, usually because Messages was writing to it.
+	ErrDatabaseLocked = errors.New("database is locked")
+
+	// ErrPermissionDenied means the file couldn't be opened or read, which
+	// on macOS usually means the terminal lacks Full Disk Access.
+	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrNotDatabase means the file isn't a readable SQLite database, such
+	// as a damaged or partly copied chat.db.
+	ErrNotDatabase = errors.New("not a readable database")
+)
+
+// DBError is a database failure of a known Kind.
+type DBError struct {
+	Kind error // one of the Err values above
+	Err  error // the driver's error
+}
+
+func (e *DBError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap exposes both the kind and the driver's error to errors.Is and
+// errors.As.
+func (e *DBError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// ClassifyError wraps err in a *DBError when it's a failure of a known
+// kind, and returns it unchanged otherwise, including nil, cancellation,
+// and sql.ErrNoRows. Store methods already do this; it's exported for
+// errors from a *sql.DB before it's handed to NewStore, like a failed Ping.
+func ClassifyError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var dbErr *DBError
+	if errors.As(err, &dbErr) {
+		return err
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		return &DBError{Kind: ErrPermissionDenied, Err: err}
+	}
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	var kind error
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		kind = ErrDatabaseLocked
+	case sqlite3.SQLITE_PERM, sqlite3.SQLITE_AUTH, sqlite3.SQLITE_CANTOPEN:
+		kind = ErrPermissionDenied
+	case sqlite3.SQLITE_CORRUPT, sqlite3.SQLITE_NOTADB:
+		kind = ErrNotDatabase
+	case sqlite3.SQLITE_ERROR:
+		if msg := sqliteErr.Error(); strings.Contains(msg, "no such column") || strings.Contains(msg, "no such table") {
+			kind = ErrSchemaUnsupported
+		}
+	}
+	if kind == nil {
+		return err
+	}
+	return &DBError{Kind: kind, Err: err}
+}
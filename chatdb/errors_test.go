@@ -0,0 +1,87 @@
+package chatdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"modernc.org/sqlite"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb/chatdbtest"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, err := range []error{nil, context.Canceled, sql.ErrNoRows, errors.New("other")} {
+		if got := ClassifyError(err); got != err {
+			t.Errorf("ClassifyError(%v) = %v, want it unchanged", err, got)
+		}
+	}
+
+	perm := &fs.PathError{Op: "open", Path: "chat.db", Err: fs.ErrPermission}
+	err := ClassifyError(perm)
+	if !errors.Is(err, ErrPermissionDenied) || !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("permission error: got %v", err)
+	}
+	if err.Error() != perm.Error() {
+		t.Errorf("message should stay the driver's: %q", err.Error())
+	}
+	if again := ClassifyError(err); again != err {
+		t.Errorf("classifying twice should be a no-op: %v", again)
+	}
+}
+
+func TestFetchSchemaUnsupported(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	if _, err := db.Exec(`ALTER TABLE message DROP COLUMN service`); err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(db)
+
+	_, err := store.FetchMessages(t.Context(), 1, MessageCursor{}, 0)
+	if !errors.Is(err, ErrSchemaUnsupported) {
+		t.Fatalf("expected ErrSchemaUnsupported, got %v", err)
+	}
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) || !strings.Contains(err.Error(), "no such column") {
+		t.Errorf("the driver's error should still be there: %v", err)
+	}
+}
+
+func TestFetchDatabaseLocked(t *testing.T) {
+	orig := busyBackoff
+	busyBackoff = time.Millisecond
+	defer func() { busyBackoff = orig }()
+
+	path := filepath.Join(t.TempDir(), "locked.db")
+	writer, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open writer: %v", err)
+	}
+	defer writer.Close()
+	writer.Exec(`CREATE TABLE message (ROWID INTEGER PRIMARY KEY, text TEXT)`)
+	conn, err := writer.Conn(t.Context())
+	if err != nil {
+		t.Fatalf("writer conn: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(t.Context(), `BEGIN EXCLUSIVE`); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	reader, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open reader: %v", err)
+	}
+	defer reader.Close()
+	store := &Store{db: reader}
+	_, err = store.queryWithRetry(t.Context(), `SELECT COUNT(*) FROM message`)
+	if !errors.Is(err, ErrDatabaseLocked) {
+		t.Errorf("expected ErrDatabaseLocked once retries run out, got %v", err)
+	}
+}
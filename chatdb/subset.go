@@ -0,0 +1,154 @@
+package chatdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// subsetTable is one table CopyChat copies and how it picks the chat's rows.
+type subsetTable struct {
+	name  string
+	where string // "{messages}" stands for a subquery of the chat's message ids
+}
+
+// subsetTables are the tables CopyChat copies, in order. Each "?" in a
+// where clause is bound to the chat id.
+var subsetTables = []subsetTable{
+	{"handle", "ROWID IN (SELECT handle_id FROM chat_handle_join WHERE chat_id = ?) OR ROWID IN (SELECT handle_id FROM message WHERE ROWID IN ({messages}))"},
+	{"chat", "ROWID = ?"},
+	{"chat_handle_join", "chat_id = ?"},
+	{"message", "ROWID IN ({messages})"},
+	{"chat_message_join", "chat_id = ? AND message_id IN ({messages})"},
+	{"attachment", "ROWID IN (SELECT attachment_id FROM message_attachment_join WHERE message_id IN ({messages}))"},
+	{"message_attachment_join", "message_id IN ({messages})"},
+}
+
+// CopyChat copies one chat into dst, an empty database, as a self-contained
+// chat.db: its chat, message, handle and attachment rows and the join rows
+// tying them together, in tables created with the source's own definitions
+// and indexes. Messages are limited to those sent between from and to,
+// inclusive, where either may be zero for no bound. Triggers are left out;
+// Messages' triggers call functions only it defines. Returns the number of
+// messages copied.
+func (s *Store) CopyChat(ctx context.Context, dst *sql.DB, chatID int, from, to time.Time) (int, error) {
+	if chatID == OrphanChatID {
+		return 0, fmt.Errorf("orphaned messages have no chat to copy")
+	}
+	msgSel := "SELECT cmj.message_id FROM chat_message_join cmj JOIN message m ON m.ROWID = cmj.message_id WHERE cmj.chat_id = ?"
+	msgArgs := []interface{}{chatID}
+	if !from.IsZero() {
+		msgSel += " AND m.date >= ?"
+		msgArgs = append(msgArgs, timeToAppleNanos(from))
+	}
+	if !to.IsZero() {
+		msgSel += " AND m.date <= ?"
+		msgArgs = append(msgArgs, timeToAppleNanos(to))
+	}
+
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	messages := 0
+	for _, t := range subsetTables {
+		if err := s.createLike(ctx, tx, t.name); err != nil {
+			return 0, err
+		}
+		// Bind arguments in the order their placeholders appear
+		where := strings.ReplaceAll(t.where, "{messages}", msgSel)
+		var args []interface{}
+		for _, part := range strings.Split(t.where, "{messages}") {
+			for range strings.Count(part, "?") {
+				args = append(args, chatID)
+			}
+			args = append(args, msgArgs...)
+		}
+		args = args[:len(args)-len(msgArgs)] // no subquery after the last part
+
+		n, err := s.copyRows(ctx, tx, t.name, where, args)
+		if err != nil {
+			return 0, fmt.Errorf("copying %s: %w", t.name, err)
+		}
+		if t.name == "message" {
+			messages = n
+		}
+	}
+	return messages, tx.Commit()
+}
+
+// createLike creates table in tx with the source's definition, then its
+// indexes.
+func (s *Store) createLike(ctx context.Context, tx *sql.Tx, table string) error {
+	rows, err := s.queryWithRetry(ctx,
+		`SELECT type, sql FROM sqlite_master WHERE tbl_name = ? AND type IN ('table', 'index') AND sql IS NOT NULL
+		 ORDER BY type = 'index'`, table)
+	if err != nil {
+		return err
+	}
+	var stmts []string
+	found := false
+	for rows.Next() {
+		var kind, stmt string
+		if err := rows.Scan(&kind, &stmt); err != nil {
+			rows.Close()
+			return err
+		}
+		found = found || kind == "table"
+		stmts = append(stmts, stmt)
+	}
+	rows.Close()
+	if err := ClassifyError(rows.Err()); err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("source database has no %s table", table)
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("creating %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// copyRows copies table's rows matching where into the same table in tx,
+// every column as stored, and returns how many it copied.
+func (s *Store) copyRows(ctx context.Context, tx *sql.Tx, table, where string, args []interface{}) (int, error) {
+	rows, err := s.queryWithRetry(ctx, "SELECT * FROM "+table+" WHERE "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	insert, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s VALUES (%s)",
+		table, strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")))
+	if err != nil {
+		return 0, err
+	}
+	defer insert.Close()
+
+	values := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		if _, err := insert.ExecContext(ctx, values...); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, ClassifyError(rows.Err())
+}
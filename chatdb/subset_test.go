@@ -0,0 +1,72 @@
+package chatdb
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb/chatdbtest"
+)
+
+func TestCopyChat(t *testing.T) {
+	src := chatdbtest.NewDB(t)
+	defer src.Close()
+	store := NewStore(src)
+
+	dst, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "subset.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	n, err := store.CopyChat(t.Context(), dst, 1, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("CopyChat: %v", err)
+	}
+	if n != 10 {
+		t.Errorf("copied %d messages, want 10", n)
+	}
+
+	// The copy opens like any chat.db and holds only the one conversation
+	copied := NewStore(dst)
+	convs, err := copied.FetchConversations(t.Context())
+	if err != nil {
+		t.Fatalf("FetchConversations on the copy: %v", err)
+	}
+	if len(convs) != 1 || convs[0].ChatID != 1 || convs[0].MessageCount != 10 {
+		t.Fatalf("copy has conversations %+v", convs)
+	}
+	want, _ := store.FetchAllMessages(t.Context(), 1)
+	got, err := copied.FetchAllMessages(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("FetchAllMessages on the copy: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("copy has %d messages, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Text != want[i].Text || got[i].Sender != want[i].Sender || len(got[i].Attachments) != len(want[i].Attachments) {
+			t.Errorf("message %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	var handles int
+	dst.QueryRow(`SELECT COUNT(*) FROM handle`).Scan(&handles)
+	if handles != 1 {
+		t.Errorf("copy has %d handles, want just the chat's one", handles)
+	}
+
+	// A date range copies only the messages inside it
+	ranged, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "ranged.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ranged.Close()
+	n, err = store.CopyChat(t.Context(), ranged, 1, want[2].Date, want[5].Date)
+	if err != nil {
+		t.Fatalf("CopyChat with range: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("ranged copy has %d messages, want 4", n)
+	}
+}
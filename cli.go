@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+// command is a subcommand: smsDbViewer <name> [flags] [args].
+type command struct {
+	summary string
+	run     func(args []string) int
+}
+
+// commands maps subcommand names to their handlers; commandOrder is the
+// order help lists them in. Filled in by init, since the handlers' usage
+// text refers back to the table.
+var (
+	commands     map[string]command
+	commandOrder = []string{"view", "list", "search", "contacts", "export"}
+)
+
+func init() {
+	commands = map[string]command{
+		"view":     {"Browse conversations in the terminal UI (the default command).", runView},
+		"list":     {"Print conversations with their chat ids, message counts, and last activity.", runList},
+		"search":   {"Print messages matching a query, newest first.", runSearch},
+		"contacts": {"Find contacts by name and show which of their numbers and emails have conversations.", runContacts},
+		"export":   {"Export a conversation, or all of them, to CSV, text, or SQLite files.", runExport},
+	}
+}
+
+// splitCommand picks the subcommand named by the first argument. Anything
+// else, including no arguments or a database path, runs view with every
+// argument, so the original `smsDbViewer [flags] [chat.db]` form still works.
+func splitCommand(args []string) (string, []string) {
+	if len(args) > 0 {
+		if _, ok := commands[args[0]]; ok {
+			return args[0], args[1:]
+		}
+	}
+	return "view", args
+}
+
+// commandList describes every subcommand for the help text.
+func commandList() string {
+	var sb strings.Builder
+	sb.WriteString("Commands:\n")
+	for _, name := range commandOrder {
+		fmt.Fprintf(&sb, "  %-8s %s\n", name, commands[name].summary)
+	}
+	sb.WriteString("\nRun smsDbViewer <command> -h for a command's flags.\n")
+	return sb.String()
+}
+
+func runList(args []string) int {
+	fs := newFlagSet("list", "[chat.db]")
+	recent := fs.Int("recent", 0, "only the n most recently active conversations (0: all)")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+
+	store, closeStore, err := openStore(fs.Arg(0))
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	defer closeStore()
+
+	if err := listConversations(context.Background(), os.Stdout, store, chatdb.NewContactBook(), *recent); err != nil {
+		printError(err)
+		return 1
+	}
+	return 0
+}
+
+// listConversations writes one tab-aligned line per conversation, most
+// recently active first, limited to recent when it's positive.
+func listConversations(ctx context.Context, w io.Writer, store *chatdb.Store, contacts *chatdb.ContactBook, recent int) error {
+	convs, err := store.FetchConversations(ctx)
+	if err != nil {
+		return err
+	}
+	convs = mostRecentConversations(convs, recent)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHAT\tNAME\tMESSAGES\tLAST MESSAGE")
+	for _, c := range convs {
+		last := "—"
+		if !c.LastMsgDate.IsZero() {
+			last = c.LastMsgDate.Format("2006-01-02 15:04")
+		}
+		name := convItem{conv: c, contacts: contacts}.Title()
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\n", c.ChatID, name, c.MessageCount, last)
+	}
+	return tw.Flush()
+}
+
+func runSearch(args []string) int {
+	fs := newFlagSet("search", "<query> [chat.db]")
+	fold := fs.Bool("fold", false, "ignore case and accents (\"jose\" finds \"José\")")
+	limit := fs.Int("limit", 100, "most results to print")
+	sortBy := fs.String("sort", "date", "result order: date, oldest, relevance, or chat")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	// Flag parsing stops at the query, so a flag after it would be taken
+	// for the database path
+	if fs.NArg() > 2 || strings.HasPrefix(fs.Arg(1), "-") {
+		fmt.Fprintln(os.Stderr, "Error: expected <query> [chat.db]; flags go before the query, and a query with spaces needs quotes")
+		return 2
+	}
+	mode, ok := searchSortModeNamed(*sortBy)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: --sort: unknown order %q\n", *sortBy)
+		return 2
+	}
+
+	store, closeStore, err := openStore(fs.Arg(1))
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	defer closeStore()
+
+	err = printSearchResults(context.Background(), os.Stdout, store, chatdb.NewContactBook(), fs.Arg(0), *limit, *fold, mode)
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	return 0
+}
+
+// searchSortModeNamed maps a --sort value to its sort mode.
+func searchSortModeNamed(name string) (searchSortMode, bool) {
+	switch strings.ToLower(name) {
+	case "date", "newest":
+		return sortDateDesc, true
+	case "oldest":
+		return sortDateAsc, true
+	case "relevance":
+		return sortRelevance, true
+	case "chat":
+		return sortChat, true
+	}
+	return 0, false
+}
+
+// printSearchResults writes the messages matching query, one tab-aligned
+// line each, with newlines in the text folded to spaces.
+func printSearchResults(ctx context.Context, w io.Writer, store *chatdb.Store, contacts *chatdb.ContactBook, query string, limit int, fold bool, mode searchSortMode) error {
+	search := store.SearchMessages
+	if fold {
+		search = store.SearchMessagesFolded
+	}
+	results, err := search(ctx, query, limit)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range sortSearchResults(results, mode, query) {
+		sender := "Me"
+		if !r.IsFromMe {
+			sender = contacts.ResolveName(r.Sender)
+			if sender == "" {
+				sender = "Unknown"
+			}
+		}
+		text := strings.Join(strings.Fields(r.Text), " ")
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Date.Format("2006-01-02 15:04"), r.ChatName, sender, text)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d results\n", len(results))
+	return nil
+}
+
+func runContacts(args []string) int {
+	fs := newFlagSet("contacts", "<name> [chat.db]")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	store, closeStore, err := openStore(fs.Arg(1))
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	defer closeStore()
+
+	contacts := chatdb.NewContactBook()
+	if err := contacts.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", contactsWarning(err))
+	}
+	if err := printContactMatches(context.Background(), os.Stdout, store, contacts, fs.Arg(0)); err != nil {
+		printError(err)
+		return 1
+	}
+	return 0
+}
+
+// printContactMatches lists the contacts whose name matches query, each
+// followed by its phone numbers and emails and, for those in the database,
+// the chat with them and how many messages they've sent.
+func printContactMatches(ctx context.Context, w io.Writer, store *chatdb.Store, contacts *chatdb.ContactBook, query string) error {
+	matches := contacts.Search(query)
+	if len(matches) == 0 {
+		fmt.Fprintf(w, "No contacts match %q\n", query)
+		return nil
+	}
+	handles, err := store.DistinctHandles(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range matches {
+		fmt.Fprintln(tw, c.Name)
+		for _, addr := range append(append([]string(nil), c.Phones...), c.Emails...) {
+			h, ok := chatdb.MatchHandle(handles, addr)
+			if !ok {
+				fmt.Fprintf(tw, "  %s\tno conversation\t\n", addr)
+				continue
+			}
+			chatID, found, err := store.FindChatByHandle(ctx, h.Handle)
+			if err != nil {
+				return err
+			}
+			chat := "no chat"
+			if found {
+				chat = fmt.Sprintf("chat %d", chatID)
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%d messages from %s\n", addr, chat, h.MessageCount, h.Handle)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d contacts\n", len(matches))
+	return nil
+}
+
+func runExport(args []string) int {
+	fs := newFlagSet("export", "(--chat id | --handle phone-or-email | --all) [chat.db]")
+	chatID := fs.Int("chat", 0, "chat id to export (see the list command)")
+	handle := fs.String("handle", "", "export the conversation with this phone number or email")
+	all := fs.Bool("all", false, "export every conversation into a new directory, one file each")
+	dir := fs.String("dir", "", "with --all, the directory to write into (default: smsDbViewer_export_<timestamp>)")
+	dryRun := fs.Bool("dry-run", false, "with --all, list the files and message counts that would be written, without writing")
+	appendTo := fs.String("append", "", "keep this CSV file up to date: write the whole conversation the first time, then only messages added since")
+	format := fs.String("format", "csv", "file format: csv, text, sqlite (a chat.db holding just this conversation), or attachments (a CSV of its attachments)")
+	columnSpec := fs.String("columns", "", "comma-separated CSV columns, e.g. timestamp,from,body (default: all)")
+	appleDates := fs.Bool("apple-dates", false, "add an AppleDate column with each message's raw chat.db date")
+	anonymize := fs.Bool("anonymize", false, "replace phone numbers, emails, and names with pseudonyms")
+	redactBodies := fs.Bool("redact-bodies", false, "replace message text with its length")
+	units := fs.String("units", "legacy", "size labels: legacy (1024-based, KB/MB), iec (KiB/MiB), or si (1000-based, kB/MB)")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+	selected := 0
+	for _, set := range []bool{*chatID != 0, *handle != "", *all} {
+		if set {
+			selected++
+		}
+	}
+	if selected != 1 {
+		fmt.Fprintln(os.Stderr, "Error: pass exactly one of --chat, --handle, or --all")
+		return 2
+	}
+	if !*all && (*dryRun || *dir != "") {
+		fmt.Fprintln(os.Stderr, "Error: --dry-run and --dir only apply to --all")
+		return 2
+	}
+	if *appendTo != "" && (*all || strings.ToLower(*format) != "csv") {
+		fmt.Fprintln(os.Stderr, "Error: --append keeps one conversation's CSV file up to date; it can't be combined with --all or another --format")
+		return 2
+	}
+	csvCols, err := parseCSVColumns(*columnSpec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --columns: %v\n", err)
+		return 2
+	}
+	if *appleDates {
+		csvCols = withAppleDates(csvCols)
+	}
+	sizeUnits, err := chatdb.ParseByteUnits(*units)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --units: %v\n", err)
+		return 2
+	}
+	privacy := exportPrivacy{anonymize: *anonymize, redactBodies: *redactBodies}
+	var cw chatWriter
+	var export exportFunc
+	switch strings.ToLower(*format) {
+	case "csv":
+		cw = csvWriter(csvCols, privacy, sizeUnits)
+	case "text", "txt":
+		cw = textWriter(privacy, sizeUnits)
+	case "sqlite", "db":
+		if *all || *anonymize || *redactBodies {
+			fmt.Fprintln(os.Stderr, "Error: --format sqlite copies one conversation as stored; it can't be combined with --all, --anonymize, or --redact-bodies")
+			return 2
+		}
+		export = sqliteExporter()
+	case "attachments":
+		if *all || *columnSpec != "" || *anonymize || *redactBodies {
+			fmt.Fprintln(os.Stderr, "Error: --format attachments lists one conversation's attachments; it can't be combined with --all, --columns, --anonymize, or --redact-bodies")
+			return 2
+		}
+		export = attachmentListExporter()
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --format: unknown format %q (valid: csv, text, sqlite, attachments)\n", *format)
+		return 2
+	}
+	added := 0
+	if *appendTo != "" {
+		export = csvAppender(csvCols, privacy, sizeUnits, *appendTo, &added)
+	}
+	if export == nil {
+		export = cw.exporter()
+	}
+
+	store, closeStore, err := openStore(fs.Arg(0))
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	defer closeStore()
+
+	if *all {
+		if *dir == "" {
+			*dir = "smsDbViewer_export_" + time.Now().Format("20060102_150405")
+		}
+		if err := exportAll(context.Background(), os.Stdout, store, chatdb.NewContactBook(), *dir, cw, *dryRun); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	}
+
+	path, err := exportConversation(context.Background(), store, chatdb.NewContactBook(), *chatID, *handle, export)
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	if *appendTo != "" {
+		fmt.Printf("%s: %d new messages\n", path, added)
+		return 0
+	}
+	fmt.Println(path)
+	return 0
+}
+
+// exportConversation runs export on the chat with chatID, or, when handle
+// is set, the chat found for it the way --open finds one. Returns the path
+// written.
+func exportConversation(ctx context.Context, store *chatdb.Store, contacts *chatdb.ContactBook, chatID int, handle string, export exportFunc) (string, error) {
+	if handle != "" {
+		id, found, err := store.FindChatByHandle(ctx, handle)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "", fmt.Errorf("no conversation found for %s", handle)
+		}
+		chatID = id
+	}
+
+	convs, err := store.FetchConversations(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, conv := range convs {
+		if conv.ChatID == chatID {
+			title := convItem{conv: conv, contacts: contacts}.Title()
+			return export(ctx, store, contacts, chatID, conv.Participants, title, dateRange{})
+		}
+	}
+	return "", fmt.Errorf("no conversation with chat id %d", chatID)
+}
+
+// exportJob is one file export --all writes.
+type exportJob struct {
+	conv     chatdb.Conversation
+	title    string
+	path     string
+	messages int
+}
+
+// planExportAll picks the file under dir for every conversation with
+// messages, without touching disk. Names end in the chat id, so chats with
+// the same name don't collide, and are generic when anonymizing.
+func planExportAll(convs []chatdb.Conversation, contacts *chatdb.ContactBook, dir string, cw chatWriter) []exportJob {
+	var jobs []exportJob
+	for _, conv := range convs {
+		if conv.MessageCount == 0 {
+			continue
+		}
+		title := convItem{conv: conv, contacts: contacts}.Title()
+		name := title
+		if cw.privacy.anonymize {
+			name = "chat"
+		}
+		jobs = append(jobs, exportJob{
+			conv:     conv,
+			title:    title,
+			path:     filepath.Join(dir, fmt.Sprintf("%s_%d%s", fileSafeName(name), conv.ChatID, cw.ext)),
+			messages: conv.MessageCount,
+		})
+	}
+	return jobs
+}
+
+// exportAll exports every conversation into dir, reporting each file and
+// then the totals to w. With dryRun it only reports the plan and writes
+// nothing, not even dir.
+func exportAll(ctx context.Context, w io.Writer, store *chatdb.Store, contacts *chatdb.ContactBook, dir string, cw chatWriter, dryRun bool) error {
+	convs, err := store.FetchConversations(ctx)
+	if err != nil {
+		return err
+	}
+	jobs := planExportAll(convs, contacts, dir, cw)
+
+	total := 0
+	for _, job := range jobs {
+		total += job.messages
+	}
+	if dryRun {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "FILE\tMESSAGES")
+		for _, job := range jobs {
+			fmt.Fprintf(tw, "%s\t%d\n", job.path, job.messages)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Would write %d files, %d messages (dry run, nothing written)\n", len(jobs), total)
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		path, err := cw.exportTo(ctx, store, contacts, job.conv.ChatID, job.conv.Participants, job.title, dateRange{}, job.path)
+		if err != nil {
+			return fmt.Errorf("exporting %s: %w", job.title, err)
+		}
+		fmt.Fprintln(w, path)
+	}
+	fmt.Fprintf(w, "Wrote %d files, %d messages\n", len(jobs), total)
+	return nil
+}
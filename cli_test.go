@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+	"github.com/aftaylor2/smsDbViewer/chatdb/chatdbtest"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantName string
+		wantArgs []string
+	}{
+		{nil, "view", nil},
+		{[]string{"list", "--recent", "5"}, "list", []string{"--recent", "5"}},
+		{[]string{"search", "lunch"}, "search", []string{"lunch"}},
+		{[]string{"--open", "+15551234567"}, "view", []string{"--open", "+15551234567"}},
+		{[]string{"/tmp/chat.db"}, "view", []string{"/tmp/chat.db"}},
+	}
+	for _, tt := range tests {
+		name, args := splitCommand(tt.args)
+		if name != tt.wantName || !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("splitCommand(%q) = %q, %q; want %q, %q", tt.args, name, args, tt.wantName, tt.wantArgs)
+		}
+	}
+}
+
+func TestListConversations(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+
+	var out bytes.Buffer
+	if err := listConversations(t.Context(), &out, chatdb.NewStore(db), contacts, 2); err != nil {
+		t.Fatalf("listConversations: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("want a header and 2 conversations, got:\n%s", out.String())
+	}
+	if !strings.HasPrefix(lines[0], "CHAT") {
+		t.Errorf("header: %q", lines[0])
+	}
+	if !strings.Contains(out.String(), "Family Group") {
+		t.Errorf("most recent conversation missing:\n%s", out.String())
+	}
+}
+
+func TestPrintSearchResults(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+
+	var out bytes.Buffer
+	err := printSearchResults(t.Context(), &out, chatdb.NewStore(db), contacts, "lunch", 100, false, sortDateDesc)
+	if err != nil {
+		t.Fatalf("printSearchResults: %v", err)
+	}
+	if !strings.Contains(out.String(), "  Me  Doing great! Want to grab lunch?") {
+		t.Errorf("result line missing:\n%s", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "1 results\n") {
+		t.Errorf("count missing:\n%s", out.String())
+	}
+}
+
+func TestRunSearchArgs(t *testing.T) {
+	// Each is rejected before any database is opened
+	for _, args := range [][]string{
+		{"lunch", "--fold"},
+		{"lunch", "plans", "chat.db"},
+	} {
+		if status := runSearch(args); status != 2 {
+			t.Errorf("runSearch(%q) = %d, want 2", args, status)
+		}
+	}
+}
+
+func TestPrintContactMatches(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"(555) 123-4567", "555-000-1111"}})
+	contacts.Add(&chatdb.Contact{Name: "Jane Roe", Emails: []string{"Jane@Example.com"}})
+
+	var out bytes.Buffer
+	if err := printContactMatches(t.Context(), &out, chatdb.NewStore(db), contacts, "john"); err != nil {
+		t.Fatalf("printContactMatches: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || lines[0] != "John Doe" || lines[3] != "1 contacts" {
+		t.Fatalf("want the contact, its two numbers, and a count, got:\n%s", out.String())
+	}
+	if !strings.Contains(lines[1], "(555) 123-4567") || !strings.Contains(lines[1], "chat 1") || !strings.Contains(lines[1], "+15551234567") {
+		t.Errorf("known number should show its chat and handle: %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "555-000-1111") || !strings.Contains(lines[2], "no conversation") {
+		t.Errorf("unknown number: %q", lines[2])
+	}
+
+	out.Reset()
+	if err := printContactMatches(t.Context(), &out, chatdb.NewStore(db), contacts, "jane"); err != nil {
+		t.Fatalf("printContactMatches: %v", err)
+	}
+	if !strings.Contains(out.String(), "chat 2") {
+		t.Errorf("email should match case-insensitively:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := printContactMatches(t.Context(), &out, chatdb.NewStore(db), contacts, "bob"); err != nil {
+		t.Fatalf("printContactMatches: %v", err)
+	}
+	if !strings.Contains(out.String(), "No contacts match") {
+		t.Errorf("no match: %q", out.String())
+	}
+}
+
+func TestExportConversation(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := chatdb.NewStore(db)
+	contacts := &chatdb.ContactBook{}
+
+	path, err := exportConversation(t.Context(), store, contacts, 0, "jane@example.com", textExporter(exportPrivacy{}, chatdb.UnitsLegacy))
+	if err != nil {
+		t.Fatalf("export by handle: %v", err)
+	}
+	defer os.Remove(path)
+	if !strings.HasSuffix(path, ".txt") {
+		t.Errorf("path = %q, want a .txt file", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	if !strings.Contains(string(data), "Thanks Jane!") {
+		t.Errorf("transcript is for the wrong chat:\n%s", data)
+	}
+
+	if _, err := exportConversation(t.Context(), store, contacts, 99, "", exportCSV); err == nil {
+		t.Error("unknown chat id should fail")
+	}
+	if _, err := exportConversation(t.Context(), store, contacts, 0, "+19999999999", exportCSV); err == nil {
+		t.Error("unknown handle should fail")
+	}
+}
+
+func TestExportAll(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := chatdb.NewStore(db)
+	contacts := &chatdb.ContactBook{}
+	dir := filepath.Join(t.TempDir(), "export")
+
+	var out bytes.Buffer
+	if err := exportAll(t.Context(), &out, store, contacts, dir, csvWriter(nil, exportPrivacy{}, chatdb.UnitsLegacy), true); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if !strings.Contains(out.String(), filepath.Join(dir, "Family_Group_3.csv")) {
+		t.Errorf("plan is missing the group chat file:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Would write 3 files") {
+		t.Errorf("plan is missing the totals:\n%s", out.String())
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("dry run created %s (stat err %v)", dir, err)
+	}
+
+	out.Reset()
+	if err := exportAll(t.Context(), &out, store, contacts, dir, textWriter(exportPrivacy{}, chatdb.UnitsLegacy), false); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("wrote %d files, want 3:\n%s", len(entries), out.String())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "Family_Group_3.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Happy birthday everyone!") {
+		t.Errorf("group transcript is for the wrong chat:\n%s", data)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// resolveDatabasePath checks that path names a readable file before SQLite
+// sees it, since its errors for a missing file or a directory are cryptic.
+// A directory holding a chat.db (usually ~/Library/Messages) resolves to
+// that file.
+func resolveDatabasePath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%s: file not found", path)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return path, nil
+	}
+
+	inner := filepath.Join(path, "chat.db")
+	info, err = os.Stat(inner)
+	if err != nil || info.IsDir() {
+		return "", fmt.Errorf("%s is a directory without a chat.db; pass the path to chat.db itself", path)
+	}
+	return inner, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveDatabasePath(t *testing.T) {
+	dir := t.TempDir()
+	messages := filepath.Join(dir, "Messages")
+	if err := os.Mkdir(messages, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(messages, "chat.db")
+	if err := os.WriteFile(dbPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr string
+	}{
+		{"file", dbPath, dbPath, ""},
+		{"directory with chat.db", messages, dbPath, ""},
+		{"directory without chat.db", dir, "", "is a directory without a chat.db"},
+		{"missing", filepath.Join(dir, "nope.db"), "", "file not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveDatabasePath(tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+// duplicateWindow is how close in time two identical messages must be to
+// count as one row stored twice. Imports that duplicate rows copy the
+// timestamp along with everything else, while someone really sending "ok"
+// twice is seconds apart, so it's kept tight.
+const duplicateWindow = time.Second
+
+// duplicateRuns finds runs of adjacent messages that look like one message
+// stored more than once. counts maps the ROWID of each run's first message
+// to the run's length, and hidden holds the ROWIDs of the rest.
+func duplicateRuns(messages []chatdb.Message) (counts map[int]int, hidden map[int]bool) {
+	counts, hidden = map[int]int{}, map[int]bool{}
+	first := 0
+	for i := 1; i < len(messages); i++ {
+		if !isDuplicate(messages[first], messages[i]) {
+			first = i
+			continue
+		}
+		hidden[messages[i].ROWID] = true
+		if counts[messages[first].ROWID] == 0 {
+			counts[messages[first].ROWID] = 1
+		}
+		counts[messages[first].ROWID]++
+	}
+	return counts, hidden
+}
+
+// isDuplicate reports whether msg repeats orig: same direction, sender,
+// text, attachments and reply target, within duplicateWindow. A repeat that
+// collected its own reactions was seen as a separate message, so it's kept.
+func isDuplicate(orig, msg chatdb.Message) bool {
+	if msg.IsFromMe != orig.IsFromMe || msg.Sender != orig.Sender || msg.Text != orig.Text ||
+		msg.ThreadOriginator != orig.ThreadOriginator || len(msg.Reactions) > 0 ||
+		!slices.Equal(msg.Attachments, orig.Attachments) {
+		return false
+	}
+	return msg.Date.Sub(orig.Date).Abs() <= duplicateWindow
+}
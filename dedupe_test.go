@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+	"github.com/aftaylor2/smsDbViewer/chatdb/chatdbtest"
+)
+
+func TestDuplicateRuns(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+
+	// An import stored one message three times, half a second apart, and
+	// "ok" was really sent twice a minute apart
+	insert := func(guid, text string, date int64) {
+		res, err := db.Exec(`INSERT INTO message (guid, text, handle_id, service, date, is_from_me)
+			VALUES (?, ?, 1, 'SMS', ?, 0)`, guid, text, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		db.Exec(`INSERT INTO chat_message_join (chat_id, message_id, message_date) VALUES (1, ?, ?)`, id, date)
+	}
+	const later = chatdbtest.BaseAppleNanos + 60*60_000_000_000
+	insert("dup-1", "Imported twice", later)
+	insert("dup-2", "Imported twice", later+500_000_000)
+	insert("dup-3", "Imported twice", later+900_000_000)
+	insert("ok-1", "ok", later+60_000_000_000)
+	insert("ok-2", "ok", later+120_000_000_000)
+
+	msgs, err := chatdb.NewStore(db).FetchAllMessages(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("FetchAllMessages: %v", err)
+	}
+	counts, hidden := duplicateRuns(msgs)
+	byGUID := map[string]int{}
+	for _, msg := range msgs {
+		byGUID[msg.GUID] = msg.ROWID
+	}
+	if got := counts[byGUID["dup-1"]]; got != 3 {
+		t.Errorf("run count = %d, want 3", got)
+	}
+	if !hidden[byGUID["dup-2"]] || !hidden[byGUID["dup-3"]] || hidden[byGUID["dup-1"]] {
+		t.Errorf("hidden = %v, want dup-2 and dup-3 only", hidden)
+	}
+	if hidden[byGUID["ok-2"]] || counts[byGUID["ok-1"]] != 0 {
+		t.Error("messages a minute apart aren't duplicates")
+	}
+	if len(hidden) != 2 {
+		t.Errorf("hidden %d messages, want 2", len(hidden))
+	}
+
+	m := model{
+		viewport: viewport.New(120, 20),
+		contacts: &chatdb.ContactBook{},
+		opts:     modelOptions{collapseDupes: true},
+		messages: msgs,
+		focus:    -1,
+	}
+	out := ansi.Strip(m.renderMessages())
+	if n := strings.Count(out, "Imported twice"); n != 1 {
+		t.Errorf("duplicates shown %d times, want 1:\n%s", n, out)
+	}
+	if !strings.Contains(out, "Imported twice  ×3") {
+		t.Errorf("collapsed message should carry ×3:\n%s", out)
+	}
+}
@@ -1,90 +1,651 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
 )
 
 var nonAlphaNum = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
 
-// exportCSV writes all messages for a chat to a CSV file.
-// Returns the path of the written file.
-func exportCSV(store *Store, contacts *ContactBook, chatID int, participants []string, chatTitle string) (string, error) {
-	messages, err := store.FetchAllMessages(chatID)
+// exportFunc writes a chat to a file and returns the path written.
+type exportFunc func(ctx context.Context, store *chatdb.Store, contacts *chatdb.ContactBook, chatID int, participants []string, chatTitle string, span dateRange) (string, error)
+
+// dateRange bounds an export to messages sent between From and To,
+// inclusive. The zero value covers the whole conversation.
+type dateRange struct {
+	From, To time.Time
+}
+
+// csvRow is what a CSV column extractor sees for one message.
+type csvRow struct {
+	msg   chatdb.Message
+	from  string
+	to    string
+	units chatdb.ByteUnits // how AttachmentSize writes sizes
+}
+
+// csvColumn is one selectable CSV column: its header and how to fill it.
+type csvColumn struct {
+	header  string
+	extract func(r csvRow) string
+}
+
+// csvColumns maps the names accepted by --columns (the header, lowercased)
+// to their columns.
+var csvColumns = map[string]csvColumn{
+	"timestamp": {"Timestamp", func(r csvRow) string { return r.msg.Date.Format("2006-01-02 15:04:05") }},
+	"appledate": {"AppleDate", func(r csvRow) string { return strconv.FormatInt(r.msg.RawDate, 10) }},
+	"from":      {"From", func(r csvRow) string { return r.from }},
+	"to":        {"To", func(r csvRow) string { return r.to }},
+	"body":      {"Body", func(r csvRow) string { return r.msg.Text }},
+	"service":   {"Service", func(r csvRow) string { return r.msg.Service }},
+	"attachmenttype": {"AttachmentType", func(r csvRow) string {
+		var types []string
+		for _, a := range r.msg.Attachments {
+			types = append(types, a.TypeLabel)
+		}
+		return strings.Join(types, "; ")
+	}},
+	"attachmentfile": {"AttachmentFile", func(r csvRow) string {
+		var files []string
+		for _, a := range r.msg.Attachments {
+			if a.Filename != "" {
+				files = append(files, a.Filename)
+			}
+		}
+		return strings.Join(files, "; ")
+	}},
+	"attachmentsize": {"AttachmentSize", func(r csvRow) string {
+		var sizes []string
+		for _, a := range r.msg.Attachments {
+			if a.Size > 0 {
+				sizes = append(sizes, r.units.Format(a.Size))
+			}
+		}
+		return strings.Join(sizes, "; ")
+	}},
+}
+
+// defaultCSVColumns is the full column set, in the default order.
+var defaultCSVColumns = []string{
+	"timestamp", "from", "to", "body", "service",
+	"attachmenttype", "attachmentfile", "attachmentsize",
+}
+
+// extraCSVColumns are left out unless asked for: AppleDate is the raw
+// message.date, for tools that read chat.db timestamps rather than
+// formatted ones.
+var extraCSVColumns = []string{"appledate"}
+
+// parseCSVColumns turns a comma-separated column spec such as
+// "timestamp,from,body" into column names, rejecting unknown ones. Names are
+// case-insensitive; an empty spec selects defaultCSVColumns.
+func parseCSVColumns(spec string) ([]string, error) {
+	if strings.TrimSpace(spec) == "" {
+		return defaultCSVColumns, nil
+	}
+	var columns []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := csvColumns[name]; !ok {
+			valid := append(append([]string(nil), defaultCSVColumns...), extraCSVColumns...)
+			return nil, fmt.Errorf("unknown CSV column %q (valid: %s)", name, strings.Join(valid, ", "))
+		}
+		columns = append(columns, name)
+	}
+	return columns, nil
+}
+
+// withAppleDates adds the AppleDate column to columns, last so the others
+// keep their places, unless it's already there.
+func withAppleDates(columns []string) []string {
+	for _, name := range columns {
+		if name == "appledate" {
+			return columns
+		}
+	}
+	return append(append([]string(nil), columns...), "appledate")
+}
+
+// exportCSV writes the messages for a chat within span to a CSV file with
+// the default columns. Returns the path of the written file.
+func exportCSV(ctx context.Context, store *chatdb.Store, contacts *chatdb.ContactBook, chatID int, participants []string, chatTitle string, span dateRange) (string, error) {
+	return csvExporter(defaultCSVColumns, exportPrivacy{}, chatdb.UnitsLegacy)(ctx, store, contacts, chatID, participants, chatTitle, span)
+}
+
+// chatWriter is a file format for exporting one chat: the extension, the
+// privacy to apply, and how to write the messages once it has been applied.
+type chatWriter struct {
+	ext     string
+	privacy exportPrivacy
+	write   func(f *os.File, messages []chatdb.Message, participants []string, contacts *chatdb.ContactBook)
+}
+
+// exportTo writes a chat's messages within span to path, or, when path is
+// "", to a timestamped file named after the chat in the current directory.
+// Returns the path written.
+func (cw chatWriter) exportTo(ctx context.Context, store *chatdb.Store, contacts *chatdb.ContactBook, chatID int, participants []string, chatTitle string, span dateRange, path string) (string, error) {
+	messages, err := store.FetchMessagesBetween(ctx, chatID, span.From, span.To)
 	if err != nil {
 		return "", err
 	}
+	messages, participants, contacts, chatTitle = cw.privacy.apply(messages, participants, contacts, chatTitle)
 
-	filename := buildExportFilename(chatTitle, participants, contacts)
-	f, err := os.Create(filename)
+	if path == "" {
+		path = exportBaseName(chatTitle, participants, contacts) + cw.ext
+	}
+	f, err := os.Create(path)
 	if err != nil {
 		return "", err
 	}
 	defer f.Close()
 
-	// Header
-	f.WriteString("Timestamp,From,To,Body,Service,AttachmentType,AttachmentFile,AttachmentSize\n")
+	cw.write(f, messages, participants, contacts)
+	return path, nil
+}
 
-	// Resolve participant names for the "To" field
-	var resolvedParticipants []string
-	for _, p := range participants {
-		resolvedParticipants = append(resolvedParticipants, contacts.ResolveName(p))
+// exporter adapts cw to an exportFunc, which always picks the filename.
+func (cw chatWriter) exporter() exportFunc {
+	return func(ctx context.Context, store *chatdb.Store, contacts *chatdb.ContactBook, chatID int, participants []string, chatTitle string, span dateRange) (string, error) {
+		return cw.exportTo(ctx, store, contacts, chatID, participants, chatTitle, span, "")
 	}
-	participantsStr := strings.Join(resolvedParticipants, "; ")
+}
 
+// csvExporter returns an exportFunc writing only the named columns, in the
+// given order, or every column when columns is empty, with privacy applied
+// and sizes written in units. Names must already be validated with
+// parseCSVColumns.
+func csvExporter(columns []string, privacy exportPrivacy, units chatdb.ByteUnits) exportFunc {
+	return csvWriter(columns, privacy, units).exporter()
+}
+
+// csvWriter is the chatWriter behind csvExporter.
+func csvWriter(columns []string, privacy exportPrivacy, units chatdb.ByteUnits) chatWriter {
+	if len(columns) == 0 {
+		columns = defaultCSVColumns
+	}
+	write := func(f *os.File, messages []chatdb.Message, participants []string, contacts *chatdb.ContactBook) {
+		writeCSVHeader(f, columns)
+		writeCSVRows(f, columns, units, messages, participants, contacts)
+	}
+	return chatWriter{ext: ".csv", privacy: privacy, write: write}
+}
+
+// writeCSVHeader writes the header line for the named columns.
+func writeCSVHeader(w io.Writer, columns []string) {
+	headers := make([]string, len(columns))
+	for i, name := range columns {
+		headers[i] = csvColumns[name].header
+	}
+	io.WriteString(w, strings.Join(headers, ",")+"\n")
+}
+
+// writeCSVRows writes one CSV line per message with the named columns and
+// sizes in units.
+func writeCSVRows(w io.Writer, columns []string, units chatdb.ByteUnits, messages []chatdb.Message, participants []string, contacts *chatdb.ContactBook) {
+	fields := make([]string, len(columns))
 	for _, msg := range messages {
-		ts := msg.Date.Format("2006-01-02 15:04:05")
+		row := csvRow{msg: msg, from: "Me", to: recipientNames(msg, participants, contacts), units: units}
+		if !msg.IsFromMe {
+			row.from = senderName(msg, participants, contacts)
+		}
 
-		var from, to string
-		if msg.IsFromMe {
-			from = "Me"
-			to = participantsStr
+		for i, name := range columns {
+			fields[i] = csvEscape(csvColumns[name].extract(row))
+		}
+		io.WriteString(w, strings.Join(fields, ",")+"\n")
+	}
+}
+
+// exportCursor is the sidecar file an appending export keeps next to its
+// CSV, recording which chat the file holds, the newest message in it and
+// how its rows were written, so later runs can't mix in rows of another
+// shape.
+type exportCursor struct {
+	ChatID       int              `json:"chat_id"`
+	ROWID        int              `json:"rowid"`
+	Columns      []string         `json:"columns"`
+	Anonymize    bool             `json:"anonymize"`
+	RedactBodies bool             `json:"redact_bodies"`
+	Units        chatdb.ByteUnits `json:"units"`
+}
+
+// cursorPath is where the sidecar for the CSV at path lives.
+func cursorPath(path string) string {
+	return path + ".cursor"
+}
+
+// check reports why rows for chatID with these columns, privacy settings
+// and size units can't be appended to the file the cursor belongs to.
+func (c exportCursor) check(path string, chatID int, columns []string, privacy exportPrivacy, units chatdb.ByteUnits) error {
+	switch {
+	case c.ChatID != chatID:
+		return fmt.Errorf("%s holds chat %d, not chat %d", path, c.ChatID, chatID)
+	case !slices.Equal(c.Columns, columns):
+		return fmt.Errorf("%s has columns %s, not %s", path, strings.Join(c.Columns, ","), strings.Join(columns, ","))
+	case c.Anonymize != privacy.anonymize || c.RedactBodies != privacy.redactBodies:
+		return fmt.Errorf("%s was written with different anonymize or redact settings", path)
+	case c.Units != units:
+		return fmt.Errorf("%s was written with different --units", path)
+	}
+	return nil
+}
+
+// writeCursor replaces the sidecar for the CSV at path in one step, so
+// it's never left half written.
+func writeCursor(path string, cursor exportCursor) error {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return err
+	}
+	tmp := cursorPath(path) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, cursorPath(path)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// csvAppender returns an exportFunc that keeps the CSV at path up to date
+// for incremental backups. The first run writes the whole chat, like a
+// normal export; later runs add only the messages written to the database
+// since, found from the sidecar cursor, and leave the rest of the file
+// alone. Runs with other columns or privacy settings than the file was
+// started with are refused, as are other size units. The number of messages written is stored in
+// *added.
+//
+// The rows are written before the cursor, and a failure to write either
+// cuts the file back to where it was. Only a crash between the two can
+// leave rows the cursor doesn't cover, which the next run writes again.
+func csvAppender(columns []string, privacy exportPrivacy, units chatdb.ByteUnits, path string, added *int) exportFunc {
+	if len(columns) == 0 {
+		columns = defaultCSVColumns
+	}
+	return func(ctx context.Context, store *chatdb.Store, contacts *chatdb.ContactBook, chatID int, participants []string, chatTitle string, span dateRange) (string, error) {
+		cursor := exportCursor{ChatID: chatID, Columns: columns, Anonymize: privacy.anonymize, RedactBodies: privacy.redactBodies, Units: units}
+		info, statErr := os.Stat(path)
+		switch {
+		case os.IsNotExist(statErr):
+		case statErr != nil:
+			return "", statErr
+		default:
+			data, err := os.ReadFile(cursorPath(path))
+			if os.IsNotExist(err) {
+				return "", fmt.Errorf("%s exists but %s doesn't, so where the last export stopped is unknown", path, cursorPath(path))
+			}
+			if err != nil {
+				return "", err
+			}
+			var saved exportCursor
+			if err := json.Unmarshal(data, &saved); err != nil {
+				return "", fmt.Errorf("reading %s: %w", cursorPath(path), err)
+			}
+			if err := saved.check(path, chatID, columns, privacy, units); err != nil {
+				return "", err
+			}
+			cursor.ROWID = saved.ROWID
+		}
+
+		var messages []chatdb.Message
+		var err error
+		if statErr == nil {
+			messages, err = store.FetchMessagesAfter(ctx, chatID, cursor.ROWID)
 		} else {
-			from = contacts.ResolveName(msg.Sender)
-			to = "Me"
+			messages, err = store.FetchAllMessages(ctx, chatID)
+		}
+		if err != nil {
+			return "", err
+		}
+		for _, msg := range messages {
+			cursor.ROWID = max(cursor.ROWID, msg.ROWID)
+		}
+		messages, participants, contacts, _ = privacy.apply(messages, participants, contacts, chatTitle)
+
+		var buf bytes.Buffer
+		if statErr != nil {
+			writeCSVHeader(&buf, columns)
+		}
+		writeCSVRows(&buf, columns, units, messages, participants, contacts)
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return "", err
+		}
+		_, err = f.Write(buf.Bytes())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = writeCursor(path, cursor)
+		}
+		if err != nil {
+			if statErr != nil {
+				os.Remove(path)
+			} else {
+				os.Truncate(path, info.Size())
+			}
+			return "", err
+		}
+		*added = len(messages)
+		return path, nil
+	}
+}
+
+// senderName names the sender of a received message in an export: the
+// contact name, or when no contact matches, the handle as Messages first
+// recorded it (often a formatted number) and failing that the raw handle.
+// Messages with no handle at all are credited to the other person in a
+// one-on-one chat, and to "Unknown" in a group.
+func senderName(msg chatdb.Message, participants []string, contacts *chatdb.ContactBook) string {
+	handle := msg.Sender
+	if handle == "" {
+		if len(participants) == 1 {
+			handle = participants[0]
+		} else {
+			return "Unknown"
+		}
+	}
+	if c := contacts.Resolve(handle); c != nil {
+		return c.Name
+	}
+	if msg.Sender != "" && msg.SenderDisplay != "" {
+		return msg.SenderDisplay
+	}
+	return handle
+}
+
+// recipientNames lists who a message was sent to: every participant except
+// its sender, plus "Me" for received messages. In a group this differs from
+// message to message.
+func recipientNames(msg chatdb.Message, participants []string, contacts *chatdb.ContactBook) string {
+	var names []string
+	if !msg.IsFromMe {
+		names = append(names, "Me")
+	}
+	for _, p := range participants {
+		if !msg.IsFromMe && strings.EqualFold(p, msg.Sender) {
+			continue
 		}
+		names = append(names, contacts.ResolveName(p))
+	}
+	return strings.Join(names, "; ")
+}
+
+// exportText writes the messages for a chat within span to a plain-text
+// transcript. Returns the path of the written file.
+func exportText(ctx context.Context, store *chatdb.Store, contacts *chatdb.ContactBook, chatID int, participants []string, chatTitle string, span dateRange) (string, error) {
+	return textExporter(exportPrivacy{}, chatdb.UnitsLegacy)(ctx, store, contacts, chatID, participants, chatTitle, span)
+}
+
+// textExporter returns an exportFunc writing a plain-text transcript with
+// privacy applied and sizes written in units.
+func textExporter(privacy exportPrivacy, units chatdb.ByteUnits) exportFunc {
+	return textWriter(privacy, units).exporter()
+}
+
+// textWriter is the chatWriter behind textExporter.
+func textWriter(privacy exportPrivacy, units chatdb.ByteUnits) chatWriter {
+	write := func(f *os.File, messages []chatdb.Message, participants []string, contacts *chatdb.ContactBook) {
+		f.WriteString(formatTranscript(messages, contacts, units))
+	}
+	return chatWriter{ext: ".txt", privacy: privacy, write: write}
+}
+
+// sqliteExporter returns an exportFunc that copies the chat into a new
+// SQLite file laid out like chat.db, which this viewer and other chat.db
+// tools can open. Rows are copied as stored, so there's no privacy option.
+func sqliteExporter() exportFunc {
+	return func(ctx context.Context, store *chatdb.Store, contacts *chatdb.ContactBook, chatID int, participants []string, chatTitle string, span dateRange) (string, error) {
+		path := exportBaseName(chatTitle, participants, contacts) + ".db"
+		return path, exportSQLite(ctx, store, chatID, span, path)
+	}
+}
+
+// exportSQLite writes chatID's rows within span to a new database at path.
+// A partly written file is removed.
+func exportSQLite(ctx context.Context, store *chatdb.Store, chatID int, span dateRange, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	_, err = store.CopyChat(ctx, db, chatID, span.From, span.To)
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
 
-		body := csvEscape(msg.Text)
+// formatTranscript renders messages as human-readable lines, e.g.
+// "[2024-06-15 15:04] Me: How are you?", with a separator line whenever
+// the calendar day changes. Attachment sizes are written in units.
+func formatTranscript(messages []chatdb.Message, contacts *chatdb.ContactBook, units chatdb.ByteUnits) string {
+	var sb strings.Builder
+	var lastDate string
+	for _, msg := range messages {
+		dateStr := msg.Date.Format("Monday, January 2, 2006")
+		if dateStr != lastDate {
+			if lastDate != "" {
+				sb.WriteString("\n")
+			}
+			lastDate = dateStr
+			sb.WriteString(fmt.Sprintf("— %s —\n\n", dateStr))
+		}
 
-		attachType := ""
-		attachFile := ""
-		attachSize := ""
+		from := "Me"
+		if !msg.IsFromMe {
+			from = contacts.ResolveName(msg.Sender)
+			if from == "" {
+				from = "Unknown"
+			}
+		}
+
+		text := msg.Text
 		if len(msg.Attachments) > 0 {
-			var types, files, sizes []string
-			for _, a := range msg.Attachments {
-				types = append(types, a.TypeLabel)
-				if a.Filename != "" {
-					files = append(files, a.Filename)
-				}
-				if a.Size > 0 {
-					sizes = append(sizes, formatBytes(a.Size))
-				}
-			}
-			attachType = csvEscape(strings.Join(types, "; "))
-			attachFile = csvEscape(strings.Join(files, "; "))
-			attachSize = csvEscape(strings.Join(sizes, "; "))
-		}
-
-		line := fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s,%s\n",
-			ts,
-			csvEscape(from),
-			csvEscape(to),
-			body,
-			msg.Service,
-			attachType,
-			attachFile,
-			attachSize,
-		)
-		f.WriteString(line)
+			label := formatAttachments(msg.Attachments, units, false)
+			if text == "" {
+				text = label
+			} else {
+				text = text + " " + label
+			}
+		} else if text == "" {
+			text = msg.Placeholder()
+		}
+
+		sb.WriteString(fmt.Sprintf("[%s] %s: %s\n", msg.Date.Format("2006-01-02 15:04"), from, text))
+	}
+	return sb.String()
+}
+
+// exportSearchResults writes global search matches to a CSV file named
+// after the search term, in the order given. privacy applies as it does to
+// chat exports, with each chat renamed "Chat A", "Chat B", ... and the term
+// left out of the filename when anonymizing. Returns the path written.
+func exportSearchResults(results []chatdb.SearchResult, contacts *chatdb.ContactBook, term string, privacy exportPrivacy) (string, error) {
+	if privacy.anonymize {
+		senders, chats := newPseudonyms("Contact "), newPseudonyms("Chat ")
+		anon := make([]chatdb.SearchResult, len(results))
+		for i, r := range results {
+			r.Sender = senders.name(r.Sender)
+			r.ChatName = chats.name(strconv.Itoa(r.ChatID))
+			anon[i] = r
+		}
+		results = anon
+		contacts = &chatdb.ContactBook{}
+		term = "anonymized"
 	}
 
+	filename := buildExportFilename("search_"+term, nil, contacts)
+	f, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	f.WriteString("Chat,Sender,Date,Text\n")
+	for _, r := range results {
+		sender := "Me"
+		if !r.IsFromMe {
+			sender = contacts.ResolveName(r.Sender)
+			if sender == "" {
+				sender = "Unknown"
+			}
+		}
+		text := r.Text
+		if privacy.redactBodies {
+			text = redactText(text)
+		}
+		f.WriteString(fmt.Sprintf("%s,%s,%s,%s\n",
+			csvEscape(contacts.ResolveName(r.ChatName)),
+			csvEscape(sender),
+			r.Date.Format("2006-01-02 15:04:05"),
+			csvEscape(text),
+		))
+	}
 	return filename, nil
 }
 
-func buildExportFilename(chatTitle string, participants []string, contacts *ContactBook) string {
+// exportAttachmentList writes attachment metadata to a CSV file named
+// after name, one row per attachment in the order given, for deciding what
+// to copy before copying it. Names and paths are written as stored, so
+// callers refuse it while exportPrivacy is enabled. Returns the path written.
+func exportAttachmentList(attachments []chatdb.ChatAttachment, contacts *chatdb.ContactBook, name string) (string, error) {
+	filename := buildExportFilename(name+"_attachments", nil, contacts)
+	f, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	f.WriteString("Filename,Type,MIME Type,Size,Date,Sender,Chat,Path\n")
+	for _, a := range attachments {
+		display := a.Filename
+		if display == "" && a.FilePath != "" {
+			display = filepath.Base(a.FilePath)
+		}
+		sender := "Me"
+		if !a.IsFromMe {
+			sender = contacts.ResolveName(a.Sender)
+			if sender == "" {
+				sender = "Unknown"
+			}
+		}
+		f.WriteString(strings.Join([]string{
+			csvEscape(display),
+			csvEscape(a.TypeLabel),
+			csvEscape(a.MimeType),
+			strconv.FormatInt(a.Size, 10),
+			a.Date.Format("2006-01-02 15:04:05"),
+			csvEscape(sender),
+			csvEscape(contacts.ResolveName(a.ChatName)),
+			csvEscape(a.FilePath),
+		}, ",") + "\n")
+	}
+	return filename, nil
+}
+
+// attachmentListExporter returns an exportFunc writing the metadata of a
+// chat's attachments sent within span, newest first.
+func attachmentListExporter() exportFunc {
+	return func(ctx context.Context, store *chatdb.Store, contacts *chatdb.ContactBook, chatID int, participants []string, chatTitle string, span dateRange) (string, error) {
+		attachments, err := store.FetchChatAttachments(ctx, chatID)
+		if err != nil {
+			return "", err
+		}
+		var kept []chatdb.ChatAttachment
+		for _, a := range attachments {
+			if (span.From.IsZero() || !a.Date.Before(span.From)) && (span.To.IsZero() || !a.Date.After(span.To)) {
+				kept = append(kept, a)
+			}
+		}
+		return exportAttachmentList(kept, contacts, chatTitle)
+	}
+}
+
+// exportVCard writes a contact card for each participant of a chat to a
+// .vcf file. Returns the path of the written file.
+func exportVCard(contacts *chatdb.ContactBook, participants []string, chatTitle string) (string, error) {
+	filename := exportBaseName(chatTitle, participants, contacts) + ".vcf"
+	f, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(formatVCards(contacts, participants)); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// formatVCards renders one vCard 3.0 block per participant. Handles that
+// resolve to the same contact share a card; handles that don't resolve get a
+// card with just the raw identifier.
+func formatVCards(contacts *chatdb.ContactBook, participants []string) string {
+	var sb strings.Builder
+	seen := map[*chatdb.Contact]bool{}
+	for _, handle := range participants {
+		c := contacts.Resolve(handle)
+		if c != nil && seen[c] {
+			continue
+		}
+		sb.WriteString("BEGIN:VCARD\r\n")
+		sb.WriteString("VERSION:3.0\r\n")
+		if c == nil {
+			sb.WriteString("FN:" + vcardEscape(handle) + "\r\n")
+			if strings.Contains(handle, "@") {
+				sb.WriteString("EMAIL:" + vcardEscape(handle) + "\r\n")
+			} else {
+				sb.WriteString("TEL:" + vcardEscape(handle) + "\r\n")
+			}
+		} else {
+			seen[c] = true
+			sb.WriteString("FN:" + vcardEscape(c.Name) + "\r\n")
+			for _, p := range c.Phones {
+				sb.WriteString("TEL:" + vcardEscape(p) + "\r\n")
+			}
+			for _, e := range c.Emails {
+				sb.WriteString("EMAIL:" + vcardEscape(e) + "\r\n")
+			}
+		}
+		sb.WriteString("END:VCARD\r\n")
+	}
+	return sb.String()
+}
+
+// vcardEscape escapes text values per RFC 6350.
+func vcardEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+func buildExportFilename(chatTitle string, participants []string, contacts *chatdb.ContactBook) string {
+	return exportBaseName(chatTitle, participants, contacts) + ".csv"
+}
+
+// exportBaseName builds a sanitized, timestamped filename without extension.
+func exportBaseName(chatTitle string, participants []string, contacts *chatdb.ContactBook) string {
 	// Build a name from the chat title or participant names
 	name := chatTitle
 	if name == "" {
@@ -95,7 +656,13 @@ func buildExportFilename(chatTitle string, participants []string, contacts *Cont
 		name = strings.Join(names, "_")
 	}
 
-	// Sanitize for filename
+	timestamp := time.Now().Format("20060102_150405")
+	return fmt.Sprintf("%s_%s", fileSafeName(name), timestamp)
+}
+
+// fileSafeName reduces name to letters, digits, '_' and '-', at most 50
+// bytes, falling back to "conversation" when nothing is left.
+func fileSafeName(name string) string {
 	name = nonAlphaNum.ReplaceAllString(name, "_")
 	name = strings.Trim(name, "_")
 	if len(name) > 50 {
@@ -104,9 +671,7 @@ func buildExportFilename(chatTitle string, participants []string, contacts *Cont
 	if name == "" {
 		name = "conversation"
 	}
-
-	timestamp := time.Now().Format("20060102_150405")
-	return fmt.Sprintf("%s_%s.csv", name, timestamp)
+	return name
 }
 
 // csvEscape wraps a field in quotes if it contains commas, quotes, or newlines.
@@ -1,21 +1,26 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+	"github.com/aftaylor2/smsDbViewer/chatdb/chatdbtest"
 )
 
 func TestExportCSV(t *testing.T) {
-	db := newTestDB(t)
+	db := chatdbtest.NewDB(t)
 	defer db.Close()
-	store := NewStore(db)
-	contacts := &ContactBook{
-		byDigits: make(map[string]*Contact),
-		byEmail:  make(map[string]*Contact),
-	}
+	store := chatdb.NewStore(db)
+	contacts := &chatdb.ContactBook{}
 
-	path, err := exportCSV(store, contacts, 1, []string{"+15551234567"}, "Test Chat")
+	path, err := exportCSV(t.Context(), store, contacts, 1, []string{"+15551234567"}, "Test Chat", dateRange{})
 	if err != nil {
 		t.Fatalf("exportCSV: %v", err)
 	}
@@ -70,6 +75,188 @@ func TestExportCSV(t *testing.T) {
 	})
 }
 
+func TestExportCSVColumns(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := chatdb.NewStore(db)
+	contacts := &chatdb.ContactBook{}
+
+	columns, err := parseCSVColumns("Body, from")
+	if err != nil {
+		t.Fatalf("parseCSVColumns: %v", err)
+	}
+	path, err := csvExporter(columns, exportPrivacy{}, chatdb.UnitsLegacy)(t.Context(), store, contacts, 1, []string{"+15551234567"}, "Columns", dateRange{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read exported file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if lines[0] != "Body,From" {
+		t.Errorf("header: got %q", lines[0])
+	}
+	if lines[1] != `"Hey, how are you?",Me` {
+		t.Errorf("first row: got %q", lines[1])
+	}
+}
+
+func TestExportCSVAppleDates(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := chatdb.NewStore(db)
+
+	columns, err := parseCSVColumns("timestamp,body")
+	if err != nil {
+		t.Fatalf("parseCSVColumns: %v", err)
+	}
+	columns = withAppleDates(columns)
+	if got := withAppleDates(columns); len(got) != 3 {
+		t.Errorf("adding AppleDate twice: got %v", got)
+	}
+	if withAppleDates(defaultCSVColumns); len(defaultCSVColumns) != 8 {
+		t.Error("withAppleDates must not change the default column set")
+	}
+	path, err := csvExporter(columns, exportPrivacy{}, chatdb.UnitsLegacy)(t.Context(), store, &chatdb.ContactBook{}, 1, []string{"+15551234567"}, "AppleDates", dateRange{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read exported file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if lines[0] != "Timestamp,Body,AppleDate" {
+		t.Errorf("header: got %q", lines[0])
+	}
+	// The fixture's first message is stored at BaseAppleNanos
+	if want := fmt.Sprintf(",%d", chatdbtest.BaseAppleNanos); !strings.HasSuffix(lines[1], want) {
+		t.Errorf("first row %q should end with the raw date %s", lines[1], want)
+	}
+}
+
+func TestExportCSVGroupSenders(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := chatdb.NewStore(db)
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+
+	// Chat 3 is the group; +15559876543 has no contact, but Messages
+	// recorded how its number was written
+	if _, err := db.Exec(`UPDATE handle SET uncanonicalized_id = '(555) 987-6543' WHERE id = '+15559876543'`); err != nil {
+		t.Fatal(err)
+	}
+	participants := []string{"+15551234567", "+15559876543"}
+	columns := []string{"body", "from", "to"}
+	path, err := csvExporter(columns, exportPrivacy{}, chatdb.UnitsLegacy)(t.Context(), store, contacts, 3, participants, "Family Group", dateRange{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read exported file: %v", err)
+	}
+	rows := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n")[1:] {
+		body, rest, _ := strings.Cut(line, ",")
+		rows[body] = rest
+	}
+
+	tests := map[string]string{
+		"Happy birthday everyone!": "Me,John Doe; +15559876543",
+		"Thanks!":                  "John Doe,Me; +15559876543",
+		"Party at 7?":              "(555) 987-6543,Me; John Doe",
+	}
+	for body, want := range tests {
+		if got := rows[body]; got != want {
+			t.Errorf("%s: got %q, want %q", body, got, want)
+		}
+	}
+
+	if got := senderName(chatdb.Message{}, []string{"+15551234567"}, contacts); got != "John Doe" {
+		t.Errorf("no handle in a 1:1 chat: got %q", got)
+	}
+	if got := senderName(chatdb.Message{}, participants, contacts); got != "Unknown" {
+		t.Errorf("no handle in a group: got %q", got)
+	}
+	if got := senderName(chatdb.Message{Sender: "+15559876543"}, participants, contacts); got != "+15559876543" {
+		t.Errorf("nothing better than the handle: got %q", got)
+	}
+	anon, _, _, _ := exportPrivacy{anonymize: true}.apply(
+		[]chatdb.Message{{Sender: "+15559876543", SenderDisplay: "(555) 987-6543"}}, participants, contacts, "Family Group")
+	if anon[0].SenderDisplay != "" {
+		t.Errorf("anonymizing kept the written-out handle %q", anon[0].SenderDisplay)
+	}
+}
+
+func TestExportPrivacy(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := chatdb.NewStore(db)
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+
+	participants := []string{"+15551234567", "+15559876543"}
+	columns := []string{"body", "from", "to"}
+	privacy := exportPrivacy{anonymize: true, redactBodies: true}
+	path, err := csvExporter(columns, privacy, chatdb.UnitsLegacy)(t.Context(), store, contacts, 3, participants, "Family Group", dateRange{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	defer os.Remove(path)
+
+	if strings.Contains(path, "Family") {
+		t.Errorf("filename leaks the chat title: %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read exported file: %v", err)
+	}
+	content := string(data)
+	for _, leak := range []string{"John", "555", "birthday"} {
+		if strings.Contains(content, leak) {
+			t.Errorf("export contains %q:\n%s", leak, content)
+		}
+	}
+	want := []string{
+		"[24 chars],Me,Contact A; Contact B", // Happy birthday everyone!
+		"[7 chars],Contact A,Me; Contact B",  // Thanks!
+		"[11 chars],Contact B,Me; Contact A", // Party at 7?
+	}
+	for _, row := range want {
+		if !strings.Contains(content, row+"\n") {
+			t.Errorf("missing row %q in:\n%s", row, content)
+		}
+	}
+}
+
+func TestPseudonymLetters(t *testing.T) {
+	for n, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := pseudonymLetters(n); got != want {
+			t.Errorf("pseudonymLetters(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestParseCSVColumns(t *testing.T) {
+	cols, err := parseCSVColumns("")
+	if err != nil || len(cols) != len(defaultCSVColumns) {
+		t.Errorf("empty spec should select all columns: got %v, %v", cols, err)
+	}
+
+	if _, err := parseCSVColumns("timestamp,sender"); err == nil || !strings.Contains(err.Error(), `"sender"`) {
+		t.Errorf("expected an error naming the unknown column, got %v", err)
+	}
+}
+
 func TestCsvEscape(t *testing.T) {
 	tests := []struct {
 		input string
@@ -90,10 +277,7 @@ func TestCsvEscape(t *testing.T) {
 }
 
 func TestBuildExportFilename(t *testing.T) {
-	contacts := &ContactBook{
-		byDigits: make(map[string]*Contact),
-		byEmail:  make(map[string]*Contact),
-	}
+	contacts := &chatdb.ContactBook{}
 
 	t.Run("with_title", func(t *testing.T) {
 		name := buildExportFilename("John Smith", nil, contacts)
@@ -116,3 +300,329 @@ func TestBuildExportFilename(t *testing.T) {
 		}
 	})
 }
+
+func TestExportText(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := chatdb.NewStore(db)
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+
+	path, err := exportText(t.Context(), store, contacts, 1, []string{"+15551234567"}, "Test Chat", dateRange{})
+	if err != nil {
+		t.Fatalf("exportText: %v", err)
+	}
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read exported file: %v", err)
+	}
+	content := string(data)
+
+	t.Run("filename_format", func(t *testing.T) {
+		if !strings.HasPrefix(path, "Test_Chat_") || !strings.HasSuffix(path, ".txt") {
+			t.Errorf("unexpected filename %q", path)
+		}
+	})
+
+	t.Run("date_separator", func(t *testing.T) {
+		if !strings.HasPrefix(content, "— ") || !strings.Contains(content, "2024 —") {
+			t.Errorf("expected leading date separator, got %q", content[:40])
+		}
+	})
+
+	t.Run("lines", func(t *testing.T) {
+		if !strings.Contains(content, "] Me: Hey, how are you?\n") {
+			t.Errorf("missing sent line in transcript:\n%s", content)
+		}
+		if !strings.Contains(content, "] John Doe: Sure, where?\n") {
+			t.Errorf("missing resolved received line in transcript:\n%s", content)
+		}
+	})
+
+	t.Run("attachments", func(t *testing.T) {
+		if !strings.Contains(content, "Doing great! Want to grab lunch? [photo — IMG_001.jpg") {
+			t.Errorf("missing attachment annotation in transcript:\n%s", content)
+		}
+	})
+}
+
+func TestFormatVCards(t *testing.T) {
+	john := &chatdb.Contact{Name: "Doe, John", Phones: []string{"+15551234567"}, Emails: []string{"john@example.com"}}
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(john)
+
+	out := formatVCards(contacts, []string{"+15551234567", "john@example.com", "+15559876543", "jane@example.com"})
+	cards := strings.Split(strings.TrimSuffix(out, "END:VCARD\r\n"), "END:VCARD\r\n")
+
+	t.Run("one_card_per_person", func(t *testing.T) {
+		// John's phone and email handles share a card
+		if len(cards) != 3 {
+			t.Fatalf("expected 3 cards, got %d:\n%s", len(cards), out)
+		}
+	})
+
+	t.Run("resolved_fields", func(t *testing.T) {
+		for _, want := range []string{"BEGIN:VCARD\r\n", "VERSION:3.0\r\n", "FN:Doe\\, John\r\n",
+			"TEL:+15551234567\r\n", "EMAIL:john@example.com\r\n"} {
+			if !strings.Contains(cards[0], want) {
+				t.Errorf("card missing %q:\n%s", want, cards[0])
+			}
+		}
+	})
+
+	t.Run("unresolved_handles", func(t *testing.T) {
+		if !strings.Contains(cards[1], "FN:+15559876543\r\nTEL:+15559876543\r\n") {
+			t.Errorf("unresolved phone card:\n%s", cards[1])
+		}
+		if !strings.Contains(cards[2], "FN:jane@example.com\r\nEMAIL:jane@example.com\r\n") {
+			t.Errorf("unresolved email card:\n%s", cards[2])
+		}
+	})
+}
+
+func TestExportSearchResults(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := chatdb.NewStore(db)
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+
+	results, err := store.SearchMessages(t.Context(), "lunch", 10)
+	if err != nil {
+		t.Fatalf("SearchMessages: %v", err)
+	}
+	path, err := exportSearchResults(results, contacts, "lunch", exportPrivacy{})
+	if err != nil {
+		t.Fatalf("exportSearchResults: %v", err)
+	}
+	defer os.Remove(path)
+
+	if !strings.HasPrefix(path, "search_lunch_") || !strings.HasSuffix(path, ".csv") {
+		t.Errorf("filename: got %q", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read exported file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if lines[0] != "Chat,Sender,Date,Text" {
+		t.Errorf("header: got %q", lines[0])
+	}
+	if len(lines) != len(results)+1 {
+		t.Fatalf("expected %d rows, got %d", len(results), len(lines)-1)
+	}
+	if !strings.HasPrefix(lines[1], "John Doe,Me,") || !strings.HasSuffix(lines[1], ",Doing great! Want to grab lunch?") {
+		t.Errorf("row: got %q", lines[1])
+	}
+
+	// Anonymized and redacted, no name, handle, or text is written
+	path, err = exportSearchResults(results, contacts, "lunch", exportPrivacy{anonymize: true, redactBodies: true})
+	if err != nil {
+		t.Fatalf("private export: %v", err)
+	}
+	defer os.Remove(path)
+	if !strings.HasPrefix(path, "search_anonymized_") {
+		t.Errorf("private filename: got %q", path)
+	}
+	data, _ = os.ReadFile(path)
+	for _, leak := range []string{"John", "5551234567", "lunch"} {
+		if strings.Contains(string(data), leak) {
+			t.Errorf("private export contains %q:\n%s", leak, data)
+		}
+	}
+	if !strings.Contains(string(data), "Chat A,Me,") || !strings.Contains(string(data), "[32 chars]") {
+		t.Errorf("private export rows:\n%s", data)
+	}
+}
+
+func TestExportAttachmentList(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := chatdb.NewStore(db)
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+
+	path, err := attachmentListExporter()(t.Context(), store, contacts, 1, []string{"+15551234567"}, "John Doe", dateRange{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	defer os.Remove(path)
+
+	if !strings.HasPrefix(path, "John_Doe_attachments_") || !strings.HasSuffix(path, ".csv") {
+		t.Errorf("filename: got %q", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read exported file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if lines[0] != "Filename,Type,MIME Type,Size,Date,Sender,Chat,Path" {
+		t.Errorf("header: got %q", lines[0])
+	}
+	if len(lines) != 5 {
+		t.Fatalf("expected 4 attachments, got %d rows", len(lines)-1)
+	}
+	var pdf string
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, "menu.pdf,") {
+			pdf = line
+		}
+	}
+	if !strings.Contains(pdf, ",application/pdf,524288,") || !strings.Contains(pdf, ",John Doe,") || !strings.HasSuffix(pdf, "/Attachments/ef/gh/att2/menu.pdf") {
+		t.Errorf("pdf row: got %q", pdf)
+	}
+
+	// Attachments outside the span are left out
+	span := dateRange{From: time.Now().Add(24 * time.Hour)}
+	path, err = attachmentListExporter()(t.Context(), store, contacts, 1, nil, "John Doe", span)
+	if err != nil {
+		t.Fatalf("export with span: %v", err)
+	}
+	defer os.Remove(path)
+	if data, _ := os.ReadFile(path); strings.Count(string(data), "\n") != 1 {
+		t.Errorf("a future span should leave only the header, got %q", data)
+	}
+}
+
+func TestCSVAppender(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := chatdb.NewStore(db)
+	contacts := &chatdb.ContactBook{}
+	path := filepath.Join(t.TempDir(), "backup.csv")
+	participants := []string{"+15551234567"}
+
+	run := func(chatID int) (int, error) {
+		added := 0
+		_, err := csvAppender([]string{"timestamp", "body"}, exportPrivacy{}, chatdb.UnitsLegacy, path, &added)(
+			t.Context(), store, contacts, chatID, participants, "John", dateRange{})
+		return added, err
+	}
+	lines := func() []string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	if added, err := run(1); err != nil || added != 10 {
+		t.Fatalf("first run: added %d, err %v", added, err)
+	}
+	if got := lines(); len(got) != 11 || got[0] != "Timestamp,Body" {
+		t.Fatalf("first run wrote %d lines, header %q", len(got), got[0])
+	}
+	if added, err := run(1); err != nil || added != 0 {
+		t.Errorf("nothing new: added %d, err %v", added, err)
+	}
+
+	res, err := db.Exec(`INSERT INTO message (guid, text, handle_id, service, date, is_from_me)
+		VALUES ('msg-new', 'Back home', 1, 'iMessage', ?, 0)`, chatdbtest.BaseAppleNanos+int64(500)*60_000_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	if _, err := db.Exec(`INSERT INTO chat_message_join (chat_id, message_id, message_date) VALUES (1, ?, 0)`, id); err != nil {
+		t.Fatal(err)
+	}
+	if added, err := run(1); err != nil || added != 1 {
+		t.Fatalf("after a new message: added %d, err %v", added, err)
+	}
+	got := lines()
+	if len(got) != 12 || !strings.HasSuffix(got[11], ",Back home") {
+		t.Errorf("appended %d lines, last %q", len(got), got[len(got)-1])
+	}
+
+	if _, err := run(2); err == nil {
+		t.Error("appending another chat to the file should fail")
+	}
+	if _, err := csvAppender([]string{"body"}, exportPrivacy{}, chatdb.UnitsLegacy, path, new(int))(
+		t.Context(), store, contacts, 1, participants, "John", dateRange{}); err == nil {
+		t.Error("appending other columns to the file should fail")
+	}
+	if _, err := csvAppender([]string{"timestamp", "body"}, exportPrivacy{redactBodies: true}, chatdb.UnitsLegacy, path, new(int))(
+		t.Context(), store, contacts, 1, participants, "John", dateRange{}); err == nil {
+		t.Error("appending redacted rows to an unredacted file should fail")
+	}
+	if _, err := csvAppender([]string{"timestamp", "body"}, exportPrivacy{}, chatdb.UnitsSI, path, new(int))(
+		t.Context(), store, contacts, 1, participants, "John", dateRange{}); err == nil {
+		t.Error("appending rows with other size units should fail")
+	}
+	os.Remove(cursorPath(path))
+	if _, err := run(1); err == nil {
+		t.Error("a file without its cursor should be left alone")
+	}
+	if len(lines()) != 12 {
+		t.Error("failed runs shouldn't touch the file")
+	}
+}
+
+func TestCSVAppenderRollsBack(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := chatdb.NewStore(db)
+	path := filepath.Join(t.TempDir(), "backup.csv")
+
+	// A directory where the cursor goes makes writing it fail
+	if err := os.Mkdir(cursorPath(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	added := 0
+	if _, err := csvAppender(nil, exportPrivacy{}, chatdb.UnitsLegacy, path, &added)(
+		t.Context(), store, &chatdb.ContactBook{}, 1, []string{"+15551234567"}, "John", dateRange{}); err == nil {
+		t.Fatal("export should fail when its cursor can't be written")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("a first run whose cursor failed should leave no CSV, stat err %v", err)
+	}
+	if added != 0 {
+		t.Errorf("added = %d after a failed run", added)
+	}
+}
+
+func TestExportFromConversationList(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	store := chatdb.NewStore(db)
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+
+	tempStateDir(t)
+
+	convs, err := store.FetchConversations(t.Context())
+	if err != nil {
+		t.Fatalf("FetchConversations: %v", err)
+	}
+	var m tea.Model = NewModel(t.Context(), store, contacts)
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 100, Height: 40})
+	m, _ = m.Update(conversationsLoadedMsg{conversations: convs})
+	loaded := m.(model)
+	loaded.convList.StatusMessageLifetime = time.Millisecond // the status tick runs below
+	m = loaded
+	selected := loaded.convList.SelectedItem().(convItem)
+
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	if cmd == nil {
+		t.Fatal("e in the conversation list should start an export")
+	}
+	var done *exportDoneMsg
+	for _, c := range cmd().(tea.BatchMsg) {
+		if msg, ok := c().(exportDoneMsg); ok {
+			done = &msg
+		}
+	}
+	if done == nil || done.err != nil {
+		t.Fatalf("export: %+v", done)
+	}
+	defer os.Remove(done.path)
+
+	data, err := os.ReadFile(done.path)
+	if err != nil {
+		t.Fatalf("read exported file: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != selected.conv.MessageCount+1 {
+		t.Errorf("exported %d lines for %q, want %d messages plus a header", lines, selected.Title(), selected.conv.MessageCount)
+	}
+}
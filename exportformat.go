@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// exportFormat is one choice in the message view's export format picker.
+type exportFormat struct {
+	name    string // key stored in exportFormatsFile
+	label   string
+	private bool // honors --anonymize and --redact-bodies
+}
+
+// exportFormats lists the picker's choices; the first is the default for
+// chats exported for the first time.
+var exportFormats = []exportFormat{
+	{"csv", "CSV", true},
+	{"text", "Text transcript", true},
+	{"sqlite", "SQLite database (this conversation only)", false},
+	{"attachments", "Attachment list (CSV)", false},
+}
+
+// formatAllowed reports whether format may be exported under the
+// command-line privacy settings: formats that can't anonymize or redact
+// are refused rather than writing the raw data.
+func (m model) formatAllowed(format string) bool {
+	if !m.opts.exportPrivacy.enabled() {
+		return true
+	}
+	for _, f := range exportFormats {
+		if f.name == format {
+			return f.private
+		}
+	}
+	return true // unknown names export as CSV
+}
+
+// exporterFor returns the export for a format name, falling back to CSV
+// for names it doesn't know, like one from a newer version's state file.
+func (m model) exporterFor(format string) exportFunc {
+	switch format {
+	case "text":
+		return textExporter(m.opts.exportPrivacy, m.opts.units)
+	case "sqlite":
+		return sqliteExporter()
+	case "attachments":
+		return attachmentListExporter()
+	}
+	return csvExporter(m.opts.exportColumns, m.opts.exportPrivacy, m.opts.units)
+}
+
+// rememberedFormat returns the index in exportFormats of the format the
+// open chat was last exported in, or 0 (CSV) if it never was or that
+// format isn't allowed now.
+func (m model) rememberedFormat() int {
+	for i, f := range exportFormats {
+		if f.name == m.chatFormats[m.activeChatKey()] && m.formatAllowed(f.name) {
+			return i
+		}
+	}
+	return 0
+}
+
+// exportAs starts exporting the open chat in format and remembers it as
+// the chat's format for next time.
+func (m *model) exportAs(format string) tea.Cmd {
+	if m.exporting {
+		return nil
+	}
+	if !m.formatAllowed(format) {
+		m.exportStatus = "Only CSV and text exports can be anonymized or redacted"
+		return nil
+	}
+	m.exporting = true
+	m.exportStatus = "Exporting..."
+	return tea.Batch(m.exportCmd(m.exporterFor(format)), m.rememberFormatCmd(format))
+}
+
+// rememberFormatCmd records format as the open chat's export format and
+// saves the table in the background.
+func (m *model) rememberFormatCmd(format string) tea.Cmd {
+	key := m.activeChatKey()
+	if m.chatFormats[key] == format {
+		return nil
+	}
+	if m.chatFormats == nil {
+		m.chatFormats = map[string]string{}
+	}
+	m.chatFormats[key] = format
+	snapshot := make(map[string]string, len(m.chatFormats))
+	for k, v := range m.chatFormats {
+		snapshot[k] = v
+	}
+	return func() tea.Msg {
+		saveState(exportFormatsFile, snapshot)
+		return nil
+	}
+}
+
+// updateFormatPicker handles keys while the format picker is open. The
+// highlight skips formats that aren't allowed.
+func (m model) updateFormatPicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		for i := m.formatPick - 1; i >= 0; i-- {
+			if m.formatAllowed(exportFormats[i].name) {
+				m.formatPick = i
+				break
+			}
+		}
+	case "down", "j":
+		for i := m.formatPick + 1; i < len(exportFormats); i++ {
+			if m.formatAllowed(exportFormats[i].name) {
+				m.formatPick = i
+				break
+			}
+		}
+	case "enter":
+		m.pickingFormat = false
+		return m, m.exportAs(exportFormats[m.formatPick].name)
+	case "esc", "backspace", "q", "E":
+		m.pickingFormat = false
+	}
+	return m, nil
+}
+
+// renderFormatPicker lists the export formats with the choice marked and
+// the ones that aren't allowed dimmed.
+func (m model) renderFormatPicker() string {
+	lines := []string{sidebarTitleStyle.Render("Export as")}
+	for i, f := range exportFormats {
+		if !m.formatAllowed(f.name) {
+			lines = append(lines, helpStyle.Render("  "+f.label+" (off while anonymizing or redacting)"))
+		} else if i == m.formatPick {
+			lines = append(lines, sidebarTitleStyle.Render("▸ "+f.label))
+		} else {
+			lines = append(lines, "  "+f.label)
+		}
+	}
+	lines = append(lines, "", helpStyle.Render("↑/↓: choose  |  enter: export  |  esc: cancel"))
+	return strings.Join(lines, "\n")
+}
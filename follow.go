@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+// defaultFollowInterval is how often follow mode checks for new messages
+// when --follow-interval isn't given.
+const defaultFollowInterval = 5 * time.Second
+
+// followTickMsg asks for the next follow-mode poll. gen ties it to the
+// follow session that scheduled it, so ticks left over from a session that
+// was turned off, or from another chat, are dropped.
+type followTickMsg struct {
+	gen int
+}
+
+// followedMsg carries the messages a follow-mode poll found, and the
+// current reactions on the messages that were already loaded, by ROWID.
+type followedMsg struct {
+	gen       int
+	chatID    int
+	messages  []chatdb.Message
+	reactions map[int][]chatdb.Reaction
+	err       error
+}
+
+// followInterval is the time between follow-mode polls.
+func (m model) followInterval() time.Duration {
+	if m.opts.followInterval > 0 {
+		return m.opts.followInterval
+	}
+	return defaultFollowInterval
+}
+
+// toggleFollow turns follow mode on or off for the open chat. The database
+// is opened read-only and gets no change notifications, so following means
+// polling it.
+func (m *model) toggleFollow() tea.Cmd {
+	m.followGen++
+	m.following = !m.following
+	if !m.following {
+		m.exportStatus = "Stopped following"
+		return nil
+	}
+	m.exportStatus = fmt.Sprintf("Following, checking every %s", m.followInterval())
+	return m.followTickCmd()
+}
+
+// stopFollowing ends follow mode, discarding any poll still scheduled.
+func (m *model) stopFollowing() {
+	m.following = false
+	m.followGen++
+}
+
+func (m model) followTickCmd() tea.Cmd {
+	gen := m.followGen
+	return tea.Tick(m.followInterval(), func(time.Time) tea.Msg {
+		return followTickMsg{gen: gen}
+	})
+}
+
+// pollNewMessagesCmd fetches the open chat's messages written since the
+// newest loaded one, and the reactions now on the loaded ones.
+func (m model) pollNewMessagesCmd() tea.Cmd {
+	chatID, gen := m.activeChatID, m.followGen
+	after := 0
+	// The command gets its own copy of the window to fill in, since the
+	// model's may change before it runs
+	window := make([]chatdb.Message, len(m.messages))
+	for i, msg := range m.messages {
+		after = max(after, msg.ROWID)
+		window[i] = chatdb.Message{ROWID: msg.ROWID, GUID: msg.GUID}
+	}
+	return func() tea.Msg {
+		msgs, err := m.store.FetchMessagesAfter(m.chatCtx, chatID, after)
+		if err == nil {
+			err = m.store.RefreshReactions(m.chatCtx, chatID, window)
+		}
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		reactions := make(map[int][]chatdb.Reaction, len(window))
+		for _, msg := range window {
+			reactions[msg.ROWID] = msg.Reactions
+		}
+		return followedMsg{gen: gen, chatID: chatID, messages: msgs, reactions: reactions, err: err}
+	}
+}
+
+// appendFollowed merges polled messages into the loaded window by date and
+// returns how many were added. Messages already loaded are skipped, as are
+// late-synced ones older than the loaded window, which paging back will
+// find. When the view was at the bottom it stays there.
+func (m *model) appendFollowed(msgs []chatdb.Message) int {
+	loaded := make(map[int]bool, len(m.messages))
+	for _, msg := range m.messages {
+		loaded[msg.ROWID] = true
+	}
+	focusID, anchorID := 0, 0
+	if msg, ok := m.focusedMessage(); ok {
+		focusID = msg.ROWID
+	}
+	if m.selectAnchor >= 0 && m.selectAnchor < len(m.messages) {
+		anchorID = m.messages[m.selectAnchor].ROWID
+	}
+
+	added := 0
+	for _, msg := range msgs {
+		if loaded[msg.ROWID] || (!m.allLoaded && msg.Date.Before(m.oldestCursor.Date)) {
+			continue
+		}
+		m.messages = append(m.messages, msg)
+		added++
+	}
+	if added == 0 {
+		return 0
+	}
+	sort.SliceStable(m.messages, func(i, j int) bool {
+		a, b := m.messages[i], m.messages[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		return a.ROWID < b.ROWID
+	})
+	for i, msg := range m.messages {
+		switch msg.ROWID {
+		case focusID:
+			m.focus = i
+		case anchorID:
+			m.selectAnchor = i
+		}
+	}
+	m.activeMsgCount += added
+
+	atBottom := m.viewport.AtBottom()
+	if m.msgSearchTerm != "" {
+		m.performMsgSearch()
+	}
+	m.viewport.SetContent(m.renderMessages())
+	if atBottom {
+		m.viewport.GotoBottom()
+	}
+	return added
+}
+
+// applyFollowedReactions replaces the reactions on loaded messages with
+// those a follow-mode poll found and reports whether any changed. Messages
+// loaded after the poll started aren't in reactions and are left alone.
+func (m *model) applyFollowedReactions(reactions map[int][]chatdb.Reaction) bool {
+	changed := false
+	for i, msg := range m.messages {
+		r, ok := reactions[msg.ROWID]
+		if !ok || slices.Equal(r, msg.Reactions) {
+			continue
+		}
+		m.messages[i].Reactions = r
+		delete(m.blockCache, msg.ROWID) // its cached block shows the old ones
+		changed = true
+	}
+	if !changed {
+		return false
+	}
+	atBottom := m.viewport.AtBottom()
+	m.viewport.SetContent(m.renderMessages())
+	if atBottom {
+		m.viewport.GotoBottom()
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+// toggleFromStart reloads the open chat from its first message, with newer
+// pages loading as the reader scrolls down, for reading a conversation in
+// order the way an export would. The chat is saved the way a reply thread
+// saves it, so esc puts it back at the latest messages, and reload and
+// follow leave the forward view alone.
+func (m *model) toggleFromStart() tea.Cmd {
+	if m.fromStart {
+		m.closeThread()
+		return nil
+	}
+	if m.threadReturn != nil || m.loading {
+		return nil
+	}
+	m.threadReturn = &savedMessages{
+		messages:     m.messages,
+		focus:        m.focus,
+		oldestCursor: m.oldestCursor,
+		allLoaded:    m.allLoaded,
+		yOffset:      m.viewport.YOffset,
+	}
+	m.fromStart = true
+	m.messages = nil
+	m.focus = -1
+	m.selectAnchor = -1
+	m.allLoaded = true // nothing to load above the first message
+	m.newestCursor = chatdb.MessageCursor{}
+	m.endLoaded = false
+	m.loading = true
+	m.viewport.SetContent(m.renderMessages())
+	m.viewport.GotoTop()
+	return m.fetchForwardCmd(m.activeChatID, chatdb.MessageCursor{})
+}
+
+// appendForwardPage adds a page read from the start below the loaded
+// messages, leaving the reader where they were. The first page opens at
+// the top with its first message focused.
+func (m *model) appendForwardPage(page []chatdb.Message) {
+	first := len(m.messages) == 0
+	m.messages = append(m.messages, page...)
+	if len(m.messages) > 0 {
+		m.newestCursor = chatdb.CursorAt(m.messages[len(m.messages)-1])
+	}
+	if len(page) < chatdb.MessagesPageSize {
+		m.endLoaded = true
+	}
+	if first && len(m.messages) > 0 {
+		m.focus = 0
+	}
+	yOffset := m.viewport.YOffset
+	m.viewport.SetContent(m.renderMessages())
+	if first {
+		m.viewport.GotoTop()
+	} else {
+		m.viewport.SetYOffset(yOffset)
+	}
+}
+
+// fetchForwardCmd loads the page of the chat just after cursor.
+func (m model) fetchForwardCmd(chatID int, cursor chatdb.MessageCursor) tea.Cmd {
+	return func() tea.Msg {
+		msgs, err := m.store.FetchMessagesAsc(m.chatCtx, chatID, cursor, chatdb.MessagesPageSize)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return messagesLoadedMsg{messages: msgs, chatID: chatID, forward: true, err: err}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+// formatGroupEvent renders one membership change as a sentence, e.g.
+// "Alice added Bob" or "You renamed the group “Family”".
+func formatGroupEvent(e chatdb.GroupEvent, contacts *chatdb.ContactBook) string {
+	name := func(handle string) string {
+		if handle == "" {
+			return "Unknown"
+		}
+		return contacts.ResolveName(handle)
+	}
+	actor := "You"
+	if !e.IsFromMe {
+		actor = name(e.Actor)
+	}
+	switch e.Kind {
+	case chatdb.MemberAdded:
+		return fmt.Sprintf("%s added %s", actor, name(e.Member))
+	case chatdb.MemberRemoved:
+		return fmt.Sprintf("%s removed %s", actor, name(e.Member))
+	case chatdb.MemberLeft:
+		return actor + " left"
+	case chatdb.GroupRenamed:
+		if e.Title == "" {
+			return actor + " removed the group name"
+		}
+		return fmt.Sprintf("%s renamed the group “%s”", actor, e.Title)
+	}
+	return actor + " changed the group"
+}
+
+// formatGroupHistory lists events for the group history overlay, one dated
+// line each, oldest first. Only the newest maxLines fit; a first line
+// counts the earlier ones left out.
+func formatGroupHistory(events []chatdb.GroupEvent, contacts *chatdb.ContactBook, maxLines int) string {
+	if len(events) == 0 {
+		return "No membership changes recorded"
+	}
+	var lines []string
+	if maxLines > 1 && len(events) > maxLines {
+		skipped := len(events) - maxLines + 1
+		lines = append(lines, helpStyle.Render(fmt.Sprintf("… %d earlier changes", skipped)))
+		events = events[skipped:]
+	}
+	for _, e := range events {
+		lines = append(lines, helpStyle.Render(e.Date.Format("Jan 02, 2006 15:04"))+"  "+formatGroupEvent(e, contacts))
+	}
+	return strings.Join(lines, "\n")
+}
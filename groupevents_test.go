@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+func TestFormatGroupEvent(t *testing.T) {
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "Alice", Phones: []string{"5551234567"}})
+	tests := []struct {
+		e    chatdb.GroupEvent
+		want string
+	}{
+		{chatdb.GroupEvent{Kind: chatdb.MemberAdded, IsFromMe: true, Member: "+15551234567"}, "You added Alice"},
+		{chatdb.GroupEvent{Kind: chatdb.MemberRemoved, Actor: "+15551234567", Member: "+15559999999"}, "Alice removed +15559999999"},
+		{chatdb.GroupEvent{Kind: chatdb.MemberLeft, Actor: "+15559999999"}, "+15559999999 left"},
+		{chatdb.GroupEvent{Kind: chatdb.GroupRenamed, Actor: "+15551234567", Title: "Family"}, "Alice renamed the group “Family”"},
+		{chatdb.GroupEvent{Kind: chatdb.MemberAdded, Actor: "+15551234567"}, "Alice added Unknown"},
+	}
+	for _, tt := range tests {
+		if got := formatGroupEvent(tt.e, contacts); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestFormatGroupHistoryTrims(t *testing.T) {
+	base := time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local)
+	var events []chatdb.GroupEvent
+	for i := 0; i < 10; i++ {
+		events = append(events, chatdb.GroupEvent{Date: base.Add(time.Duration(i) * time.Hour), Kind: chatdb.MemberLeft, IsFromMe: true})
+	}
+	lines := strings.Split(ansi.Strip(formatGroupHistory(events, &chatdb.ContactBook{}, 4)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	if lines[0] != "… 7 earlier changes" {
+		t.Errorf("first line = %q", lines[0])
+	}
+	if want := "Jun 15, 2024 19:00  You left"; lines[3] != want {
+		t.Errorf("last line = %q, want %q (newest kept)", lines[3], want)
+	}
+}
+
+func TestGroupHistoryKeyByStyle(t *testing.T) {
+	press := func(conv chatdb.Conversation, participants []string) (model, bool) {
+		m := model{viewport: viewport.New(100, 10), contacts: &chatdb.ContactBook{}, state: viewMessages, focus: -1, selectAnchor: -1}
+		m.convItems = []chatdb.Conversation{conv}
+		m.activeChatID = conv.ChatID
+		m.activeParticipants = participants
+		updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("H")})
+		return updated.(model), cmd != nil
+	}
+
+	// Everyone else left the group
+	group := chatdb.Conversation{ChatID: 3, Style: chatdb.ChatStyleGroup, Participants: []string{"+15551234567"}}
+	if m, fetched := press(group, group.Participants); !fetched || m.exportStatus == "Not a group conversation" {
+		t.Errorf("a group with one member left should show its history: status %q", m.exportStatus)
+	}
+
+	// A one-to-one chat listing the same person twice
+	direct := chatdb.Conversation{ChatID: 1, Style: chatdb.ChatStyleDirect, Participants: []string{"+15551234567", "+15551234567"}}
+	if m, fetched := press(direct, direct.Participants); fetched || m.exportStatus != "Not a group conversation" {
+		t.Errorf("a one-to-one chat has no group history: status %q", m.exportStatus)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+// handleViewTarget picks whose messages A shows across chats: the sender
+// of the focused message, or the other person in a one-on-one chat.
+func (m model) handleViewTarget() (string, bool) {
+	if msg, ok := m.focusedMessage(); ok && !msg.IsFromMe && msg.Sender != "" {
+		return msg.Sender, true
+	}
+	if len(m.activeParticipants) == 1 {
+		return m.activeParticipants[0], true
+	}
+	return "", false
+}
+
+// toggleHandleView replaces the open chat's messages with every message
+// exchanged with one person, from all chats, paged like a chat. The chat
+// is saved the way a reply thread saves it, so esc puts it back, and
+// reload and follow leave the cross-chat view alone.
+func (m *model) toggleHandleView() tea.Cmd {
+	if m.handleView != "" {
+		m.closeThread()
+		return nil
+	}
+	if m.threadReturn != nil || m.loading {
+		return nil
+	}
+	handle, ok := m.handleViewTarget()
+	if !ok {
+		m.exportStatus = "Focus a message from someone to see all their messages"
+		return nil
+	}
+	m.threadReturn = &savedMessages{
+		messages:     m.messages,
+		focus:        m.focus,
+		oldestCursor: m.oldestCursor,
+		allLoaded:    m.allLoaded,
+		yOffset:      m.viewport.YOffset,
+	}
+	m.handleView = handle
+	m.messages = nil
+	m.focus = -1
+	m.selectAnchor = -1
+	m.oldestCursor = chatdb.MessageCursor{}
+	m.allLoaded = false
+	m.loading = true
+	m.viewport.SetContent(m.renderMessages())
+	return m.fetchMessagesCmd(m.activeChatID, chatdb.MessageCursor{}, false)
+}
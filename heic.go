@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+// sipsCommand is the macOS image tool used to convert HEIC photos. It's a
+// variable so tests can point it somewhere that doesn't exist.
+var sipsCommand = "sips"
+
+// isHEIC reports whether a is a HEIC or HEIF photo, which many viewers
+// outside macOS can't open.
+func isHEIC(a chatdb.ChatAttachment) bool {
+	mime := strings.ToLower(a.MimeType)
+	if mime == "image/heic" || mime == "image/heif" {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(a.FilePath))
+	return ext == ".heic" || ext == ".heif"
+}
+
+// convertToJPEG writes a JPEG copy of the image at path with sips and
+// returns the copy's path. Copies go in one temporary directory, named by
+// jpegCopyPath, so converting a photo that hasn't changed since reuses the
+// copy without running sips again.
+func convertToJPEG(path string) (string, error) {
+	if _, err := exec.LookPath(sipsCommand); err != nil {
+		return "", fmt.Errorf("%s not found; converting HEIC needs macOS", sipsCommand)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	out := jpegCopyPath(path, info)
+	if _, err := os.Stat(out); err == nil {
+		return out, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return "", err
+	}
+	// sips writes beside the copy and the finished file is renamed into
+	// place, so an interrupted conversion is never mistaken for a copy
+	part := strings.TrimSuffix(out, ".jpg") + ".part.jpg"
+	if msg, err := exec.Command(sipsCommand, "-s", "format", "jpeg", path, "--out", part).CombinedOutput(); err != nil {
+		os.Remove(part)
+		if text := strings.TrimSpace(string(msg)); text != "" {
+			return "", fmt.Errorf("%s: %s", sipsCommand, text)
+		}
+		return "", err
+	}
+	if err := os.Rename(part, out); err != nil {
+		os.Remove(part)
+		return "", err
+	}
+	return out, nil
+}
+
+// jpegCopyPath is where convertToJPEG keeps its copy of the image at path.
+// The name hashes the full path with the file's size and modification
+// time, so photos of the same name in different folders get their own
+// copies and an edited photo isn't served its stale one.
+func jpegCopyPath(path string, info os.FileInfo) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s\x00%d\x00%d", path, info.Size(), info.ModTime().UnixNano())
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return filepath.Join(os.TempDir(), "smsDbViewer-jpeg", fmt.Sprintf("%s-%016x.jpg", base, hash.Sum64()))
+}
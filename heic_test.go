@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+func TestIsHEIC(t *testing.T) {
+	tests := []struct {
+		a    chatdb.ChatAttachment
+		want bool
+	}{
+		{chatdb.ChatAttachment{MimeType: "image/heic", FilePath: "/a/IMG_1.HEIC"}, true},
+		{chatdb.ChatAttachment{MimeType: "image/HEIF"}, true},
+		{chatdb.ChatAttachment{FilePath: "/a/IMG_2.heic"}, true}, // no MIME type recorded
+		{chatdb.ChatAttachment{MimeType: "image/jpeg", FilePath: "/a/IMG_3.jpeg"}, false},
+		{chatdb.ChatAttachment{MimeType: "video/quicktime", FilePath: "/a/IMG_4.MOV"}, false},
+	}
+	for _, tt := range tests {
+		if got := isHEIC(tt.a); got != tt.want {
+			t.Errorf("isHEIC(%q, %q) = %v, want %v", tt.a.MimeType, tt.a.FilePath, got, tt.want)
+		}
+	}
+}
+
+func TestConvertToJPEGWithoutSips(t *testing.T) {
+	orig := sipsCommand
+	sipsCommand = "smsDbViewer-no-such-sips"
+	defer func() { sipsCommand = orig }()
+
+	_, err := convertToJPEG("/tmp/IMG_1.HEIC")
+	if err == nil || !strings.Contains(err.Error(), "needs macOS") {
+		t.Errorf("err = %v, want a not-found error", err)
+	}
+}
+
+func TestConvertToJPEGReusesCopy(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	orig := sipsCommand
+	sipsCommand = "false" // found, but fails if it's ever run
+	defer func() { sipsCommand = orig }()
+
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "IMG_1.HEIC")
+	if err := os.WriteFile(photo, []byte("heic"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copyPath := jpegCopyPath(photo, info)
+	if err := os.MkdirAll(filepath.Dir(copyPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(copyPath, []byte("jpeg"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := convertToJPEG(photo); err != nil || got != copyPath {
+		t.Errorf("convertToJPEG = %q, %v; want the existing copy %q", got, err, copyPath)
+	}
+
+	// A photo of the same name elsewhere has its own copy
+	other := filepath.Join(dir, "sub", "IMG_1.HEIC")
+	if err := os.MkdirAll(filepath.Dir(other), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(other, []byte("heic"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	otherInfo, err := os.Stat(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jpegCopyPath(other, otherInfo) == copyPath {
+		t.Errorf("two photos named IMG_1.HEIC share the copy %q", copyPath)
+	}
+
+	// Once the photo changes its old copy isn't used
+	if err := os.WriteFile(photo, []byte("edited heic"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := convertToJPEG(photo); err == nil {
+		t.Errorf("convertToJPEG after an edit = %q, want sips to run (and fail)", got)
+	}
+}
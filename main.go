@@ -1,39 +1,258 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 
 	tea "github.com/charmbracelet/bubbletea"
 	_ "modernc.org/sqlite"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
 )
 
 func main() {
-	dbPath := filepath.Join(os.Getenv("HOME"), "Library", "Messages", "chat.db")
-	if len(os.Args) > 1 {
-		dbPath = os.Args[1]
+	os.Exit(run(os.Args[1:]))
+}
+
+// run is the body of main. It returns the exit status instead of calling
+// os.Exit so deferred cleanup, like removing an unpacked database, runs.
+func run(args []string) int {
+	name, args := splitCommand(args)
+	return commands[name].run(args)
+}
+
+// runView starts the TUI. It's the default command, so its flags also work
+// without naming it.
+func runView(args []string) int {
+	fs := newFlagSet("view", "[chat.db]")
+	noColor := fs.Bool("no-color", false, "disable colors and text styling (also set by NO_COLOR)")
+	unknownHandles := fs.Bool("unknown-handles", false, "print handles that don't match any contact and exit")
+	openHandle := fs.String("open", "", "open the conversation with this phone number or email")
+	openChat := fs.Int("open-chat", 0, "open the conversation with this chat id")
+	recentCount := fs.Int("recent", 10, "number of conversations in the recent quick view (r)")
+	showOrphans := fs.Bool("orphans", false, "list messages that belong to no conversation as an \"Orphaned messages\" conversation")
+	daysAgo := fs.Int("days-ago", 0, "show dates up to n days back as \"Nd ago\" instead of a weekday or date (0: off)")
+	collapseDupes := fs.Bool("collapse-duplicates", false, "show identical messages stored more than once within a second as one, marked \"×N\"")
+	textCounts := fs.Bool("text-counts", false, "count only messages with text in the conversation list, leaving out reactions and attachment-only messages")
+	followInterval := fs.Duration("follow-interval", defaultFollowInterval, "how often follow mode (L) checks the open conversation for new messages")
+	searchLimit := fs.Int("search-limit", defaultSearchLimit, "matches a search fetches at first, and how many more M loads in the results")
+	foldSearch := fs.Bool("fold-search", false, "ignore case and accents when searching (\"jose\" finds \"José\")")
+	showVersion := fs.Bool("version", false, "print version and build information and exit")
+	anonymize := fs.Bool("anonymize", false, "replace phone numbers, emails, and names in CSV and text exports with pseudonyms")
+	redactBodies := fs.Bool("redact-bodies", false, "replace message text in CSV and text exports with its length")
+	columnSpec := fs.String("columns", "", "comma-separated CSV export columns, e.g. timestamp,from,body (default: all)")
+	appleDates := fs.Bool("apple-dates", false, "add an AppleDate column to CSV exports with each message's raw chat.db date")
+	units := fs.String("units", "legacy", "size labels: legacy (1024-based, KB/MB), iec (KiB/MiB), or si (1000-based, kB/MB)")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+
+	if *showVersion {
+		fmt.Println(versionString(debug.ReadBuildInfo()))
+		return 0
 	}
 
-	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro", dbPath))
+	csvCols, err := parseCSVColumns(*columnSpec)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error: --columns: %v\n", err)
+		return 2
+	}
+	if *appleDates {
+		csvCols = withAppleDates(csvCols)
+	}
+	sizeUnits, err := chatdb.ParseByteUnits(*units)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --units: %v\n", err)
+		return 2
+	}
+	if *followInterval <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --follow-interval must be positive")
+		return 2
+	}
+	if *searchLimit <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --search-limit must be positive")
+		return 2
 	}
-	defer db.Close()
 
-	if err := db.Ping(); err != nil {
-		fmt.Fprintf(os.Stderr, "Cannot read database: %v\n", err)
-		os.Exit(1)
+	if *noColor || os.Getenv("NO_COLOR") != "" {
+		usePlainStyles()
+	}
+
+	store, closeStore, err := openStore(fs.Arg(0))
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	defer closeStore()
+	contacts := chatdb.NewContactBook()
+
+	// Canceled on return so queries still running when the UI quits stop
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if *unknownHandles {
+		if err := contacts.Err(); err != nil {
+			// Otherwise every handle would look unknown for no clear reason
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", contactsWarning(err))
+		}
+		if err := printUnknownHandles(ctx, os.Stdout, store, contacts); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	}
+
+	startChat := *openChat
+	if *openHandle != "" {
+		chatID, found, err := store.FindChatByHandle(ctx, *openHandle)
+		if err != nil {
+			printError(err)
+			return 1
+		}
+		if found {
+			startChat = chatID
+		} else {
+			fmt.Fprintf(os.Stderr, "No conversation found for %s, showing all conversations\n", *openHandle)
+		}
 	}
 
-	contacts := NewContactBook()
-	store := NewStore(db)
-	m := NewModel(store, contacts)
+	opts := modelOptions{
+		foldSearch:     *foldSearch,
+		recentCount:    *recentCount,
+		showOrphans:    *showOrphans,
+		textCounts:     *textCounts,
+		followInterval: *followInterval,
+		searchLimit:    *searchLimit,
+		collapseDupes:  *collapseDupes,
+		exportColumns:  csvCols,
+		exportPrivacy:  exportPrivacy{anonymize: *anonymize, redactBodies: *redactBodies},
+		units:          sizeUnits,
+	}
+	if *daysAgo > 0 {
+		dates := daysAgoDates(*daysAgo)
+		opts.dates = &dates
+	}
+	m := NewModel(ctx, store, contacts).withOptions(opts)
+	if startChat > 0 {
+		m = m.withInitialChat(startChat)
+	}
 	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
 	if _, err := p.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		printError(err)
+		return 1
+	}
+	return 0
+}
+
+// newFlagSet returns a flag set for a subcommand whose usage line names the
+// command and its positional arguments.
+func newFlagSet(name, positional string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: smsDbViewer %s [flags] %s\n\n%s\n\nFlags:\n", name, positional, commands[name].summary)
+		fs.PrintDefaults()
+		if name == "view" {
+			fmt.Fprint(fs.Output(), "\n"+commandList())
+		}
+	}
+	return fs
+}
+
+// parseFlags parses args into fs. When parsing ends the command (-h, or a
+// bad flag that the flag package has already reported), ok is false and
+// status is the exit status to return.
+func parseFlags(fs *flag.FlagSet, args []string) (status int, ok bool) {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0, false
+	}
+	if err != nil {
+		return 2, false
+	}
+	return 0, true
+}
+
+// openStore opens the chat database at path, or the default Messages
+// database when path is empty, read-only. Compressed dumps are unpacked
+// first. The returned function closes the database and removes anything
+// unpacked.
+func openStore(path string) (*chatdb.Store, func(), error) {
+	if path == "" {
+		path = filepath.Join(os.Getenv("HOME"), "Library", "Messages", "chat.db")
+	}
+	path, err := resolveDatabasePath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cleanup := func() {}
+	if isCompressedDatabase(path) {
+		unpacked, removeUnpacked, err := openCompressedDatabase(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unpacking database: %w", err)
+		}
+		path, cleanup = unpacked, removeUnpacked
+	}
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("opening database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		cleanup()
+		return nil, nil, fmt.Errorf("cannot read database: %w", chatdb.ClassifyError(err))
+	}
+	return chatdb.NewStore(db), func() {
+		db.Close()
+		cleanup()
+	}, nil
+}
+
+// errorHint suggests what to do about a database failure, by its kind, or
+// returns "" for errors that explain themselves.
+func errorHint(err error) string {
+	switch {
+	case errors.Is(err, chatdb.ErrPermissionDenied):
+		return "Grant your terminal app Full Disk Access in System Settings > Privacy & Security > Full Disk Access, then run it again."
+	case errors.Is(err, chatdb.ErrDatabaseLocked):
+		return "Messages is busy writing to the database. Try again in a moment, or open a copy of chat.db instead."
+	case errors.Is(err, chatdb.ErrSchemaUnsupported):
+		return "This chat.db has a layout this version doesn't know, perhaps from a newer macOS. Please report the error along with your macOS version."
+	case errors.Is(err, chatdb.ErrNotDatabase):
+		return "The file isn't a readable SQLite database; it may be damaged or only partly copied."
+	}
+	return ""
+}
+
+// printError reports err on stderr, with a hint when it's a database
+// failure of a known kind.
+func printError(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	if hint := errorHint(err); hint != "" {
+		fmt.Fprintln(os.Stderr, hint)
+	}
+}
+
+// printUnknownHandles writes every handle without a matching contact, with
+// its message count, one per line.
+func printUnknownHandles(ctx context.Context, w io.Writer, store *chatdb.Store, contacts *chatdb.ContactBook) error {
+	handles, err := store.DistinctHandles(ctx)
+	if err != nil {
+		return err
+	}
+	unknown := contacts.UnresolvedHandles(handles)
+	for _, h := range unknown {
+		fmt.Fprintf(w, "%-40s %6d msgs\n", h.Handle, h.MessageCount)
 	}
+	fmt.Fprintf(w, "%d of %d handles have no contact\n", len(unknown), len(handles))
+	return nil
 }
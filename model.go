@@ -1,16 +1,28 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"math"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
 )
 
 type viewState int
@@ -20,34 +32,82 @@ const (
 	viewMessages
 	viewSearch
 	viewAttachments
+	viewStats
+)
+
+// Below this size the layout can't fit a header, messages, and footer, so
+// View asks for a bigger terminal instead.
+const (
+	minWidth  = 40
+	minHeight = 10
 )
 
+// modelOptions carries command-line settings into the model.
+type modelOptions struct {
+	foldSearch  bool // ignore case and diacritics when searching
+	recentCount int  // conversations shown in the recent quick view
+	showOrphans bool // list messages joined to no chat as their own conversation
+	textCounts  bool // list counts leave out reactions and attachment-only messages
+
+	followInterval time.Duration // how often follow mode polls; 0 for the default
+	searchLimit    int           // matches per search page; 0 for the default
+	collapseDupes  bool          // show runs of duplicate rows as one message with "×N"
+
+	dates *relativeDates   // relative date cutoffs; nil for the defaults
+	units chatdb.ByteUnits // how file sizes are labeled
+
+	exportColumns []string      // CSV export columns; nil means all
+	exportPrivacy exportPrivacy // anonymizing and redaction for CSV and text exports
+}
+
 type model struct {
-	store    *Store
-	contacts *ContactBook
+	ctx      context.Context // canceled when the program exits
+	store    *chatdb.Store
+	contacts *chatdb.ContactBook
+	opts     modelOptions
 	state    viewState
 	width    int
 	height   int
 	err      error
 
-	convList  list.Model
-	convItems []Conversation
+	convList    list.Model
+	convItems   []chatdb.Conversation
+	convLoading bool            // the conversation list hasn't arrived yet
+	spinner     spinner.Model   // shown while convLoading
+	recentOnly  bool            // quick view: only the most recent conversations
+	hidden      map[string]bool // chat identifiers and ids kept out of the list
+	exactFilter bool            // substring instead of fuzzy conversation filter
+	gotoInput   string          // position being typed to jump to in the list
 
 	viewport           viewport.Model
-	messages           []Message
+	messages           []chatdb.Message
 	activeChatID       int
+	chatCtx            context.Context    // canceled when leaving the active chat
+	cancelChat         context.CancelFunc // cancels chatCtx; nil outside a chat
 	activeChatTitle    string
 	activeParticipants []string // raw handle IDs for the active chat
 	activeMsgCount     int
-	oldestCursor       int
+	senderColors       map[string]lipgloss.Style // group chat name styles by lowercased handle
+	oldestCursor       chatdb.MessageCursor
 	allLoaded          bool
 	loading            bool
+	previewID          int // chat last opened, shown beside the list in the split layout; 0 for none
 
 	// Search state
 	searchInput   textinput.Model
 	searchResults list.Model
 	searching     bool
 	searchTerm    string
+	searchData    []chatdb.SearchResult // results as returned by the store
+	searchSort    searchSortMode
+	searchDates   searchDateFilter
+	searchScope   chatdb.ChatScope
+	searchLimit   int      // matches fetched for the current query; M raises it
+	searchCapped  bool     // the last search hit searchLimit, so there may be more
+	searchChat    int      // show only this chat's results (f), or 0 for all
+	searchChatIn  string   // searchChat's name, for the title
+	searchHistory []string // past queries, newest first
+	historyIdx    int      // position while cycling searchHistory, or -1
 
 	// In-conversation search state
 	msgSearchActive bool
@@ -56,66 +116,244 @@ type model struct {
 	msgSearchHits   []int // indices into m.messages that match
 	msgSearchIdx    int   // current match position in msgSearchHits
 
+	senderFilter senderFilter // render-time filter over m.messages
+	showSidebar  bool         // participant panel beside the messages
+	expandHeader bool         // list every participant in the header
+	compact      bool         // group runs of messages under one sender header
+	showHandles  bool         // show the raw handle after resolved contact names
+	hideSizes    bool         // leave file sizes out of attachment labels
+
+	// Live keyword filter over the loaded messages (message view)
+	msgFilterInput textinput.Model
+	msgFilterTerm  string
+
+	focus             int                   // index into m.messages of the focused message
+	pendingCount      int                   // vim-style count typed before a motion key, or 0
+	lastViewed        map[string]int        // chat GUID → newest ROWID seen on the last visit
+	chatFormats       map[string]string     // chat GUID → format it was last exported in
+	pickingFormat     bool                  // the export format picker is open
+	formatPick        int                   // the picker's highlighted index in exportFormats
+	newSince          int                   // ROWID after which messages are new this visit, or 0
+	newMarkerLine     int                   // content line of the "new since" separator, or -1
+	detail            *chatdb.MessageDetail // focused message's metadata overlay, if open
+	threadReturn      *savedMessages        // conversation to restore when showing a reply thread
+	handleView        string                // handle whose messages from every chat are shown, or ""
+	fromStart         bool                  // reading the chat forward from its first message
+	newestCursor      chatdb.MessageCursor  // with fromStart, the newest loaded message
+	endLoaded         bool                  // with fromStart, the chat's newest message is loaded
+	selectAnchor      int                   // where a range selection started, or -1
+	expandReactionsOf map[int]bool          // ROWIDs whose reactions are listed by name
+	following         bool                  // polling the open chat for new messages
+	followGen         int                   // bumped whenever following starts or stops
+
+	// Render layout, refreshed by renderMessages
+	dupCounts  map[int]int      // run length by ROWID of each duplicate run's first message
+	dupHidden  map[int]bool     // ROWIDs of duplicates folded into an earlier message
+	msgLines   []int            // content line each message starts on
+	dayLines   []int            // content line of each date separator
+	blockCache map[int]msgBlock // rendered messages by ROWID
+
+	// Messages quoted by replies but not on a loaded page, by guid
+	quotes map[string]chatdb.Message
+
+	// Group membership history overlay; nil when closed
+	groupEvents *[]chatdb.GroupEvent
+
 	// Export state
 	exporting    bool
 	exportStatus string
 
 	// Attachment list state
-	attachmentList list.Model
+	attachmentList   list.Model
+	attachmentData   []chatdb.ChatAttachment // as loaded, before type filter and sort
+	attachTypeFilter string                  // TypeLabel to show, or "" for all
+	attachSortBySize bool
+	attachGlobal     bool // browsing attachments from every chat
+	attachLoading    bool // waiting for attachmentsLoadedMsg
+	preview          attachmentPreview
+
+	// Stats view state; nil until loaded
+	stats *chatStats
+
+	summary *chatdb.DatabaseSummary // shown above the conversation list; nil until loaded
+	// contactsWarning says why names aren't resolved. It replaces the
+	// summary until the first key press in the conversation list.
+	contactsWarning string
 }
 
 // Bubble Tea messages
 type conversationsLoadedMsg struct {
-	conversations []Conversation
+	conversations []chatdb.Conversation
 	err           error
 }
 
 type messagesLoadedMsg struct {
-	messages []Message
+	messages []chatdb.Message
 	chatID   int
+	handle   string // the cross-chat handle view the page is for, or ""
 	prepend  bool
+	forward  bool // a page after the newest loaded, reading from the start
 	err      error
 }
 
 type searchResultsMsg struct {
-	results []SearchResult
+	results []chatdb.SearchResult
 	term    string
+	limit   int
+	err     error
+}
+
+type summaryLoadedMsg struct {
+	summary chatdb.DatabaseSummary
 	err     error
 }
 
+type messageDetailMsg struct {
+	detail chatdb.MessageDetail
+	found  bool
+	err    error
+}
+
+type quotesLoadedMsg struct {
+	chatID int
+	quotes map[string]chatdb.Message
+	err    error
+}
+
+// messagesReloadedMsg is the loaded window fetched again, from its oldest
+// message through any that arrived since.
+type messagesReloadedMsg struct {
+	chatID   int
+	messages []chatdb.Message
+	err      error
+}
+
+type groupEventsMsg struct {
+	chatID int
+	events []chatdb.GroupEvent
+	err    error
+}
+
+type threadLoadedMsg struct {
+	messages []chatdb.Message
+	err      error
+}
+
+// savedMessages is the message view's place in a conversation, kept while a
+// reply thread temporarily replaces it.
+type savedMessages struct {
+	messages     []chatdb.Message
+	focus        int
+	oldestCursor chatdb.MessageCursor
+	allLoaded    bool
+	yOffset      int
+}
+
+type attachmentSearchMsg struct {
+	groups []chatdb.AttachmentGroup
+	label  string
+	err    error
+}
+
 type exportDoneMsg struct {
 	path string
 	err  error
 }
 
 type attachmentsLoadedMsg struct {
-	attachments []ChatAttachment
+	attachments []chatdb.ChatAttachment
 	err         error
 }
 
 type attachmentOpenedMsg struct {
-	err error
+	status string // what happened, when there's more to say than success
+	err    error
+}
+
+type previewLoadedMsg struct {
+	path string
+	text string
+	err  error
+}
+
+// attachmentPreview is the text shown under the attachment list for the
+// selected file; path is "" when it isn't a previewable type.
+type attachmentPreview struct {
+	path   string
+	loaded bool
+	text   string
+	err    error
+}
+
+// senderFilter hides one side of a conversation when rendering.
+type senderFilter int
+
+const (
+	showAll senderFilter = iota
+	showSent
+	showReceived
+)
+
+func (f senderFilter) String() string {
+	switch f {
+	case showSent:
+		return "sent only"
+	case showReceived:
+		return "received only"
+	default:
+		return "all messages"
+	}
+}
+
+func (f senderFilter) next() senderFilter {
+	return (f + 1) % 3
+}
+
+func (f senderFilter) shows(msg chatdb.Message) bool {
+	switch f {
+	case showSent:
+		return msg.IsFromMe
+	case showReceived:
+		return !msg.IsFromMe
+	default:
+		return true
+	}
 }
 
 // convItem adapts Conversation for bubbles/list
 type convItem struct {
-	conv     Conversation
-	contacts *ContactBook
+	conv        chatdb.Conversation
+	contacts    *chatdb.ContactBook
+	dates       *relativeDates // nil for the defaults
+	textCounts  bool           // count only messages with text
+	showHandles bool           // follow contact names with their handle
 }
 
 func (c convItem) Title() string {
 	if c.conv.DisplayName != "" {
 		return c.conv.DisplayName
 	}
-	if c.contacts != nil && len(c.conv.Participants) > 0 {
+	handles := c.conv.Participants
+	if len(handles) == 0 {
+		handles = c.conv.Senders
+	}
+	if c.contacts != nil && len(handles) > 0 {
 		var names []string
-		for _, p := range c.conv.Participants {
-			names = append(names, c.contacts.ResolveName(p))
+		for _, p := range handles {
+			if c.showHandles {
+				names = append(names, nameWithHandle(c.contacts, p))
+			} else {
+				names = append(names, c.contacts.ResolveName(p))
+			}
 		}
 		return strings.Join(names, ", ")
 	}
-	if len(c.conv.Participants) > 0 {
-		return strings.Join(c.conv.Participants, ", ")
+	if len(handles) > 0 {
+		return strings.Join(handles, ", ")
+	}
+	if c.conv.Style == chatdb.ChatStyleGroup {
+		// An identifier like "chat123456789" means nothing to the reader
+		return "Unnamed group"
 	}
 	return c.conv.Identifier
 }
@@ -123,15 +361,35 @@ func (c convItem) Title() string {
 func (c convItem) Description() string {
 	last := "no messages"
 	if !c.conv.LastMsgDate.IsZero() {
-		last = formatRelativeDate(c.conv.LastMsgDate)
+		last = c.dates.format(c.conv.LastMsgDate)
 	}
 	started := ""
 	if !c.conv.FirstMsgDate.IsZero() {
 		started = c.conv.FirstMsgDate.Format("Jan 02, 2006")
 	}
 	msgStats := fmt.Sprintf("%d msgs (%d sent, %d recv)", c.conv.MessageCount, c.conv.SentCount, c.conv.ReceivedCount)
-	return fmt.Sprintf("%-14s |  %-36s |  started %s  |  %s",
+	if c.textCounts {
+		msgStats = fmt.Sprintf("%d text msgs (%d in all)", c.conv.TextMessageCount, c.conv.MessageCount)
+	}
+	desc := fmt.Sprintf("%-14s |  %-36s |  started %s  |  %s",
 		last, msgStats, started, c.conv.ServiceName)
+	if c.conv.MessageCount == 0 {
+		return desc
+	}
+	return desc + "\n" + lastMessagePreview(c.conv.LastMessageText)
+}
+
+// lastMessagePreview flattens a conversation's newest message onto one
+// line for the list, with a placeholder for messages without text.
+func lastMessagePreview(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return "[attachment]"
+	}
+	if r := []rune(text); len(r) > previewLength {
+		text = string(r[:previewLength-1]) + "…"
+	}
+	return text
 }
 
 func (c convItem) FilterValue() string {
@@ -140,7 +398,8 @@ func (c convItem) FilterValue() string {
 
 // searchItem adapts SearchResult for bubbles/list
 type searchItem struct {
-	result SearchResult
+	result chatdb.SearchResult
+	dates  *relativeDates // nil for the defaults
 }
 
 func (s searchItem) Title() string {
@@ -162,7 +421,11 @@ func (s searchItem) Title() string {
 }
 
 func (s searchItem) Description() string {
-	return fmt.Sprintf("in %s  |  %s", s.result.ChatName, formatRelativeDate(s.result.Date))
+	desc := fmt.Sprintf("in %s  |  %s", s.result.ChatName, s.dates.format(s.result.Date))
+	if s.result.Service != "" {
+		desc += "  |  " + s.result.Service
+	}
+	return desc
 }
 
 func (s searchItem) FilterValue() string {
@@ -171,8 +434,12 @@ func (s searchItem) FilterValue() string {
 
 // attachmentItem adapts ChatAttachment for bubbles/list
 type attachmentItem struct {
-	attachment ChatAttachment
-	contacts   *ContactBook
+	attachment chatdb.ChatAttachment
+	contacts   *chatdb.ContactBook
+	showChat   bool             // include the conversation name (global browser)
+	hideSize   bool             // leave out the file size
+	units      chatdb.ByteUnits // how the file size is labeled
+	dates      *relativeDates   // nil for the defaults
 }
 
 func (a attachmentItem) Title() string {
@@ -180,10 +447,17 @@ func (a attachmentItem) Title() string {
 	if a.attachment.Filename != "" {
 		parts = append(parts, a.attachment.Filename)
 	}
-	if a.attachment.Size > 0 {
-		parts = append(parts, formatBytes(a.attachment.Size))
+	if a.attachment.Size > 0 && !a.hideSize {
+		parts = append(parts, a.units.Format(a.attachment.Size))
 	}
-	return strings.Join(parts, " — ")
+	title := strings.Join(parts, " — ")
+	switch a.attachment.State {
+	case chatdb.AttachmentOffloaded:
+		title += "  " + offloadedStyle.Render("☁ needs download")
+	case chatdb.AttachmentMissing:
+		title += "  " + failedStyle.Render("✗ missing")
+	}
+	return title
 }
 
 func (a attachmentItem) Description() string {
@@ -198,31 +472,106 @@ func (a attachmentItem) Description() string {
 			sender = "Unknown"
 		}
 	}
-	return fmt.Sprintf("from %s  |  %s", sender, formatRelativeDate(a.attachment.Date))
+	if a.showChat {
+		chat := a.attachment.ChatName
+		if a.contacts != nil {
+			chat = a.contacts.ResolveName(chat)
+		}
+		return fmt.Sprintf("from %s  |  in %s  |  %s", sender, chat, a.dates.format(a.attachment.Date))
+	}
+	return fmt.Sprintf("from %s  |  %s", sender, a.dates.format(a.attachment.Date))
 }
 
 func (a attachmentItem) FilterValue() string {
 	return a.attachment.Filename + " " + a.attachment.TypeLabel
 }
 
-func formatRelativeDate(t time.Time) string {
-	now := time.Now()
+// relativeDates holds the cutoffs and layouts for relative dates in the
+// conversation, search, and attachment lists.
+type relativeDates struct {
+	weekdayDays int    // days ago, from 2, shown as weekday and time below this
+	daysAgoDays int    // days ago shown as "Nd ago" below this, after weekdays
+	timeLayout  string // clock time after "Yesterday" and the weekday
+	dateLayout  string // dates earlier this year
+	yearLayout  string // dates in earlier years
+}
+
+// defaultRelativeDates shows the weekday for the past week, then the date.
+var defaultRelativeDates = relativeDates{
+	weekdayDays: 7,
+	daysAgoDays: 7,
+	timeLayout:  "03:04 PM",
+	dateLayout:  "Jan 02",
+	yearLayout:  "Jan 02, 2006",
+}
+
+// daysAgoDates shows "Nd ago" instead of the weekday for dates up to days
+// back, e.g. "12d ago" with days 30, then the date as usual.
+func daysAgoDates(days int) relativeDates {
+	r := defaultRelativeDates
+	r.weekdayDays = 2
+	r.daysAgoDays = days + 1
+	return r
+}
+
+// format formats t relative to the current time. A nil r uses the defaults.
+func (r *relativeDates) format(t time.Time) string {
+	return r.formatAt(t, time.Now())
+}
+
+// formatAt formats t relative to now. Beyond the first hour it goes by
+// calendar day rather than elapsed time, so a message from 11:50pm
+// yesterday reads "Yesterday" even when fewer than 24 hours have passed.
+func (r *relativeDates) formatAt(t, now time.Time) string {
+	if r == nil {
+		r = &defaultRelativeDates
+	}
 	diff := now.Sub(t)
+	days := calendarDaysBetween(t, now)
 
 	switch {
 	case diff < time.Minute:
 		return "just now"
 	case diff < time.Hour:
 		return fmt.Sprintf("%dm ago", int(diff.Minutes()))
-	case diff < 24*time.Hour:
+	case days == 0:
 		return fmt.Sprintf("%dh ago", int(diff.Hours()))
-	case diff < 7*24*time.Hour:
-		return t.Format("Mon 03:04 PM")
+	case days == 1:
+		return "Yesterday " + t.Format(r.timeLayout)
+	case days < r.weekdayDays:
+		return t.Format("Mon " + r.timeLayout)
+	case days < r.daysAgoDays:
+		return fmt.Sprintf("%dd ago", days)
 	case t.Year() == now.Year():
-		return t.Format("Jan 02")
+		return t.Format(r.dateLayout)
 	default:
-		return t.Format("Jan 02, 2006")
+		return t.Format(r.yearLayout)
+	}
+}
+
+// calendarDaysBetween counts the midnights between t and now in now's
+// time zone: 0 for the same day, 1 for yesterday.
+func calendarDaysBetween(t, now time.Time) int {
+	t = t.In(now.Location())
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, now.Location())
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	// Round to absorb 23h/25h days around DST changes
+	return int(math.Round(end.Sub(start).Hours() / 24))
+}
+
+// formatSummary renders a one-line overview of the database, e.g.
+// "3 conversations, 23 messages, 4 attachments, spanning Jun 2024".
+func formatSummary(sum chatdb.DatabaseSummary) string {
+	line := fmt.Sprintf("%d conversations, %d messages, %d attachments",
+		sum.Conversations, sum.Messages, sum.Attachments)
+	if sum.First.IsZero() {
+		return line
+	}
+	first, last := sum.First.Format("Jan 2006"), sum.Last.Format("Jan 2006")
+	if first == last {
+		return line + ", spanning " + first
 	}
+	return line + ", spanning " + first + " – " + last
 }
 
 func formatMessageTime(t time.Time) string {
@@ -245,10 +594,15 @@ func formatMessageTime(t time.Time) string {
 	return fmt.Sprintf("%s, %s", t.Format("Jan 02, 2006"), timeStr)
 }
 
-func formatAttachments(attachments []AttachmentInfo) string {
+// formatAttachments labels a message's attachments, with their sizes in
+// units unless hideSizes is set.
+func formatAttachments(attachments []chatdb.AttachmentInfo, units chatdb.ByteUnits, hideSizes bool) string {
 	var parts []string
 	for _, a := range attachments {
-		parts = append(parts, a.String())
+		if hideSizes {
+			a.Size = 0 // Label leaves out unknown sizes
+		}
+		parts = append(parts, a.Label(units))
 	}
 	return strings.Join(parts, " ")
 }
@@ -271,22 +625,29 @@ func highlightTerm(text, term string) string {
 	return sb.String()
 }
 
+// truncate cuts s to at most max terminal cells, marking the cut with "~".
+// Width is measured the way lipgloss pads, so emoji and CJK characters
+// (two cells each) keep the columns aligned.
 func truncate(s string, max int) string {
-	if len(s) <= max {
+	if ansi.StringWidth(s) <= max {
 		return s
 	}
 	if max <= 3 {
-		return s[:max]
+		return ansi.Truncate(s, max, "")
 	}
-	return s[:max-1] + "~"
+	return ansi.Truncate(s, max, "~")
 }
 
-func NewModel(store *Store, contacts *ContactBook) model {
+// NewModel builds the UI model. Store queries run under ctx, so canceling
+// it aborts any still in flight.
+func NewModel(ctx context.Context, store *chatdb.Store, contacts *chatdb.ContactBook) model {
 	delegate := list.NewDefaultDelegate()
+	delegate.SetHeight(3) // title, stats, last message preview
 	convList := list.New([]list.Item{}, delegate, 0, 0)
 	convList.Title = "iMessage Conversations"
 	convList.SetShowStatusBar(true)
 	convList.SetFilteringEnabled(true)
+	convList.Filter = conversationFilter(false)
 	convList.Styles.Title = titleStyle
 
 	vp := viewport.New(0, 0)
@@ -309,6 +670,11 @@ func NewModel(store *Store, contacts *ContactBook) model {
 	msgSearchTi.CharLimit = 256
 	msgSearchTi.Width = 40
 
+	msgFilterTi := textinput.New()
+	msgFilterTi.Placeholder = "Filter loaded messages..."
+	msgFilterTi.CharLimit = 256
+	msgFilterTi.Width = 40
+
 	attachDelegate := list.NewDefaultDelegate()
 	attachList := list.New([]list.Item{}, attachDelegate, 0, 0)
 	attachList.Title = "Attachments"
@@ -316,24 +682,104 @@ func NewModel(store *Store, contacts *ContactBook) model {
 	attachList.SetFilteringEnabled(true)
 	attachList.Styles.Title = titleStyle
 
+	sp := spinner.New()
+	sp.Spinner = spinner.Dot
+	sp.Style = fromThemStyle
+
 	return model{
-		store:          store,
-		contacts:       contacts,
-		state:          viewConversations,
-		convList:       convList,
-		viewport:       vp,
-		searchInput:    ti,
-		searchResults:  searchList,
-		attachmentList: attachList,
-		msgSearchInput: msgSearchTi,
+		ctx:             ctx,
+		chatCtx:         ctx,
+		store:           store,
+		contacts:        contacts,
+		state:           viewConversations,
+		convList:        convList,
+		convLoading:     true,
+		spinner:         sp,
+		viewport:        vp,
+		searchInput:     ti,
+		searchResults:   searchList,
+		attachmentList:  attachList,
+		msgSearchInput:  msgSearchTi,
+		msgFilterInput:  msgFilterTi,
+		focus:           -1,
+		selectAnchor:    -1,
+		searchHistory:   loadSearchHistory(),
+		lastViewed:      loadLastViewed(),
+		chatFormats:     loadExportFormats(),
+		hidden:          loadHiddenChats(),
+		historyIdx:      -1,
+		contactsWarning: contactsWarning(contacts.Err()),
+	}
+}
+
+// contactsWarning explains a failure to read the AddressBook, or returns ""
+// when there was none. Without it a blocked AddressBook just looks like
+// nobody is in it.
+func contactsWarning(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, fs.ErrPermission):
+		return "Contacts unavailable — grant Full Disk Access to resolve names"
+	default:
+		return fmt.Sprintf("Contacts unavailable — %v", err)
+	}
+}
+
+// withOptions applies command-line settings.
+func (m model) withOptions(opts modelOptions) model {
+	m.opts = opts
+	return m
+}
+
+// withInitialChat starts the model in the message view for chatID. The
+// title and participants are filled in once conversations load; if the chat
+// doesn't exist the model falls back to the conversation list.
+func (m model) withInitialChat(chatID int) model {
+	m.state = viewMessages
+	m.activeChatID = chatID
+	m.loading = true
+	m.enterChat()
+	return m
+}
+
+// enterChat gives the newly active chat its own context, canceling queries
+// still running for the previous one.
+func (m *model) enterChat() {
+	m.leaveChat()
+	m.chatCtx, m.cancelChat = context.WithCancel(m.ctx)
+}
+
+// leaveChat cancels queries for the active chat that are still running.
+func (m *model) leaveChat() {
+	m.stopFollowing()
+	if m.cancelChat != nil {
+		m.cancelChat()
+		m.cancelChat = nil
 	}
 }
 
 func (m model) Init() tea.Cmd {
-	return func() tea.Msg {
-		convs, err := m.store.FetchConversations()
+	loadConvs := func() tea.Msg {
+		convs, err := m.store.FetchConversations(m.ctx)
+		if err == nil && m.opts.showOrphans {
+			var orphans chatdb.Conversation
+			var found bool
+			orphans, found, err = m.store.FetchOrphanConversation(m.ctx)
+			if found {
+				convs = append([]chatdb.Conversation{orphans}, convs...)
+			}
+		}
 		return conversationsLoadedMsg{conversations: convs, err: err}
 	}
+	loadSummary := func() tea.Msg {
+		sum, err := m.store.DatabaseSummary(m.ctx)
+		return summaryLoadedMsg{summary: sum, err: err}
+	}
+	if m.state == viewMessages && m.activeChatID > 0 {
+		return tea.Batch(loadConvs, loadSummary, m.spinner.Tick, m.fetchMessagesCmd(m.activeChatID, chatdb.MessageCursor{}, false))
+	}
+	return tea.Batch(loadConvs, loadSummary, m.spinner.Tick)
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -342,31 +788,41 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
-		m.convList.SetSize(msg.Width-4, msg.Height-4)
+		m.convList.SetSize(m.convListWidth(), msg.Height-5)
 		m.searchResults.SetSize(msg.Width-4, msg.Height-7)
 		m.attachmentList.SetSize(msg.Width-4, msg.Height-4)
-		m.viewport.Width = msg.Width - 4
-		m.viewport.Height = calcViewportHeight(m.height, len(m.activeParticipants))
-		if m.state == viewMessages && len(m.messages) > 0 {
+		m.viewport.Width = m.messageViewportWidth()
+		m.viewport.Height = calcViewportHeight(m.height, m.headerParticipantLines())
+		if len(m.messages) > 0 {
 			m.viewport.SetContent(m.renderMessages())
 		}
-		return m, nil
+		// Growing into the split layout fills the message pane
+		return m, m.syncPreview()
 
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "ctrl+c":
+			if m.state == viewMessages {
+				return m, tea.Sequence(m.rememberLastViewed(), tea.Quit)
+			}
 			return m, tea.Quit
 		}
 
 		switch m.state {
 		case viewConversations:
-			return m.updateConversationList(msg)
+			// Whatever the key did to the selection, the message pane
+			// follows it
+			updated, cmd := m.updateConversationList(msg)
+			m = updated.(model)
+			return m, tea.Batch(cmd, m.syncPreview())
 		case viewMessages:
 			return m.updateMessageView(msg)
 		case viewSearch:
 			return m.updateSearchView(msg)
 		case viewAttachments:
 			return m.updateAttachmentView(msg)
+		case viewStats:
+			return m.updateStatsView(msg)
 		}
 
 	case conversationsLoadedMsg:
@@ -374,12 +830,21 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.err = msg.err
 			return m, tea.Quit
 		}
+		m.convLoading = false
 		m.convItems = msg.conversations
-		items := make([]list.Item, len(msg.conversations))
-		for i, c := range msg.conversations {
-			items[i] = convItem{conv: c, contacts: m.contacts}
+		cmd := m.applyConversationItems()
+		if m.state == viewMessages && m.activeChatTitle == "" {
+			m.resolveInitialChat()
+		}
+		return m, tea.Batch(cmd, m.syncPreview())
+
+	case spinner.TickMsg:
+		// Stop ticking once the list is in
+		if !m.convLoading {
+			return m, nil
 		}
-		cmd := m.convList.SetItems(items)
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
 		return m, cmd
 
 	case messagesLoadedMsg:
@@ -387,10 +852,14 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.err = msg.err
 			return m, nil
 		}
-		if msg.chatID != m.activeChatID {
+		if msg.chatID != m.activeChatID || msg.handle != m.handleView || msg.forward != m.fromStart {
 			return m, nil
 		}
 		m.loading = false
+		if msg.forward {
+			m.appendForwardPage(msg.messages)
+			return m, m.fetchQuotesCmd()
+		}
 		if len(msg.messages) == 0 {
 			m.allLoaded = true
 			m.viewport.SetContent(m.renderMessages())
@@ -398,18 +867,86 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		if msg.prepend {
 			m.messages = append(msg.messages, m.messages...)
+			m.focus += len(msg.messages)
+			if m.selectAnchor >= 0 {
+				m.selectAnchor += len(msg.messages)
+			}
 		} else {
 			m.messages = msg.messages
+			m.focus = len(m.messages) - 1
 		}
 		if len(m.messages) > 0 {
-			m.oldestCursor = m.messages[0].ROWID
+			m.oldestCursor = chatdb.CursorAt(m.messages[0])
 		}
-		if len(msg.messages) < messagesPageSize {
+		if len(msg.messages) < chatdb.MessagesPageSize {
 			m.allLoaded = true
 		}
 		m.viewport.SetContent(m.renderMessages())
 		if !msg.prepend {
 			m.viewport.GotoBottom()
+			m.scrollToNewSince()
+		}
+		return m, m.fetchQuotesCmd()
+
+	case messagesReloadedMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		if msg.chatID != m.activeChatID || m.threadReturn != nil {
+			return m, nil
+		}
+		m.loading = false
+		m.applyReload(msg.messages)
+		return m, m.fetchQuotesCmd()
+
+	case followTickMsg:
+		if msg.gen != m.followGen || !m.following {
+			return m, nil
+		}
+		if m.loading || m.threadReturn != nil {
+			// Try again next time rather than racing a load or
+			// appending to a thread
+			return m, m.followTickCmd()
+		}
+		return m, m.pollNewMessagesCmd()
+
+	case followedMsg:
+		if msg.gen != m.followGen || msg.chatID != m.activeChatID {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.exportStatus = fmt.Sprintf("Follow failed: %v", msg.err)
+			return m, m.followTickCmd()
+		}
+		if m.threadReturn != nil || m.loading {
+			// The next poll picks these up again
+			return m, m.followTickCmd()
+		}
+		m.applyFollowedReactions(msg.reactions)
+		if n := m.appendFollowed(msg.messages); n > 0 {
+			m.exportStatus = fmt.Sprintf("Following, %d new", n)
+			return m, tea.Batch(m.followTickCmd(), m.fetchQuotesCmd())
+		}
+		return m, m.followTickCmd()
+
+	case quotesLoadedMsg:
+		// Quotes are context only; a failed lookup just leaves them out
+		if msg.err != nil || msg.chatID != m.activeChatID {
+			return m, nil
+		}
+		if m.quotes == nil {
+			m.quotes = map[string]chatdb.Message{}
+		}
+		for guid, q := range msg.quotes {
+			m.quotes[guid] = q
+		}
+		atBottom := m.viewport.AtBottom()
+		m.viewport.SetContent(m.renderMessages())
+		if atBottom {
+			m.viewport.GotoBottom()
+		} else {
+			m.scrollToFocus()
 		}
 		return m, nil
 
@@ -420,6 +957,17 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		} else {
 			m.exportStatus = fmt.Sprintf("Exported to %s", msg.path)
 		}
+		if m.state == viewConversations {
+			// Exported from the list; don't carry the note into the next chat
+			status := m.exportStatus
+			m.exportStatus = ""
+			return m, m.convList.NewStatusMessage(status)
+		}
+		if m.state == viewAttachments {
+			status := m.exportStatus
+			m.exportStatus = ""
+			return m, m.attachmentList.NewStatusMessage(status)
+		}
 		return m, nil
 
 	case attachmentsLoadedMsg:
@@ -427,34 +975,136 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.err = msg.err
 			return m, nil
 		}
-		items := make([]list.Item, len(msg.attachments))
-		for i, a := range msg.attachments {
-			items[i] = attachmentItem{attachment: a, contacts: m.contacts}
+		m.attachmentData = msg.attachments
+		m.attachLoading = false
+		return m, m.applyAttachmentView()
+
+	case summaryLoadedMsg:
+		// The summary is only orientation; leave it out if it fails
+		if msg.err == nil {
+			m.summary = &msg.summary
 		}
-		cmd := m.attachmentList.SetItems(items)
-		m.attachmentList.Title = fmt.Sprintf("Attachments — %d files", len(msg.attachments))
-		return m, cmd
+		return m, nil
 
-	case attachmentOpenedMsg:
+	case messageDetailMsg:
 		if msg.err != nil {
-			m.exportStatus = fmt.Sprintf("Failed to open: %v", msg.err)
+			m.err = msg.err
+			return m, nil
+		}
+		if m.state == viewMessages && msg.found {
+			m.detail = &msg.detail
 		}
 		return m, nil
 
-	case searchResultsMsg:
+	case groupEventsMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		if m.state == viewMessages && msg.chatID == m.activeChatID {
+			m.groupEvents = &msg.events
+		}
+		return m, nil
+
+	case threadLoadedMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		if m.state != viewMessages || m.threadReturn != nil {
+			return m, nil
+		}
+		if len(msg.messages) < 2 {
+			m.exportStatus = "No replies to this message"
+			return m, nil
+		}
+		m.threadReturn = &savedMessages{
+			messages:     m.messages,
+			focus:        m.focus,
+			oldestCursor: m.oldestCursor,
+			allLoaded:    m.allLoaded,
+			yOffset:      m.viewport.YOffset,
+		}
+		m.messages = msg.messages
+		m.focus = 0
+		m.selectAnchor = -1
+		m.allLoaded = true
+		m.viewport.SetContent(m.renderMessages())
+		m.viewport.GotoTop()
+		return m, nil
+
+	case attachmentSearchMsg:
 		m.searching = false
 		if msg.err != nil {
 			m.err = msg.err
 			return m, nil
 		}
-		m.searchTerm = msg.term
-		items := make([]list.Item, len(msg.results))
-		for i, r := range msg.results {
-			items[i] = searchItem{result: r}
+		m.searchTerm = ""
+		m.searchData = nil
+		items := make([]list.Item, len(msg.groups))
+		total := 0
+		for i, g := range msg.groups {
+			items[i] = attachmentGroupItem{group: g, contacts: m.contacts, dates: m.opts.dates}
+			total += len(g.Attachments)
 		}
 		cmd := m.searchResults.SetItems(items)
-		m.searchResults.Title = fmt.Sprintf("Search Results — %d matches for %q", len(msg.results), msg.term)
+		m.searchResults.Title = fmt.Sprintf("Attachment Search — %d %q files in %d conversations",
+			total, msg.label, len(msg.groups))
 		return m, cmd
+
+	case statsLoadedMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		if msg.chatID == m.activeChatID {
+			st := msg.stats
+			m.stats = &st
+		}
+		return m, nil
+
+	case clipboardMsg:
+		status := fmt.Sprintf("Copied %s", msg.what)
+		if msg.err != nil {
+			status = fmt.Sprintf("Copy failed: %v", msg.err)
+		}
+		if m.state == viewAttachments {
+			return m, m.attachmentList.NewStatusMessage(status)
+		}
+		m.exportStatus = status
+		return m, nil
+
+	case attachmentOpenedMsg:
+		if msg.err == nil && msg.status != "" {
+			m.exportStatus = msg.status
+			return m, nil
+		}
+		if msg.err == nil {
+			return m, nil
+		}
+		if m.state == viewAttachments {
+			return m, m.attachmentList.NewStatusMessage(fmt.Sprintf("Failed to open: %v", msg.err))
+		}
+		m.exportStatus = fmt.Sprintf("Failed to open: %v", msg.err)
+		return m, nil
+
+	case previewLoadedMsg:
+		// A slow read can land after the selection has moved on
+		if msg.path == m.preview.path {
+			m.preview = attachmentPreview{path: msg.path, loaded: true, text: msg.text, err: msg.err}
+		}
+		return m, nil
+
+	case searchResultsMsg:
+		m.searching = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.searchTerm = msg.term
+		m.searchData = msg.results
+		m.searchCapped = len(msg.results) >= msg.limit
+		return m, m.applySearchSort()
 	}
 
 	switch m.state {
@@ -468,6 +1118,11 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.msgSearchInput, cmd = m.msgSearchInput.Update(msg)
 			return m, cmd
 		}
+		if m.msgFilterInput.Focused() {
+			var cmd tea.Cmd
+			m.msgFilterInput, cmd = m.msgFilterInput.Update(msg)
+			return m, cmd
+		}
 		var cmd tea.Cmd
 		m.viewport, cmd = m.viewport.Update(msg)
 		return m, cmd
@@ -483,59 +1138,293 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case viewAttachments:
 		var cmd tea.Cmd
 		m.attachmentList, cmd = m.attachmentList.Update(msg)
-		return m, cmd
+		m.updateAttachmentTitle()
+		return m, tea.Batch(cmd, m.previewSelectedCmd())
 	}
 
 	return m, nil
 }
 
 func (m model) updateConversationList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
+	m.contactsWarning = ""
+
+	// Typing a number jumps to that position in the list, like switching
+	// tabs in a browser; esc cancels and any other key finishes
+	key := msg.String()
+	if m.convList.FilterState() != list.Filtering {
+		switch {
+		case len(key) == 1 && key[0] >= '0' && key[0] <= '9':
+			m.typeGoto(m.gotoInput + key)
+			return m, nil
+		case m.gotoInput != "" && key == "backspace":
+			m.typeGoto(m.gotoInput[:len(m.gotoInput)-1])
+			return m, nil
+		case m.gotoInput != "" && key == "esc":
+			m.gotoInput = ""
+			return m, nil
+		}
+	}
+	m.gotoInput = ""
+
+	switch key {
 	case "enter":
 		selected, ok := m.convList.SelectedItem().(convItem)
 		if !ok {
 			return m, nil
 		}
-		m.state = viewMessages
-		m.activeChatID = selected.conv.ChatID
-		m.activeChatTitle = selected.Title()
-		m.activeParticipants = selected.conv.Participants
-		m.activeMsgCount = selected.conv.MessageCount
-		m.messages = nil
-		m.oldestCursor = 0
-		m.allLoaded = false
-		m.loading = true
-		m.viewport.Height = calcViewportHeight(m.height, len(m.activeParticipants))
-		return m, m.fetchMessagesCmd(selected.conv.ChatID, 0, false)
+		if m.split() && selected.conv.ChatID == m.previewID {
+			// Already open beside the list; just hand it the keys
+			m.state = viewMessages
+			return m, nil
+		}
+		return m, m.openChat(selected.conv.ChatID, selected.Title())
 
 	case "s":
 		if m.convList.FilterState() == list.Unfiltered {
 			m.state = viewSearch
 			m.searchInput.Focus()
 			m.searchInput.SetValue("")
+			m.historyIdx = -1
+			m.exportStatus = ""
 			return m, textinput.Blink
 		}
 
+	case "m":
+		if m.convList.FilterState() == list.Unfiltered {
+			return m, m.openAttachmentBrowser(true)
+		}
+
+	case "r":
+		if m.convList.FilterState() == list.Unfiltered {
+			m.recentOnly = !m.recentOnly
+			return m, m.applyConversationItems()
+		}
+
+	case "e":
+		if m.convList.FilterState() != list.Filtering && !m.exporting {
+			selected, ok := m.convList.SelectedItem().(convItem)
+			if !ok {
+				return m, nil
+			}
+			m.exporting = true
+			export := csvExporter(m.opts.exportColumns, m.opts.exportPrivacy, m.opts.units)
+			return m, tea.Batch(
+				m.convList.NewStatusMessage("Exporting "+selected.Title()+"..."),
+				m.exportChatCmd(export, selected.conv.ChatID, selected.conv.Participants, selected.Title(), dateRange{}))
+		}
+
+	case "x":
+		if m.convList.FilterState() != list.Filtering {
+			selected, ok := m.convList.SelectedItem().(convItem)
+			if !ok {
+				return m, nil
+			}
+			if m.hidden == nil {
+				m.hidden = map[string]bool{}
+			}
+			m.hidden[hiddenKey(selected.conv)] = true
+			cmd := m.applyConversationItems()
+			status := m.convList.NewStatusMessage("Hid " + selected.Title() + " — X unhides all")
+			return m, tea.Batch(cmd, status, saveHiddenChatsCmd(m.hidden))
+		}
+
+	case "I":
+		if m.convList.FilterState() != list.Filtering {
+			m.showHandles = !m.showHandles
+			return m, m.applyConversationItems()
+		}
+
+	case "X":
+		if m.convList.FilterState() != list.Filtering && len(m.hidden) > 0 {
+			n := len(m.convItems) - len(withoutHidden(m.convItems, m.hidden))
+			m.hidden = map[string]bool{}
+			cmd := m.applyConversationItems()
+			status := m.convList.NewStatusMessage(fmt.Sprintf("Unhid %d conversations", n))
+			return m, tea.Batch(cmd, status, saveHiddenChatsCmd(m.hidden))
+		}
+
+	case "F":
+		if m.convList.FilterState() != list.Filtering {
+			m.exactFilter = !m.exactFilter
+			m.convList.Filter = conversationFilter(m.exactFilter)
+			if m.convList.FilterState() == list.FilterApplied {
+				m.convList.SetFilterText(m.convList.FilterValue())
+			}
+			mode := "fuzzy"
+			if m.exactFilter {
+				mode = "exact"
+			}
+			return m, m.convList.NewStatusMessage("Filter: " + mode)
+		}
+
 	case "q":
 		if m.convList.FilterState() == list.Unfiltered {
 			return m, tea.Quit
 		}
 	}
 
+	// Remember the selection so clearing a filter doesn't jump to the top
+	prevState := m.convList.FilterState()
+	selectedID := -1
+	if selected, ok := m.convList.SelectedItem().(convItem); ok {
+		selectedID = selected.conv.ChatID
+	}
+
 	var cmd tea.Cmd
 	m.convList, cmd = m.convList.Update(msg)
+
+	if prevState != list.Unfiltered && m.convList.FilterState() == list.Unfiltered && selectedID >= 0 {
+		m.selectConversation(selectedID)
+	}
 	return m, cmd
 }
 
-func (m model) updateMessageView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	// When the search input is focused, handle input keys
-	if m.msgSearchActive && m.msgSearchInput.Focused() {
-		switch msg.String() {
-		case "enter":
-			query := strings.TrimSpace(m.msgSearchInput.Value())
-			if query == "" {
-				m.msgSearchActive = false
-				m.msgSearchInput.Blur()
+// typeGoto sets the pending goto input and selects the conversation at
+// that 1-based position among the visible ones. Input past the end of the
+// list is ignored so a stray digit doesn't lose the selection.
+func (m *model) typeGoto(input string) {
+	if input == "" {
+		m.gotoInput = ""
+		return
+	}
+	n, err := strconv.Atoi(input)
+	if err != nil || n < 1 || n > len(m.convList.VisibleItems()) {
+		return
+	}
+	m.gotoInput = input
+	m.convList.Select(n - 1)
+}
+
+// openChat switches to the message view for chatID and starts loading its
+// newest messages. Title and participants come from the loaded
+// conversations; fallbackTitle is used if the chat isn't among them.
+func (m *model) openChat(chatID int, fallbackTitle string) tea.Cmd {
+	m.state = viewMessages
+	m.activeChatID = chatID
+	m.previewID = chatID
+	m.enterChat()
+	m.activeChatTitle = fallbackTitle
+	m.activeParticipants = nil
+	m.activeMsgCount = 0
+	if conv, ok := m.activeConversation(); ok {
+		ci := convItem{conv: conv, contacts: m.contacts}
+		m.activeChatTitle = ci.Title()
+		m.activeParticipants = conv.Participants
+		m.activeMsgCount = conv.MessageCount
+	}
+	m.senderColors = senderStyles(m.activeParticipants)
+	m.messages = nil
+	m.focus = -1
+	m.selectAnchor = -1
+	m.threadReturn = nil
+	m.handleView = ""
+	m.fromStart = false
+	m.detail = nil
+	m.groupEvents = nil
+	m.quotes = nil
+	m.blockCache = nil
+	m.newSince = m.lastViewed[m.activeChatKey()]
+	m.msgFilterTerm = ""
+	m.msgFilterInput.SetValue("")
+	m.expandReactionsOf = nil
+	m.oldestCursor = chatdb.MessageCursor{}
+	m.allLoaded = false
+	m.loading = true
+	m.viewport.Height = calcViewportHeight(m.height, m.headerParticipantLines())
+	return m.fetchMessagesCmd(chatID, chatdb.MessageCursor{}, false)
+}
+
+// resolveInitialChat fills in the active chat details for a conversation
+// opened from the command line, or returns to the list if it doesn't exist.
+func (m *model) resolveInitialChat() {
+	for _, conv := range m.convItems {
+		if conv.ChatID == m.activeChatID {
+			ci := convItem{conv: conv, contacts: m.contacts}
+			m.activeChatTitle = ci.Title()
+			m.activeParticipants = conv.Participants
+			m.activeMsgCount = conv.MessageCount
+			m.senderColors = senderStyles(conv.Participants)
+			m.blockCache = nil
+			m.viewport.Height = calcViewportHeight(m.height, m.headerParticipantLines())
+			if len(m.messages) > 0 {
+				m.viewport.SetContent(m.renderMessages())
+			}
+			m.selectConversation(conv.ChatID)
+			return
+		}
+	}
+	m.leaveChat()
+	m.state = viewConversations
+	m.activeChatID = 0
+	m.previewID = 0
+	m.messages = nil
+	m.loading = false
+}
+
+// applyConversationItems rebuilds the conversation list from m.convItems,
+// trimmed to the most recent ones in quick view, keeping the selection.
+func (m *model) applyConversationItems() tea.Cmd {
+	selectedID := -1
+	if selected, ok := m.convList.SelectedItem().(convItem); ok {
+		selectedID = selected.conv.ChatID
+	}
+
+	convs := withoutHidden(m.convItems, m.hidden)
+	title := "iMessage Conversations"
+	if m.recentOnly {
+		convs = mostRecentConversations(convs, m.opts.recentCount)
+		title = fmt.Sprintf("iMessage Conversations — %d most recent", len(convs))
+	}
+	if n := len(m.convItems) - len(withoutHidden(m.convItems, m.hidden)); n > 0 {
+		title += fmt.Sprintf(" (%d hidden)", n)
+	}
+
+	items := make([]list.Item, len(convs))
+	for i, c := range convs {
+		items[i] = convItem{conv: c, contacts: m.contacts, dates: m.opts.dates, textCounts: m.opts.textCounts, showHandles: m.showHandles}
+	}
+	cmd := m.convList.SetItems(items)
+	m.convList.Title = title
+	if selectedID >= 0 {
+		m.selectConversation(selectedID)
+	}
+	return cmd
+}
+
+// mostRecentConversations returns the n conversations with the latest
+// activity, most recent first.
+func mostRecentConversations(convs []chatdb.Conversation, n int) []chatdb.Conversation {
+	sorted := make([]chatdb.Conversation, len(convs))
+	copy(sorted, convs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].LastMsgDate.After(sorted[j].LastMsgDate)
+	})
+	if n > 0 && len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// selectConversation moves the conversation list cursor to the given chat,
+// if it's present in the (unfiltered) list.
+func (m *model) selectConversation(chatID int) {
+	for i, item := range m.convList.Items() {
+		if ci, ok := item.(convItem); ok && ci.conv.ChatID == chatID {
+			m.convList.Select(i)
+			return
+		}
+	}
+}
+
+func (m model) updateMessageView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	// When the search input is focused, handle input keys
+	if m.msgSearchActive && m.msgSearchInput.Focused() {
+		switch msg.String() {
+		case "enter":
+			query := strings.TrimSpace(m.msgSearchInput.Value())
+			if query == "" {
+				m.msgSearchActive = false
+				m.msgSearchInput.Blur()
 				return m, nil
 			}
 			m.msgSearchInput.Blur()
@@ -559,8 +1448,67 @@ func (m model) updateMessageView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, cmd
 	}
 
-	switch msg.String() {
+	// The live filter re-renders on every keystroke; enter keeps it applied
+	if m.msgFilterInput.Focused() {
+		switch msg.String() {
+		case "enter":
+			m.msgFilterInput.Blur()
+			return m, nil
+		case "esc":
+			m.clearMsgFilter()
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.msgFilterInput, cmd = m.msgFilterInput.Update(msg)
+		m.setMsgFilter(m.msgFilterInput.Value())
+		return m, cmd
+	}
+
+	// The detail overlay takes over the keyboard until it's closed
+	if m.detail != nil {
+		switch msg.String() {
+		case "esc", "backspace", "i", "q", "enter":
+			m.detail = nil
+		}
+		return m, nil
+	}
+	if m.groupEvents != nil {
+		switch msg.String() {
+		case "esc", "backspace", "H", "q", "enter":
+			m.groupEvents = nil
+		}
+		return m, nil
+	}
+	if m.pickingFormat {
+		return m.updateFormatPicker(msg)
+	}
+
+	// A count prefix ("10j") repeats the motion that follows it
+	key := msg.String()
+	if len(key) == 1 && key[0] >= '0' && key[0] <= '9' && (key != "0" || m.pendingCount > 0) {
+		if m.pendingCount < maxCountPrefix {
+			m.pendingCount = m.pendingCount*10 + int(key[0]-'0')
+		}
+		return m, nil
+	}
+	count := max(m.pendingCount, 1)
+	m.pendingCount = 0
+
+	switch key {
 	case "esc", "backspace":
+		if m.selectAnchor >= 0 {
+			m.selectAnchor = -1
+			m.viewport.SetContent(m.renderMessages())
+			return m, nil
+		}
+		if m.threadReturn != nil {
+			m.closeThread()
+			return m, nil
+		}
+		if m.msgFilterTerm != "" {
+			m.clearMsgFilter()
+			return m, nil
+		}
 		if m.msgSearchTerm != "" {
 			// First esc clears search highlighting
 			m.msgSearchActive = false
@@ -569,29 +1517,104 @@ func (m model) updateMessageView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.viewport.SetContent(m.renderMessages())
 			return m, nil
 		}
+		saveCmd := m.rememberLastViewed()
+		m.leaveChat()
 		m.state = viewConversations
 		m.messages = nil
+		m.previewID = 0
 		m.exportStatus = ""
-		return m, nil
+		return m, tea.Batch(saveCmd, m.syncPreview())
 	case "/":
 		m.msgSearchActive = true
 		m.msgSearchInput.SetValue("")
 		m.msgSearchInput.Focus()
 		return m, textinput.Blink
 	case "n":
+		if m.msgSearchTerm == "" {
+			for i := 0; i < count; i++ {
+				m.jumpToNextDay()
+			}
+			return m, nil
+		}
 		if len(m.msgSearchHits) > 0 {
-			m.msgSearchIdx = (m.msgSearchIdx + 1) % len(m.msgSearchHits)
+			m.msgSearchIdx = (m.msgSearchIdx + count) % len(m.msgSearchHits)
 			m.scrollToMsgSearchHit()
 			m.viewport.SetContent(m.renderMessages())
 		}
 		return m, nil
+	case "p":
+		jumped := false
+		for i := 0; i < count && m.jumpToPrevDay(); i++ {
+			jumped = true
+		}
+		if jumped || m.allLoaded || m.loading {
+			return m, nil
+		}
+		// Already at the oldest loaded day: fetch the page before it
+		m.viewport.GotoTop()
+		m.loading = true
+		return m, m.fetchMessagesCmd(m.activeChatID, m.oldestCursor, true)
 	case "N":
 		if len(m.msgSearchHits) > 0 {
-			m.msgSearchIdx = (m.msgSearchIdx - 1 + len(m.msgSearchHits)) % len(m.msgSearchHits)
+			n := len(m.msgSearchHits)
+			m.msgSearchIdx = ((m.msgSearchIdx-count)%n + n) % n
 			m.scrollToMsgSearchHit()
 			m.viewport.SetContent(m.renderMessages())
 		}
 		return m, nil
+	case "V":
+		if m.opts.exportPrivacy.anonymize {
+			m.exportStatus = "vCard export is off while anonymizing exports"
+			return m, nil
+		}
+		if !m.exporting {
+			m.exporting = true
+			m.exportStatus = "Exporting..."
+			return m, m.exportVCardCmd()
+		}
+		return m, nil
+	case "P":
+		m.showSidebar = !m.showSidebar
+		m.viewport.Width = m.messageViewportWidth()
+		m.viewport.SetContent(m.renderMessages())
+		return m, nil
+	case "F":
+		m.msgFilterInput.SetValue(m.msgFilterTerm)
+		m.msgFilterInput.CursorEnd()
+		m.msgFilterInput.Focus()
+		return m, textinput.Blink
+	case "f":
+		m.senderFilter = m.senderFilter.next()
+		m.viewport.SetContent(m.renderMessages())
+		return m, nil
+	case "v":
+		if m.selectAnchor >= 0 {
+			m.selectAnchor = -1
+		} else if m.focus >= 0 {
+			m.selectAnchor = m.focus
+		}
+		m.viewport.SetContent(m.renderMessages())
+		return m, nil
+	case "[":
+		m.moveFocus(-count)
+		return m, nil
+	case "]":
+		m.moveFocus(count)
+		return m, nil
+	case "i":
+		if msg, ok := m.focusedMessage(); ok {
+			return m, m.fetchMessageDetailCmd(msg.ROWID)
+		}
+		return m, nil
+	case "R":
+		if msg, ok := m.focusedMessage(); ok && len(msg.Reactions) > 0 {
+			if m.expandReactionsOf == nil {
+				m.expandReactionsOf = map[int]bool{}
+			}
+			m.expandReactionsOf[msg.ROWID] = !m.expandReactionsOf[msg.ROWID]
+			m.viewport.SetContent(m.renderMessages())
+		}
+		return m, nil
 	case "t":
 		m.viewport.GotoTop()
 		return m, nil
@@ -599,30 +1622,562 @@ func (m model) updateMessageView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.viewport.GotoBottom()
 		return m, nil
 	case "e":
+		return m, m.exportAs("csv")
+	case "T":
+		return m, m.exportAs("text")
+	case "E":
 		if !m.exporting {
-			m.exporting = true
-			m.exportStatus = "Exporting..."
-			return m, m.exportCmd()
+			m.pickingFormat = true
+			m.formatPick = m.rememberedFormat()
 		}
 		return m, nil
 	case "a":
-		m.state = viewAttachments
-		m.attachmentList.Title = "Loading attachments..."
-		return m, m.fetchAttachmentsCmd(m.activeChatID)
+		return m, m.openAttachmentBrowser(false)
+	case "C":
+		return m, m.copyChatGUIDCmd()
+	case "y":
+		return m, m.copySummaryCmd()
+	case "o":
+		return m, m.openInMessagesCmd()
+	case "O":
+		return m, m.openLatestAttachmentCmd()
+	case "c":
+		m.compact = !m.compact
+		m.viewport.SetContent(m.renderMessages())
+		if m.focus >= 0 {
+			m.scrollToFocus()
+		}
+		return m, nil
+	case "h":
+		m.expandHeader = !m.expandHeader
+		m.viewport.Height = calcViewportHeight(m.height, m.headerParticipantLines())
+		m.viewport.SetContent(m.renderMessages())
+		return m, nil
+	case "r":
+		if m.threadReturn != nil || m.loading {
+			return m, nil
+		}
+		if msg, ok := m.focusedMessage(); ok {
+			root := msg.ThreadOriginator
+			if root == "" {
+				root = msg.GUID
+			}
+			return m, m.fetchThreadCmd(root)
+		}
+		return m, nil
+	case "S":
+		m.state = viewStats
+		m.stats = nil
+		return m, m.fetchStatsCmd(m.activeChatID)
+	case "ctrl+r":
+		if m.loading || m.threadReturn != nil {
+			return m, nil
+		}
+		m.loading = true
+		if len(m.messages) == 0 {
+			return m, m.fetchMessagesCmd(m.activeChatID, chatdb.MessageCursor{}, false)
+		}
+		return m, m.reloadMessagesCmd()
+	case "L":
+		return m, m.toggleFollow()
+	case "z":
+		m.hideSizes = !m.hideSizes
+		m.viewport.SetContent(m.renderMessages())
+		if m.hideSizes {
+			m.exportStatus = "Hiding attachment sizes"
+		} else {
+			m.exportStatus = "Showing attachment sizes"
+		}
+		return m, nil
+	case "I":
+		m.showHandles = !m.showHandles
+		m.viewport.SetContent(m.renderMessages())
+		if m.showHandles {
+			m.exportStatus = "Showing handles after names"
+		} else {
+			m.exportStatus = "Showing names only"
+		}
+		return m, nil
+	case "H":
+		// By style, not head count: a group everyone else left is still
+		// a group
+		if conv, ok := m.activeConversation(); !ok || conv.Style != chatdb.ChatStyleGroup {
+			m.exportStatus = "Not a group conversation"
+			return m, nil
+		}
+		return m, m.fetchGroupEventsCmd(m.activeChatID)
+	case "A":
+		return m, m.toggleHandleView()
+	case "B":
+		return m, m.toggleFromStart()
 	}
 
-	var cmd tea.Cmd
-	m.viewport, cmd = m.viewport.Update(msg)
+	var cmds []tea.Cmd
+	for i := 0; i < count; i++ {
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		cmds = append(cmds, cmd)
+	}
+	cmd := tea.Batch(cmds...)
 
 	if m.viewport.AtTop() && !m.allLoaded && !m.loading {
 		m.loading = true
 		loadCmd := m.fetchMessagesCmd(m.activeChatID, m.oldestCursor, true)
 		return m, tea.Batch(cmd, loadCmd)
 	}
+	if m.fromStart && m.viewport.AtBottom() && !m.endLoaded && !m.loading {
+		m.loading = true
+		m.viewport.SetContent(m.renderMessages())
+		return m, tea.Batch(cmd, m.fetchForwardCmd(m.activeChatID, m.newestCursor))
+	}
 
 	return m, cmd
 }
 
+// activeChatKey identifies the open chat in persisted state: its GUID,
+// which survives copying the database, or the chat id if it's unknown.
+func (m model) activeChatKey() string {
+	if conv, ok := m.activeConversation(); ok && conv.GUID != "" {
+		return conv.GUID
+	}
+	return strconv.Itoa(m.activeChatID)
+}
+
+// newSinceIndex returns the first loaded message newer than the last
+// visit, if the chat has been visited and has anything new.
+func (m model) newSinceIndex() (int, bool) {
+	if m.newSince == 0 || m.threadReturn != nil {
+		return 0, false
+	}
+	for i, msg := range m.messages {
+		if msg.ROWID > m.newSince {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// scrollToNewSince puts the "new since last visit" separator at the top of
+// the viewport and focuses the first new message.
+func (m *model) scrollToNewSince() {
+	i, ok := m.newSinceIndex()
+	if !ok || m.newMarkerLine < 0 {
+		return
+	}
+	m.focus = i
+	m.viewport.SetContent(m.renderMessages())
+	m.viewport.SetYOffset(m.newMarkerLine)
+}
+
+// rememberLastViewed records the newest loaded message of the open chat as
+// seen and persists it in the background.
+func (m *model) rememberLastViewed() tea.Cmd {
+	messages := m.messages
+	if m.threadReturn != nil {
+		messages = m.threadReturn.messages
+	}
+	newest := 0
+	for _, msg := range messages {
+		if msg.ROWID > newest {
+			newest = msg.ROWID
+		}
+	}
+	key := m.activeChatKey()
+	if newest == 0 || newest <= m.lastViewed[key] {
+		return nil
+	}
+	if m.lastViewed == nil {
+		m.lastViewed = map[string]int{}
+	}
+	m.lastViewed[key] = newest
+	snapshot := make(map[string]int, len(m.lastViewed))
+	for k, v := range m.lastViewed {
+		snapshot[k] = v
+	}
+	return func() tea.Msg {
+		saveState(lastViewedFile, snapshot)
+		return nil
+	}
+}
+
+// closeThread leaves a reply thread, the cross-chat handle view, or
+// reading from the start, and puts the conversation back where it was. A
+// page still loading belonged to the view being left and is dropped when
+// it arrives, so nothing is loading anymore.
+func (m *model) closeThread() {
+	saved := m.threadReturn
+	m.threadReturn = nil
+	m.handleView = ""
+	m.fromStart = false
+	m.messages = saved.messages
+	m.focus = saved.focus
+	m.oldestCursor = saved.oldestCursor
+	m.allLoaded = saved.allLoaded
+	m.loading = false
+	m.selectAnchor = -1
+	m.viewport.SetContent(m.renderMessages())
+	m.viewport.SetYOffset(saved.yOffset)
+}
+
+// reloadMessagesCmd fetches the loaded window again, from its oldest
+// message on, so new messages show up without losing older pages.
+func (m model) reloadMessagesCmd() tea.Cmd {
+	chatID, from := m.activeChatID, m.oldestCursor
+	return func() tea.Msg {
+		msgs, err := m.store.FetchMessagesFrom(m.chatCtx, chatID, from)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return messagesReloadedMsg{chatID: chatID, messages: msgs, err: err}
+	}
+}
+
+// applyReload swaps in a reloaded window without moving the reader: the
+// message at the top of the screen stays there, down to the line, and the
+// focus stays on the same message. At the bottom, the view follows any new
+// messages instead.
+func (m *model) applyReload(messages []chatdb.Message) {
+	atBottom := m.viewport.AtBottom()
+	anchorID, within := 0, 0
+	if idx, ok := m.topVisibleIndex(); ok {
+		anchorID = m.messages[idx].ROWID
+		within = m.viewport.YOffset - m.msgLines[idx]
+	}
+	focusID := 0
+	if msg, ok := m.focusedMessage(); ok {
+		focusID = msg.ROWID
+	}
+	added := len(messages) - len(m.messages)
+
+	m.messages = messages
+	m.blockCache = nil // reactions and edits may have changed
+	m.selectAnchor = -1
+	m.focus = len(m.messages) - 1
+	for i, msg := range m.messages {
+		if msg.ROWID == focusID {
+			m.focus = i
+		}
+	}
+	if m.msgSearchTerm != "" {
+		m.performMsgSearch()
+	}
+	m.viewport.SetContent(m.renderMessages())
+
+	switch {
+	case atBottom:
+		m.viewport.GotoBottom()
+	case anchorID != 0:
+		for i, msg := range m.messages {
+			if msg.ROWID == anchorID {
+				m.viewport.SetYOffset(m.msgLines[i] + within)
+				break
+			}
+		}
+	}
+	if added > 0 {
+		m.exportStatus = fmt.Sprintf("Reloaded, %d new messages", added)
+	} else {
+		m.exportStatus = "Reloaded, no new messages"
+	}
+}
+
+func (m model) fetchGroupEventsCmd(chatID int) tea.Cmd {
+	return func() tea.Msg {
+		events, err := m.store.GroupEvents(m.chatCtx, chatID)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return groupEventsMsg{chatID: chatID, events: events, err: err}
+	}
+}
+
+func (m model) fetchMessageDetailCmd(rowid int) tea.Cmd {
+	return func() tea.Msg {
+		detail, found, err := m.store.FetchMessageDetail(m.chatCtx, rowid)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return messageDetailMsg{detail: detail, found: found, err: err}
+	}
+}
+
+// fetchQuotesCmd looks up the messages that loaded replies quote but that
+// aren't on a loaded page themselves, or nil when there are none.
+func (m model) fetchQuotesCmd() tea.Cmd {
+	loaded := make(map[string]bool, len(m.messages))
+	for _, msg := range m.messages {
+		loaded[msg.GUID] = true
+	}
+	var missing []string
+	for _, msg := range m.messages {
+		g := msg.ThreadOriginator
+		if _, ok := m.quotes[g]; g == "" || loaded[g] || ok {
+			continue
+		}
+		loaded[g] = true // ask once
+		missing = append(missing, g)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	chatID := m.activeChatID
+	return func() tea.Msg {
+		quotes, err := m.store.FetchMessagesByGUID(m.chatCtx, missing)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return quotesLoadedMsg{chatID: chatID, quotes: quotes, err: err}
+	}
+}
+
+// formatQuote renders a one-line preview of a quoted message, e.g.
+// "╭ John: Lunch tomorrow?", fitted to width.
+func formatQuote(q chatdb.Message, contacts *chatdb.ContactBook, width int) string {
+	name := "Me"
+	if !q.IsFromMe {
+		name = contacts.ResolveName(q.Sender)
+		if name == "" {
+			name = "Unknown"
+		}
+	}
+	text := strings.Join(strings.Fields(q.Text), " ")
+	if text == "" {
+		text = q.Placeholder()
+	}
+	return truncate("╭ "+name+": "+text, width)
+}
+
+// nameWithHandle shows a handle with a contact as "John Doe (+15551234567)",
+// so it's clear which of the contact's numbers or emails is meant. A
+// handle without a contact is shown once, as is.
+func nameWithHandle(contacts *chatdb.ContactBook, handle string) string {
+	name := contacts.ResolveName(handle)
+	if name == "" || name == handle {
+		return handle
+	}
+	return fmt.Sprintf("%s (%s)", name, handle)
+}
+
+// fitNameHandle fits "name (handle)" to width for the sender column. The
+// handle is the point of showing it, so the name is shortened first. An
+// empty handle leaves just the name.
+func fitNameHandle(name, handle string, width int) string {
+	if handle == "" {
+		return truncate(name, width)
+	}
+	suffix := " (" + handle + ")"
+	room := width - ansi.StringWidth(suffix)
+	if room < 4 {
+		return truncate(name+suffix, width)
+	}
+	return truncate(name, room) + suffix
+}
+
+// formatMessageDetail lays out everything known about a message as
+// label/value lines for the detail overlay.
+func formatMessageDetail(d chatdb.MessageDetail, contacts *chatdb.ContactBook, units chatdb.ByteUnits) string {
+	stamp := func(t time.Time) string {
+		if t.IsZero() {
+			return "—"
+		}
+		return t.Format("2006-01-02 15:04:05.000 MST")
+	}
+	from := "Me"
+	if !d.IsFromMe {
+		from = d.Sender
+		if from == "" {
+			from = "Unknown"
+		} else {
+			from = nameWithHandle(contacts, d.Sender)
+		}
+	}
+
+	var sb strings.Builder
+	row := func(label, value string) {
+		fmt.Fprintf(&sb, "%-11s %s\n", label, value)
+	}
+	row("ROWID", strconv.Itoa(d.ROWID))
+	row("GUID", d.GUID)
+	row("Chat ID", strconv.Itoa(d.ChatID))
+	row("Service", d.Service)
+	row("From me", strconv.FormatBool(d.IsFromMe))
+	row("Handle", from)
+	if d.SenderCountry != "" {
+		row("Country", strings.ToUpper(d.SenderCountry))
+	}
+	row("Sent", stamp(d.Date))
+	row("Delivered", stamp(d.DateDelivered))
+	row("Read", stamp(d.DateRead))
+	if d.ThreadOriginator != "" {
+		row("Reply to", d.ThreadOriginator)
+	}
+	if d.Edited {
+		row("Edited", "yes")
+	}
+	if d.Failed {
+		row("Status", "not delivered")
+	}
+	if len(d.Reactions) > 0 {
+		row("Reactions", formatReactionNames(groupReactions(d.Reactions, contacts)))
+	}
+	for i, f := range d.Files {
+		label := ""
+		if i == 0 {
+			label = "Attachments"
+		}
+		row(label, fmt.Sprintf("%s  %s", f.MimeType, units.Format(f.Size)))
+		row("", f.FilePath)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func (m model) fetchThreadCmd(originatorGUID string) tea.Cmd {
+	return func() tea.Msg {
+		messages, err := m.store.FetchThread(m.chatCtx, originatorGUID)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return threadLoadedMsg{messages: messages, err: err}
+	}
+}
+
+// focusedMessage returns the message the focus cursor is on, if any.
+func (m model) focusedMessage() (chatdb.Message, bool) {
+	if m.focus < 0 || m.focus >= len(m.messages) {
+		return chatdb.Message{}, false
+	}
+	return m.messages[m.focus], true
+}
+
+// shows reports whether msg passes both the sender filter and the live
+// keyword filter.
+func (m model) shows(msg chatdb.Message) bool {
+	if m.dupHidden[msg.ROWID] || !m.senderFilter.shows(msg) {
+		return false
+	}
+	return m.msgFilterTerm == "" ||
+		strings.Contains(strings.ToLower(msg.Text), strings.ToLower(m.msgFilterTerm))
+}
+
+// setMsgFilter applies term as the live keyword filter and redraws. The
+// view stays pinned to the newest matches, like a freshly opened chat.
+func (m *model) setMsgFilter(term string) {
+	term = strings.TrimSpace(term)
+	if term == m.msgFilterTerm {
+		return
+	}
+	m.msgFilterTerm = term
+	if m.focus >= 0 && m.focus < len(m.messages) && !m.shows(m.messages[m.focus]) {
+		m.focus = -1
+	}
+	m.viewport.SetContent(m.renderMessages())
+	m.viewport.GotoBottom()
+}
+
+// countShown returns how many loaded messages pass the filters.
+func (m model) countShown() int {
+	n := 0
+	for _, msg := range m.messages {
+		if m.shows(msg) {
+			n++
+		}
+	}
+	return n
+}
+
+// clearMsgFilter removes the live keyword filter and returns to the
+// focused message, if any.
+func (m *model) clearMsgFilter() {
+	m.msgFilterInput.Blur()
+	m.msgFilterInput.SetValue("")
+	m.msgFilterTerm = ""
+	m.viewport.SetContent(m.renderMessages())
+	if m.focus >= 0 {
+		m.scrollToFocus()
+	} else {
+		m.viewport.GotoBottom()
+	}
+}
+
+// moveFocus steps the focus cursor delta messages (of those the filters
+// show), stopping at either end, then scrolls just enough to keep it in
+// view.
+func (m *model) moveFocus(delta int) {
+	step, remaining := 1, delta
+	if delta < 0 {
+		step, remaining = -1, -delta
+	}
+	for i := m.focus + step; i >= 0 && i < len(m.messages) && remaining > 0; i += step {
+		if m.shows(m.messages[i]) {
+			m.focus = i
+			remaining--
+		}
+	}
+	m.viewport.SetContent(m.renderMessages())
+	m.scrollToFocus()
+}
+
+// scrollToFocus scrolls the viewport the minimum needed to show the focused
+// message.
+func (m *model) scrollToFocus() {
+	if m.focus < 0 || m.focus >= len(m.msgLines) {
+		return
+	}
+	line := m.msgLines[m.focus]
+	if line < m.viewport.YOffset {
+		m.viewport.SetYOffset(line)
+	} else if bottom := m.viewport.YOffset + m.viewport.Height - 1; line > bottom {
+		m.viewport.SetYOffset(line - m.viewport.Height + 1)
+	}
+}
+
+// selection returns the bounds (indices into m.messages, inclusive) of the
+// range between the selection anchor and the focus.
+func (m model) selection() (lo, hi int, ok bool) {
+	if m.selectAnchor < 0 || m.focus < 0 || m.selectAnchor >= len(m.messages) || m.focus >= len(m.messages) {
+		return 0, 0, false
+	}
+	lo, hi = m.selectAnchor, m.focus
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	return lo, hi, true
+}
+
+// exportSpan is the date range to export: the selection if there is one,
+// otherwise the whole conversation.
+func (m model) exportSpan() dateRange {
+	lo, hi, ok := m.selection()
+	if !ok {
+		return dateRange{}
+	}
+	return dateRange{From: m.messages[lo].Date, To: m.messages[hi].Date}
+}
+
+// jumpToNextDay scrolls so the next date separator below the top of the
+// viewport is the first line shown.
+func (m *model) jumpToNextDay() {
+	for _, line := range m.dayLines {
+		if line > m.viewport.YOffset {
+			m.viewport.SetYOffset(line)
+			return
+		}
+	}
+	m.viewport.GotoBottom()
+}
+
+// jumpToPrevDay scrolls to the nearest date separator above the top of the
+// viewport. It reports false when there is none among the loaded messages.
+func (m *model) jumpToPrevDay() bool {
+	for i := len(m.dayLines) - 1; i >= 0; i-- {
+		if m.dayLines[i] < m.viewport.YOffset {
+			m.viewport.SetYOffset(m.dayLines[i])
+			return true
+		}
+	}
+	return false
+}
+
 func (m *model) performMsgSearch() {
 	m.msgSearchHits = nil
 	m.msgSearchIdx = 0
@@ -639,25 +2194,13 @@ func (m *model) scrollToMsgSearchHit() {
 		return
 	}
 	hitIdx := m.msgSearchHits[m.msgSearchIdx]
+	m.focus = hitIdx
 
-	// Count rendered lines up to this message to scroll there
-	lineCount := 0
-	var lastDate string
-	if m.allLoaded || m.loading {
-		lineCount += 2 // "Beginning of conversation" or "Loading..." + blank line
-	}
-	for i, msg := range m.messages {
-		dateStr := msg.Date.Format("Monday, January 2, 2006")
-		if dateStr != lastDate {
-			lastDate = dateStr
-			lineCount += 3 // blank line + date separator + blank line
-		}
-		if i == hitIdx {
-			break
-		}
-		lineCount++ // message line
+	// Make sure line offsets reflect the current content before scrolling
+	m.viewport.SetContent(m.renderMessages())
+	if hitIdx < len(m.msgLines) {
+		m.viewport.SetYOffset(m.msgLines[hitIdx])
 	}
-	m.viewport.SetYOffset(lineCount)
 }
 
 func (m model) updateSearchView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
@@ -671,11 +2214,23 @@ func (m model) updateSearchView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.searchInput.Blur()
 			m.searching = true
 			m.searchResults.Title = "Searching..."
-			return m, m.searchCmd(query)
+			m.historyIdx = -1
+			m.searchHistory = addSearchHistory(m.searchHistory, query)
+			saveCmd := saveSearchHistoryCmd(m.searchHistory)
+			if label, ok := attachmentTypeQuery(query); ok {
+				return m, tea.Batch(m.attachmentSearchCmd(label), saveCmd)
+			}
+			m.searchLimit = m.searchPageSize()
+			m.searchChat, m.searchChatIn = 0, ""
+			return m, tea.Batch(m.searchCmd(query), saveCmd)
 		case "esc":
 			m.state = viewConversations
 			m.searchInput.Blur()
 			return m, nil
+		case "up", "down":
+			if m.cycleSearchHistory(msg.String() == "up") {
+				return m, nil
+			}
 		}
 		var cmd tea.Cmd
 		m.searchInput, cmd = m.searchInput.Update(msg)
@@ -685,78 +2240,469 @@ func (m model) updateSearchView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	// Results browsing mode
 	switch msg.String() {
 	case "esc":
+		if m.searchChat != 0 {
+			m.searchChat, m.searchChatIn = 0, ""
+			return m, m.applySearchSort()
+		}
 		m.state = viewConversations
 		return m, nil
+	case "f":
+		if m.searchChat != 0 {
+			m.searchChat, m.searchChatIn = 0, ""
+			return m, m.applySearchSort()
+		}
+		if selected, ok := m.searchResults.SelectedItem().(searchItem); ok {
+			m.searchChat = selected.result.ChatID
+			m.searchChatIn = m.contacts.ResolveName(selected.result.ChatName)
+			return m, m.applySearchSort()
+		}
+		return m, nil
+	case "o":
+		if m.searchTerm == "" {
+			return m, nil
+		}
+		m.searchSort = m.searchSort.next()
+		return m, m.applySearchSort()
+	case "d", "c":
+		if msg.String() == "d" {
+			m.searchDates = m.searchDates.next()
+		} else {
+			m.searchScope = nextChatScope(m.searchScope)
+		}
+		if m.searchTerm == "" {
+			return m, nil
+		}
+		m.searching = true
+		m.searchResults.Title = "Searching..."
+		return m, m.searchCmd(m.searchTerm)
+	case "a":
+		m.opts.foldSearch = !m.opts.foldSearch
+		if m.searchTerm == "" {
+			return m, nil
+		}
+		m.searching = true
+		m.searchResults.Title = "Searching..."
+		return m, m.searchCmd(m.searchTerm)
+	case "M":
+		if m.searchTerm == "" || !m.searchCapped || m.searching {
+			return m, nil
+		}
+		m.searchLimit += m.searchPageSize()
+		m.searching = true
+		m.searchResults.Title = "Searching..."
+		return m, m.searchCmd(m.searchTerm)
 	case "s":
 		m.searchInput.Focus()
 		m.searchInput.SetValue("")
+		m.historyIdx = -1
 		return m, textinput.Blink
+	case "e":
+		if m.searchTerm == "" || m.exporting {
+			return m, nil
+		}
+		m.exporting = true
+		m.exportStatus = "Exporting..."
+		return m, m.exportSearchCmd()
+	case "enter":
+		switch selected := m.searchResults.SelectedItem().(type) {
+		case searchItem:
+			// Open the conversation containing this message
+			return m, m.openChat(selected.result.ChatID, m.contacts.ResolveName(selected.result.ChatName))
+		case attachmentGroupItem:
+			// Open the conversation's attachments, filtered to the searched type
+			openCmd := m.openChat(selected.group.ChatID, m.contacts.ResolveName(selected.group.ChatName))
+			attachCmd := m.openAttachmentBrowser(false)
+			m.attachTypeFilter = selected.group.Attachments[0].TypeLabel
+			return m, tea.Batch(openCmd, attachCmd)
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.searchResults, cmd = m.searchResults.Update(msg)
+	return m, cmd
+}
+
+// cycleSearchHistory steps through past queries in the search input, older
+// on up and newer on down. It only acts while the input is empty or still
+// shows a recalled query, so it never clobbers typed text, and reports
+// whether it handled the key.
+func (m *model) cycleSearchHistory(older bool) bool {
+	value := m.searchInput.Value()
+	browsing := m.historyIdx >= 0 && m.historyIdx < len(m.searchHistory) &&
+		value == m.searchHistory[m.historyIdx]
+	if !browsing && value != "" {
+		return false
+	}
+	if !browsing {
+		m.historyIdx = -1
+	}
+
+	if older {
+		if m.historyIdx+1 >= len(m.searchHistory) {
+			return true
+		}
+		m.historyIdx++
+	} else {
+		if m.historyIdx < 0 {
+			return true
+		}
+		m.historyIdx--
+	}
+
+	if m.historyIdx < 0 {
+		m.searchInput.SetValue("")
+	} else {
+		m.searchInput.SetValue(m.searchHistory[m.historyIdx])
+		m.searchInput.CursorEnd()
+	}
+	return true
+}
+
+// saveHiddenChatsCmd persists the hidden list in the background, sorted so
+// the file stays stable between saves.
+func saveHiddenChatsCmd(hidden map[string]bool) tea.Cmd {
+	ids := make([]string, 0, len(hidden))
+	for id := range hidden {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return func() tea.Msg {
+		saveState(hiddenChatsFile, ids)
+		return nil
+	}
+}
+
+// saveSearchHistoryCmd persists history in the background. Failing to save
+// only loses the convenience, so errors are dropped.
+func saveSearchHistoryCmd(history []string) tea.Cmd {
+	return func() tea.Msg {
+		saveState(searchHistoryFile, history)
+		return nil
+	}
+}
+
+// applySearchSort re-sorts the loaded search results into the results list
+// and refreshes its title.
+func (m *model) applySearchSort() tea.Cmd {
+	results := m.searchData
+	if m.searchChat != 0 {
+		results = nil
+		for _, r := range m.searchData {
+			if r.ChatID == m.searchChat {
+				results = append(results, r)
+			}
+		}
+	}
+	sorted := sortSearchResults(results, m.searchSort, m.searchTerm)
+	items := make([]list.Item, len(sorted))
+	for i, r := range sorted {
+		items[i] = searchItem{result: r, dates: m.opts.dates}
+	}
+	cmd := m.searchResults.SetItems(items)
+	mode := m.searchSort.String()
+	if m.searchDates != anyDate {
+		mode += ", " + m.searchDates.String()
+	}
+	if m.searchScope != chatdb.ScopeAll {
+		mode += ", " + m.searchScope.String()
+	}
+	if m.opts.foldSearch {
+		mode += ", accent-insensitive"
+	}
+	m.searchResults.Title = fmt.Sprintf("Search Results — %d matches for %q (%s)",
+		len(sorted), m.searchTerm, mode)
+	if m.searchChat != 0 {
+		m.searchResults.Title = fmt.Sprintf("Search Results — %d of %d matches for %q in %s (%s, f: all chats)",
+			len(sorted), len(m.searchData), m.searchTerm, m.searchChatIn, mode)
+	}
+	if m.searchCapped {
+		m.searchResults.Title += fmt.Sprintf(" (showing first %d — more exist, M: load more)", len(m.searchData))
+	}
+	return cmd
+}
+
+func (m model) updateAttachmentView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "backspace":
+		if m.attachmentList.FilterState() == list.Filtering {
+			m.attachmentList.ResetFilter()
+			m.updateAttachmentTitle()
+			return m, m.previewSelectedCmd()
+		}
+		if msg.String() == "esc" && m.attachmentList.FilterState() == list.FilterApplied {
+			// Drop the typed filter but keep the type filter under it
+			m.attachmentList.ResetFilter()
+			m.updateAttachmentTitle()
+			return m, m.previewSelectedCmd()
+		}
+		if m.attachGlobal {
+			m.state = viewConversations
+			return m, nil
+		}
+		m.state = viewMessages
+		return m, nil
+	case "t":
+		if m.attachmentList.FilterState() != list.Filtering {
+			m.attachTypeFilter = nextAttachmentType(m.attachmentData, m.attachTypeFilter)
+			return m, m.applyAttachmentView()
+		}
+	case "o":
+		if m.attachmentList.FilterState() != list.Filtering {
+			m.attachSortBySize = !m.attachSortBySize
+			return m, m.applyAttachmentView()
+		}
+	case "z":
+		if m.attachmentList.FilterState() != list.Filtering {
+			m.hideSizes = !m.hideSizes
+			return m, m.applyAttachmentView()
+		}
 	case "enter":
-		selected, ok := m.searchResults.SelectedItem().(searchItem)
+		if m.attachmentList.FilterState() == list.Filtering {
+			var cmd tea.Cmd
+			m.attachmentList, cmd = m.attachmentList.Update(msg)
+			m.updateAttachmentTitle()
+			return m, tea.Batch(cmd, m.previewSelectedCmd())
+		}
+		selected, ok := m.attachmentList.SelectedItem().(attachmentItem)
+		if !ok {
+			return m, nil
+		}
+		switch selected.attachment.State {
+		case chatdb.AttachmentOffloaded:
+			return m, m.attachmentList.NewStatusMessage("Stored in iCloud — open the conversation in Messages to download it")
+		case chatdb.AttachmentMissing:
+			return m, m.attachmentList.NewStatusMessage("File is no longer on disk")
+		}
+		return m, m.openAttachmentCmd(selected.attachment.FilePath)
+	case "y":
+		if m.attachmentList.FilterState() != list.Filtering {
+			return m, m.copyAttachmentPathsCmd()
+		}
+	case "e":
+		if m.attachmentList.FilterState() != list.Filtering && !m.exporting {
+			if m.opts.exportPrivacy.enabled() {
+				// The list names senders, chats, and file paths as stored
+				return m, m.attachmentList.NewStatusMessage("Attachment list export is off while anonymizing or redacting exports")
+			}
+			m.exporting = true
+			return m, tea.Batch(
+				m.attachmentList.NewStatusMessage("Exporting attachment list..."),
+				m.exportAttachmentListCmd())
+		}
+	case "J":
+		if m.attachmentList.FilterState() == list.Filtering {
+			break
+		}
+		selected, ok := m.attachmentList.SelectedItem().(attachmentItem)
 		if !ok {
 			return m, nil
 		}
-		// Open the conversation containing this message
-		m.state = viewMessages
-		m.activeChatID = selected.result.ChatID
-		m.activeChatTitle = m.contacts.ResolveName(selected.result.ChatName)
-		m.activeParticipants = nil
-		m.activeMsgCount = 0
-		// Find participants from loaded conversations
-		for _, conv := range m.convItems {
-			if conv.ChatID == selected.result.ChatID {
-				m.activeParticipants = conv.Participants
-				m.activeMsgCount = conv.MessageCount
-				// Re-resolve the title using the convItem logic
-				ci := convItem{conv: conv, contacts: m.contacts}
-				m.activeChatTitle = ci.Title()
-				break
-			}
+		if !isHEIC(selected.attachment) {
+			return m, m.attachmentList.NewStatusMessage("Not a HEIC photo; press enter to open it")
+		}
+		if selected.attachment.State != chatdb.AttachmentAvailable {
+			return m, m.attachmentList.NewStatusMessage("File isn't on disk to convert")
+		}
+		return m, tea.Batch(
+			m.attachmentList.NewStatusMessage("Converting to JPEG..."),
+			m.openAsJPEGCmd(selected.attachment.FilePath))
+	}
+
+	var cmd tea.Cmd
+	m.attachmentList, cmd = m.attachmentList.Update(msg)
+	m.updateAttachmentTitle()
+	return m, tea.Batch(cmd, m.previewSelectedCmd())
+}
+
+func (m model) fetchAttachmentsCmd(chatID int) tea.Cmd {
+	return func() tea.Msg {
+		attachments, err := m.store.FetchChatAttachments(m.chatCtx, chatID)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return attachmentsLoadedMsg{attachments: attachments, err: err}
+	}
+}
+
+func (m model) fetchAllAttachmentsCmd() tea.Cmd {
+	return func() tea.Msg {
+		attachments, err := m.store.FetchAllAttachments(m.ctx, chatdb.GlobalAttachmentLimit)
+		return attachmentsLoadedMsg{attachments: attachments, err: err}
+	}
+}
+
+// openAttachmentBrowser switches to the attachment view, either for the
+// active chat or across all chats.
+func (m *model) openAttachmentBrowser(global bool) tea.Cmd {
+	m.state = viewAttachments
+	m.attachGlobal = global
+	m.attachmentData = nil
+	m.attachTypeFilter = ""
+	m.attachSortBySize = false
+	m.attachmentList.ResetFilter()
+	m.attachmentList.SetItems(nil)
+	m.attachmentList.Title = "Loading attachments..."
+	m.attachLoading = true
+	m.preview = attachmentPreview{}
+	if global {
+		return m.fetchAllAttachmentsCmd()
+	}
+	return m.fetchAttachmentsCmd(m.activeChatID)
+}
+
+// applyAttachmentView rebuilds the attachment list from the loaded data,
+// applying the type filter and sort order.
+func (m *model) applyAttachmentView() tea.Cmd {
+	var shown []chatdb.ChatAttachment
+	for _, a := range m.attachmentData {
+		if m.attachTypeFilter == "" || a.TypeLabel == m.attachTypeFilter {
+			shown = append(shown, a)
+		}
+	}
+	if m.attachSortBySize {
+		sort.SliceStable(shown, func(i, j int) bool {
+			return shown[i].Size > shown[j].Size
+		})
+	}
+
+	items := make([]list.Item, len(shown))
+	for i, a := range shown {
+		items[i] = attachmentItem{attachment: a, contacts: m.contacts, showChat: m.attachGlobal, hideSize: m.hideSizes, units: m.opts.units, dates: m.opts.dates}
+	}
+	cmd := m.attachmentList.SetItems(items)
+	m.updateAttachmentTitle()
+	return tea.Batch(cmd, m.previewSelectedCmd())
+}
+
+// previewSelectedCmd reads a text preview of the selected attachment when
+// the selection has moved to a contact card or text file on disk, and
+// clears the preview when it has moved to anything else.
+func (m *model) previewSelectedCmd() tea.Cmd {
+	selected, ok := m.attachmentList.SelectedItem().(attachmentItem)
+	if !ok || !isTextPreviewable(selected.attachment) || selected.attachment.State != chatdb.AttachmentAvailable {
+		m.preview = attachmentPreview{}
+		return nil
+	}
+	path := selected.attachment.FilePath
+	if path == m.preview.path {
+		return nil
+	}
+	m.preview = attachmentPreview{path: path}
+	return func() tea.Msg {
+		text, err := readTextPreview(path)
+		return previewLoadedMsg{path: path, text: text, err: err}
+	}
+}
+
+// updateAttachmentTitle shows the file count and every active narrowing in
+// the attachment list title: the type filter, the typed text filter layered
+// on top of it, and the sort order.
+func (m *model) updateAttachmentTitle() {
+	if m.attachLoading {
+		return
+	}
+	title := "Attachments"
+	if m.attachGlobal {
+		title = "All Attachments"
+	}
+	total := len(m.attachmentList.Items())
+	var modes []string
+	if m.attachTypeFilter != "" {
+		modes = append(modes, m.attachTypeFilter)
+	}
+	if m.attachmentList.FilterState() == list.FilterApplied {
+		title = fmt.Sprintf("%s — %d of %d files", title, len(m.attachmentList.VisibleItems()), total)
+		modes = append(modes, fmt.Sprintf("%q", m.attachmentList.FilterValue()))
+	} else {
+		title = fmt.Sprintf("%s — %d files", title, total)
+	}
+	if m.attachSortBySize {
+		modes = append(modes, "largest first")
+	}
+	if len(modes) > 0 {
+		title += " (" + strings.Join(modes, ", ") + ")"
+	}
+	m.attachmentList.Title = title
+}
+
+// nextAttachmentType cycles the type filter through the labels present in
+// attachments, in first-seen order, then back to "" (all types).
+func nextAttachmentType(attachments []chatdb.ChatAttachment, current string) string {
+	var labels []string
+	seen := map[string]bool{}
+	for _, a := range attachments {
+		if !seen[a.TypeLabel] {
+			seen[a.TypeLabel] = true
+			labels = append(labels, a.TypeLabel)
+		}
+	}
+	if current == "" {
+		if len(labels) > 0 {
+			return labels[0]
+		}
+		return ""
+	}
+	for i, l := range labels {
+		if l == current && i+1 < len(labels) {
+			return labels[i+1]
 		}
-		m.messages = nil
-		m.oldestCursor = 0
-		m.allLoaded = false
-		m.loading = true
-		m.viewport.Height = calcViewportHeight(m.height, len(m.activeParticipants))
-		return m, m.fetchMessagesCmd(selected.result.ChatID, 0, false)
 	}
-
-	var cmd tea.Cmd
-	m.searchResults, cmd = m.searchResults.Update(msg)
-	return m, cmd
+	return ""
 }
 
-func (m model) updateAttachmentView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "esc", "backspace":
-		if m.attachmentList.FilterState() == list.Filtering {
-			m.attachmentList.ResetFilter()
-			return m, nil
-		}
-		m.state = viewMessages
-		return m, nil
-	case "enter":
-		if m.attachmentList.FilterState() == list.Filtering {
-			var cmd tea.Cmd
-			m.attachmentList, cmd = m.attachmentList.Update(msg)
-			return m, cmd
+// visibleAttachmentPaths returns the file paths of the attachments the list
+// shows, in display order, so the type filter, typed filter and sort all
+// apply. Attachments without a path are left out.
+func (m model) visibleAttachmentPaths() []string {
+	var paths []string
+	for _, item := range m.attachmentList.VisibleItems() {
+		if a, ok := item.(attachmentItem); ok && a.attachment.FilePath != "" {
+			paths = append(paths, a.attachment.FilePath)
 		}
-		selected, ok := m.attachmentList.SelectedItem().(attachmentItem)
-		if !ok {
-			return m, nil
+	}
+	return paths
+}
+
+// visibleAttachments returns the attachments the list shows, in its order,
+// with the type filter, text filter, and sort applied.
+func (m model) visibleAttachments() []chatdb.ChatAttachment {
+	var attachments []chatdb.ChatAttachment
+	for _, item := range m.attachmentList.VisibleItems() {
+		if a, ok := item.(attachmentItem); ok {
+			attachments = append(attachments, a.attachment)
 		}
-		return m, m.openAttachmentCmd(selected.attachment.FilePath)
 	}
+	return attachments
+}
 
-	var cmd tea.Cmd
-	m.attachmentList, cmd = m.attachmentList.Update(msg)
-	return m, cmd
+// exportAttachmentListCmd writes the metadata of the listed attachments
+// to a CSV file.
+func (m model) exportAttachmentListCmd() tea.Cmd {
+	attachments := m.visibleAttachments()
+	name := m.activeChatTitle
+	if m.attachGlobal {
+		name = "all"
+	}
+	return func() tea.Msg {
+		path, err := exportAttachmentList(attachments, m.contacts, name)
+		return exportDoneMsg{path: path, err: err}
+	}
 }
 
-func (m model) fetchAttachmentsCmd(chatID int) tea.Cmd {
+// copyAttachmentPathsCmd puts the visible attachments' paths on the
+// clipboard, one per line, for piping into other tools.
+func (m model) copyAttachmentPathsCmd() tea.Cmd {
+	paths := m.visibleAttachmentPaths()
+	if len(paths) == 0 {
+		return m.attachmentList.NewStatusMessage("No attachment paths to copy")
+	}
+	what := fmt.Sprintf("%d paths", len(paths))
+	if len(paths) == 1 {
+		what = "1 path"
+	}
 	return func() tea.Msg {
-		attachments, err := m.store.FetchChatAttachments(chatID)
-		return attachmentsLoadedMsg{attachments: attachments, err: err}
+		return clipboardMsg{what: what, err: clipboard.WriteAll(strings.Join(paths, "\n") + "\n")}
 	}
 }
 
@@ -768,37 +2714,321 @@ func (m model) openAttachmentCmd(path string) tea.Cmd {
 	}
 }
 
-func (m model) fetchMessagesCmd(chatID int, cursor int, prepend bool) tea.Cmd {
+// openLatestAttachmentCmd opens the newest attachment in the active chat,
+// for seeing what was just sent without going through the attachment list.
+func (m model) openLatestAttachmentCmd() tea.Cmd {
+	chatID := m.activeChatID
+	return func() tea.Msg {
+		attachments, err := m.store.FetchChatAttachments(m.chatCtx, chatID)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		if err != nil {
+			return attachmentOpenedMsg{err: err}
+		}
+		if len(attachments) == 0 {
+			return attachmentOpenedMsg{status: "No attachments in this conversation"}
+		}
+		latest := attachments[0]
+		name := latest.Filename
+		if name == "" {
+			name = filepath.Base(latest.FilePath)
+		}
+		switch latest.State {
+		case chatdb.AttachmentOffloaded:
+			return attachmentOpenedMsg{status: name + " is stored in iCloud — open the conversation in Messages to download it"}
+		case chatdb.AttachmentMissing:
+			return attachmentOpenedMsg{status: name + " is no longer on disk"}
+		}
+		if err := exec.Command("open", latest.FilePath).Start(); err != nil {
+			return attachmentOpenedMsg{err: err}
+		}
+		return attachmentOpenedMsg{status: "Opened " + name}
+	}
+}
+
+// openAsJPEGCmd converts a HEIC photo to a temporary JPEG and opens that,
+// for viewers that can't read HEIC.
+func (m model) openAsJPEGCmd(path string) tea.Cmd {
+	return func() tea.Msg {
+		jpeg, err := convertToJPEG(path)
+		if err != nil {
+			return attachmentOpenedMsg{err: err}
+		}
+		return attachmentOpenedMsg{err: exec.Command("open", jpeg).Start()}
+	}
+}
+
+// openInMessagesCmd opens the active chat's first participant in the
+// Messages app. Unlike attachments it waits for open to finish, so a URL
+// scheme nothing handles is reported in the footer.
+func (m model) openInMessagesCmd() tea.Cmd {
+	if len(m.activeParticipants) == 0 {
+		return nil
+	}
+	service := ""
+	if conv, ok := m.activeConversation(); ok {
+		service = conv.ServiceName
+	}
+	url := messagesAppURL(service, m.activeParticipants[0])
+	return func() tea.Msg {
+		out, err := exec.Command("open", url).CombinedOutput()
+		if err != nil && len(out) > 0 {
+			err = fmt.Errorf("%s", strings.TrimSpace(string(out)))
+		}
+		return attachmentOpenedMsg{err: err}
+	}
+}
+
+// messagesAppURL builds the URL that opens a handle in Messages: sms: for
+// SMS chats, imessage: otherwise.
+func messagesAppURL(service, handle string) string {
+	if strings.EqualFold(service, "SMS") {
+		return "sms:" + handle
+	}
+	return "imessage:" + handle
+}
+
+func (m model) fetchMessagesCmd(chatID int, cursor chatdb.MessageCursor, prepend bool) tea.Cmd {
+	handle := m.handleView
 	return func() tea.Msg {
-		msgs, err := m.store.FetchMessages(chatID, cursor, messagesPageSize)
+		var msgs []chatdb.Message
+		var err error
+		if handle != "" {
+			msgs, err = m.store.FetchMessagesByHandle(m.chatCtx, handle, cursor, chatdb.MessagesPageSize)
+		} else {
+			msgs, err = m.store.FetchMessages(m.chatCtx, chatID, cursor, chatdb.MessagesPageSize)
+		}
+		if errors.Is(err, context.Canceled) {
+			// The chat was closed before the page arrived
+			return nil
+		}
 		return messagesLoadedMsg{
 			messages: msgs,
 			chatID:   chatID,
+			handle:   handle,
 			prepend:  prepend,
 			err:      err,
 		}
 	}
 }
 
-func (m model) exportCmd() tea.Cmd {
-	chatID := m.activeChatID
+func (m model) exportCmd(export exportFunc) tea.Cmd {
+	return m.exportChatCmd(export, m.activeChatID, m.activeParticipants, m.activeChatTitle, m.exportSpan())
+}
+
+// exportChatCmd runs export for any chat in the background, so the
+// conversation list can export without opening the chat first.
+func (m model) exportChatCmd(export exportFunc, chatID int, participants []string, title string, span dateRange) tea.Cmd {
+	return func() tea.Msg {
+		path, err := export(m.ctx, m.store, m.contacts, chatID, participants, title, span)
+		return exportDoneMsg{path: path, err: err}
+	}
+}
+
+func (m model) attachmentSearchCmd(label string) tea.Cmd {
+	return func() tea.Msg {
+		groups, err := m.store.SearchAttachments(m.ctx, label, chatdb.GlobalAttachmentLimit)
+		return attachmentSearchMsg{groups: groups, label: label, err: err}
+	}
+}
+
+// exportSearchCmd writes the search results in their current sort order.
+func (m model) exportSearchCmd() tea.Cmd {
+	var results []chatdb.SearchResult
+	for _, item := range m.searchResults.Items() {
+		if si, ok := item.(searchItem); ok {
+			results = append(results, si.result)
+		}
+	}
+	term := m.searchTerm
+	return func() tea.Msg {
+		path, err := exportSearchResults(results, m.contacts, term, m.opts.exportPrivacy)
+		return exportDoneMsg{path: path, err: err}
+	}
+}
+
+func (m model) exportVCardCmd() tea.Cmd {
 	participants := m.activeParticipants
 	title := m.activeChatTitle
 	return func() tea.Msg {
-		path, err := exportCSV(m.store, m.contacts, chatID, participants, title)
+		path, err := exportVCard(m.contacts, participants, title)
 		return exportDoneMsg{path: path, err: err}
 	}
 }
 
 func (m model) searchCmd(term string) tea.Cmd {
+	fold := m.opts.foldSearch
+	from, to := m.searchDates.bounds(time.Now())
+	scope := m.searchScope
+	limit := m.searchLimit
+	if limit <= 0 {
+		limit = m.searchPageSize()
+	}
 	return func() tea.Msg {
-		results, err := m.store.SearchMessages(term, 100)
-		return searchResultsMsg{results: results, term: term, err: err}
+		results, err := m.store.SearchMessagesScoped(m.ctx, term, scope, from, to, limit, fold)
+		return searchResultsMsg{results: results, term: term, limit: limit, err: err}
+	}
+}
+
+// searchPageSize is how many matches a search fetches at first, and how
+// many more each M adds.
+func (m model) searchPageSize() int {
+	if m.opts.searchLimit > 0 {
+		return m.opts.searchLimit
+	}
+	return defaultSearchLimit
+}
+
+// previewLength is the most characters of a conversation's last message
+// shown in the list; the delegate also cuts it to the terminal width.
+const previewLength = 120
+
+// maxCountPrefix caps a typed count prefix so a held-down digit can't
+// queue up an absurd number of repeats.
+const maxCountPrefix = 1000
+
+const (
+	// headerParticipantLimit is how many participants the message header
+	// lists before collapsing the rest into "+N more".
+	headerParticipantLimit = 5
+	// minViewportHeight is the fewest message lines the header may leave.
+	minViewportHeight = 5
+)
+
+// headerParticipants returns how many participants the header lists and how
+// many are left over. Even when expanded, the list stops where it would
+// squeeze the messages below minViewportHeight.
+func (m model) headerParticipants() (shown, more int) {
+	shown, more, _ = m.headerLayout()
+	return shown, more
+}
+
+// headerParticipantLines is the number of header lines used for
+// participants, including the "+N more" line.
+func (m model) headerParticipantLines() int {
+	_, more, lines := m.headerLayout()
+	if more > 0 {
+		return lines + 1
+	}
+	return lines
+}
+
+// headerLayout works out how many participants fit in the header and how
+// many lines they take. Expanded entries can wrap onto several lines.
+func (m model) headerLayout() (shown, more, lines int) {
+	total := len(m.activeParticipants)
+	limit := total
+	if !m.expandHeader && limit > headerParticipantLimit {
+		limit = headerParticipantLimit
+	}
+	room := -1
+	if m.height > 0 {
+		// Everything but the participant lines, plus one for "+N more"
+		room = max(calcViewportHeight(m.height, 0)-minViewportHeight-1, 0)
+	}
+	conv, _ := m.activeConversation()
+	width := m.headerLineWidth()
+	for shown < limit {
+		n := len(m.participantLines(m.activeParticipants[shown], conv, width))
+		if room >= 0 && lines+n > room {
+			break
+		}
+		lines += n
+		shown++
+	}
+	return shown, total - shown, lines
+}
+
+// headerLineWidth is the width available to a header line.
+func (m model) headerLineWidth() int {
+	return max(m.messagePaneWidth()-2, senderWidth)
+}
+
+// participantLines renders one participant's header entry: the contact's
+// name with their phones and emails, or the bare handle. Collapsed, it's one
+// line showing as many whole identifiers as fit, then "… +N more"; expanded
+// (h), the identifiers wrap onto indented lines below.
+func (m model) participantLines(handle string, conv chatdb.Conversation, width int) []string {
+	var c *chatdb.Contact
+	if m.contacts != nil {
+		c = m.contacts.Resolve(handle)
+	}
+	if c == nil {
+		line := " " + handle
+		if country := conv.Countries[handle]; country != "" {
+			// Where an unknown number is from helps spot spam
+			line += "  " + helpStyle.Render(strings.ToUpper(country))
+		}
+		return []string{truncate(line, width)}
+	}
+	details := append(append([]string{}, c.Phones...), c.Emails...)
+	if len(details) == 0 {
+		return []string{truncate(" "+c.Name, width)}
+	}
+	prefix := fmt.Sprintf(" %s: ", c.Name)
+	if m.expandHeader {
+		return wrapDetails(prefix, details, width)
+	}
+	return []string{fitDetails(prefix, details, width)}
+}
+
+// fitDetails joins details after prefix, keeping to width by dropping
+// whole identifiers from the end and noting how many were left out.
+func fitDetails(prefix string, details []string, width int) string {
+	line := prefix + strings.Join(details, ", ")
+	if ansi.StringWidth(line) <= width {
+		return line
+	}
+	for n := len(details) - 1; n > 0; n-- {
+		line = fmt.Sprintf("%s%s, … +%d more", prefix, strings.Join(details[:n], ", "), len(details)-n)
+		if ansi.StringWidth(line) <= width {
+			return line
+		}
 	}
+	// Not even one identifier fits whole
+	return truncate(prefix+strings.Join(details, ", "), width)
 }
 
-func calcViewportHeight(totalHeight int, participantCount int) int {
-	headerLines := 2 + participantCount // title + count + participants + border
+// wrapDetails lays details out after prefix across as many lines as needed,
+// continuation lines indented. An identifier wider than a line is truncated.
+func wrapDetails(prefix string, details []string, width int) []string {
+	const indent = "   "
+	var lines []string
+	line := prefix
+	fresh := true // nothing after the prefix or indent yet
+	for i, d := range details {
+		if i < len(details)-1 {
+			d += ","
+		}
+		if !fresh && ansi.StringWidth(line)+1+ansi.StringWidth(d) > width {
+			lines = append(lines, line)
+			line, fresh = indent, true
+		}
+		if !fresh {
+			line += " "
+		}
+		line += d
+		fresh = false
+	}
+	lines = append(lines, line)
+	for i := range lines {
+		lines[i] = truncate(lines[i], width)
+	}
+	return lines
+}
+
+// tooSmall reports whether the terminal is below the minimum size. Until
+// the first WindowSizeMsg the size is unknown, which doesn't count.
+func (m model) tooSmall() bool {
+	if m.width == 0 || m.height == 0 {
+		return false
+	}
+	return m.width < minWidth || m.height < minHeight
+}
+
+func calcViewportHeight(totalHeight int, participantLines int) int {
+	headerLines := 3 + participantLines // title + count + date + participants + border
 	footerH := 1
 	h := totalHeight - headerLines - footerH - 4
 	if h < 1 {
@@ -807,132 +3037,513 @@ func calcViewportHeight(totalHeight int, participantCount int) int {
 	return h
 }
 
+// messageViewportWidth is the width left for messages in the message
+// pane, minus the participant sidebar when it's shown.
+func (m model) messageViewportWidth() int {
+	w := m.messagePaneWidth() - scrollbarWidth
+	if m.showSidebar {
+		w -= sidebarWidth
+	}
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
+
+// renderScrollbar draws a one-column scrollbar height lines tall for
+// content of total lines scrolled down by offset. The thumb's length is the
+// visible share of the content and it's at least one line; when everything
+// fits there's only the track.
+func renderScrollbar(height, total, offset int) string {
+	if height < 1 {
+		return ""
+	}
+	thumbLen, thumbTop := 0, 0
+	if total > height {
+		thumbLen = max(height*height/total, 1)
+		maxOffset := total - height
+		offset = min(max(offset, 0), maxOffset)
+		thumbTop = int(math.Round(float64(offset) / float64(maxOffset) * float64(height-thumbLen)))
+	}
+	lines := make([]string, height)
+	for i := range lines {
+		if i >= thumbTop && i < thumbTop+thumbLen {
+			lines[i] = scrollThumbStyle.Render("┃")
+		} else {
+			lines[i] = scrollTrackStyle.Render("│")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// senderStyle is the name style for a received message's sender: their own
+// color in a group chat, fromThemStyle otherwise.
+func (m model) senderStyle(handle string) lipgloss.Style {
+	if style, ok := m.senderColors[strings.ToLower(handle)]; ok {
+		return style
+	}
+	return fromThemStyle
+}
+
+// renderParticipantSidebar lists the active chat's participants with their
+// resolved names and raw handles.
+func (m model) renderParticipantSidebar() string {
+	inner := sidebarWidth - 2 // border + padding
+	lines := []string{sidebarTitleStyle.Render(fmt.Sprintf("Participants (%d)", len(m.activeParticipants))), ""}
+	for _, handle := range m.activeParticipants {
+		name := handle
+		if c := m.contacts.Resolve(handle); c != nil {
+			name = c.Name
+		}
+		lines = append(lines,
+			m.senderStyle(handle).Render(truncate(name, inner)),
+			helpStyle.Render(truncate(handle, inner)),
+			"")
+	}
+	return sidebarStyle.Height(m.viewport.Height).Render(strings.Join(lines, "\n"))
+}
+
 func (m model) buildMessageHeader() string {
 	var lines []string
 	lines = append(lines, fmt.Sprintf(" %s", m.activeChatTitle))
 
-	// Show contact details for each participant
-	for _, handle := range m.activeParticipants {
-		c := m.contacts.Resolve(handle)
-		if c != nil {
-			var details []string
-			for _, p := range c.Phones {
-				details = append(details, p)
-			}
-			for _, e := range c.Emails {
-				details = append(details, e)
-			}
-			if len(details) > 0 {
-				lines = append(lines, fmt.Sprintf(" %s: %s", c.Name, strings.Join(details, ", ")))
-			}
-		} else {
-			lines = append(lines, fmt.Sprintf(" %s", handle))
+	// Show contact details for each participant. Collapsed, each gets one
+	// line so long details never push the messages down
+	shown, more := m.headerParticipants()
+	conv, _ := m.activeConversation()
+	width := m.headerLineWidth()
+	for _, handle := range m.activeParticipants[:shown] {
+		lines = append(lines, m.participantLines(handle, conv, width)...)
+	}
+	if more > 0 {
+		hint := "h: show all"
+		if m.expandHeader {
+			hint = "P: sidebar lists everyone"
 		}
+		lines = append(lines, fmt.Sprintf(" +%d more  (%s)", more, hint))
 	}
 
 	countInfo := fmt.Sprintf(" %d loaded / %d total", len(m.messages), m.activeMsgCount)
+	if m.handleView != "" {
+		countInfo = fmt.Sprintf(" %d loaded with %s across all chats", len(m.messages), nameWithHandle(m.contacts, m.handleView))
+	}
+	if m.following {
+		countInfo += "  ● following"
+	}
 	lines = append(lines, countInfo)
 
+	// Sticky date of the topmost visible message
+	lines = append(lines, fmt.Sprintf(" ▸ %s", m.topVisibleDate()))
+
 	return strings.Join(lines, "\n")
 }
 
-func (m model) renderMessages() string {
+// renderMessages builds the viewport content for the loaded messages and
+// records the content line each message starts on in m.msgLines, so
+// scroll positions can be mapped back to messages.
+func (m *model) renderMessages() string {
 	var sb strings.Builder
 	var lastDate string
+	line := 0
+	write := func(s string) {
+		sb.WriteString(s)
+		line += strings.Count(s, "\n")
+	}
 
-	if m.allLoaded {
-		sb.WriteString(dateSepStyle.Width(m.viewport.Width).Render("— Beginning of conversation —"))
-		sb.WriteString("\n\n")
+	if m.handleView != "" {
+		who := m.contacts.ResolveName(m.handleView)
+		if m.loading {
+			write(dateSepStyle.Width(m.viewport.Width).Render("Loading older messages..."))
+			write("\n\n")
+		} else if m.allLoaded {
+			write(dateSepStyle.Width(m.viewport.Width).Render("— Beginning of messages with " + who + ", all chats —"))
+			write("\n\n")
+		}
+	} else if m.fromStart {
+		write(dateSepStyle.Width(m.viewport.Width).Render("— Beginning of conversation —"))
+		write("\n\n")
+	} else if m.threadReturn != nil {
+		write(dateSepStyle.Width(m.viewport.Width).Render(fmt.Sprintf("— Thread: %d replies —", len(m.messages)-1)))
+		write("\n\n")
+	} else if m.allLoaded {
+		write(dateSepStyle.Width(m.viewport.Width).Render("— Beginning of conversation —"))
+		write("\n\n")
 	} else if m.loading {
-		sb.WriteString(dateSepStyle.Width(m.viewport.Width).Render("Loading older messages..."))
-		sb.WriteString("\n\n")
+		write(dateSepStyle.Width(m.viewport.Width).Render("Loading older messages..."))
+		write("\n\n")
 	}
 
-	for _, msg := range m.messages {
+	selLo, selHi, selecting := m.selection()
+	var lastSender, runDate string // compact layout: the current run's sender and day
+	loaded := make(map[string]int, len(m.messages))
+	for i, msg := range m.messages {
+		loaded[msg.GUID] = i
+	}
+	if m.blockCache == nil {
+		m.blockCache = map[int]msgBlock{}
+	}
+	if m.opts.collapseDupes {
+		m.dupCounts, m.dupHidden = duplicateRuns(m.messages)
+	}
+	newIdx, hasNew := m.newSinceIndex()
+	m.newMarkerLine = -1
+	m.msgLines = make([]int, len(m.messages))
+	m.dayLines = nil
+	for i, msg := range m.messages {
+		if !m.shows(msg) {
+			// Hidden messages map to where the next visible one starts
+			m.msgLines[i] = line
+			continue
+		}
 		dateStr := msg.Date.Format("Monday, January 2, 2006")
 		if dateStr != lastDate {
 			lastDate = dateStr
-			sb.WriteString("\n")
-			sb.WriteString(dateSepStyle.Width(m.viewport.Width).Render(fmt.Sprintf("— %s —", dateStr)))
-			sb.WriteString("\n\n")
+			write("\n")
+			m.dayLines = append(m.dayLines, line)
+			write(dateSepStyle.Width(m.viewport.Width).Render(fmt.Sprintf("— %s —", dateStr)))
+			write("\n\n")
+		}
+		if hasNew && i == newIdx {
+			lastSender = "" // restart the sender run below the marker
+			m.newMarkerLine = line
+			write(newSinceStyle.Width(m.viewport.Width).Render("— New since last visit —"))
+			write("\n")
+		}
+		m.msgLines[i] = line
+
+		key := msgBlockKey{
+			width:     m.viewport.Width,
+			compact:   m.compact,
+			highlight: m.msgSearchTerm,
+			expanded:  m.expandReactionsOf[msg.ROWID],
+			inThread:  m.threadReturn != nil,
+			handles:   m.showHandles,
+			hideSizes: m.hideSizes,
+			repeats:   m.dupCounts[msg.ROWID],
+		}
+		if key.highlight == "" {
+			key.highlight = m.msgFilterTerm
+		}
+		if i == m.focus {
+			key.marker = "▸ "
+		} else if selecting && i >= selLo && i <= selHi {
+			key.marker = "┃ "
+		}
+		if m.compact {
+			// One sender header per run of messages, then just the time
+			run := "me"
+			if !msg.IsFromMe {
+				run = "handle:" + msg.Sender
+			}
+			if run != lastSender || lastDate != runDate {
+				key.header = true
+				lastSender, runDate = run, lastDate
+			}
+		}
+		var quote *chatdb.Message
+		if msg.ThreadOriginator != "" && !key.inThread {
+			if j, ok := loaded[msg.ThreadOriginator]; ok {
+				quote = &m.messages[j]
+			} else if q, ok := m.quotes[msg.ThreadOriginator]; ok {
+				quote = &q
+			}
+			key.quoted = quote != nil
 		}
 
-		ts := timestampStyle.Render(formatMessageTime(msg.Date))
+		block, ok := m.blockCache[msg.ROWID]
+		if !ok || block.key != key {
+			text := m.renderMessageBlock(msg, key, quote)
+			block = msgBlock{key: key, text: text, lines: strings.Count(text, "\n")}
+			m.blockCache[msg.ROWID] = block
+		}
+		sb.WriteString(block.text)
+		line += block.lines
+	}
+	if m.fromStart && m.loading && len(m.messages) > 0 {
+		write("\n" + dateSepStyle.Width(m.viewport.Width).Render("Loading newer messages..."))
+	}
 
-		var sender string
-		var styledSender string
-		if msg.IsFromMe {
-			sender = "Me"
-			styledSender = senderStyle.Copy().Inherit(fromMeStyle).Render(truncate(sender, senderWidth))
-		} else {
-			sender = m.contacts.ResolveName(msg.Sender)
-			if sender == "" {
-				sender = "Unknown"
-			}
-			styledSender = senderStyle.Copy().Inherit(fromThemStyle).Render(truncate(sender, senderWidth))
+	return sb.String()
+}
+
+// msgBlockKey is everything besides the message itself that shapes its
+// rendered block. A cached block is reused only while its key still
+// matches, so scrolling, moving the focus, or paging in older messages on
+// a huge thread re-renders just the messages that changed.
+type msgBlockKey struct {
+	width     int
+	marker    string // focus or selection marker; "" for neither
+	compact   bool
+	header    bool   // compact layout: the message starts a sender run
+	highlight string // search or filter term to highlight
+	expanded  bool   // reactions listed by name
+	quoted    bool   // the message it replies to is known
+	inThread  bool   // shown in a reply thread
+	handles   bool   // sender's handle follows their name
+	hideSizes bool   // attachment labels leave out file sizes
+	repeats   int    // copies of the message collapsed into it, 0 for none
+}
+
+// msgBlock is one message as rendered by renderMessageBlock.
+type msgBlock struct {
+	key   msgBlockKey
+	text  string
+	lines int
+}
+
+// renderMessageBlock renders one message: the compact sender header when
+// key.header is set, the quoted message, the message line itself, and its
+// reactions. quote is the message it replies to, or nil.
+func (m model) renderMessageBlock(msg chatdb.Message, key msgBlockKey, quote *chatdb.Message) string {
+	var sb strings.Builder
+
+	sender, nameStyle := "Me", fromMeStyle
+	if !msg.IsFromMe {
+		sender, nameStyle = m.contacts.ResolveName(msg.Sender), m.senderStyle(msg.Sender)
+		if sender == "" {
+			sender = "Unknown"
 		}
+	}
+	handle := ""
+	if key.handles && !msg.IsFromMe && msg.Sender != "" && sender != msg.Sender {
+		handle = msg.Sender
+	}
 
-		text := msg.Text
-		// Highlight search term in message text
-		if m.msgSearchTerm != "" && text != "" {
-			text = highlightTerm(text, m.msgSearchTerm)
+	text := msg.Text
+	// Highlight search term in message text
+	if key.highlight != "" && text != "" {
+		text = highlightTerm(text, key.highlight)
+	}
+	if len(msg.Attachments) > 0 {
+		label := formatAttachments(msg.Attachments, m.opts.units, key.hideSizes)
+		if text == "" {
+			text = attachmentStyle.Render(label)
+		} else {
+			text = text + "  " + attachmentStyle.Render(label)
 		}
-		if len(msg.Attachments) > 0 {
-			label := formatAttachments(msg.Attachments)
-			if text == "" {
-				text = attachmentStyle.Render(label)
-			} else {
-				text = text + "  " + attachmentStyle.Render(label)
+	} else if text == "" {
+		text = attachmentStyle.Render(msg.Placeholder())
+	}
+	if msg.Failed {
+		text += "  " + failedStyle.Render("⚠ Not Delivered")
+	}
+	if msg.ThreadOriginator != "" && !key.inThread {
+		text = attachmentStyle.Render("↪ ") + text
+	}
+	if key.repeats > 1 {
+		text += "  " + helpStyle.Render(fmt.Sprintf("×%d", key.repeats))
+	}
+
+	marker, markerStyle := key.marker, timestampStyle
+	switch marker {
+	case "▸ ":
+		markerStyle = timestampStyle.Copy().Inherit(focusStyle)
+	case "┃ ":
+		markerStyle = timestampStyle.Copy().Inherit(selectedStyle)
+	}
+
+	indent := markerWidth + tsWidth + 2 + senderWidth + 2
+	if key.compact {
+		indent = compactTimeWidth + 2
+	}
+	quoteLine := ""
+	if quote != nil {
+		quoteLine = strings.Repeat(" ", indent) +
+			quoteStyle.Render(formatQuote(*quote, m.contacts, key.width-indent)) + "\n"
+	}
+	if key.compact {
+		if key.header {
+			if handle != "" {
+				sender += " (" + handle + ")"
 			}
-		} else if text == "" {
-			text = attachmentStyle.Render("[attachment]")
+			sb.WriteString(nameStyle.Render(sender) + "\n")
 		}
-
-		sb.WriteString(fmt.Sprintf("%s  %s  %s\n", ts, styledSender, text))
+		sb.WriteString(quoteLine)
+		if marker == "" {
+			marker = "  "
+		}
+		ts := markerStyle.Copy().Width(compactTimeWidth).Render(marker + msg.Date.Format("03:04 PM"))
+		fmt.Fprintf(&sb, "%s  %s\n", ts, text)
+	} else {
+		sb.WriteString(quoteLine)
+		cell := markerStyle.Copy().Width(markerWidth).Align(lipgloss.Left).Render(marker)
+		ts := markerStyle.Render(formatMessageTime(msg.Date))
+		styledSender := senderStyle.Copy().Inherit(nameStyle).Render(fitNameHandle(sender, handle, senderWidth))
+		fmt.Fprintf(&sb, "%s%s  %s  %s\n", cell, ts, styledSender, text)
 	}
 
+	if len(msg.Reactions) > 0 {
+		groups := groupReactions(msg.Reactions, m.contacts)
+		summary := formatReactionCounts(groups)
+		if key.expanded {
+			summary = formatReactionNames(groups)
+		}
+		sb.WriteString(strings.Repeat(" ", indent) + reactionStyle.Render(summary) + "\n")
+	}
 	return sb.String()
 }
 
+// topVisibleDate returns the date of the message at the top of the
+// viewport, or "" when nothing has been rendered yet.
+func (m model) topVisibleDate() string {
+	idx, ok := m.topVisibleIndex()
+	if !ok {
+		return ""
+	}
+	return m.messages[idx].Date.Format("Monday, January 2, 2006")
+}
+
+// topVisibleIndex returns the index of the message at the top of the
+// viewport, or false when nothing has been rendered yet.
+func (m model) topVisibleIndex() (int, bool) {
+	if len(m.messages) == 0 || len(m.msgLines) != len(m.messages) {
+		return 0, false
+	}
+	offset := m.viewport.YOffset
+	idx := sort.Search(len(m.msgLines), func(i int) bool {
+		return m.msgLines[i] > offset
+	}) - 1
+	return max(idx, 0), true
+}
+
+// renderListTop is the line above the conversation list: the database
+// summary, or a warning or the position being typed when there is one.
+func (m model) renderListTop(width int) string {
+	summary := ""
+	if m.summary != nil {
+		summary = formatSummary(*m.summary)
+	}
+	top := searchCountStyle.Render(" " + summary)
+	if m.contactsWarning != "" {
+		top = failedStyle.Render(" " + truncate(m.contactsWarning, max(width-2, 1)))
+	}
+	if m.gotoInput != "" {
+		top = searchCountStyle.Render(" Go to #" + m.gotoInput + "  (enter: open, esc: cancel)")
+	}
+	return top
+}
+
+// renderMessagePane is the message view: header, messages with any
+// overlay, and the footer.
+func (m model) renderMessagePane() string {
+	headerText := m.buildMessageHeader()
+	header := headerStyle.Width(m.messagePaneWidth()).Render(headerText)
+
+	var footerText string
+	if m.state == viewConversations {
+		// Previewed beside the list, which still has the keys
+		footerText = " Preview  |  enter: open this conversation"
+	} else if m.msgSearchActive && m.msgSearchInput.Focused() {
+		footerText = " " + m.msgSearchInput.View()
+	} else if m.msgFilterInput.Focused() {
+		footerText = fmt.Sprintf(" %s  (%d shown)", m.msgFilterInput.View(), m.countShown())
+	} else if m.msgFilterTerm != "" {
+		footerText = fmt.Sprintf(" Filter %q: %d of %d loaded messages  |  F: edit  |  esc: clear",
+			m.msgFilterTerm, m.countShown(), len(m.messages))
+	} else if m.msgSearchTerm != "" {
+		matchInfo := fmt.Sprintf(" %d/%d matches for %q  |  n/N: next/prev  |  esc: clear",
+			m.msgSearchIdx+1, len(m.msgSearchHits), m.msgSearchTerm)
+		if len(m.msgSearchHits) == 0 {
+			matchInfo = fmt.Sprintf(" No matches for %q  |  esc: clear", m.msgSearchTerm)
+		}
+		footerText = matchInfo
+	} else if m.handleView != "" {
+		footerText = fmt.Sprintf(" Messages with %s in every chat  |  [/]: focus  |  A/esc: back to conversation", m.contacts.ResolveName(m.handleView))
+	} else if m.fromStart {
+		footerText = " Reading from the beginning, newer messages load as you scroll down  |  [/]: focus  |  B/esc: back to latest"
+	} else if m.threadReturn != nil {
+		footerText = " Reply thread  |  [/]: focus  |  R: reactions  |  esc: back to conversation"
+	} else if lo, hi, ok := m.selection(); ok {
+		footerText = fmt.Sprintf(" %d messages selected  |  [/]: extend  |  e/T: export selection  |  v/esc: clear", hi-lo+1)
+		if m.exportStatus != "" {
+			footerText += "  |  " + m.exportStatus
+		}
+	} else {
+		footerText = fmt.Sprintf(" %.0f%%  |  /: search  |  esc: back  |  [/]: focus  |  n/p: next/prev day  |  e/T/E: export CSV/text/as...  |  a: attachments  |  S: stats  |  f: %s  |  z: sizes  |  t/b: top/bottom",
+			m.viewport.ScrollPercent()*100, m.senderFilter)
+		if m.exportStatus != "" {
+			footerText += "  |  " + m.exportStatus
+		}
+	}
+	if m.pendingCount > 0 {
+		footerText += fmt.Sprintf("  |  %d", m.pendingCount)
+	}
+	footer := statusBarStyle.Render(footerText)
+	scrollbar := renderScrollbar(m.viewport.Height, m.viewport.TotalLineCount(), m.viewport.YOffset)
+	body := lipgloss.JoinHorizontal(lipgloss.Top, m.viewport.View(), scrollbar)
+	if m.showSidebar {
+		body = lipgloss.JoinHorizontal(lipgloss.Top, body, m.renderParticipantSidebar())
+	}
+	if m.detail != nil {
+		box := detailStyle.Render(formatMessageDetail(*m.detail, m.contacts, m.opts.units) +
+			"\n\n" + helpStyle.Render("esc: close"))
+		body = lipgloss.Place(lipgloss.Width(body), m.viewport.Height,
+			lipgloss.Center, lipgloss.Center, box)
+	}
+	if m.groupEvents != nil {
+		// Title, blank line, and help line, plus the border
+		history := formatGroupHistory(*m.groupEvents, m.contacts, m.viewport.Height-6)
+		box := detailStyle.Render(sidebarTitleStyle.Render("Group history") + "\n" + history +
+			"\n\n" + helpStyle.Render("esc: close"))
+		body = lipgloss.Place(lipgloss.Width(body), m.viewport.Height,
+			lipgloss.Center, lipgloss.Center, box)
+	}
+	if m.pickingFormat {
+		body = lipgloss.Place(lipgloss.Width(body), m.viewport.Height,
+			lipgloss.Center, lipgloss.Center, detailStyle.Render(m.renderFormatPicker()))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, header, body, footer)
+}
+
 func (m model) View() string {
 	if m.err != nil {
+		if hint := errorHint(m.err); hint != "" {
+			return fmt.Sprintf("\n  Error: %v\n\n  %s\n\n  Press any key to exit.\n", m.err, hint)
+		}
 		return fmt.Sprintf("\n  Error: %v\n\n  Press any key to exit.\n", m.err)
 	}
+	if m.tooSmall() {
+		msg := fmt.Sprintf("Terminal too small (%d×%d)\nneed at least %d×%d", m.width, m.height, minWidth, minHeight)
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center,
+			failedStyle.Width(m.width).Align(lipgloss.Center).Render(msg))
+	}
+
+	if (m.state == viewConversations || m.state == viewMessages) && m.split() && !m.convLoading {
+		return m.renderSplit()
+	}
 
 	switch m.state {
 	case viewConversations:
-		help := helpStyle.Render("  s: search all messages")
-		return appStyle.Render(m.convList.View() + "\n" + help)
+		help := helpStyle.Render("  s: search all messages  |  m: all attachments  |  r: recent only  |  F: fuzzy/exact filter  |  0-9: go to #")
+		top := m.renderListTop(m.width - 4)
+		body := m.convList.View()
+		if m.convLoading {
+			// Reading every chat's participants can take a while on a big
+			// database; show that something is happening
+			body = lipgloss.Place(max(m.width-4, 0), max(m.height-4, 1), lipgloss.Center, lipgloss.Center,
+				m.spinner.View()+" Loading conversations...")
+		}
+		return appStyle.Render(top + "\n" + body + "\n" + help)
 
 	case viewMessages:
-		headerText := m.buildMessageHeader()
-		header := headerStyle.Width(m.viewport.Width).Render(headerText)
-
-		var footerText string
-		if m.msgSearchActive && m.msgSearchInput.Focused() {
-			footerText = " " + m.msgSearchInput.View()
-		} else if m.msgSearchTerm != "" {
-			matchInfo := fmt.Sprintf(" %d/%d matches for %q  |  n/N: next/prev  |  esc: clear",
-				m.msgSearchIdx+1, len(m.msgSearchHits), m.msgSearchTerm)
-			if len(m.msgSearchHits) == 0 {
-				matchInfo = fmt.Sprintf(" No matches for %q  |  esc: clear", m.msgSearchTerm)
-			}
-			footerText = matchInfo
-		} else {
-			footerText = fmt.Sprintf(" %.0f%%  |  /: search  |  esc: back  |  e: export CSV  |  a: attachments  |  t/b: top/bottom",
-				m.viewport.ScrollPercent()*100)
-			if m.exportStatus != "" {
-				footerText += "  |  " + m.exportStatus
-			}
-		}
-		footer := statusBarStyle.Render(footerText)
-		return appStyle.Render(
-			lipgloss.JoinVertical(lipgloss.Left, header, m.viewport.View(), footer),
-		)
+		return appStyle.Render(m.renderMessagePane())
 
 	case viewAttachments:
-		help := helpStyle.Render("  enter: open  |  /: filter  |  esc: back")
-		return appStyle.Render(m.attachmentList.View() + "\n" + help)
+		help := helpStyle.Render("  enter: open  |  /: filter  |  t: type  |  o: sort by size  |  z: sizes  |  J: open as JPEG  |  y: copy paths  |  e: export list  |  esc: back")
+		if m.preview.path == "" {
+			return appStyle.Render(m.attachmentList.View() + "\n" + help)
+		}
+		pane := m.renderPreview()
+		// m is a copy, so shrinking the list here only affects this frame
+		m.attachmentList.SetHeight(max(m.attachmentList.Height()-lipgloss.Height(pane), 3))
+		return appStyle.Render(m.attachmentList.View() + "\n" + pane + "\n" + help)
+
+	case viewStats:
+		helpText := "  C: copy chat GUID  |  y: copy summary  |  esc: back"
+		if m.exportStatus != "" {
+			helpText += "  |  " + m.exportStatus
+		}
+		return appStyle.Render(m.renderStats() + "\n\n" + helpStyle.Render(helpText))
 
 	case viewSearch:
 		var sections []string
@@ -947,8 +3558,11 @@ func (m model) View() string {
 
 		sections = append(sections, m.searchResults.View())
 
-		help := helpStyle.Render("  enter: open conversation  |  s: new search  |  esc: back")
-		sections = append(sections, help)
+		helpText := "  enter: open conversation  |  o: sort  |  d: date  |  c: chats  |  f: this chat only  |  a: ignore accents  |  e: export CSV  |  s: new search  |  esc: back"
+		if m.exportStatus != "" {
+			helpText += "  |  " + m.exportStatus
+		}
+		sections = append(sections, helpStyle.Render(helpText))
 
 		return appStyle.Render(lipgloss.JoinVertical(lipgloss.Left, sections...))
 	}
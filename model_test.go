@@ -0,0 +1,1263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+	"github.com/aftaylor2/smsDbViewer/chatdb/chatdbtest"
+)
+
+func TestFormatRelativeDate(t *testing.T) {
+	loc := time.Local
+	now := time.Date(2024, 6, 16, 9, 0, 0, 0, loc)
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want string
+	}{
+		{"just_now", now.Add(-30 * time.Second), "just now"},
+		{"minutes", now.Add(-15 * time.Minute), "15m ago"},
+		{"early_today", time.Date(2024, 6, 16, 0, 10, 0, 0, loc), "8h ago"},
+		{"late_yesterday", time.Date(2024, 6, 15, 23, 50, 0, 0, loc), "Yesterday 11:50 PM"},
+		{"yesterday_morning", time.Date(2024, 6, 15, 8, 0, 0, 0, loc), "Yesterday 08:00 AM"},
+		{"this_week", time.Date(2024, 6, 12, 14, 5, 0, 0, loc), "Wed 02:05 PM"},
+		{"this_year", time.Date(2024, 3, 2, 12, 0, 0, 0, loc), "Mar 02"},
+		{"older", time.Date(2022, 3, 2, 12, 0, 0, 0, loc), "Mar 02, 2022"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := defaultRelativeDates.formatAt(tt.t, now); got != tt.want {
+				t.Errorf("formatAt(%v) = %q, want %q", tt.t, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("just_after_midnight", func(t *testing.T) {
+		// 11:50pm yesterday seen at 12:10am is still within the minutes window
+		late := time.Date(2024, 6, 15, 23, 50, 0, 0, loc)
+		at := time.Date(2024, 6, 16, 0, 10, 0, 0, loc)
+		if got := defaultRelativeDates.formatAt(late, at); got != "20m ago" {
+			t.Errorf("got %q, want %q", got, "20m ago")
+		}
+	})
+
+	t.Run("days_ago", func(t *testing.T) {
+		dates := daysAgoDates(30)
+		for _, tt := range []struct {
+			t    time.Time
+			want string
+		}{
+			{time.Date(2024, 6, 15, 8, 0, 0, 0, loc), "Yesterday 08:00 AM"},
+			{time.Date(2024, 6, 12, 14, 5, 0, 0, loc), "4d ago"},
+			{time.Date(2024, 5, 17, 12, 0, 0, 0, loc), "30d ago"},
+			{time.Date(2024, 5, 16, 12, 0, 0, 0, loc), "May 16"},
+		} {
+			if got := dates.formatAt(tt.t, now); got != tt.want {
+				t.Errorf("formatAt(%v) = %q, want %q", tt.t, got, tt.want)
+			}
+		}
+	})
+}
+
+func TestMostRecentConversations(t *testing.T) {
+	base := time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local)
+	convs := []chatdb.Conversation{
+		{ChatID: 1, LastMsgDate: base.Add(1 * time.Hour)},
+		{ChatID: 2, LastMsgDate: base.Add(3 * time.Hour)},
+		{ChatID: 3, LastMsgDate: base},
+		{ChatID: 4, LastMsgDate: base.Add(2 * time.Hour)},
+	}
+
+	recent := mostRecentConversations(convs, 2)
+	if len(recent) != 2 || recent[0].ChatID != 2 || recent[1].ChatID != 4 {
+		t.Errorf("expected chats 2 and 4, got %+v", recent)
+	}
+	if convs[0].ChatID != 1 {
+		t.Error("input slice should not be reordered")
+	}
+
+	if all := mostRecentConversations(convs, 10); len(all) != 4 {
+		t.Errorf("n larger than the list should return everything, got %d", len(all))
+	}
+}
+
+func TestJumpToDay(t *testing.T) {
+	m := model{viewport: viewport.New(80, 5)}
+	m.viewport.SetContent(strings.Repeat("line\n", 40))
+	m.dayLines = []int{0, 10, 20}
+
+	var offsets []int
+	m.jumpToNextDay()
+	offsets = append(offsets, m.viewport.YOffset)
+	m.jumpToNextDay()
+	offsets = append(offsets, m.viewport.YOffset)
+	m.jumpToPrevDay()
+	offsets = append(offsets, m.viewport.YOffset)
+	m.jumpToPrevDay()
+	offsets = append(offsets, m.viewport.YOffset)
+	if want := []int{10, 20, 10, 0}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("offsets: got %v, want %v", offsets, want)
+	}
+	if m.jumpToPrevDay() {
+		t.Error("no separator above the first day: expected false")
+	}
+}
+
+func TestRememberLastViewed(t *testing.T) {
+	tempStateDir(t)
+
+	m := model{activeChatID: 7, lastViewed: map[string]int{}}
+	m.messages = []chatdb.Message{{ROWID: 10}, {ROWID: 12}, {ROWID: 15}}
+	cmd := m.rememberLastViewed()
+	if cmd == nil {
+		t.Fatal("expected a save command")
+	}
+	cmd()
+	if got := loadLastViewed()["7"]; got != 15 {
+		t.Errorf("saved ROWID: got %d, want 15", got)
+	}
+	if m.rememberLastViewed() != nil {
+		t.Error("nothing new since the last save: expected no command")
+	}
+
+	m.newSince = 12
+	if i, ok := m.newSinceIndex(); !ok || i != 2 {
+		t.Errorf("newSinceIndex: got %d, %v; want 2, true", i, ok)
+	}
+	m.newSince = 15
+	if _, ok := m.newSinceIndex(); ok {
+		t.Error("no messages newer than the last visit: expected false")
+	}
+}
+
+func TestExportFormatPicker(t *testing.T) {
+	tempStateDir(t)
+
+	key := func(s string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)} }
+	m := model{viewport: viewport.New(80, 10), state: viewMessages, activeChatID: 7, focus: -1, selectAnchor: -1}
+	updated, _ := m.Update(key("E"))
+	m = updated.(model)
+	if !m.pickingFormat || m.formatPick != 0 {
+		t.Fatalf("a chat never exported should offer CSV: picking %v, pick %d", m.pickingFormat, m.formatPick)
+	}
+	updated, _ = m.Update(key("j"))
+	m = updated.(model)
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if m.pickingFormat || !m.exporting || cmd == nil {
+		t.Fatalf("enter should export: picking %v, exporting %v", m.pickingFormat, m.exporting)
+	}
+	if got := m.chatFormats["7"]; got != "text" {
+		t.Errorf("remembered format = %q, want text", got)
+	}
+
+	// A later run reads the saved table and offers the last format used
+	m.rememberFormatCmd("sqlite")()
+	m = model{viewport: viewport.New(80, 10), state: viewMessages, activeChatID: 7, chatFormats: loadExportFormats()}
+	updated, _ = m.Update(key("E"))
+	m = updated.(model)
+	if exportFormats[m.formatPick].name != "sqlite" {
+		t.Errorf("picker offered %q, want the saved sqlite", exportFormats[m.formatPick].name)
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if m = updated.(model); m.pickingFormat || m.exporting {
+		t.Errorf("esc should close the picker without exporting")
+	}
+}
+
+func TestExportAsPrivacy(t *testing.T) {
+	tempStateDir(t)
+	m := model{activeChatID: 7, opts: modelOptions{exportPrivacy: exportPrivacy{redactBodies: true}}}
+	for _, format := range []string{"sqlite", "attachments"} {
+		if cmd := m.exportAs(format); cmd != nil || m.exporting || m.exportStatus == "" {
+			t.Errorf("%s should be refused while redacting: exporting %v, status %q", format, m.exporting, m.exportStatus)
+		}
+	}
+	if cmd := m.exportAs("text"); cmd == nil || !m.exporting {
+		t.Error("text exports redact, so they should run")
+	}
+
+	// The picker skips the refused formats, even one remembered for the chat
+	m = model{viewport: viewport.New(80, 10), state: viewMessages, activeChatID: 7, focus: -1, selectAnchor: -1,
+		chatFormats: map[string]string{"7": "sqlite"}, opts: m.opts}
+	key := func(s string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)} }
+	for _, k := range []string{"E", "j", "j", "j"} {
+		updated, _ := m.Update(key(k))
+		m = updated.(model)
+	}
+	if got := exportFormats[m.formatPick].name; got != "text" {
+		t.Errorf("picker highlighted %q, want text", got)
+	}
+	if !strings.Contains(ansi.Strip(m.renderFormatPicker()), "SQLite database (this conversation only) (off while") {
+		t.Error("refused formats should be marked in the picker")
+	}
+}
+
+func TestMsgFilter(t *testing.T) {
+	m := model{viewport: viewport.New(80, 10), focus: 1}
+	m.messages = []chatdb.Message{
+		{ROWID: 1, Text: "Lunch tomorrow?", IsFromMe: true},
+		{ROWID: 2, Text: "sure", IsFromMe: true},
+		{ROWID: 3, Text: "Where for lunch", IsFromMe: true},
+	}
+
+	m.setMsgFilter("LUNCH")
+	if got := m.countShown(); got != 2 {
+		t.Errorf("shown: got %d, want 2", got)
+	}
+	if m.focus != -1 {
+		t.Errorf("focus on a hidden message should be dropped, got %d", m.focus)
+	}
+	out := m.renderMessages()
+	if strings.Contains(out, "sure") {
+		t.Error("non-matching message should be hidden")
+	}
+	if !strings.Contains(out, "Where for") {
+		t.Error("matching message should be shown")
+	}
+
+	m.clearMsgFilter()
+	if got := m.countShown(); got != 3 {
+		t.Errorf("after clearing: got %d shown, want 3", got)
+	}
+}
+
+func TestCountPrefix(t *testing.T) {
+	press := func(m model, keys ...string) model {
+		for _, k := range keys {
+			next, _ := m.updateMessageView(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)})
+			m = next.(model)
+		}
+		return m
+	}
+
+	m := model{viewport: viewport.New(80, 5), allLoaded: true}
+	m.viewport.SetContent(strings.Repeat("line\n", 40))
+	m = press(m, "1", "2", "j")
+	if m.viewport.YOffset != 12 {
+		t.Errorf("12j: got offset %d, want 12", m.viewport.YOffset)
+	}
+	if m.pendingCount != 0 {
+		t.Errorf("count should reset after a motion, got %d", m.pendingCount)
+	}
+	m = press(m, "k")
+	if m.viewport.YOffset != 11 {
+		t.Errorf("k without a count: got offset %d, want 11", m.viewport.YOffset)
+	}
+
+	m = model{viewport: viewport.New(80, 20), allLoaded: true, focus: -1}
+	for i := 0; i < 6; i++ {
+		m.messages = append(m.messages, chatdb.Message{ROWID: i + 1, Text: "hi", IsFromMe: true})
+	}
+	m = press(m, "3", "]")
+	if m.focus != 2 {
+		t.Errorf("3]: got focus %d, want 2", m.focus)
+	}
+	m = press(m, "9", "]")
+	if m.focus != 5 {
+		t.Errorf("9] should stop at the last message, got focus %d", m.focus)
+	}
+}
+
+func TestLastMessagePreview(t *testing.T) {
+	tests := []struct{ text, want string }{
+		{"See you\n  tonight!", "See you tonight!"},
+		{"", "[attachment]"},
+		{strings.Repeat("é", previewLength+5), strings.Repeat("é", previewLength-1) + "…"},
+	}
+	for _, tt := range tests {
+		if got := lastMessagePreview(tt.text); got != tt.want {
+			t.Errorf("lastMessagePreview(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestConvItemTextCounts(t *testing.T) {
+	conv := chatdb.Conversation{MessageCount: 23, TextMessageCount: 15, SentCount: 11, ReceivedCount: 12}
+	if desc := (convItem{conv: conv}).Description(); !strings.Contains(desc, "23 msgs (11 sent, 12 recv)") {
+		t.Errorf("default description = %q", desc)
+	}
+	if desc := (convItem{conv: conv, textCounts: true}).Description(); !strings.Contains(desc, "15 text msgs (23 in all)") {
+		t.Errorf("text count description = %q", desc)
+	}
+}
+
+func TestConvItemTitleUnnamedGroup(t *testing.T) {
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+
+	conv := chatdb.Conversation{Identifier: "chat123456789", Style: chatdb.ChatStyleGroup,
+		Senders: []string{"+15551234567", "+15559876543"}}
+	if got := (convItem{conv: conv, contacts: contacts}).Title(); got != "John Doe, +15559876543" {
+		t.Errorf("group named by its senders: title = %q", got)
+	}
+	conv.Senders = nil
+	if got := (convItem{conv: conv, contacts: contacts}).Title(); got != "Unnamed group" {
+		t.Errorf("group with nobody to name: title = %q", got)
+	}
+	direct := chatdb.Conversation{Identifier: "+15550001111", Style: chatdb.ChatStyleDirect}
+	if got := (convItem{conv: direct, contacts: contacts}).Title(); got != "+15550001111" {
+		t.Errorf("direct chat keeps its identifier: title = %q", got)
+	}
+}
+
+func TestHideAttachmentSizes(t *testing.T) {
+	a := chatdb.ChatAttachment{TypeLabel: "photo", Filename: "IMG_0001.jpeg", Size: 2 << 20}
+	if got := (attachmentItem{attachment: a}).Title(); got != "photo — IMG_0001.jpeg — 2.0 MB" {
+		t.Errorf("title = %q", got)
+	}
+	if got := (attachmentItem{attachment: a, hideSize: true}).Title(); got != "photo — IMG_0001.jpeg" {
+		t.Errorf("title without size = %q", got)
+	}
+
+	m := model{viewport: viewport.New(100, 10), contacts: &chatdb.ContactBook{}, state: viewMessages, focus: -1, selectAnchor: -1}
+	m.messages = []chatdb.Message{{ROWID: 1, Sender: "+15551234567",
+		Attachments: []chatdb.AttachmentInfo{{TypeLabel: "photo", Filename: "IMG_0001.jpeg", Size: 2 << 20}}}}
+	if out := ansi.Strip(m.renderMessages()); !strings.Contains(out, "2.0 MB") {
+		t.Fatalf("sizes should show by default:\n%s", out)
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("z")})
+	m = updated.(model)
+	out := ansi.Strip(m.renderMessages())
+	if strings.Contains(out, "MB") || !strings.Contains(out, "IMG_0001.jpeg") {
+		t.Errorf("z should drop the size but keep the name:\n%s", out)
+	}
+}
+
+func TestSizeUnits(t *testing.T) {
+	a := chatdb.ChatAttachment{TypeLabel: "photo", Filename: "IMG_0001.jpeg", Size: 2 << 20}
+	if got := (attachmentItem{attachment: a, units: chatdb.UnitsIEC}).Title(); got != "photo — IMG_0001.jpeg — 2.0 MiB" {
+		t.Errorf("title = %q", got)
+	}
+
+	m := model{viewport: viewport.New(100, 10), contacts: &chatdb.ContactBook{}, state: viewMessages, focus: -1, selectAnchor: -1}
+	m.opts.units = chatdb.UnitsSI
+	m.messages = []chatdb.Message{{ROWID: 1, Sender: "+15551234567",
+		Attachments: []chatdb.AttachmentInfo{{TypeLabel: "photo", Filename: "IMG_0001.jpeg", Size: 2 << 20}}}}
+	if out := ansi.Strip(m.renderMessages()); !strings.Contains(out, "2.1 MB") {
+		t.Errorf("sizes should be in SI units:\n%s", out)
+	}
+	// Other models and exports keep the default
+	if got := m.messages[0].Attachments[0].String(); !strings.HasSuffix(got, "2.0 MB]") {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestShowHandles(t *testing.T) {
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "Jonathan Doe-Smithers", Phones: []string{"5551234567"}})
+
+	conv := chatdb.Conversation{Participants: []string{"+15551234567", "+15559876543"}}
+	if got := (convItem{conv: conv, contacts: contacts, showHandles: true}).Title(); got != "Jonathan Doe-Smithers (+15551234567), +15559876543" {
+		t.Errorf("title = %q", got)
+	}
+
+	at := time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local)
+	m := model{viewport: viewport.New(120, 20), contacts: contacts, focus: -1, showHandles: true}
+	m.messages = []chatdb.Message{{ROWID: 1, Date: at, Text: "hi", Sender: "+15551234567"}}
+	out := ansi.Strip(m.renderMessages())
+	if !strings.Contains(out, "(+15551234567)") {
+		t.Errorf("sender column should keep the handle:\n%s", out)
+	}
+	if got := fitNameHandle("Jonathan Doe-Smithers", "+15551234567", senderWidth); ansi.StringWidth(got) != senderWidth || !strings.HasSuffix(got, "(+15551234567)") {
+		t.Errorf("fitNameHandle = %q", got)
+	}
+}
+
+func TestRenderMessagesWideNames(t *testing.T) {
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "山田太郎山田太郎山田太郎", Phones: []string{"5551234567"}})
+	contacts.Add(&chatdb.Contact{Name: "🎉 Party Planner", Emails: []string{"party@example.com"}})
+
+	at := time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local)
+	m := model{viewport: viewport.New(120, 20), contacts: contacts, focus: -1}
+	m.messages = []chatdb.Message{
+		{ROWID: 1, Date: at, Text: "TEXT-A", Sender: "+15551234567"},
+		{ROWID: 2, Date: at, Text: "TEXT-B", Sender: "party@example.com"},
+		{ROWID: 3, Date: at, Text: "TEXT-C", IsFromMe: true},
+	}
+
+	// The message text starts in the same column whatever the sender's name
+	var cols []int
+	for _, line := range strings.Split(ansi.Strip(m.renderMessages()), "\n") {
+		if i := strings.Index(line, "TEXT-"); i >= 0 {
+			cols = append(cols, ansi.StringWidth(line[:i]))
+		}
+	}
+	want := markerWidth + tsWidth + 2 + senderWidth + 2
+	if len(cols) != 3 || cols[0] != want || cols[1] != want || cols[2] != want {
+		t.Errorf("text columns: got %v, want all %d", cols, want)
+	}
+
+	if got := truncate("山田太郎山田太郎山田太郎", 9); ansi.StringWidth(got) > 9 || !strings.HasSuffix(got, "~") {
+		t.Errorf("truncate to 9 cells: got %q (%d cells)", got, ansi.StringWidth(got))
+	}
+}
+
+func TestFormatMessageDetail(t *testing.T) {
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+	sent := time.Date(2024, 6, 15, 10, 2, 0, 0, time.UTC)
+	d := chatdb.MessageDetail{
+		Message: chatdb.Message{
+			ROWID: 4, GUID: "msg-c1-3", Service: "iMessage", Sender: "+15551234567",
+			Date: sent, DateRead: sent.Add(90 * time.Second),
+		},
+		ChatID: 1,
+		Files: []chatdb.ChatAttachment{
+			{MimeType: "application/pdf", Size: 524288, FilePath: "/Users/me/Library/Messages/Attachments/ef/menu.pdf"},
+		},
+	}
+	out := formatMessageDetail(d, contacts, chatdb.UnitsLegacy)
+	for _, want := range []string{
+		"ROWID       4\n",
+		"GUID        msg-c1-3\n",
+		"Handle      John Doe (+15551234567)\n",
+		"Sent        2024-06-15 10:02:00.000 UTC\n",
+		"Delivered   —\n",
+		"Read        2024-06-15 10:03:30.000 UTC\n",
+		"Attachments application/pdf  512.0 KB\n",
+		"            /Users/me/Library/Messages/Attachments/ef/menu.pdf",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderMessagesCompact(t *testing.T) {
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+	at := time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local)
+	m := model{viewport: viewport.New(80, 20), contacts: contacts, focus: -1, compact: true}
+	m.messages = []chatdb.Message{
+		{ROWID: 1, Date: at, Text: "Sure, where?", Sender: "+15551234567"},
+		{ROWID: 2, Date: at.Add(time.Minute), Text: "Downtown?", Sender: "+15551234567"},
+		{ROWID: 3, Date: at.Add(2 * time.Minute), Text: "Sounds good", IsFromMe: true},
+		{ROWID: 4, Date: at.Add(24 * time.Hour), Text: "Still on?", IsFromMe: true},
+	}
+
+	var got []string
+	for _, line := range strings.Split(ansi.Strip(m.renderMessages()), "\n") {
+		if line = strings.TrimRight(line, " "); line != "" && !strings.HasPrefix(strings.TrimSpace(line), "—") {
+			got = append(got, line)
+		}
+	}
+	want := []string{
+		"John Doe",
+		"  10:00 AM  Sure, where?",
+		"  10:01 AM  Downtown?",
+		"Me",
+		"  10:02 AM  Sounds good",
+		"Me", // a new day starts a new run
+		"  10:00 AM  Still on?",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("compact layout:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestRenderMessagesQuotes(t *testing.T) {
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+	at := time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local)
+	m := model{viewport: viewport.New(100, 20), contacts: contacts, focus: -1}
+	m.messages = []chatdb.Message{
+		{ROWID: 5, GUID: "g5", Date: at, Text: "Lunch\ntomorrow?", Sender: "+15551234567"},
+		{ROWID: 6, GUID: "g6", Date: at.Add(time.Minute), Text: "Yes!", IsFromMe: true, ThreadOriginator: "g5"},
+		{ROWID: 7, GUID: "g7", Date: at.Add(2 * time.Minute), Text: "Still true", IsFromMe: true, ThreadOriginator: "g1"},
+	}
+
+	if m.fetchQuotesCmd() == nil {
+		t.Fatal("expected a lookup for the quote outside the loaded page")
+	}
+	out := ansi.Strip(m.renderMessages())
+	if !strings.Contains(out, "╭ John Doe: Lunch tomorrow?") {
+		t.Errorf("loaded quote missing:\n%s", out)
+	}
+	if strings.Count(out, "╭") != 1 {
+		t.Errorf("unresolved quote should be left out until fetched:\n%s", out)
+	}
+
+	m.quotes = map[string]chatdb.Message{"g1": {GUID: "g1", Text: "I'm always right", IsFromMe: true}}
+	if m.fetchQuotesCmd() != nil {
+		t.Error("no lookup expected once every quote is known")
+	}
+	out = ansi.Strip(m.renderMessages())
+	if !strings.Contains(out, "╭ Me: I'm always right") {
+		t.Errorf("fetched quote missing:\n%s", out)
+	}
+	if lines := strings.Split(out, "\n"); m.msgLines[2] >= len(lines) || !strings.Contains(lines[m.msgLines[2]], "╭ Me:") {
+		t.Errorf("message should start at its quote line")
+	}
+}
+
+func TestRenderMessagesCache(t *testing.T) {
+	contacts := &chatdb.ContactBook{}
+	at := time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local)
+	m := model{viewport: viewport.New(100, 20), contacts: contacts, focus: 0, selectAnchor: -1}
+	for i := 0; i < 5; i++ {
+		m.messages = append(m.messages, chatdb.Message{
+			ROWID: i + 1, GUID: fmt.Sprintf("g%d", i+1), Date: at.Add(time.Duration(i) * time.Minute),
+			Text: fmt.Sprintf("message %d", i+1), IsFromMe: i%2 == 0, Sender: "+15551234567",
+		})
+	}
+	m.renderMessages()
+
+	// Untouched messages reuse their cached block; the two whose focus
+	// marker changed are rendered again
+	stale := m.blockCache[3]
+	stale.text = "cached 3\n"
+	m.blockCache[3] = stale
+	m.focus = 1
+	out := m.renderMessages()
+	if !strings.Contains(out, "cached 3") {
+		t.Error("unchanged message was re-rendered")
+	}
+	if !strings.Contains(ansi.Strip(out), "▸") || strings.Count(ansi.Strip(out), "▸") != 1 {
+		t.Errorf("focus marker should move to message 2:\n%s", ansi.Strip(out))
+	}
+
+	// With a clean cache the output matches a cached render exactly
+	m.blockCache = nil
+	fresh := m.renderMessages()
+	m.msgSearchTerm = "message"
+	m.compact = true
+	m.focus = 4
+	cached := m.renderMessages()
+	m.blockCache = nil
+	if fresh == cached || cached != m.renderMessages() {
+		t.Error("cached render differs from a fresh one after changing the layout")
+	}
+}
+
+func TestRenderMessagesMarkerWidth(t *testing.T) {
+	// A full date fills the timestamp column; the marker mustn't wrap it
+	at := time.Date(time.Now().Year()-1, 6, 15, 22, 45, 0, 0, time.Local)
+	m := model{viewport: viewport.New(100, 20), contacts: &chatdb.ContactBook{}, focus: 0, selectAnchor: -1}
+	m.messages = []chatdb.Message{
+		{ROWID: 1, Date: at, Text: "focused", Sender: "+15551234567"},
+		{ROWID: 2, Date: at.Add(time.Minute), Text: "next", IsFromMe: true},
+	}
+	m.renderMessages()
+	if got := m.blockCache[1].lines; got != 1 {
+		t.Errorf("focused prior-year message takes %d lines, want 1:\n%s", got, ansi.Strip(m.blockCache[1].text))
+	}
+	if m.msgLines[1] != m.msgLines[0]+1 {
+		t.Errorf("next message starts on line %d, want %d", m.msgLines[1], m.msgLines[0]+1)
+	}
+
+	// Selecting a range marks it without reflowing the transcript
+	plain := m.renderMessages()
+	m.focus, m.selectAnchor = 1, 0
+	selected := m.renderMessages()
+	if !strings.Contains(ansi.Strip(selected), "┃") || strings.Count(selected, "\n") != strings.Count(plain, "\n") {
+		t.Errorf("selection changed the line count:\n%s", ansi.Strip(selected))
+	}
+}
+
+func TestApplyReloadKeepsPlace(t *testing.T) {
+	at := time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local)
+	msg := func(id int) chatdb.Message {
+		return chatdb.Message{
+			ROWID: id, GUID: fmt.Sprintf("g%d", id), Date: at.Add(time.Duration(id) * time.Minute),
+			Text: fmt.Sprintf("message %d", id), Sender: "+15551234567",
+		}
+	}
+	m := model{viewport: viewport.New(100, 10), contacts: &chatdb.ContactBook{}, selectAnchor: -1}
+	for id := 1; id <= 30; id++ {
+		m.messages = append(m.messages, msg(id))
+	}
+	// A reaction line makes message 11 two lines tall
+	m.messages[10].Reactions = []chatdb.Reaction{{Type: 2000, IsFromMe: true}}
+	m.focus = 10
+	m.viewport.SetContent(m.renderMessages())
+	m.viewport.SetYOffset(m.msgLines[10] + 1)
+
+	// Two messages arrived, and a late sync put one in the middle
+	reloaded := append([]chatdb.Message{}, m.messages[:5]...)
+	synced := msg(100)
+	synced.Date = at.Add(5*time.Minute + 30*time.Second)
+	reloaded = append(reloaded, synced)
+	reloaded = append(reloaded, m.messages[5:]...)
+	reloaded = append(reloaded, msg(31), msg(32))
+	m.applyReload(reloaded)
+
+	idx, _ := m.topVisibleIndex()
+	if got := m.messages[idx].ROWID; got != 11 {
+		t.Errorf("top visible message = %d, want 11", got)
+	}
+	if got := m.viewport.YOffset - m.msgLines[idx]; got != 1 {
+		t.Errorf("offset into the top message = %d, want 1", got)
+	}
+	if got := m.messages[m.focus].ROWID; got != 11 {
+		t.Errorf("focus = message %d, want 11", got)
+	}
+	if m.exportStatus != "Reloaded, 3 new messages" {
+		t.Errorf("status = %q", m.exportStatus)
+	}
+
+	// At the bottom, the view follows new messages
+	m.viewport.GotoBottom()
+	m.applyReload(append(m.messages, msg(33)))
+	if !m.viewport.AtBottom() {
+		t.Error("view should stay at the bottom")
+	}
+}
+
+func TestAppendFollowed(t *testing.T) {
+	at := time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local)
+	msg := func(id int) chatdb.Message {
+		return chatdb.Message{
+			ROWID: id, GUID: fmt.Sprintf("g%d", id), Date: at.Add(time.Duration(id) * time.Minute),
+			Text: fmt.Sprintf("message %d", id), Sender: "+15551234567",
+		}
+	}
+	m := model{viewport: viewport.New(100, 10), contacts: &chatdb.ContactBook{}, selectAnchor: -1, focus: -1}
+	for id := 10; id <= 40; id++ {
+		m.messages = append(m.messages, msg(id))
+	}
+	m.oldestCursor = chatdb.CursorAt(m.messages[0])
+	m.activeMsgCount = 100
+	m.viewport.SetContent(m.renderMessages())
+	m.viewport.GotoBottom()
+
+	// A repeat, a late sync older than the loaded window, a late sync
+	// inside it, and a new message
+	synced := msg(101)
+	synced.Date = at.Add(20*time.Minute + 30*time.Second)
+	early := msg(102)
+	early.Date = at
+	if n := m.appendFollowed([]chatdb.Message{msg(40), early, synced, msg(41)}); n != 2 {
+		t.Fatalf("added %d, want 2", n)
+	}
+	if got := m.messages[11].ROWID; got != 101 {
+		t.Errorf("synced message landed at ROWID %d's place", got)
+	}
+	if got := m.messages[len(m.messages)-1].ROWID; got != 41 {
+		t.Errorf("last message = %d, want 41", got)
+	}
+	if m.activeMsgCount != 102 {
+		t.Errorf("total = %d, want 102", m.activeMsgCount)
+	}
+	if !m.viewport.AtBottom() {
+		t.Error("view should stay at the bottom")
+	}
+}
+
+func TestApplyFollowedReactions(t *testing.T) {
+	m := model{viewport: viewport.New(100, 10), contacts: &chatdb.ContactBook{}, selectAnchor: -1, focus: -1}
+	m.messages = []chatdb.Message{
+		{ROWID: 1, GUID: "g1", Text: "Dinner?", Sender: "+15551234567"},
+		{ROWID: 2, GUID: "g2", Text: "Sure", IsFromMe: true, Reactions: []chatdb.Reaction{{Type: 2001, Sender: "+15551234567"}}},
+		{ROWID: 3, GUID: "g3", Text: "Loaded after the poll started", IsFromMe: true, Reactions: []chatdb.Reaction{{Type: 2003, Sender: "+15551234567"}}},
+	}
+	m.viewport.SetContent(m.renderMessages()) // fills the block cache
+	loved := []chatdb.Reaction{{Type: 2000, Sender: "+15551234567"}}
+	if !m.applyFollowedReactions(map[int][]chatdb.Reaction{1: loved, 2: nil}) {
+		t.Fatal("a new tapback and a removed one should count as changes")
+	}
+	if r := m.messages[0].Reactions; len(r) != 1 || r[0].Type != 2000 {
+		t.Errorf("new tapback not applied: %+v", r)
+	}
+	if r := m.messages[1].Reactions; len(r) != 0 {
+		t.Errorf("removed tapback still shown: %+v", r)
+	}
+	if r := m.messages[2].Reactions; len(r) != 1 {
+		t.Errorf("a message the poll didn't cover lost its reactions: %+v", r)
+	}
+	if !strings.Contains(ansi.Strip(m.viewport.View()), "❤") {
+		t.Error("the new tapback should be rendered")
+	}
+	if m.applyFollowedReactions(map[int][]chatdb.Reaction{1: loved, 2: nil}) {
+		t.Error("the same reactions again shouldn't count as a change")
+	}
+}
+
+func TestFollowIgnoresStaleTicks(t *testing.T) {
+	m := model{viewport: viewport.New(100, 10), contacts: &chatdb.ContactBook{}, focus: -1}
+	if cmd := m.toggleFollow(); cmd == nil || !m.following {
+		t.Fatal("toggling on should schedule a poll")
+	}
+	stale := followTickMsg{gen: m.followGen}
+	m.toggleFollow()
+	m.toggleFollow()
+	if _, cmd := m.Update(stale); cmd != nil {
+		t.Error("a tick from an earlier follow session should be dropped")
+	}
+}
+
+func TestRenderScrollbar(t *testing.T) {
+	thumb := func(bar string) (top, length int) {
+		top = -1
+		for i, line := range strings.Split(ansi.Strip(bar), "\n") {
+			if line == "┃" {
+				if top < 0 {
+					top = i
+				}
+				length++
+			}
+		}
+		return top, length
+	}
+	tests := []struct {
+		name                string
+		height, total, off  int
+		wantTop, wantLength int
+	}{
+		{"fits", 10, 8, 0, -1, 0},
+		{"top", 10, 40, 0, 0, 2},
+		{"bottom", 10, 40, 30, 8, 2},
+		{"middle", 10, 40, 15, 4, 2},
+		{"past the end", 10, 40, 99, 8, 2},
+		{"huge content", 10, 100000, 50000, 5, 1},
+	}
+	for _, tt := range tests {
+		bar := renderScrollbar(tt.height, tt.total, tt.off)
+		if n := strings.Count(bar, "\n") + 1; n != tt.height {
+			t.Errorf("%s: %d lines, want %d", tt.name, n, tt.height)
+		}
+		if top, length := thumb(bar); top != tt.wantTop || length != tt.wantLength {
+			t.Errorf("%s: thumb at %d, %d long; want %d, %d long", tt.name, top, length, tt.wantTop, tt.wantLength)
+		}
+	}
+}
+
+func TestSenderStyles(t *testing.T) {
+	if senderStyles([]string{"+15551234567"}) != nil {
+		t.Error("a one-on-one chat should keep the default sender color")
+	}
+	group := []string{"+15551234567", "+15559876543", "Jane@Example.com", "+447700900123"}
+	styles := senderStyles(group)
+	seen := map[lipgloss.TerminalColor]string{}
+	for _, h := range group {
+		style, ok := styles[strings.ToLower(h)]
+		if !ok {
+			t.Fatalf("no style for %s", h)
+		}
+		color := style.GetForeground()
+		if other, dup := seen[color]; dup {
+			t.Errorf("%s and %s share a color", h, other)
+		}
+		seen[color] = h
+	}
+
+	// The same people in another order keep their colors
+	again := senderStyles([]string{"+447700900123", "jane@example.com", "+15559876543", "+15551234567"})
+	for h, style := range styles {
+		if again[h].GetForeground() != style.GetForeground() {
+			t.Errorf("%s changed color", h)
+		}
+	}
+
+	m := model{senderColors: styles}
+	if m.senderStyle("JANE@example.com").GetForeground() != styles["jane@example.com"].GetForeground() {
+		t.Error("sender lookup should ignore case")
+	}
+	if m.senderStyle("+10000000000").GetForeground() != fromThemStyle.GetForeground() {
+		t.Error("an unknown sender should fall back to the default color")
+	}
+}
+
+func TestOpenLatestAttachment(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	m := model{store: chatdb.NewStore(db), chatCtx: t.Context(), activeChatID: 1}
+
+	// The fixture's files aren't on disk, so the newest one is reported
+	// rather than opened
+	msg := m.openLatestAttachmentCmd()().(attachmentOpenedMsg)
+	if msg.err != nil || msg.status != "menu.pdf is no longer on disk" {
+		t.Errorf("chat 1: got %+v", msg)
+	}
+	m.activeChatID = 2
+	msg = m.openLatestAttachmentCmd()().(attachmentOpenedMsg)
+	if msg.status != "No attachments in this conversation" {
+		t.Errorf("chat 2: got %+v", msg)
+	}
+}
+
+func TestHandleView(t *testing.T) {
+	chat := []chatdb.Message{
+		{ROWID: 1, Text: "hi", IsFromMe: true},
+		{ROWID: 2, Text: "hello", Sender: "+15551234567"},
+	}
+	m := model{
+		viewport:           viewport.New(100, 10),
+		contacts:           &chatdb.ContactBook{},
+		state:              viewMessages,
+		activeChatID:       3,
+		activeParticipants: []string{"+15551234567", "+15559876543"},
+		messages:           chat,
+		focus:              0,
+		selectAnchor:       -1,
+	}
+	if m.toggleHandleView(); m.handleView != "" {
+		t.Fatal("a message from me in a group names nobody to show")
+	}
+	m.focus = 1
+	if cmd := m.toggleHandleView(); cmd == nil || m.handleView != "+15551234567" {
+		t.Fatalf("handle view = %q, want the focused sender", m.handleView)
+	}
+
+	// A page of the chat itself, still in flight, mustn't land in the view
+	updated, _ := m.Update(messagesLoadedMsg{chatID: 3, messages: chat})
+	m = updated.(model)
+	if len(m.messages) != 0 {
+		t.Errorf("a chat page replaced the handle view: %+v", m.messages)
+	}
+	across := []chatdb.Message{{ROWID: 7, Text: "elsewhere", Sender: "+15551234567"}}
+	updated, _ = m.Update(messagesLoadedMsg{chatID: 3, handle: "+15551234567", messages: across})
+	m = updated.(model)
+	if len(m.messages) != 1 || m.messages[0].ROWID != 7 || !m.allLoaded {
+		t.Errorf("handle view messages = %+v, all loaded %v", m.messages, m.allLoaded)
+	}
+
+	m.toggleHandleView()
+	if m.handleView != "" || m.threadReturn != nil || len(m.messages) != 2 || m.focus != 1 {
+		t.Errorf("leaving should restore the chat: view %q, %d messages, focus %d", m.handleView, len(m.messages), m.focus)
+	}
+
+	// Leaving before the first page arrives mustn't leave the chat loading
+	m.toggleHandleView()
+	m.toggleHandleView()
+	updated, _ = m.Update(messagesLoadedMsg{chatID: 3, handle: "+15551234567", messages: across})
+	m = updated.(model)
+	if m.loading || len(m.messages) != 2 {
+		t.Errorf("after a late page: loading %v, %d messages", m.loading, len(m.messages))
+	}
+}
+
+func TestFromStart(t *testing.T) {
+	db := chatdbtest.NewDB(t)
+	defer db.Close()
+	chat := []chatdb.Message{{ROWID: 9, Text: "latest"}}
+	m := model{
+		viewport:     viewport.New(100, 10),
+		contacts:     &chatdb.ContactBook{},
+		store:        chatdb.NewStore(db),
+		chatCtx:      t.Context(),
+		state:        viewMessages,
+		activeChatID: 1,
+		messages:     chat,
+		focus:        0,
+		selectAnchor: -1,
+	}
+	cmd := m.toggleFromStart()
+	if cmd == nil || !m.fromStart || len(m.messages) != 0 || !m.allLoaded {
+		t.Fatalf("from start = %v with %d messages", m.fromStart, len(m.messages))
+	}
+
+	// A backward page still in flight mustn't land in the forward view
+	updated, _ := m.Update(messagesLoadedMsg{chatID: 1, messages: chat})
+	m = updated.(model)
+	if len(m.messages) != 0 {
+		t.Errorf("a backward page replaced the forward view: %+v", m.messages)
+	}
+
+	// The fixture's 10 messages are one short page, so the end is reached
+	updated, _ = m.Update(cmd())
+	m = updated.(model)
+	if len(m.messages) != 10 || m.focus != 0 || !m.endLoaded || m.viewport.YOffset != 0 {
+		t.Fatalf("first page: %d messages, focus %d, end %v, offset %d", len(m.messages), m.focus, m.endLoaded, m.viewport.YOffset)
+	}
+	if m.messages[0].Text != "Hey, how are you?" {
+		t.Errorf("first message = %q", m.messages[0].Text)
+	}
+
+	// A later page is appended below without moving the reader
+	m.endLoaded = false
+	m.viewport.SetYOffset(3)
+	more := []chatdb.Message{{ROWID: 50, Text: "later"}}
+	updated, _ = m.Update(messagesLoadedMsg{chatID: 1, forward: true, messages: more})
+	m = updated.(model)
+	if len(m.messages) != 11 || m.newestCursor.ROWID != 50 || m.viewport.YOffset != 3 {
+		t.Errorf("next page: %d messages, cursor %+v, offset %d", len(m.messages), m.newestCursor, m.viewport.YOffset)
+	}
+
+	m.toggleFromStart()
+	if m.fromStart || m.threadReturn != nil || len(m.messages) != 1 || m.messages[0].ROWID != 9 {
+		t.Errorf("leaving should restore the chat: from start %v, %d messages", m.fromStart, len(m.messages))
+	}
+
+	// B then B again before the first page arrives drops the page and
+	// leaves the chat able to load
+	cmd = m.toggleFromStart()
+	m.toggleFromStart()
+	updated, _ = m.Update(cmd())
+	m = updated.(model)
+	if m.loading || m.fromStart || len(m.messages) != 1 {
+		t.Errorf("after a late forward page: loading %v, from start %v, %d messages", m.loading, m.fromStart, len(m.messages))
+	}
+}
+
+func TestAttachmentFiltersLayer(t *testing.T) {
+	m := model{
+		attachmentList: list.New(nil, list.NewDefaultDelegate(), 80, 20),
+		contacts:       &chatdb.ContactBook{},
+		attachmentData: []chatdb.ChatAttachment{
+			{ROWID: 1, Filename: "IMG_0001.HEIC", TypeLabel: "photo"},
+			{ROWID: 2, Filename: "IMG_0002.MOV", TypeLabel: "video"},
+			{ROWID: 3, Filename: "IMG_0003.HEIC", TypeLabel: "photo"},
+			{ROWID: 4, Filename: "beach.jpeg", TypeLabel: "photo"},
+		},
+		attachTypeFilter: "photo",
+		state:            viewAttachments,
+	}
+	m.applyAttachmentView()
+	m.attachmentList.SetFilterText("IMG")
+	m.updateAttachmentTitle()
+
+	var got []int
+	for _, item := range m.attachmentList.VisibleItems() {
+		got = append(got, item.(attachmentItem).attachment.ROWID)
+	}
+	if want := []int{1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("visible = %v, want %v", got, want)
+	}
+	if want := `Attachments — 2 of 3 files (photo, "IMG")`; m.attachmentList.Title != want {
+		t.Errorf("title = %q, want %q", m.attachmentList.Title, want)
+	}
+
+	// Changing the type keeps the typed filter applied
+	m.attachTypeFilter = "video"
+	refilter := m.applyAttachmentView()
+	updated, _ := m.Update(refilter())
+	m = updated.(model)
+	if want := `Attachments — 1 of 1 files (video, "IMG")`; m.attachmentList.Title != want {
+		t.Errorf("after type change, title = %q, want %q", m.attachmentList.Title, want)
+	}
+}
+
+func TestAttachmentListExportPrivacy(t *testing.T) {
+	m := model{
+		attachmentList: list.New(nil, list.NewDefaultDelegate(), 80, 20),
+		contacts:       &chatdb.ContactBook{},
+		state:          viewAttachments,
+		opts:           modelOptions{exportPrivacy: exportPrivacy{anonymize: true}},
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	if updated.(model).exporting {
+		t.Error("the attachment list can't be anonymized, so it shouldn't export")
+	}
+}
+
+func TestVisibleAttachmentPaths(t *testing.T) {
+	m := model{
+		attachmentList: list.New(nil, list.NewDefaultDelegate(), 80, 20),
+		contacts:       &chatdb.ContactBook{},
+		attachmentData: []chatdb.ChatAttachment{
+			{ROWID: 1, FilePath: "/a/IMG_0001.HEIC", TypeLabel: "photo", Size: 10},
+			{ROWID: 2, FilePath: "/a/IMG_0002.MOV", TypeLabel: "video", Size: 500},
+			{ROWID: 3, FilePath: "/a/IMG_0003.HEIC", TypeLabel: "photo", Size: 30},
+			{ROWID: 4, FilePath: "", TypeLabel: "photo", Size: 20},
+		},
+		attachTypeFilter: "photo",
+		attachSortBySize: true,
+		state:            viewAttachments,
+	}
+	m.applyAttachmentView()
+
+	got := m.visibleAttachmentPaths()
+	if want := []string{"/a/IMG_0003.HEIC", "/a/IMG_0001.HEIC"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("paths = %q, want %q", got, want)
+	}
+}
+
+func TestMessagesAppURL(t *testing.T) {
+	if got := messagesAppURL("iMessage", "+15551234567"); got != "imessage:+15551234567" {
+		t.Errorf("iMessage: got %q", got)
+	}
+	if got := messagesAppURL("SMS", "+15551234567"); got != "sms:+15551234567" {
+		t.Errorf("SMS: got %q", got)
+	}
+}
+
+func TestFormatSummary(t *testing.T) {
+	sum := chatdb.DatabaseSummary{
+		Conversations: 3, Messages: 23, Attachments: 4,
+		First: time.Date(2024, 6, 15, 10, 0, 0, 0, time.Local),
+		Last:  time.Date(2024, 6, 15, 10, 47, 0, 0, time.Local),
+	}
+	if got, want := formatSummary(sum), "3 conversations, 23 messages, 4 attachments, spanning Jun 2024"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	sum.Last = time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local)
+	if got := formatSummary(sum); !strings.HasSuffix(got, "spanning Jun 2024 – Mar 2025") {
+		t.Errorf("multi-month span: got %q", got)
+	}
+
+	if got := formatSummary(chatdb.DatabaseSummary{}); got != "0 conversations, 0 messages, 0 attachments" {
+		t.Errorf("empty: got %q", got)
+	}
+}
+
+func TestContactsWarning(t *testing.T) {
+	tempStateDir(t)
+	if got := contactsWarning(nil); got != "" {
+		t.Errorf("no error: got %q", got)
+	}
+	denied := fmt.Errorf("reading AddressBook-v22.abcddb: %w", fs.ErrPermission)
+	if got := contactsWarning(denied); !strings.Contains(got, "Full Disk Access") {
+		t.Errorf("permission error: got %q", got)
+	}
+	m := NewModel(t.Context(), nil, &chatdb.ContactBook{})
+	m.contactsWarning, m.width = contactsWarning(denied), 100
+	if !strings.Contains(ansi.Strip(m.View()), "Full Disk Access") {
+		t.Error("the conversation list should show the warning")
+	}
+	updated, _ := m.updateConversationList(tea.KeyMsg{Type: tea.KeyDown})
+	if updated.(model).contactsWarning != "" {
+		t.Error("a key press should dismiss the warning")
+	}
+}
+
+func TestConversationsLoading(t *testing.T) {
+	tempStateDir(t)
+	m := NewModel(t.Context(), nil, &chatdb.ContactBook{})
+	m.width, m.height = 100, 30
+	if !strings.Contains(ansi.Strip(m.View()), "Loading conversations") {
+		t.Error("the conversation list should show a spinner until it loads")
+	}
+	updated, _ := m.Update(conversationsLoadedMsg{})
+	m = updated.(model)
+	if strings.Contains(ansi.Strip(m.View()), "Loading conversations") {
+		t.Error("the spinner should go once the list has loaded")
+	}
+	if _, cmd := m.Update(m.spinner.Tick()); cmd != nil {
+		t.Error("the spinner should stop ticking once the list has loaded")
+	}
+}
+
+func TestErrorScreenHint(t *testing.T) {
+	m := model{err: &chatdb.DBError{Kind: chatdb.ErrDatabaseLocked, Err: errors.New("database is locked (5) (SQLITE_BUSY)")}}
+	out := m.View()
+	if !strings.Contains(out, "SQLITE_BUSY") || !strings.Contains(out, "Try again in a moment") {
+		t.Errorf("a locked database should be explained:\n%s", out)
+	}
+	m.err = errors.New("something else")
+	if out := m.View(); strings.Count(out, "\n\n") != 1 {
+		t.Errorf("an unknown error gets no hint:\n%s", out)
+	}
+}
+
+func TestTerminalTooSmall(t *testing.T) {
+	tempStateDir(t)
+	var m tea.Model = NewModel(t.Context(), nil, &chatdb.ContactBook{})
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 30, Height: 8})
+	if got := ansi.Strip(m.View()); !strings.Contains(got, "Terminal too small (30×8)") || !strings.Contains(got, "40×10") {
+		t.Errorf("small terminal: got %q", got)
+	}
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+	if strings.Contains(ansi.Strip(m.View()), "too small") {
+		t.Error("growing the terminal should bring the layout back")
+	}
+}
+
+func TestGotoConversation(t *testing.T) {
+	tempStateDir(t)
+	m := NewModel(t.Context(), nil, &chatdb.ContactBook{})
+	m.width, m.height = 100, 30
+	var convs []chatdb.Conversation
+	for i := 1; i <= 12; i++ {
+		convs = append(convs, chatdb.Conversation{ChatID: i, DisplayName: fmt.Sprintf("Chat %d", i)})
+	}
+	updated, _ := m.Update(conversationsLoadedMsg{conversations: convs})
+	m = updated.(model)
+
+	press := func(key string) {
+		t.Helper()
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		switch key {
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		case "backspace":
+			msg = tea.KeyMsg{Type: tea.KeyBackspace}
+		}
+		updated, _ := m.updateConversationList(msg)
+		m = updated.(model)
+	}
+	press("1")
+	press("2")
+	if m.gotoInput != "12" || m.convList.Index() != 11 {
+		t.Fatalf("after 1 2: input %q, index %d", m.gotoInput, m.convList.Index())
+	}
+	if !strings.Contains(ansi.Strip(m.View()), "Go to #12") {
+		t.Error("the pending number should show above the list")
+	}
+	press("3")
+	if m.gotoInput != "12" || m.convList.Index() != 11 {
+		t.Errorf("a number past the end should be ignored: input %q, index %d", m.gotoInput, m.convList.Index())
+	}
+	press("backspace")
+	if m.gotoInput != "1" || m.convList.Index() != 0 {
+		t.Errorf("after backspace: input %q, index %d", m.gotoInput, m.convList.Index())
+	}
+	press("esc")
+	if m.gotoInput != "" || m.convList.Index() != 0 {
+		t.Errorf("esc should cancel: input %q, index %d", m.gotoInput, m.convList.Index())
+	}
+	press("0")
+	if m.gotoInput != "" {
+		t.Errorf("there is no conversation 0: input %q", m.gotoInput)
+	}
+}
+
+func TestHeaderUnknownCountry(t *testing.T) {
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "John Doe", Phones: []string{"5551234567"}})
+	conv := chatdb.Conversation{
+		ChatID:       3,
+		Participants: []string{"+15551234567", "+447700900123"},
+		Countries:    map[string]string{"+15551234567": "us", "+447700900123": "gb"},
+	}
+	m := model{
+		contacts:           contacts,
+		convItems:          []chatdb.Conversation{conv},
+		activeChatID:       3,
+		activeParticipants: conv.Participants,
+		width:              100,
+		height:             40,
+	}
+
+	header := ansi.Strip(m.buildMessageHeader())
+	if !strings.Contains(header, "+447700900123  GB") {
+		t.Errorf("unknown number should show its country:\n%s", header)
+	}
+	if strings.Contains(header, "US") {
+		t.Errorf("resolved contacts don't need a country:\n%s", header)
+	}
+}
+
+func TestHeaderParticipants(t *testing.T) {
+	participants := make([]string, 12)
+	for i := range participants {
+		participants[i] = fmt.Sprintf("+1555000%04d", i)
+	}
+	m := model{activeParticipants: participants, height: 40}
+
+	if shown, more := m.headerParticipants(); shown != headerParticipantLimit || more != 7 {
+		t.Errorf("collapsed: got %d shown, %d more", shown, more)
+	}
+
+	m.expandHeader = true
+	if shown, more := m.headerParticipants(); shown != 12 || more != 0 {
+		t.Errorf("expanded: got %d shown, %d more", shown, more)
+	}
+
+	// A short terminal keeps the viewport usable even when expanded
+	m.height = 20
+	if h := calcViewportHeight(m.height, m.headerParticipantLines()); h < minViewportHeight {
+		t.Errorf("viewport collapsed to %d lines", h)
+	}
+}
+
+func TestHeaderContactDetails(t *testing.T) {
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{
+		Name:   "John Doe",
+		Phones: []string{"5551234567", "5559876543", "5550001111"},
+		Emails: []string{"john@example.com", "jd@work.example.com"},
+	})
+	conv := chatdb.Conversation{ChatID: 1, Participants: []string{"+15551234567"}}
+	m := model{
+		contacts:           contacts,
+		convItems:          []chatdb.Conversation{conv},
+		activeChatID:       1,
+		activeParticipants: conv.Participants,
+		width:              50,
+		height:             40,
+	}
+
+	lines := m.participantLines("+15551234567", conv, m.headerLineWidth())
+	if len(lines) != 1 {
+		t.Fatalf("collapsed: got %d lines, want 1", len(lines))
+	}
+	if want := " John Doe: 5551234567, 5559876543, … +3 more"; lines[0] != want {
+		t.Errorf("collapsed: got %q, want %q", lines[0], want)
+	}
+
+	m.expandHeader = true
+	lines = m.participantLines("+15551234567", conv, m.headerLineWidth())
+	joined := strings.Join(lines, "\n")
+	for _, id := range []string{"5550001111", "john@example.com", "jd@work.example.com"} {
+		if !strings.Contains(joined, id) {
+			t.Errorf("expanded header missing %s:\n%s", id, joined)
+		}
+	}
+	for _, l := range lines {
+		if w := ansi.StringWidth(l); w > m.headerLineWidth() {
+			t.Errorf("line %q is %d wide, over %d", l, w, m.headerLineWidth())
+		}
+	}
+	if got := m.headerParticipantLines(); got != len(lines) {
+		t.Errorf("header lines: got %d, want %d", got, len(lines))
+	}
+}
+
+func TestSplitLayout(t *testing.T) {
+	tempStateDir(t)
+	var m tea.Model = NewModel(t.Context(), nil, &chatdb.ContactBook{})
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 160, Height: 30})
+	var convs []chatdb.Conversation
+	for i := 1; i <= 3; i++ {
+		convs = append(convs, chatdb.Conversation{ChatID: i, DisplayName: fmt.Sprintf("Chat %d", i)})
+	}
+	m, cmd := m.Update(conversationsLoadedMsg{conversations: convs})
+	got := m.(model)
+	if cmd == nil || got.state != viewConversations || got.previewID != 1 || got.activeChatID != 1 {
+		t.Fatalf("loading the list should preview the first chat: state %v, preview %d", got.state, got.previewID)
+	}
+	m, _ = m.Update(messagesLoadedMsg{chatID: 1, messages: []chatdb.Message{{ROWID: 1, Text: "first chat's message"}}})
+	view := ansi.Strip(m.View())
+	if !strings.Contains(view, "Chat 2") || !strings.Contains(view, "first chat's message") {
+		t.Errorf("the list and the preview should show side by side:\n%s", view)
+	}
+	if width := m.(model).viewport.Width; width >= 160-4-m.(model).convListWidth() {
+		t.Errorf("the message viewport should fit beside the list: width %d", width)
+	}
+
+	m, cmd = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	got = m.(model)
+	if cmd == nil || got.state != viewConversations || got.previewID != 2 || len(got.messages) != 0 {
+		t.Fatalf("moving the selection should preview the next chat: state %v, preview %d", got.state, got.previewID)
+	}
+
+	m, cmd = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	got = m.(model)
+	if got.state != viewMessages || got.activeChatID != 2 || !got.loading {
+		t.Errorf("enter should hand the keys to the preview without reloading it: state %v, chat %d", got.state, got.activeChatID)
+	}
+	if !strings.Contains(ansi.Strip(m.View()), "esc: back to the list") {
+		t.Error("the list should stay beside the open chat")
+	}
+	m, cmd = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	got = m.(model)
+	if cmd == nil || got.state != viewConversations || got.previewID != 2 {
+		t.Errorf("esc should go back to the list and keep previewing: state %v, preview %d", got.state, got.previewID)
+	}
+
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	got = m.(model)
+	if got.split() || got.convList.Width() != 96 || strings.Contains(ansi.Strip(m.View()), "Preview") {
+		t.Error("a narrower terminal should fall back to the list alone")
+	}
+	m, cmd = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd == nil || m.(model).state != viewMessages {
+		t.Error("enter without the split should open the chat")
+	}
+}
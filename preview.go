@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+const (
+	previewMaxBytes = 16 << 10 // read no more of a file than this
+	previewMaxLines = 10
+)
+
+// errNotText marks files that claim a text type but hold binary data.
+var errNotText = errors.New("not a text file")
+
+// isTextPreviewable reports whether a is a contact card or plain text note
+// worth showing inline.
+func isTextPreviewable(a chatdb.ChatAttachment) bool {
+	switch strings.ToLower(a.MimeType) {
+	case "text/vcard", "text/x-vcard", "text/directory", "text/plain":
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(a.FilePath)) {
+	case ".vcf", ".txt":
+		return true
+	}
+	return false
+}
+
+// readTextPreview returns the first lines of the text file at path. Only
+// the start of a large file is read. Contact cards are summarized as name,
+// phone, and email lines instead of raw vCard fields.
+func readTextPreview(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, previewMaxBytes))
+	if err != nil {
+		return "", err
+	}
+	if len(data) == previewMaxBytes {
+		// Cut at a line end so a multibyte character isn't split
+		if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+			data = data[:i]
+		}
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return "", errNotText
+	}
+
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(text)), "BEGIN:VCARD") {
+		text = summarizeVCard(text)
+	}
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > previewMaxLines {
+		lines = append(lines[:previewMaxLines], "…")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// summarizeVCard turns vCard text into readable lines, e.g. "Name  Jane
+// Doe" and "Phone +15551234567", with a blank line between cards.
+func summarizeVCard(text string) string {
+	// Folded lines continue with a leading space or tab
+	text = strings.NewReplacer("\n ", "", "\n\t", "").Replace(text)
+
+	labels := map[string]string{"FN": "Name", "TEL": "Phone", "EMAIL": "Email", "ORG": "Company"}
+	var out []string
+	for _, line := range strings.Split(text, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.ToUpper(key), ";")
+		if name == "END" && len(out) > 0 {
+			out = append(out, "")
+			continue
+		}
+		if label, ok := labels[name]; ok && value != "" {
+			out = append(out, label+strings.Repeat(" ", 8-len(label))+vcardUnescape(value))
+		}
+	}
+	return strings.TrimRight(strings.Join(out, "\n"), "\n")
+}
+
+// vcardUnescape reverses vcardEscape.
+func vcardUnescape(s string) string {
+	return strings.NewReplacer(`\n`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// renderPreview draws the selected attachment's preview in a box as wide as
+// the attachment list.
+func (m model) renderPreview() string {
+	width := m.attachmentList.Width() - detailStyle.GetHorizontalFrameSize()
+	var body string
+	switch {
+	case !m.preview.loaded:
+		body = helpStyle.Render("Loading preview...")
+	case errors.Is(m.preview.err, errNotText):
+		body = helpStyle.Render("Binary file; press enter to open it")
+	case m.preview.err != nil:
+		body = helpStyle.Render(fmt.Sprintf("Can't preview: %v", m.preview.err))
+	case m.preview.text == "":
+		body = helpStyle.Render("Empty file")
+	default:
+		lines := strings.Split(m.preview.text, "\n")
+		for i, line := range lines {
+			lines[i] = ansi.Truncate(line, width, "…")
+		}
+		body = strings.Join(lines, "\n")
+	}
+	return detailStyle.Width(width + detailStyle.GetHorizontalPadding()).Render(body)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+func TestIsTextPreviewable(t *testing.T) {
+	tests := []struct {
+		a    chatdb.ChatAttachment
+		want bool
+	}{
+		{chatdb.ChatAttachment{MimeType: "text/vcard", FilePath: "/a/Jane Doe.vcf"}, true},
+		{chatdb.ChatAttachment{MimeType: "text/x-vCard"}, true},
+		{chatdb.ChatAttachment{FilePath: "/a/notes.TXT"}, true}, // no MIME type recorded
+		{chatdb.ChatAttachment{MimeType: "image/jpeg", FilePath: "/a/IMG_1.jpeg"}, false},
+		{chatdb.ChatAttachment{MimeType: "application/pdf", FilePath: "/a/menu.pdf"}, false},
+	}
+	for _, tt := range tests {
+		if got := isTextPreviewable(tt.a); got != tt.want {
+			t.Errorf("isTextPreviewable(%q, %q) = %v, want %v", tt.a.MimeType, tt.a.FilePath, got, tt.want)
+		}
+	}
+}
+
+func TestReadTextPreview(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("vcard", func(t *testing.T) {
+		path := write("jane.vcf", "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Doe;Jane;;;\r\nFN:Jane Doe\r\n"+
+			"TEL;type=CELL;type=VOICE:+15551234567\r\nEMAIL;type=INTERNET:jane@exam\r\n ple.com\r\n"+
+			"ORG:Acme\\, Inc.\r\nEND:VCARD\r\n")
+		got, err := readTextPreview(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "Name    Jane Doe\nPhone   +15551234567\nEmail   jane@example.com\nCompany Acme, Inc."
+		if got != want {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	})
+
+	t.Run("long_text", func(t *testing.T) {
+		path := write("notes.txt", strings.Repeat("line\n", previewMaxLines+5))
+		got, err := readTextPreview(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(got, "\n")
+		if len(lines) != previewMaxLines+1 || lines[len(lines)-1] != "…" {
+			t.Errorf("got %d lines ending %q, want %d and an ellipsis", len(lines), lines[len(lines)-1], previewMaxLines+1)
+		}
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		path := write("photo.txt", "\xff\xd8\xff\xe0\x00\x10JFIF")
+		if _, err := readTextPreview(path); !errors.Is(err, errNotText) {
+			t.Errorf("err = %v, want errNotText", err)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if _, err := readTextPreview(filepath.Join(dir, "gone.vcf")); err == nil {
+			t.Error("expected an error for a missing file")
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+// reactionGroup is every reaction on a message that shares an emoji.
+type reactionGroup struct {
+	emoji string
+	names []string
+}
+
+// groupReactions aggregates reactions by emoji, most common first; ties keep
+// the order the emoji first appeared.
+func groupReactions(reactions []chatdb.Reaction, contacts *chatdb.ContactBook) []reactionGroup {
+	var groups []reactionGroup
+	index := map[string]int{}
+	for _, r := range reactions {
+		e := r.Glyph()
+		i, ok := index[e]
+		if !ok {
+			i = len(groups)
+			index[e] = i
+			groups = append(groups, reactionGroup{emoji: e})
+		}
+		name := "Me"
+		if !r.IsFromMe {
+			name = contacts.ResolveName(r.Sender)
+			if name == "" {
+				name = "Unknown"
+			}
+		}
+		groups[i].names = append(groups[i].names, name)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].names) > len(groups[j].names)
+	})
+	return groups
+}
+
+// formatReactionCounts renders groups as compact counters, e.g. "❤️3 👍2 😂1".
+func formatReactionCounts(groups []reactionGroup) string {
+	parts := make([]string, len(groups))
+	for i, g := range groups {
+		parts[i] = fmt.Sprintf("%s%d", g.emoji, len(g.names))
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatReactionNames renders groups with who reacted, e.g.
+// "❤️ Alice, Me  👍 Bob".
+func formatReactionNames(groups []reactionGroup) string {
+	parts := make([]string, len(groups))
+	for i, g := range groups {
+		parts[i] = g.emoji + " " + strings.Join(g.names, ", ")
+	}
+	return strings.Join(parts, "  ")
+}
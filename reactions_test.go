@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+func TestGroupReactions(t *testing.T) {
+	contacts := &chatdb.ContactBook{}
+	contacts.Add(&chatdb.Contact{Name: "Alice", Phones: []string{"5551234567"}})
+	contacts.Add(&chatdb.Contact{Name: "Bob", Emails: []string{"bob@example.com"}})
+	reactions := []chatdb.Reaction{
+		{Type: 2001, Sender: "bob@example.com"},
+		{Type: 2000, Sender: "+15551234567"},
+		{Type: 2000, IsFromMe: true},
+		{Type: 2006, Emoji: "🎉", Sender: "+15559999999"},
+		{Type: 2000, Sender: "+15559999999"},
+	}
+	groups := groupReactions(reactions, contacts)
+
+	if got, want := formatReactionCounts(groups), "❤️3 👍1 🎉1"; got != want {
+		t.Errorf("counts: got %q, want %q", got, want)
+	}
+	if got, want := formatReactionNames(groups), "❤️ Alice, Me, +15559999999  👍 Bob  🎉 +15559999999"; got != want {
+		t.Errorf("names: got %q, want %q", got, want)
+	}
+}
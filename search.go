@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+// defaultSearchLimit is how many matches a search fetches at a time when
+// --search-limit isn't given.
+const defaultSearchLimit = 100
+
+// searchSortMode controls the client-side ordering of search results.
+type searchSortMode int
+
+const (
+	sortDateDesc searchSortMode = iota
+	sortDateAsc
+	sortRelevance
+	sortChat
+	numSearchSortModes
+)
+
+func (s searchSortMode) String() string {
+	switch s {
+	case sortDateAsc:
+		return "oldest first"
+	case sortRelevance:
+		return "relevance"
+	case sortChat:
+		return "conversation"
+	default:
+		return "newest first"
+	}
+}
+
+// next cycles to the following sort mode.
+func (s searchSortMode) next() searchSortMode {
+	return (s + 1) % numSearchSortModes
+}
+
+// searchDateFilter limits search to a recent period of the local calendar.
+type searchDateFilter int
+
+const (
+	anyDate searchDateFilter = iota
+	dateToday
+	dateYesterday
+	dateLastWeek
+	dateThisMonth
+	numSearchDateFilters
+)
+
+func (f searchDateFilter) String() string {
+	switch f {
+	case dateToday:
+		return "today"
+	case dateYesterday:
+		return "yesterday"
+	case dateLastWeek:
+		return "last 7 days"
+	case dateThisMonth:
+		return "this month"
+	default:
+		return "any date"
+	}
+}
+
+// next cycles to the following date filter.
+func (f searchDateFilter) next() searchDateFilter {
+	return (f + 1) % numSearchDateFilters
+}
+
+// bounds returns the period f covers as of now, for the ranged search. A
+// zero bound is open; anyDate leaves both open. The last 7 days are today
+// and the six days before it.
+func (f searchDateFilter) bounds(now time.Time) (from, to time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch f {
+	case dateToday:
+		return today, time.Time{}
+	case dateYesterday:
+		return today.AddDate(0, 0, -1), today.Add(-time.Nanosecond)
+	case dateLastWeek:
+		return today.AddDate(0, 0, -6), time.Time{}
+	case dateThisMonth:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()), time.Time{}
+	}
+	return time.Time{}, time.Time{}
+}
+
+// nextChatScope cycles the search scope: all chats, direct, then groups.
+func nextChatScope(sc chatdb.ChatScope) chatdb.ChatScope {
+	switch sc {
+	case chatdb.ScopeAll:
+		return chatdb.ScopeDirect
+	case chatdb.ScopeDirect:
+		return chatdb.ScopeGroups
+	default:
+		return chatdb.ScopeAll
+	}
+}
+
+// relevanceTerms are the texts relevance sorting counts for a query: its
+// clauses that must match, without quotes, lowercased.
+func relevanceTerms(query string) []string {
+	var terms []string
+	for _, c := range chatdb.ParseQuery(query) {
+		if !c.Negate {
+			terms = append(terms, strings.ToLower(c.Text))
+		}
+	}
+	return terms
+}
+
+// sortSearchResults returns a sorted copy of results. Relevance ranks by the
+// number of occurrences of the query's required terms in the text, then by
+// earliest match position. Ties always fall back to newest first.
+func sortSearchResults(results []chatdb.SearchResult, mode searchSortMode, term string) []chatdb.SearchResult {
+	sorted := make([]chatdb.SearchResult, len(results))
+	copy(sorted, results)
+
+	terms := relevanceTerms(term)
+	relevance := func(r chatdb.SearchResult) (count, pos int) {
+		text := strings.ToLower(r.Text)
+		pos = len(text)
+		for _, t := range terms {
+			count += strings.Count(text, t)
+			if i := strings.Index(text, t); i >= 0 {
+				pos = min(pos, i)
+			}
+		}
+		return count, pos
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		switch mode {
+		case sortDateAsc:
+			return a.Date.Before(b.Date)
+		case sortRelevance:
+			ca, pa := relevance(a)
+			cb, pb := relevance(b)
+			if ca != cb {
+				return ca > cb
+			}
+			if pa != pb {
+				return pa < pb
+			}
+		case sortChat:
+			if a.ChatName != b.ChatName {
+				return strings.ToLower(a.ChatName) < strings.ToLower(b.ChatName)
+			}
+		}
+		return a.Date.After(b.Date)
+	})
+	return sorted
+}
+
+// attachmentTypePrefix switches the search view to searching attachments by
+// type, e.g. "type:pdf".
+const attachmentTypePrefix = "type:"
+
+// attachmentTypeQuery extracts the type from a "type:<label>" search query.
+func attachmentTypeQuery(query string) (string, bool) {
+	if !strings.HasPrefix(strings.ToLower(query), attachmentTypePrefix) {
+		return "", false
+	}
+	label := strings.TrimSpace(query[len(attachmentTypePrefix):])
+	return label, label != ""
+}
+
+// attachmentGroupItem adapts AttachmentGroup for bubbles/list
+type attachmentGroupItem struct {
+	group    chatdb.AttachmentGroup
+	contacts *chatdb.ContactBook
+	dates    *relativeDates // nil for the defaults
+}
+
+func (a attachmentGroupItem) Title() string {
+	if a.contacts != nil {
+		return a.contacts.ResolveName(a.group.ChatName)
+	}
+	return a.group.ChatName
+}
+
+func (a attachmentGroupItem) Description() string {
+	var names []string
+	for _, att := range a.group.Attachments {
+		if att.Filename != "" && len(names) < 3 {
+			names = append(names, att.Filename)
+		}
+	}
+	desc := fmt.Sprintf("%d × %s  |  latest %s", len(a.group.Attachments),
+		a.group.Attachments[0].TypeLabel, a.dates.format(a.group.Attachments[0].Date))
+	if len(names) > 0 {
+		desc += "  |  " + strings.Join(names, ", ")
+	}
+	return desc
+}
+
+func (a attachmentGroupItem) FilterValue() string {
+	return a.Title()
+}
+
+const (
+	searchHistoryFile  = "search_history.json"
+	searchHistoryLimit = 20
+)
+
+// addSearchHistory puts term at the front of history, dropping any earlier
+// copy and anything past searchHistoryLimit.
+func addSearchHistory(history []string, term string) []string {
+	updated := []string{term}
+	for _, h := range history {
+		if h != term && len(updated) < searchHistoryLimit {
+			updated = append(updated, h)
+		}
+	}
+	return updated
+}
+
+// loadSearchHistory reads the persisted search terms, newest first. History
+// is a convenience, so an unreadable file just means starting empty.
+func loadSearchHistory() []string {
+	var history []string
+	if err := loadState(searchHistoryFile, &history); err != nil {
+		return nil
+	}
+	return history
+}
+
+// isHidden reports whether conv is on the hidden list, by chat identifier
+// or chat id.
+func isHidden(conv chatdb.Conversation, hidden map[string]bool) bool {
+	return (conv.Identifier != "" && hidden[conv.Identifier]) || hidden[hiddenChatID(conv.ChatID)]
+}
+
+// hiddenKey is conv's entry in the hidden list: its chat identifier, or its
+// chat id for a chat without one.
+func hiddenKey(conv chatdb.Conversation) string {
+	if conv.Identifier != "" {
+		return conv.Identifier
+	}
+	return hiddenChatID(conv.ChatID)
+}
+
+// hiddenChatID is a chat id's entry in the hidden list. The "chat:" prefix
+// keeps it apart from all-digit identifiers like the short code "692",
+// which would otherwise hide chat 692 too.
+func hiddenChatID(chatID int) string {
+	return "chat:" + strconv.Itoa(chatID)
+}
+
+// withoutHidden returns convs minus those on the hidden list.
+func withoutHidden(convs []chatdb.Conversation, hidden map[string]bool) []chatdb.Conversation {
+	if len(hidden) == 0 {
+		return convs
+	}
+	visible := make([]chatdb.Conversation, 0, len(convs))
+	for _, c := range convs {
+		if !isHidden(c, hidden) {
+			visible = append(visible, c)
+		}
+	}
+	return visible
+}
+
+// conversationFilter picks the list filter for the conversation list: fuzzy
+// ranking by default, so "jn smth" finds "John Smith", or plain
+// case-insensitive substring matching when exact is set.
+func conversationFilter(exact bool) list.FilterFunc {
+	if exact {
+		return substringFilter
+	}
+	return list.DefaultFilter
+}
+
+// substringFilter is a list.FilterFunc keeping targets that contain term,
+// ignoring case, in their original order.
+func substringFilter(term string, targets []string) []list.Rank {
+	needle := []rune(strings.ToLower(term))
+	var ranks []list.Rank
+	for i, target := range targets {
+		hay := []rune(strings.ToLower(target))
+		pos := runeIndex(hay, needle)
+		if pos < 0 {
+			continue
+		}
+		matched := make([]int, len(needle))
+		for j := range matched {
+			matched[j] = pos + j
+		}
+		ranks = append(ranks, list.Rank{Index: i, MatchedIndexes: matched})
+	}
+	return ranks
+}
+
+// runeIndex is strings.Index over runes, so match positions line up with
+// the characters the list highlights.
+func runeIndex(hay, needle []rune) int {
+	for i := 0; i+len(needle) <= len(hay); i++ {
+		if string(hay[i:i+len(needle)]) == string(needle) {
+			return i
+		}
+	}
+	return -1
+}
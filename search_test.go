@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+func TestAddSearchHistory(t *testing.T) {
+	history := addSearchHistory(nil, "lunch")
+	history = addSearchHistory(history, "cake")
+	history = addSearchHistory(history, "lunch")
+	if want := []string{"lunch", "cake"}; !reflect.DeepEqual(history, want) {
+		t.Errorf("repeat search should move to front: got %v, want %v", history, want)
+	}
+
+	for i := 0; i < searchHistoryLimit+5; i++ {
+		history = addSearchHistory(history, fmt.Sprintf("q%d", i))
+	}
+	if len(history) != searchHistoryLimit {
+		t.Errorf("history should be capped at %d, got %d", searchHistoryLimit, len(history))
+	}
+	if history[0] != fmt.Sprintf("q%d", searchHistoryLimit+4) {
+		t.Errorf("newest term should be first, got %q", history[0])
+	}
+}
+
+func TestConversationFilter(t *testing.T) {
+	targets := []string{"John Smith", "Family Group", "Jane Doe"}
+	matches := func(ranks []list.Rank) []string {
+		var out []string
+		for _, r := range ranks {
+			out = append(out, targets[r.Index])
+		}
+		return out
+	}
+
+	if got := matches(conversationFilter(false)("jn smth", targets)); !reflect.DeepEqual(got, []string{"John Smith"}) {
+		t.Errorf("fuzzy: got %v", got)
+	}
+	if got := conversationFilter(true)("jn smth", targets); len(got) != 0 {
+		t.Errorf("exact should not match scattered letters: got %v", matches(got))
+	}
+
+	ranks := conversationFilter(true)("GROUP", targets)
+	if got := matches(ranks); !reflect.DeepEqual(got, []string{"Family Group"}) {
+		t.Fatalf("exact: got %v", got)
+	}
+	if want := []int{7, 8, 9, 10, 11}; !reflect.DeepEqual(ranks[0].MatchedIndexes, want) {
+		t.Errorf("matched indexes: got %v, want %v", ranks[0].MatchedIndexes, want)
+	}
+}
+
+func TestWithoutHidden(t *testing.T) {
+	convs := []chatdb.Conversation{
+		{ChatID: 1, Identifier: "+15551234567"},
+		{ChatID: 2, Identifier: "12345"}, // short code spam
+		{ChatID: 3, Identifier: "chat987654"},
+	}
+	ids := func(cs []chatdb.Conversation) []int {
+		var out []int
+		for _, c := range cs {
+			out = append(out, c.ChatID)
+		}
+		return out
+	}
+
+	if got := ids(withoutHidden(convs, nil)); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("no hidden: got %v", got)
+	}
+	hidden := map[string]bool{"12345": true, "chat:3": true}
+	if got := ids(withoutHidden(convs, hidden)); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("by identifier and chat id: got %v, want [1]", got)
+	}
+
+	// A short code and the chat whose id has the same digits are different
+	// chats
+	convs = append(convs, chatdb.Conversation{ChatID: 12345, Identifier: "+15559876543"})
+	if got := ids(withoutHidden(convs, map[string]bool{hiddenKey(convs[1]): true})); !reflect.DeepEqual(got, []int{1, 3, 12345}) {
+		t.Errorf("hiding short code 12345: got %v", got)
+	}
+	if got := hiddenKey(chatdb.Conversation{ChatID: 7}); got != "chat:7" {
+		t.Errorf("key for a chat without an identifier = %q", got)
+	}
+}
+
+func TestSearchItemService(t *testing.T) {
+	date := time.Now().Add(-2 * time.Hour)
+	sms := searchItem{result: chatdb.SearchResult{Message: chatdb.Message{Date: date, Service: "SMS"}, ChatName: "John Doe"}}
+	if got := sms.Description(); !strings.HasPrefix(got, "in John Doe  |  ") || !strings.HasSuffix(got, "  |  SMS") {
+		t.Errorf("SMS result: got %q", got)
+	}
+	unknown := searchItem{result: chatdb.SearchResult{Message: chatdb.Message{Date: date}, ChatName: "John Doe"}}
+	if got := unknown.Description(); strings.Count(got, "|") != 1 {
+		t.Errorf("no service should add no tag: got %q", got)
+	}
+}
+
+func TestRelevanceTerms(t *testing.T) {
+	for query, want := range map[string][]string{
+		"lunch plans":        {"lunch", "plans"},
+		`-pizza "Deep Dish"`: {"deep dish"},
+		"-pizza":             nil,
+	} {
+		if got := relevanceTerms(query); !reflect.DeepEqual(got, want) {
+			t.Errorf("relevanceTerms(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestSearchDateFilterBounds(t *testing.T) {
+	loc := time.Local
+	now := time.Date(2024, 6, 16, 9, 30, 0, 0, loc)
+	day := func(d int) time.Time { return time.Date(2024, 6, d, 0, 0, 0, 0, loc) }
+
+	tests := []struct {
+		f        searchDateFilter
+		from, to time.Time
+	}{
+		{anyDate, time.Time{}, time.Time{}},
+		{dateToday, day(16), time.Time{}},
+		{dateYesterday, day(15), day(16).Add(-time.Nanosecond)},
+		{dateLastWeek, day(10), time.Time{}},
+		{dateThisMonth, day(1), time.Time{}},
+	}
+	for _, tt := range tests {
+		from, to := tt.f.bounds(now)
+		if !from.Equal(tt.from) || !to.Equal(tt.to) {
+			t.Errorf("%s: got %v – %v, want %v – %v", tt.f, from, to, tt.from, tt.to)
+		}
+	}
+	if anyDate.next().next().next().next().next() != anyDate {
+		t.Error("date filters should cycle back to any date")
+	}
+}
+
+func TestSearchLoadMore(t *testing.T) {
+	tempStateDir(t)
+	m := NewModel(t.Context(), nil, &chatdb.ContactBook{}).withOptions(modelOptions{searchLimit: 2})
+	m.state = viewSearch
+	m.searchInput.Blur()
+	m.searchLimit = 2
+	results := []chatdb.SearchResult{{Message: chatdb.Message{ROWID: 1, Text: "lunch"}}, {Message: chatdb.Message{ROWID: 2, Text: "lunch?"}}}
+
+	updated, _ := m.Update(searchResultsMsg{results: results, term: "lunch", limit: 2})
+	m = updated.(model)
+	if !strings.Contains(m.searchResults.Title, "showing first 2 — more exist") {
+		t.Errorf("a full page should say there are more: %q", m.searchResults.Title)
+	}
+	updated, cmd := m.updateSearchView(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("M")})
+	m = updated.(model)
+	if cmd == nil || m.searchLimit != 4 {
+		t.Errorf("M should search again for the next page: limit %d", m.searchLimit)
+	}
+
+	updated, _ = m.Update(searchResultsMsg{results: results[:1], term: "lunch", limit: 4})
+	m = updated.(model)
+	if strings.Contains(m.searchResults.Title, "more exist") {
+		t.Errorf("a short page is everything: %q", m.searchResults.Title)
+	}
+	if _, cmd := m.updateSearchView(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("M")}); cmd != nil {
+		t.Error("M should do nothing once every match is loaded")
+	}
+}
+
+func TestSearchChatFilter(t *testing.T) {
+	tempStateDir(t)
+	m := NewModel(t.Context(), nil, &chatdb.ContactBook{})
+	m.state = viewSearch
+	m.searchInput.Blur()
+	results := []chatdb.SearchResult{
+		{Message: chatdb.Message{ROWID: 1, Text: "lunch"}, ChatID: 1, ChatName: "+15551234567"},
+		{Message: chatdb.Message{ROWID: 2, Text: "lunch?"}, ChatID: 2, ChatName: "jane@example.com"},
+		{Message: chatdb.Message{ROWID: 3, Text: "lunch!"}, ChatID: 2, ChatName: "jane@example.com"},
+	}
+	updated, _ := m.Update(searchResultsMsg{results: results, term: "lunch", limit: 100})
+	m = updated.(model)
+	m.searchResults.Select(1)
+
+	key := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("f")}
+	updated, _ = m.updateSearchView(key)
+	m = updated.(model)
+	if m.searchChat != 2 || len(m.searchResults.Items()) != 2 {
+		t.Fatalf("f should keep the selected chat's 2 results: chat %d, %d items", m.searchChat, len(m.searchResults.Items()))
+	}
+	if !strings.Contains(m.searchResults.Title, `2 of 3 matches for "lunch" in jane@example.com`) {
+		t.Errorf("title should name the chat: %q", m.searchResults.Title)
+	}
+
+	// esc clears the filter before it leaves the results
+	updated, _ = m.updateSearchView(tea.KeyMsg{Type: tea.KeyEsc})
+	m = updated.(model)
+	if m.state != viewSearch || m.searchChat != 0 || len(m.searchResults.Items()) != 3 {
+		t.Errorf("esc should show every chat again: state %v, chat %d, %d items", m.state, m.searchChat, len(m.searchResults.Items()))
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// From this width up the conversation list and the message view are shown
+// side by side; below it they take turns filling the screen.
+const (
+	splitMinWidth = 140
+	splitGap      = 2 // columns between the two panes
+)
+
+// split reports whether the terminal is wide enough for the two-pane
+// layout.
+func (m model) split() bool {
+	return m.width >= splitMinWidth && !m.tooSmall()
+}
+
+// convListWidth is the width of the conversation list: the left pane in
+// the split layout, the whole screen otherwise.
+func (m model) convListWidth() int {
+	if m.split() {
+		return m.width * 2 / 5
+	}
+	return m.width - 4
+}
+
+// messagePaneWidth is the width of the message view: what the list leaves
+// in the split layout, the whole screen otherwise.
+func (m model) messagePaneWidth() int {
+	if m.split() {
+		return m.width - 4 - m.convListWidth() - splitGap
+	}
+	return m.width - 4
+}
+
+// syncPreview loads the selected conversation into the message pane when
+// the list is showing beside it, so the pane follows the selection. The
+// preview is an open chat in all but the keys, which stay with the list
+// until enter moves them over.
+func (m *model) syncPreview() tea.Cmd {
+	if m.state != viewConversations || !m.split() || m.convLoading {
+		return nil
+	}
+	selected, ok := m.convList.SelectedItem().(convItem)
+	if !ok || selected.conv.ChatID == m.previewID {
+		return nil
+	}
+	cmd := m.openChat(selected.conv.ChatID, selected.Title())
+	m.state = viewConversations
+	return cmd
+}
+
+// renderSplit lays the conversation list beside the message pane. The
+// list keeps its keys' help under it while it has them, and the message
+// pane says how to take them over.
+func (m model) renderSplit() string {
+	listWidth := m.convListWidth()
+	helpText := "enter: open  |  s: search  |  m: all attachments  |  r: recent only  |  F: fuzzy/exact filter  |  0-9: go to #"
+	if m.state == viewMessages {
+		helpText = "esc: back to the list"
+	}
+	help := helpStyle.Width(listWidth).Render(helpText)
+	// m is a copy, so shrinking the list here only affects this frame
+	m.convList.SetHeight(max(m.convList.Height()-lipgloss.Height(help)+1, 3))
+	left := lipgloss.NewStyle().Width(listWidth).MaxWidth(listWidth).
+		Render(m.renderListTop(listWidth) + "\n" + m.convList.View() + "\n" + help)
+
+	paneWidth := m.messagePaneWidth()
+	right := lipgloss.Place(paneWidth, max(m.height-2, 1), lipgloss.Center, lipgloss.Center,
+		helpStyle.Render("No conversation selected"))
+	if m.previewID != 0 || m.state == viewMessages {
+		// Long footers are cut at the pane's edge rather than wrapping
+		right = lipgloss.NewStyle().MaxWidth(paneWidth).Render(m.renderMessagePane())
+	}
+	return appStyle.Render(lipgloss.JoinHorizontal(lipgloss.Top, left, strings.Repeat(" ", splitGap), right))
+}
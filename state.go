@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// stateDir returns the directory for small files the viewer keeps between
+// runs. It's a variable so tests can point it at a temporary directory.
+var stateDir = func() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "smsDbViewer"), nil
+}
+
+// loadState decodes the JSON state file name into v. A missing file leaves
+// v untouched and is not an error.
+func loadState(name string, v interface{}) error {
+	dir, err := stateDir()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// lastViewedFile maps chat GUIDs to the newest message ROWID seen in them.
+const lastViewedFile = "last_viewed.json"
+
+// loadLastViewed reads the per-chat last viewed positions. Like search
+// history this is a convenience, so a bad file just starts fresh.
+func loadLastViewed() map[string]int {
+	seen := map[string]int{}
+	if err := loadState(lastViewedFile, &seen); err != nil || seen == nil {
+		return map[string]int{}
+	}
+	return seen
+}
+
+// exportFormatsFile maps chat GUIDs to the format each was last exported
+// in, so the export picker offers it first.
+const exportFormatsFile = "export_formats.json"
+
+// loadExportFormats reads the per-chat export formats. A bad file just
+// starts fresh.
+func loadExportFormats() map[string]string {
+	formats := map[string]string{}
+	if err := loadState(exportFormatsFile, &formats); err != nil || formats == nil {
+		return map[string]string{}
+	}
+	return formats
+}
+
+// hiddenChatsFile lists conversations hidden from the list, by chat
+// identifier (the handle for one-to-one chats, like "+15551234567" or the
+// short code "692") or by chat id written as "chat:<id>", like "chat:42".
+// It's plain JSON so the list can be edited by hand.
+const hiddenChatsFile = "hidden_chats.json"
+
+// loadHiddenChats reads the hidden conversation list as a set.
+func loadHiddenChats() map[string]bool {
+	var ids []string
+	hidden := map[string]bool{}
+	if err := loadState(hiddenChatsFile, &ids); err != nil {
+		return hidden
+	}
+	for _, id := range ids {
+		hidden[id] = true
+	}
+	return hidden
+}
+
+// saveState writes v as JSON to the state file name, creating the state
+// directory if needed.
+func saveState(name string, v interface{}) error {
+	dir, err := stateDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name), data, 0o644)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// tempStateDir points the state files at a fresh directory for the rest
+// of the test, so nothing is read from or written to the real cache
+// directory: NewModel loads search history, hidden chats, and more from
+// there.
+func tempStateDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	orig := stateDir
+	stateDir = func() (string, error) { return dir, nil }
+	t.Cleanup(func() { stateDir = orig })
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	orig := stateDir
+	stateDir = func() (string, error) { return dir + "/nested", nil }
+	defer func() { stateDir = orig }()
+
+	var missing []string
+	if err := loadState("absent.json", &missing); err != nil || missing != nil {
+		t.Fatalf("missing file: got %v, %v", missing, err)
+	}
+
+	want := []string{"lunch", "type:pdf"}
+	if err := saveState("history.json", want); err != nil {
+		t.Fatalf("saveState: %v", err)
+	}
+	var got []string
+	if err := loadState("history.json", &got); err != nil {
+		t.Fatalf("loadState: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip: got %v, want %v", got, want)
+	}
+}
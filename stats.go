@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+// sparkBlocks are the eighth-height block characters used by sparkline,
+// from empty to full.
+var sparkBlocks = []rune(" ▁▂▃▄▅▆▇█")
+
+// heatShades are the shading characters used by renderHeatmap, from empty
+// to busiest.
+var heatShades = []rune(" ░▒▓█")
+
+// chatStats holds the aggregates shown in the stats view.
+type chatStats struct {
+	activity []chatdb.DayCount
+	hours    [7][24]int // messages by weekday (Sunday first) and hour
+	text     textStats
+}
+
+// textStats sums up message text for one chat, split by direction.
+type textStats struct {
+	sent, received textTotals
+	longest        chatdb.Message
+	longestLen     int // in characters
+}
+
+type textTotals struct {
+	messages int // messages with text
+	words    int
+	chars    int
+}
+
+// avgLength is the mean length in characters of messages with text.
+func (t textTotals) avgLength() int {
+	if t.messages == 0 {
+		return 0
+	}
+	return (t.chars + t.messages/2) / t.messages
+}
+
+// computeTextStats tallies words and lengths. Messages without text, like
+// bare attachments, are left out so they don't drag the averages down.
+func computeTextStats(messages []chatdb.Message) textStats {
+	var st textStats
+	for _, msg := range messages {
+		text := strings.TrimSpace(msg.Text)
+		if text == "" {
+			continue
+		}
+		n := utf8.RuneCountInString(text)
+		side := &st.received
+		if msg.IsFromMe {
+			side = &st.sent
+		}
+		side.messages++
+		side.words += len(strings.Fields(text))
+		side.chars += n
+		if n > st.longestLen {
+			st.longest, st.longestLen = msg, n
+		}
+	}
+	return st
+}
+
+type statsLoadedMsg struct {
+	chatID int
+	stats  chatStats
+	err    error
+}
+
+func (m model) fetchStatsCmd(chatID int) tea.Cmd {
+	return func() tea.Msg {
+		var st chatStats
+		var err error
+		st.activity, err = m.store.MessagesPerDay(m.chatCtx, chatID)
+		if err == nil {
+			st.hours, err = m.store.MessageHourHistogram(m.chatCtx, chatID)
+		}
+		if err == nil {
+			var msgs []chatdb.Message
+			msgs, err = m.store.FetchAllMessages(m.chatCtx, chatID)
+			st.text = computeTextStats(msgs)
+		}
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return statsLoadedMsg{chatID: chatID, stats: st, err: err}
+	}
+}
+
+func (m model) updateStatsView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "backspace", "q":
+		m.state = viewMessages
+		return m, nil
+	case "C":
+		return m, m.copyChatGUIDCmd()
+	case "y":
+		return m, m.copySummaryCmd()
+	}
+	return m, nil
+}
+
+type clipboardMsg struct {
+	what string
+	err  error
+}
+
+// copyChatGUIDCmd puts the open chat's guid on the system clipboard, for
+// cross-referencing with other iMessage tools.
+func (m model) copyChatGUIDCmd() tea.Cmd {
+	conv, ok := m.activeConversation()
+	if !ok || conv.GUID == "" {
+		return nil
+	}
+	return func() tea.Msg {
+		return clipboardMsg{what: "chat GUID", err: clipboard.WriteAll(conv.GUID)}
+	}
+}
+
+// summaryTopTypes is how many attachment types the shared summary lists.
+const summaryTopTypes = 3
+
+// copySummaryCmd puts a short plain-text summary of the open chat on the
+// clipboard: who it's with, how many messages over what span, and the most
+// common attachment types.
+func (m model) copySummaryCmd() tea.Cmd {
+	conv, ok := m.activeConversation()
+	if !ok {
+		return nil
+	}
+	ctx, store, contacts := m.chatCtx, m.store, m.contacts
+	return func() tea.Msg {
+		attachments, err := store.FetchChatAttachments(ctx, conv.ChatID)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		if err != nil {
+			return clipboardMsg{what: "summary", err: err}
+		}
+		text := formatShareSummary(conv, contacts, attachments, time.Now())
+		return clipboardMsg{what: "summary", err: clipboard.WriteAll(text)}
+	}
+}
+
+// formatShareSummary renders conv as a few lines suitable for pasting, e.g.
+//
+//	Family Group: Alice, Bob
+//	1,204 messages (580 sent, 624 received), Jun 2020 – now
+//	Attachments: 50 × photo, 3 × PDF, 1 × video
+//
+// The span ends in "now" when the last message is from the current month.
+func formatShareSummary(conv chatdb.Conversation, contacts *chatdb.ContactBook, attachments []chatdb.ChatAttachment, now time.Time) string {
+	names := make([]string, len(conv.Participants))
+	for i, p := range conv.Participants {
+		names[i] = contacts.ResolveName(p)
+	}
+	with := strings.Join(names, ", ")
+	if with == "" {
+		with = conv.Identifier
+	}
+	var lines []string
+	if conv.DisplayName != "" {
+		lines = append(lines, conv.DisplayName+": "+with)
+	} else {
+		lines = append(lines, "Conversation with "+with)
+	}
+
+	counts := fmt.Sprintf("%s messages (%s sent, %s received)",
+		groupDigits(conv.MessageCount), groupDigits(conv.SentCount), groupDigits(conv.ReceivedCount))
+	if !conv.FirstMsgDate.IsZero() {
+		end := conv.LastMsgDate.Format("Jan 2006")
+		if conv.LastMsgDate.Year() == now.Year() && conv.LastMsgDate.Month() == now.Month() {
+			end = "now"
+		}
+		counts += fmt.Sprintf(", %s – %s", conv.FirstMsgDate.Format("Jan 2006"), end)
+	}
+	lines = append(lines, counts)
+
+	if types := topAttachmentTypes(attachments, summaryTopTypes); len(types) > 0 {
+		lines = append(lines, "Attachments: "+strings.Join(types, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// topAttachmentTypes counts attachments by type label and returns the n
+// most common as "count × label", ties in label order.
+func topAttachmentTypes(attachments []chatdb.ChatAttachment, n int) []string {
+	byLabel := map[string]int{}
+	for _, a := range attachments {
+		byLabel[a.TypeLabel]++
+	}
+	labels := make([]string, 0, len(byLabel))
+	for label := range byLabel {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if byLabel[labels[i]] != byLabel[labels[j]] {
+			return byLabel[labels[i]] > byLabel[labels[j]]
+		}
+		return labels[i] < labels[j]
+	})
+	if len(labels) > n {
+		labels = labels[:n]
+	}
+	out := make([]string, len(labels))
+	for i, label := range labels {
+		out[i] = fmt.Sprintf("%s × %s", groupDigits(byLabel[label]), label)
+	}
+	return out
+}
+
+// groupDigits formats n with comma thousands separators, e.g. "1,204".
+func groupDigits(n int) string {
+	if n < 0 {
+		return "-" + groupDigits(-n)
+	}
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// activeConversation returns the loaded Conversation for the open chat.
+func (m model) activeConversation() (chatdb.Conversation, bool) {
+	for _, conv := range m.convItems {
+		if conv.ChatID == m.activeChatID {
+			return conv, true
+		}
+	}
+	return chatdb.Conversation{}, false
+}
+
+func (m model) renderStats() string {
+	var lines []string
+	lines = append(lines, titleStyle.Render("Stats — "+m.activeChatTitle), "")
+
+	if m.stats == nil {
+		lines = append(lines, searchCountStyle.Render("Loading stats..."))
+		return strings.Join(lines, "\n")
+	}
+
+	if conv, ok := m.activeConversation(); ok {
+		lines = append(lines,
+			fmt.Sprintf("Messages   %d (%d sent, %d received)", conv.MessageCount, conv.SentCount, conv.ReceivedCount))
+		if !conv.FirstMsgDate.IsZero() {
+			lines = append(lines, fmt.Sprintf("Span       %s – %s",
+				conv.FirstMsgDate.Format("Jan 02, 2006"), conv.LastMsgDate.Format("Jan 02, 2006")))
+		}
+		lines = append(lines,
+			fmt.Sprintf("Identifier %s", conv.Identifier),
+			fmt.Sprintf("GUID       %s", conv.GUID),
+			fmt.Sprintf("Chat ID    %d", conv.ChatID),
+			"")
+	}
+
+	if t := m.stats.text; t.longestLen > 0 {
+		who := "Me"
+		if !t.longest.IsFromMe {
+			who = m.contacts.ResolveName(t.longest.Sender)
+			if who == "" {
+				who = "Unknown"
+			}
+		}
+		lines = append(lines,
+			fmt.Sprintf("Words      %d sent, %d received", t.sent.words, t.received.words),
+			fmt.Sprintf("Avg length %d chars sent, %d received", t.sent.avgLength(), t.received.avgLength()),
+			fmt.Sprintf("Longest    %d chars (%s, %s)", t.longestLen, who, t.longest.Date.Format("Jan 02, 2006")),
+			"")
+	}
+
+	width := m.width - 8
+	if width < 10 {
+		width = 10
+	}
+	counts, label := activitySeries(m.stats.activity, width)
+	if len(counts) > 0 {
+		first := m.stats.activity[0].Day.Format("Jan 2006")
+		last := m.stats.activity[len(m.stats.activity)-1].Day.Format("Jan 2006")
+		lines = append(lines,
+			headerStyle.UnsetBorderBottom().Render(fmt.Sprintf("Activity (%s)", label)),
+			fromThemStyle.Render(sparkline(counts)),
+			helpStyle.Render(spreadLabels(first, last, len(counts))),
+		)
+	}
+
+	lines = append(lines, "",
+		headerStyle.UnsetBorderBottom().Render("Busy hours"),
+		renderHeatmap(m.stats.hours))
+
+	return strings.Join(lines, "\n")
+}
+
+// activitySeries turns sparse per-day counts into a continuous series that
+// fits in width columns. Days are used when they fit; otherwise counts are
+// bucketed by month, and if months still don't fit, adjacent months are
+// merged. The returned label names the bucket size.
+func activitySeries(days []chatdb.DayCount, width int) ([]int, string) {
+	if len(days) == 0 || width <= 0 {
+		return nil, ""
+	}
+
+	first, last := days[0].Day, days[len(days)-1].Day
+	byDay := make(map[string]int, len(days))
+	for _, d := range days {
+		byDay[d.Day.Format("2006-01-02")] = d.Count
+	}
+
+	var series []int
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		series = append(series, byDay[d.Format("2006-01-02")])
+	}
+	if len(series) <= width {
+		return series, "per day"
+	}
+
+	series = series[:0]
+	byMonth := make(map[string]int)
+	for _, d := range days {
+		byMonth[d.Day.Format("2006-01")] += d.Count
+	}
+	start := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, first.Location())
+	for d := start; !d.After(last); d = d.AddDate(0, 1, 0) {
+		series = append(series, byMonth[d.Format("2006-01")])
+	}
+	if len(series) <= width {
+		return series, "per month"
+	}
+
+	per := (len(series) + width - 1) / width
+	var merged []int
+	for i := 0; i < len(series); i += per {
+		sum := 0
+		for j := i; j < i+per && j < len(series); j++ {
+			sum += series[j]
+		}
+		merged = append(merged, sum)
+	}
+	return merged, fmt.Sprintf("per %d months", per)
+}
+
+// sparkline renders counts as a row of block characters scaled to the
+// largest value. Any non-zero count gets at least the smallest block.
+func sparkline(counts []int) string {
+	max := 0
+	for _, c := range counts {
+		if c > max {
+			max = c
+		}
+	}
+	var sb strings.Builder
+	for _, c := range counts {
+		level := 0
+		if max > 0 && c > 0 {
+			level = c * (len(sparkBlocks) - 1) / max
+			if level == 0 {
+				level = 1
+			}
+		}
+		sb.WriteRune(sparkBlocks[level])
+	}
+	return sb.String()
+}
+
+// renderHeatmap draws a weekday × hour grid, Monday first, with each hour
+// two columns wide and shaded relative to the busiest hour.
+func renderHeatmap(hours [7][24]int) string {
+	max := 0
+	for _, day := range hours {
+		for _, c := range day {
+			if c > max {
+				max = c
+			}
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(helpStyle.Render("    0     3     6     9     12    15    18    21"))
+	for i := 0; i < 7; i++ {
+		dow := (i + 1) % 7 // Monday first
+		var row strings.Builder
+		for _, c := range hours[dow] {
+			shade := heatShades[heatLevel(c, max)]
+			row.WriteRune(shade)
+			row.WriteRune(shade)
+		}
+		sb.WriteString("\n" + helpStyle.Render(time.Weekday(dow).String()[:3]) + " " + fromThemStyle.Render(row.String()))
+	}
+	return sb.String()
+}
+
+// heatLevel maps count to an index into heatShades. Any non-zero count gets
+// at least the lightest shade.
+func heatLevel(count, max int) int {
+	if max <= 0 || count <= 0 {
+		return 0
+	}
+	level := count * (len(heatShades) - 1) / max
+	if level == 0 {
+		level = 1
+	}
+	return level
+}
+
+// spreadLabels places left and right labels at the edges of a width-column row.
+func spreadLabels(left, right string, width int) string {
+	gap := width - lipgloss.Width(left) - lipgloss.Width(right)
+	if gap < 1 {
+		return left + " " + right
+	}
+	return left + strings.Repeat(" ", gap) + right
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aftaylor2/smsDbViewer/chatdb"
+)
+
+func TestSparkline(t *testing.T) {
+	got := sparkline([]int{0, 1, 4, 8})
+	want := " ▁▄█"
+	if got != want {
+		t.Errorf("sparkline = %q, want %q", got, want)
+	}
+}
+
+func TestActivitySeries(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	}
+
+	t.Run("fills_missing_days", func(t *testing.T) {
+		days := []chatdb.DayCount{
+			{Day: day(2024, 6, 1), Count: 3},
+			{Day: day(2024, 6, 4), Count: 1},
+		}
+		series, label := activitySeries(days, 80)
+		if label != "per day" {
+			t.Errorf("label: got %q", label)
+		}
+		want := []int{3, 0, 0, 1}
+		if len(series) != len(want) {
+			t.Fatalf("series: got %v, want %v", series, want)
+		}
+		for i := range want {
+			if series[i] != want[i] {
+				t.Errorf("series: got %v, want %v", series, want)
+				break
+			}
+		}
+	})
+
+	t.Run("buckets_by_month", func(t *testing.T) {
+		days := []chatdb.DayCount{
+			{Day: day(2024, 1, 1), Count: 2},
+			{Day: day(2024, 1, 20), Count: 3},
+			{Day: day(2024, 3, 5), Count: 4},
+		}
+		series, label := activitySeries(days, 10)
+		if label != "per month" {
+			t.Errorf("label: got %q", label)
+		}
+		want := []int{5, 0, 4}
+		if len(series) != len(want) {
+			t.Fatalf("series: got %v, want %v", series, want)
+		}
+		for i := range want {
+			if series[i] != want[i] {
+				t.Errorf("series: got %v, want %v", series, want)
+				break
+			}
+		}
+	})
+
+	t.Run("merges_months", func(t *testing.T) {
+		days := []chatdb.DayCount{
+			{Day: day(2020, 1, 1), Count: 1},
+			{Day: day(2024, 12, 1), Count: 1},
+		}
+		series, _ := activitySeries(days, 20)
+		if len(series) > 20 {
+			t.Errorf("series has %d buckets, want at most 20", len(series))
+		}
+		total := 0
+		for _, c := range series {
+			total += c
+		}
+		if total != 2 {
+			t.Errorf("merged total: got %d, want 2", total)
+		}
+	})
+}
+
+func TestRenderHeatmap(t *testing.T) {
+	var hours [7][24]int
+	hours[time.Monday][9] = 8
+	hours[time.Sunday][23] = 1
+
+	rows := strings.Split(renderHeatmap(hours), "\n")
+	if len(rows) != 8 {
+		t.Fatalf("expected header + 7 rows, got %d", len(rows))
+	}
+	if !strings.HasPrefix(rows[1], "Mon") || !strings.HasPrefix(rows[7], "Sun") {
+		t.Errorf("rows should run Monday to Sunday: %q … %q", rows[1], rows[7])
+	}
+	if !strings.Contains(rows[1], "██") {
+		t.Errorf("busiest hour should be fully shaded: %q", rows[1])
+	}
+	if !strings.HasSuffix(rows[7], "░░") {
+		t.Errorf("a quiet hour should still be visible: %q", rows[7])
+	}
+}
+
+func TestComputeTextStats(t *testing.T) {
+	msgs := []chatdb.Message{
+		{ROWID: 1, Text: "hey there", IsFromMe: true},
+		{ROWID: 2, Text: "héllo you two"},
+		{ROWID: 3, Text: "  "}, // attachment only
+		{ROWID: 4, Text: "ok", IsFromMe: true},
+	}
+	st := computeTextStats(msgs)
+
+	if want := (textTotals{messages: 2, words: 3, chars: 11}); st.sent != want {
+		t.Errorf("sent = %+v, want %+v", st.sent, want)
+	}
+	if want := (textTotals{messages: 1, words: 3, chars: 13}); st.received != want {
+		t.Errorf("received = %+v, want %+v", st.received, want)
+	}
+	if st.longest.ROWID != 2 || st.longestLen != 13 {
+		t.Errorf("longest = ROWID %d (%d chars), want ROWID 2 (13 chars)", st.longest.ROWID, st.longestLen)
+	}
+	if got := st.sent.avgLength(); got != 6 {
+		t.Errorf("sent avg = %d, want 6", got)
+	}
+	if got := (textTotals{}).avgLength(); got != 0 {
+		t.Errorf("empty avg = %d, want 0", got)
+	}
+}
+
+func TestFormatShareSummary(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.Local)
+	conv := chatdb.Conversation{
+		DisplayName:   "Family Group",
+		Participants:  []string{"+15551234567", "jane@example.com"},
+		FirstMsgDate:  time.Date(2020, 6, 2, 9, 0, 0, 0, time.Local),
+		LastMsgDate:   time.Date(2024, 3, 1, 9, 0, 0, 0, time.Local),
+		MessageCount:  1204,
+		SentCount:     580,
+		ReceivedCount: 624,
+	}
+	var attachments []chatdb.ChatAttachment
+	add := func(label string, n int) {
+		for range n {
+			attachments = append(attachments, chatdb.ChatAttachment{TypeLabel: label})
+		}
+	}
+	add("video", 1)
+	add("photo", 50)
+	add("PDF", 3)
+	add("audio", 1)
+
+	got := formatShareSummary(conv, &chatdb.ContactBook{}, attachments, now)
+	want := "Family Group: +15551234567, jane@example.com\n" +
+		"1,204 messages (580 sent, 624 received), Jun 2020 – now\n" +
+		"Attachments: 50 × photo, 3 × PDF, 1 × audio"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	conv.DisplayName = ""
+	conv.Participants = conv.Participants[1:]
+	got = formatShareSummary(conv, &chatdb.ContactBook{}, nil, now.AddDate(0, 1, 0))
+	want = "Conversation with jane@example.com\n" +
+		"1,204 messages (580 sent, 624 received), Jun 2020 – Mar 2024"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
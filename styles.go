@@ -1,10 +1,31 @@
 package main
 
-import "github.com/charmbracelet/lipgloss"
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
 
 const (
-	tsWidth     = 22
-	senderWidth = 20
+	tsWidth      = 22
+	senderWidth  = 20
+	sidebarWidth = 32
+
+	// markerWidth is the cell before each timestamp that holds the focus or
+	// selection marker, kept apart so a marker never pushes a full date
+	// past tsWidth and onto a second line.
+	markerWidth = 2
+
+	// scrollbarWidth is the column beside the messages showing where the
+	// viewport is in the loaded messages.
+	scrollbarWidth = 1
+
+	// compactTimeWidth fits a focus marker and "03:04 PM" in the compact
+	// layout, which drops the date and the sender column.
+	compactTimeWidth = 10
 )
 
 var (
@@ -37,10 +58,36 @@ var (
 	senderStyle = lipgloss.NewStyle().
 			Width(senderWidth)
 
+	focusStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("212")).
+			Bold(true)
+
+	selectedStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("63"))
+
+	failedStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("196")).
+			Bold(true)
+
+	newSinceStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("212")).
+			Bold(true).
+			Align(lipgloss.Center)
+
+	reactionStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("245"))
+
+	quoteStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("241")).
+			Italic(true)
+
 	dateSepStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("241")).
 			Align(lipgloss.Center)
 
+	offloadedStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214"))
+
 	attachmentStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("245")).
 			Italic(true)
@@ -65,4 +112,76 @@ var (
 
 	helpStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("241"))
+
+	// Width excludes the border, so the panel spans sidebarWidth columns
+	sidebarStyle = lipgloss.NewStyle().
+			Width(sidebarWidth - 1).
+			PaddingLeft(1).
+			BorderStyle(lipgloss.NormalBorder()).
+			BorderLeft(true).
+			BorderForeground(lipgloss.Color("240"))
+
+	detailStyle = lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("62")).
+			Padding(0, 1)
+
+	scrollTrackStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("238"))
+
+	scrollThumbStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("63"))
+
+	sidebarTitleStyle = lipgloss.NewStyle().
+				Bold(true).
+				Foreground(lipgloss.Color("62"))
 )
+
+// senderPalette colors the senders of a group chat. It leaves out the
+// colors that already mean something: 63 for me, 196 for failures.
+var senderPalette = []lipgloss.Color{"212", "39", "214", "114", "176", "81", "209", "150", "227", "147"}
+
+// senderStyles gives each participant of a group chat its own name color,
+// keyed by lowercased handle. A handle hashes to its preferred palette
+// slot, so it keeps its color from visit to visit; on a collision it takes
+// the next free slot, so no two senders share a color until the palette
+// runs out. One-on-one chats get nil and keep fromThemStyle.
+func senderStyles(participants []string) map[string]lipgloss.Style {
+	if len(participants) < 2 {
+		return nil
+	}
+	handles := make([]string, len(participants))
+	for i, p := range participants {
+		handles[i] = strings.ToLower(p)
+	}
+	sort.Strings(handles)
+
+	styles := make(map[string]lipgloss.Style, len(handles))
+	used := make([]bool, len(senderPalette))
+	free := len(senderPalette)
+	for _, h := range handles {
+		hash := fnv.New32a()
+		hash.Write([]byte(h))
+		slot := int(hash.Sum32() % uint32(len(senderPalette)))
+		for free > 0 && used[slot] {
+			slot = (slot + 1) % len(senderPalette)
+		}
+		if free > 0 {
+			used[slot] = true
+			free--
+		}
+		styles[h] = lipgloss.NewStyle().Foreground(senderPalette[slot])
+	}
+	return styles
+}
+
+// usePlainStyles downgrades every style to plain text for NO_COLOR and
+// --no-color. Layout (widths, padding, borders) is kept; colors and
+// attributes are dropped. Search matches lose their background, so they
+// are bracketed instead to stay visible.
+func usePlainStyles() {
+	lipgloss.SetColorProfile(termenv.Ascii)
+	highlightStyle = lipgloss.NewStyle().Transform(func(s string) string {
+		return "[" + s + "]"
+	})
+}
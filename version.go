@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+// version can be set at build time with
+// -ldflags "-X main.version=v1.2.3"; otherwise it comes from the module
+// build info.
+var version string
+
+// versionString describes the build for --version, e.g.
+// "smsDbViewer v1.2.3 (3f2a9c1d0b7e, 2026-01-20T17:59:30Z) go1.25.6".
+// VCS details are included when the binary was built from a git checkout.
+func versionString(info *debug.BuildInfo, ok bool) string {
+	v := version
+	if v == "" && ok {
+		v = info.Main.Version
+	}
+	if v == "" {
+		v = "(unknown)"
+	}
+	out := "smsDbViewer " + v
+	if !ok {
+		return out
+	}
+
+	var vcs []string
+	settings := map[string]string{}
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	if rev := settings["vcs.revision"]; rev != "" {
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+		vcs = append(vcs, rev)
+	}
+	if t := settings["vcs.time"]; t != "" {
+		vcs = append(vcs, t)
+	}
+	if settings["vcs.modified"] == "true" {
+		vcs = append(vcs, "modified")
+	}
+	if len(vcs) > 0 {
+		out += fmt.Sprintf(" (%s)", strings.Join(vcs, ", "))
+	}
+	return out + " " + info.GoVersion
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestVersionString(t *testing.T) {
+	info := &debug.BuildInfo{
+		GoVersion: "go1.25.6",
+		Main:      debug.Module{Path: "smsDbViewer", Version: "(devel)"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "3f2a9c1d0b7e55aa"},
+			{Key: "vcs.time", Value: "2026-01-20T17:59:30Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+	want := "smsDbViewer (devel) (3f2a9c1d0b7e, 2026-01-20T17:59:30Z, modified) go1.25.6"
+	if got := versionString(info, true); got != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+
+	version = "v1.2.3"
+	defer func() { version = "" }()
+	if got := versionString(nil, false); got != "smsDbViewer v1.2.3" {
+		t.Errorf("ldflags version without build info: got %q", got)
+	}
+}